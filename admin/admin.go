@@ -0,0 +1,466 @@
+// Package admin is the REST api managing the balances outside of Telegram. It works on the same api.Storage
+// and validation as the bot commands, every request but the OpenAPI description carries the admin token:
+//
+//	Authorization: Bearer <admin.token>
+package admin
+
+import (
+	"bytes"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/op/go-logging"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	moduleName = "admin"
+
+	// Prefix is the path prefix of the api, the OpenAPI description is served at Prefix + "/openapi.yaml"
+	Prefix = "/api/v1"
+
+	defaultLedgerLimit = 50
+	maxLedgerLimit     = 1000
+	maxRequestBodySize = 1 << 16
+)
+
+var (
+	//go:embed openapi.yaml
+	openApi []byte
+
+	errorInvalidPath   = errors.New("invalid path")
+	errorUnknownMethod = errors.New("method isn't allowed")
+	errorNoBackup      = errors.New("the storage can't be backed up")
+)
+
+type (
+	server struct {
+		storage api.Storage
+		token   []byte
+		logger  *logging.Logger
+	}
+
+	// route is the path below Prefix split by slashes, the ids are parsed by the handlers
+	route []string
+
+	player struct {
+		UserId   int64  `json:"userId"`
+		UserName string `json:"userName"`
+		Balance  int64  `json:"balance"`
+	}
+
+	chat struct {
+		ChatId   int64 `json:"chatId"`
+		Treasury int64 `json:"treasury"`
+		Players  int   `json:"players"`
+	}
+
+	userBalance struct {
+		UserId  int64 `json:"userId"`
+		Balance int64 `json:"balance"`
+	}
+
+	setBalanceRequest struct {
+		Balance *int64 `json:"balance"`
+	}
+
+	transactionRequest struct {
+		FromId int64 `json:"fromId"`
+		ToId   int64 `json:"toId"`
+		Amount int64 `json:"amount"`
+	}
+
+	user struct {
+		UserId   int64  `json:"userId"`
+		UserName string `json:"userName"`
+	}
+
+	// backup is the storage snapshot sent as the file instead of json
+	backup struct {
+		name string
+		data []byte
+	}
+
+	apiError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+)
+
+// NewHandler serves the admin api below Prefix, the requests without the token are rejected with 401
+func NewHandler(storage api.Storage, token string, provider api.LoggerProvider) http.Handler {
+	return &server{
+		storage: storage,
+		token:   []byte(token),
+		logger:  provider.MustGetLogger(moduleName),
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == Prefix+"/openapi.yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write(openApi)
+		return
+	}
+
+	if !s.authorized(r) {
+		s.logger.Warningf("unauthorized %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="dnd-util-bot admin"`)
+		writeJson(w, http.StatusUnauthorized, &apiError{Code: "unauthorized", Message: "admin token is missing or wrong"})
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, Prefix+"/") {
+		s.writeError(w, r, errorInvalidPath)
+		return
+	}
+
+	start := time.Now()
+	status := s.route(w, r, strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, Prefix), "/"), "/"))
+	s.logger.Infof("%s %s %d %s", r.Method, r.URL.Path, status, time.Since(start))
+}
+
+func (s *server) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && len(s.token) > 0 && subtle.ConstantTimeCompare([]byte(token), s.token) == 1
+}
+
+// route dispatches the request by the path and the method, it returns the status of the response
+func (s *server) route(w http.ResponseWriter, r *http.Request, path route) int {
+	switch {
+	case path.is("chats"):
+		return s.handle(w, r, map[string]handler{http.MethodGet: s.getChats}, path)
+	case path.is("chats", "*", "players"):
+		return s.handle(w, r, map[string]handler{http.MethodGet: s.getPlayers}, path)
+	case path.is("chats", "*", "players", "*", "balance"):
+		return s.handle(w, r, map[string]handler{http.MethodGet: s.getBalance, http.MethodPut: s.setBalance}, path)
+	case path.is("chats", "*", "ledger"):
+		return s.handle(w, r, map[string]handler{http.MethodGet: s.getLedger}, path)
+	case path.is("chats", "*", "transactions"):
+		return s.handle(w, r, map[string]handler{http.MethodPost: s.transact}, path)
+	case path.is("backup"):
+		return s.handle(w, r, map[string]handler{http.MethodGet: s.getBackup}, path)
+	case path.is("users", "*"):
+		return s.handle(w, r, map[string]handler{http.MethodGet: s.getUser}, path)
+	default:
+		return s.writeError(w, r, errorInvalidPath)
+	}
+}
+
+// handler returns the status and the body of the response
+type handler func(r *http.Request, path route) (int, any, error)
+
+func (s *server) handle(w http.ResponseWriter, r *http.Request, handlers map[string]handler, path route) int {
+	h, ok := handlers[r.Method]
+	if !ok {
+		methods := make([]string, 0, len(handlers))
+		for method := range handlers {
+			methods = append(methods, method)
+		}
+
+		slices.Sort(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		return s.writeError(w, r, errorUnknownMethod)
+	}
+
+	status, body, err := h(r, path)
+	if err != nil {
+		return s.writeError(w, r, err)
+	}
+
+	if file, ok := body.(*backup); ok {
+		writeFile(w, status, file)
+		return status
+	}
+
+	writeJson(w, status, body)
+	return status
+}
+
+func (s *server) getChats(_ *http.Request, _ route) (int, any, error) {
+	chatIds, err := s.storage.ChatIds()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error during ChatIds %w", err)
+	}
+
+	chats := make([]*chat, 0, len(chatIds))
+	for _, chatId := range chatIds {
+		treasury, err := s.storage.GetTreasuryBalance(chatId)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error during GetTreasuryBalance %w", err)
+		}
+
+		wallets, err := s.storage.GetChatWallets(chatId)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error during GetChatWallets %w", err)
+		}
+
+		chats = append(chats, &chat{ChatId: chatId, Treasury: treasury, Players: len(wallets)})
+	}
+
+	return http.StatusOK, chats, nil
+}
+
+func (s *server) getPlayers(_ *http.Request, path route) (int, any, error) {
+	chatId, err := path.id(1)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	wallets, err := s.storage.GetChatWallets(chatId)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error during GetChatWallets %w", err)
+	}
+
+	players := make([]*player, 0, len(wallets))
+	for _, wallet := range wallets {
+		userName, _ := s.storage.GetUserNameById(wallet.UserId)
+		players = append(players, &player{UserId: wallet.UserId, UserName: userName, Balance: wallet.Balance})
+	}
+
+	return http.StatusOK, players, nil
+}
+
+func (s *server) getBalance(_ *http.Request, path route) (int, any, error) {
+	chatId, userId, err := path.chatAndUser()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	balance, err := s.storage.GetUserBalance(chatId, userId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, &userBalance{UserId: userId, Balance: balance}, nil
+}
+
+// setBalance is /set_balance of the player registered in the chat, the treasury changes through the transactions only
+func (s *server) setBalance(r *http.Request, path route) (int, any, error) {
+	chatId, userId, err := path.chatAndUser()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	request := new(setBalanceRequest)
+	err = readJson(r, request)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if request.Balance == nil {
+		return 0, nil, api.ErrorInvalidParameters
+	}
+
+	if userId == api.TreasuryAccountId {
+		return 0, nil, api.ErrorInvalidTransactionParameters
+	}
+
+	err = s.storage.WithTx(r.Context(), func(tx api.StorageTx) error {
+		isRegistered, err := tx.IsRegistered(chatId, userId)
+		if err != nil {
+			return fmt.Errorf("error during IsRegistered %w", err)
+		}
+
+		if !isRegistered {
+			return api.ErrorNotRegistered
+		}
+
+		return api.SetBalance(tx, chatId, userId, *request.Balance)
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.logger.Infof("balance of user %d in chat %d is set to %d", userId, chatId, *request.Balance)
+	return http.StatusOK, &userBalance{UserId: userId, Balance: *request.Balance}, nil
+}
+
+// getLedger returns the ledger records of the account newest first, the whole chat if the account isn't set
+func (s *server) getLedger(r *http.Request, path route) (int, any, error) {
+	chatId, err := path.id(1)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	limit := defaultLedgerLimit
+	if param := r.URL.Query().Get("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 || limit > maxLedgerLimit {
+			return 0, nil, api.ErrorInvalidIntegerParameter
+		}
+	}
+
+	if param := r.URL.Query().Get("account"); param != "" {
+		accountId, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return 0, nil, api.ErrorInvalidIntegerParameter
+		}
+
+		transfers, err := s.storage.GetMoneyTransfers(chatId, accountId, limit)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error during GetMoneyTransfers %w", err)
+		}
+
+		return http.StatusOK, transfers, nil
+	}
+
+	transfers, err := s.storage.GetChatMoneyTransfers(chatId, limit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error during GetChatMoneyTransfers %w", err)
+	}
+
+	return http.StatusOK, transfers, nil
+}
+
+// transact is /transaction between the players or the treasury, the actor of the ledger record is api.ExternalAccountId
+func (s *server) transact(r *http.Request, path route) (int, any, error) {
+	chatId, err := path.id(1)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	request := new(transactionRequest)
+	err = readJson(r, request)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	transfer := &api.MoneyTransfer{
+		FromId:  request.FromId,
+		ToId:    request.ToId,
+		ActorId: api.ExternalAccountId,
+		Amount:  request.Amount,
+	}
+	err = api.Transact(r.Context(), s.storage, chatId, transfer)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.logger.Infof("%d coins are moved from %d to %d in chat %d", transfer.Amount, transfer.FromId, transfer.ToId, chatId)
+	return http.StatusCreated, transfer, nil
+}
+
+// getBackup is /backup of the bot owner, the snapshot is taken in one read transaction of the running bot
+func (s *server) getBackup(_ *http.Request, _ route) (int, any, error) {
+	storage, ok := s.storage.(api.BackupStorage)
+	if !ok {
+		return 0, nil, errorNoBackup
+	}
+
+	var snapshot bytes.Buffer
+	_, err := storage.Backup(&snapshot)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error during Backup %w", err)
+	}
+
+	return http.StatusOK, &backup{name: time.Now().Format(api.BackupFileNameLayout), data: snapshot.Bytes()}, nil
+}
+
+func (s *server) getUser(_ *http.Request, path route) (int, any, error) {
+	userName := strings.TrimPrefix(path[1], "@")
+	userId, ok := s.storage.GetIdByUserName(userName)
+	if !ok {
+		return 0, nil, api.ErrorNotFound
+	}
+
+	return http.StatusOK, &user{UserId: userId, UserName: userName}, nil
+}
+
+// is matches the path to the pattern, * matches any non empty element
+func (p route) is(pattern ...string) bool {
+	if len(p) != len(pattern) {
+		return false
+	}
+
+	for i, element := range pattern {
+		if p[i] == "" || (element != "*" && element != p[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p route) id(i int) (int64, error) {
+	id, err := strconv.ParseInt(p[i], 10, 64)
+	if err != nil {
+		return 0, errorInvalidPath
+	}
+
+	return id, nil
+}
+
+func (p route) chatAndUser() (chatId int64, userId int64, err error) {
+	chatId, err = p.id(1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	userId, err = p.id(3)
+	return chatId, userId, err
+}
+
+func readJson(r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err != nil {
+		return fmt.Errorf("%w: %s", api.ErrorInvalidParameters, err)
+	}
+
+	return nil
+}
+
+// writeError maps the api errors to the statuses, the unexpected errors are logged and hidden from the response
+func (s *server) writeError(w http.ResponseWriter, r *http.Request, err error) int {
+	status := http.StatusInternalServerError
+	code := api.ErrorCode(err)
+	message := err.Error()
+	switch {
+	case errors.Is(err, errorInvalidPath):
+		status, code = http.StatusNotFound, "invalid_path"
+	case errors.Is(err, errorUnknownMethod):
+		status, code = http.StatusMethodNotAllowed, "method_not_allowed"
+	case errors.Is(err, errorNoBackup):
+		status, code = http.StatusNotImplemented, "not_implemented"
+	case errors.Is(err, api.ErrorInvalidParameters),
+		errors.Is(err, api.ErrorInvalidIntegerParameter),
+		errors.Is(err, api.ErrorInvalidTransactionParameters):
+		status = http.StatusBadRequest
+	case errors.Is(err, api.ErrorNotRegistered), errors.Is(err, api.ErrorNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, api.ErrorInsufficientMoney),
+		errors.Is(err, api.ErrorInsufficientTreasury),
+		errors.Is(err, api.ErrorBalanceOverflow):
+		status = http.StatusConflict
+	default:
+		s.logger.Errorf("error while %s %s: %s", r.Method, r.URL.Path, err)
+		message = http.StatusText(status)
+	}
+
+	writeJson(w, status, &apiError{Code: code, Message: message})
+	return status
+}
+
+func writeJson(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeFile sends the backup with its length so the client detects the cut off download
+func writeFile(w http.ResponseWriter, status int, file *backup) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.name))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file.data)))
+	w.WriteHeader(status)
+	_, _ = w.Write(file.data)
+}
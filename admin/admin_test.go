@@ -0,0 +1,330 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/Refreezer/dnd-util-bot/internal/mapStorage"
+	"github.com/op/go-logging"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	chatId      int64 = -100
+	otherChatId int64 = -200
+	alice       int64 = 10
+	bob         int64 = 11
+	// carol has no user name, the bot only knows the id
+	carol int64 = 12
+
+	token = "0123456789abcdef"
+)
+
+var (
+	errDisk = errors.New("disk is on fire")
+)
+
+type (
+	loggerProvider struct{}
+
+	// noBackupStorage hides the Backup method of the storage
+	noBackupStorage struct {
+		api.Storage
+	}
+
+	// failingStorage fails ChatIds with the error the api doesn't know
+	failingStorage struct {
+		api.Storage
+	}
+)
+
+func (lp loggerProvider) MustGetLogger(moduleName string) *logging.Logger {
+	return logging.MustGetLogger(moduleName)
+}
+
+func (s failingStorage) ChatIds() ([]int64, error) {
+	return nil, errDisk
+}
+
+// newStorage has alice with 50 coins, bob with nothing and carol with 5 coins registered in chatId
+func newStorage(t *testing.T) *mapStorage.MapStorage {
+	t.Helper()
+	storage := mapStorage.NewMapStorage()
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice", alice))
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("bob", bob))
+	for userId, balance := range map[int64]int64{alice: 50, bob: 0, carol: 5} {
+		mustNotFail(t, storage.SetUserBalance(chatId, userId, balance))
+	}
+
+	return storage
+}
+
+func serve(storage api.Storage, method string, path string, authorization string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, Prefix+path, strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+
+	w := httptest.NewRecorder()
+	NewHandler(storage, token, loggerProvider{}).ServeHTTP(w, r)
+	return w
+}
+
+func mustNotFail(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var body T
+	err := json.NewDecoder(w.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("can't decode the response %s", err)
+	}
+
+	return body
+}
+
+func TestStatuses(t *testing.T) {
+	bearer := "Bearer " + token
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		body          string
+		status        int
+		code          string
+	}{
+		{"no token", http.MethodGet, "/chats", "", "", http.StatusUnauthorized, "unauthorized"},
+		{"wrong token", http.MethodGet, "/chats", "Bearer wrong", "", http.StatusUnauthorized, "unauthorized"},
+		{"token without the scheme", http.MethodGet, "/chats", token, "", http.StatusUnauthorized, "unauthorized"},
+		{"unknown path", http.MethodGet, "/nope", bearer, "", http.StatusNotFound, "invalid_path"},
+		{"chat id isn't a number", http.MethodGet, "/chats/x/players", bearer, "", http.StatusNotFound, "invalid_path"},
+		{"empty path element", http.MethodGet, "/chats//players", bearer, "", http.StatusNotFound, "invalid_path"},
+		{"unknown method", http.MethodDelete, "/chats/-100/players/10/balance", bearer, "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"chats", http.MethodGet, "/chats", bearer, "", http.StatusOK, ""},
+		{"players", http.MethodGet, "/chats/-100/players", bearer, "", http.StatusOK, ""},
+		{"balance", http.MethodGet, "/chats/-100/players/10/balance", bearer, "", http.StatusOK, ""},
+		{"balance of unknown player", http.MethodGet, "/chats/-100/players/99/balance", bearer, "", http.StatusNotFound, "not_registered"},
+		{"set balance", http.MethodPut, "/chats/-100/players/10/balance", bearer, `{"balance": 70}`, http.StatusOK, ""},
+		{"set balance of player without name", http.MethodPut, "/chats/-100/players/12/balance", bearer, `{"balance": 6}`, http.StatusOK, ""},
+		{"set balance above max", http.MethodPut, "/chats/-100/players/10/balance", bearer, `{"balance": 7000000000000}`, http.StatusBadRequest, "invalid_integer_parameter"},
+		{"set balance unknown field", http.MethodPut, "/chats/-100/players/10/balance", bearer, `{"bal": 1}`, http.StatusBadRequest, "invalid_parameters"},
+		{"set balance without balance", http.MethodPut, "/chats/-100/players/10/balance", bearer, `{}`, http.StatusBadRequest, "invalid_parameters"},
+		{"set balance of treasury", http.MethodPut, "/chats/-100/players/0/balance", bearer, `{"balance": 6}`, http.StatusBadRequest, "invalid_transaction_parameters"},
+		{"set balance of unknown player", http.MethodPut, "/chats/-100/players/99/balance", bearer, `{"balance": 1}`, http.StatusNotFound, "not_registered"},
+		{"set balance in other chat", http.MethodPut, "/chats/-200/players/10/balance", bearer, `{"balance": 6}`, http.StatusNotFound, "not_registered"},
+		{"transaction", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 10, "toId": 11, "amount": 20}`, http.StatusCreated, ""},
+		{"transaction to treasury", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 12, "toId": 0, "amount": 3}`, http.StatusCreated, ""},
+		{"transaction above balance", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 10, "toId": 11, "amount": 2000}`, http.StatusConflict, "insufficient_money"},
+		{"transaction from empty treasury", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 0, "toId": 10, "amount": 1}`, http.StatusConflict, "insufficient_treasury"},
+		{"transaction to self", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 10, "toId": 10, "amount": 2}`, http.StatusBadRequest, "invalid_transaction_parameters"},
+		{"transaction of nothing", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 10, "toId": 11, "amount": 0}`, http.StatusBadRequest, "invalid_integer_parameter"},
+		{"transaction to unknown player", http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 10, "toId": 99, "amount": 3}`, http.StatusNotFound, "not_registered"},
+		{"transaction in other chat", http.MethodPost, "/chats/-200/transactions", bearer, `{"fromId": 10, "toId": 11, "amount": 1}`, http.StatusNotFound, "not_registered"},
+		{"ledger", http.MethodGet, "/chats/-100/ledger", bearer, "", http.StatusOK, ""},
+		{"ledger of account", http.MethodGet, "/chats/-100/ledger?account=11&limit=1", bearer, "", http.StatusOK, ""},
+		{"ledger zero limit", http.MethodGet, "/chats/-100/ledger?limit=0", bearer, "", http.StatusBadRequest, "invalid_integer_parameter"},
+		{"ledger limit above max", http.MethodGet, "/chats/-100/ledger?limit=1001", bearer, "", http.StatusBadRequest, "invalid_integer_parameter"},
+		{"ledger account isn't a number", http.MethodGet, "/chats/-100/ledger?account=bob", bearer, "", http.StatusBadRequest, "invalid_integer_parameter"},
+		{"user", http.MethodGet, "/users/@bob", bearer, "", http.StatusOK, ""},
+		{"unknown user", http.MethodGet, "/users/carol", bearer, "", http.StatusNotFound, "not_found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(newStorage(t), test.method, test.path, test.authorization, test.body)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d %s", test.status, w.Code, w.Body)
+			}
+
+			if test.code == "" {
+				return
+			}
+
+			body := decode[apiError](t, w)
+			if body.Code != test.code {
+				t.Errorf("expected code %q, got %q", test.code, body.Code)
+			}
+		})
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	w := serve(newStorage(t), http.MethodGet, "/chats", "", "")
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("401 without WWW-Authenticate")
+	}
+
+	// the empty token never matches, the api is closed if the token isn't configured
+	r := httptest.NewRequest(http.MethodGet, Prefix+"/chats", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	w = httptest.NewRecorder()
+	NewHandler(newStorage(t), "", loggerProvider{}).ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 with the empty token, got %d", w.Code)
+	}
+}
+
+func TestOpenApi(t *testing.T) {
+	w := serve(newStorage(t), http.MethodGet, "/openapi.yaml", "", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/yaml" {
+		t.Fatalf("expected the yaml without the token, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if !strings.HasPrefix(w.Body.String(), "openapi:") {
+		t.Errorf("unexpected description %.20q", w.Body.String())
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	w := serve(newStorage(t), http.MethodPost, "/chats/-100/players/10/balance", "Bearer "+token, "")
+	if allow := w.Header().Get("Allow"); allow != "GET, PUT" {
+		t.Errorf("expected Allow %q, got %q", "GET, PUT", allow)
+	}
+}
+
+// TestUnexpectedError hides the message of the error the api doesn't know
+func TestUnexpectedError(t *testing.T) {
+	w := serve(failingStorage{newStorage(t)}, http.MethodGet, "/chats", "Bearer "+token, "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", w.Code)
+	}
+
+	body := decode[apiError](t, w)
+	if strings.Contains(body.Message, errDisk.Error()) {
+		t.Errorf("the internal error is sent %q", body.Message)
+	}
+}
+
+func TestPlayersAndBalances(t *testing.T) {
+	storage := newStorage(t)
+	bearer := "Bearer " + token
+	w := serve(storage, http.MethodPut, "/chats/-100/players/12/balance", bearer, `{"balance": 6}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d %s", w.Code, w.Body)
+	}
+
+	w = serve(storage, http.MethodPost, "/chats/-100/transactions", bearer, `{"fromId": 12, "toId": 0, "amount": 4}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d %s", w.Code, w.Body)
+	}
+
+	transfer := decode[api.MoneyTransfer](t, w)
+	if transfer.Kind != api.MoneyTransferKindTransaction || transfer.ActorId != api.ExternalAccountId {
+		t.Errorf("unexpected ledger record %+v", transfer)
+	}
+
+	players := decode[[]*player](t, serve(storage, http.MethodGet, "/chats/-100/players", bearer, ""))
+	slices.SortFunc(players, func(a, b *player) int { return int(a.UserId - b.UserId) })
+	expected := []player{{alice, "alice", 50}, {bob, "bob", 0}, {carol, "", 2}}
+	if len(players) != len(expected) {
+		t.Fatalf("expected %d players, got %d", len(expected), len(players))
+	}
+
+	for i := range expected {
+		if *players[i] != expected[i] {
+			t.Errorf("expected player %+v, got %+v", expected[i], *players[i])
+		}
+	}
+
+	chats := decode[[]*chat](t, serve(storage, http.MethodGet, "/chats", bearer, ""))
+	if len(chats) != 1 || *chats[0] != (chat{ChatId: chatId, Treasury: 4, Players: 3}) {
+		t.Errorf("unexpected chats %+v", chats)
+	}
+
+	balance := decode[userBalance](t, serve(storage, http.MethodGet, "/chats/-100/players/12/balance", bearer, ""))
+	if balance.Balance != 2 {
+		t.Errorf("expected balance 2, got %d", balance.Balance)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	storage := newStorage(t)
+	mustNotFail(t, storage.SetUserBalance(otherChatId, alice, 10))
+	mustNotFail(t, storage.SetUserBalance(otherChatId, bob, 0))
+	for _, transfer := range []struct {
+		chatId   int64
+		from, to int64
+		amount   int64
+	}{
+		{chatId, alice, bob, 1},
+		{chatId, bob, carol, 1},
+		{otherChatId, alice, bob, 7},
+		{chatId, alice, carol, 3},
+	} {
+		err := api.Transact(
+			context.Background(),
+			storage,
+			transfer.chatId,
+			&api.MoneyTransfer{FromId: transfer.from, ToId: transfer.to, ActorId: alice, Amount: transfer.amount},
+		)
+		mustNotFail(t, err)
+	}
+
+	tests := []struct {
+		query   string
+		amounts []int64
+	}{
+		{"", []int64{3, 1, 1}},
+		{"?limit=2", []int64{3, 1}},
+		{"?account=11", []int64{1, 1}},
+		{"?account=12&limit=1", []int64{3}},
+		{"?account=99", []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			w := serve(storage, http.MethodGet, "/chats/-100/ledger"+test.query, "Bearer "+token, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d %s", w.Code, w.Body)
+			}
+
+			amounts := make([]int64, 0)
+			for _, transfer := range decode[[]*api.MoneyTransfer](t, w) {
+				amounts = append(amounts, transfer.Amount)
+			}
+
+			if !slices.Equal(amounts, test.amounts) {
+				t.Errorf("expected the ledger %v newest first, got %v", test.amounts, amounts)
+			}
+		})
+	}
+}
+
+func TestBackup(t *testing.T) {
+	storage := newStorage(t)
+	w := serve(storage, http.MethodGet, "/backup", "Bearer "+token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d %s", w.Code, w.Body)
+	}
+
+	if !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment; filename=") ||
+		w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("unexpected headers %v", w.Header())
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	mustNotFail(t, os.WriteFile(path, w.Body.Bytes(), 0600))
+	restored, closeRestored := mapStorage.NewPersistentMapStorage(loggerProvider{}, path)
+	defer closeRestored()
+	balance, err := restored.GetUserBalance(chatId, alice)
+	mustNotFail(t, err)
+	if balance != 50 {
+		t.Errorf("expected balance 50 in the backup, got %d", balance)
+	}
+
+	w = serve(noBackupStorage{storage}, http.MethodGet, "/backup", "Bearer "+token, "")
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501 of the storage without backups, got %d", w.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"time"
+)
+
+const (
+	// BackupFileNameLayout is the time layout of the backup file names sent by /backup and written by the scheduled backups
+	BackupFileNameLayout = "dndUtil-20060102-150405.db"
+	// BackupFileNameGlob matches the file names of BackupFileNameLayout
+	BackupFileNameGlob = "dndUtil-*.db"
+)
+
+// backup handles `/backup`, sends the db snapshot to the bot owner privately
+func (api *dndUtilBotApi) backup(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	if api.ownerId == 0 || upd.SentFrom().ID != api.ownerId {
+		return nil, ErrorRightsViolation
+	}
+
+	storage, ok := api.storage.(BackupStorage)
+	if !ok {
+		return newMessageNotImplemented(upd), nil
+	}
+
+	var snapshot bytes.Buffer
+	size, err := storage.Backup(&snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("error during Backup %w", err)
+	}
+
+	now := time.Now()
+	doc := tgbotapi.NewDocument(api.ownerId, tgbotapi.FileBytes{
+		Name:  now.Format(BackupFileNameLayout),
+		Bytes: snapshot.Bytes(),
+	})
+	doc.Caption = fmt.Sprintf(messageBackupCaption, now.Format(time.DateTime), size)
+	if upd.FromChat().ID == api.ownerId {
+		return &doc, nil
+	}
+
+	api.sendToChat(&doc)
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, messageBackupSentPrivately)
+	return &msg, nil
+}
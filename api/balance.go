@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// MaxBalance bounds wallets and amounts, it keeps sums over all the wallets of a chat far from int64 overflow
+	MaxBalance int64 = 1_000_000_000_000
+)
+
+// CreditBalance returns balance increased by amount, ErrorBalanceOverflow if it exceeds MaxBalance
+func CreditBalance(balance int64, amount int64) (int64, error) {
+	if amount > MaxBalance-balance {
+		return 0, ErrorBalanceOverflow
+	}
+
+	return balance + amount, nil
+}
+
+// DebitBalance returns balance decreased by amount, ErrorInsufficientMoney if the debt exceeds creditLimit
+func DebitBalance(balance int64, amount int64, creditLimit int64) (int64, error) {
+	if balance-amount < -creditLimit {
+		return 0, ErrorInsufficientMoney
+	}
+
+	return balance - amount, nil
+}
+
+// ValidateAmount checks the amount of coins moved between the accounts, it's positive and bounded by MaxBalance
+func ValidateAmount(amount int64) error {
+	if amount <= 0 || amount > MaxBalance {
+		return ErrorInvalidIntegerParameter
+	}
+
+	return nil
+}
+
+// ValidateBalance checks the balance set by /set_balance, the debt is bounded by MaxBalance as well
+func ValidateBalance(balance int64) error {
+	if balance < -MaxBalance || balance > MaxBalance {
+		return ErrorInvalidIntegerParameter
+	}
+
+	return nil
+}
+
+// parseAmount parses positive amount of coins
+func parseAmount(param string) (int64, error) {
+	amount, err := strconv.ParseInt(param, 10, 64)
+	if err != nil || ValidateAmount(amount) != nil {
+		return 0, ErrorInvalidIntegerParameter
+	}
+
+	return amount, nil
+}
+
+// SetBalance is /set_balance of the user, the bot and the admin api set the balances with it
+func SetBalance(storage StorageTx, chatId int64, userId int64, balance int64) error {
+	err := ValidateBalance(balance)
+	if err != nil {
+		return err
+	}
+
+	err = storage.SetUserBalance(chatId, userId, balance)
+	if err != nil {
+		return fmt.Errorf("error during setUserBalance %w", err)
+	}
+
+	return nil
+}
+
+// Transact is /transaction made by the admin api, unlike the bot command it never waits for the confirmation
+// since the caller holds the admin token. The parties are the players registered in the chat or the treasury,
+// the transfer gets MoneyTransferKindTransaction and its ledger id
+func Transact(ctx context.Context, storage Storage, chatId int64, transfer *MoneyTransfer) error {
+	err := ValidateAmount(transfer.Amount)
+	if err != nil {
+		return err
+	}
+
+	if transfer.FromId == transfer.ToId {
+		return ErrorInvalidTransactionParameters
+	}
+
+	transfer.Kind = MoneyTransferKindTransaction
+	return storage.WithTx(ctx, func(tx StorageTx) error {
+		for _, accountId := range []int64{transfer.FromId, transfer.ToId} {
+			if accountId == TreasuryAccountId {
+				continue
+			}
+
+			isRegistered, err := tx.IsRegistered(chatId, accountId)
+			if err != nil {
+				return fmt.Errorf("error during IsRegistered %w", err)
+			}
+
+			if !isRegistered {
+				return fmt.Errorf("account %d %w", accountId, ErrorNotRegistered)
+			}
+		}
+
+		err := tx.TransferMoney(chatId, transfer)
+		if err != nil {
+			return fmt.Errorf("error during TransferMoney %w", err)
+		}
+
+		return nil
+	})
+}
+
+// checkTransaction fails with ErrorInsufficientMoney or ErrorBalanceOverflow if the wallets can't take the transfer
+func checkTransaction(tx StorageTx, chatId int64, fromId int64, toId int64, amount int64) error {
+	settings, err := tx.GetChatSettings(chatId)
+	if err != nil {
+		return fmt.Errorf("error during GetChatSettings %w", err)
+	}
+
+	fromBalance, err := tx.GetUserBalance(chatId, fromId)
+	if err != nil {
+		return err
+	}
+
+	_, err = DebitBalance(fromBalance, amount, settings.CreditLimit)
+	if err != nil {
+		return err
+	}
+
+	toBalance, err := tx.GetUserBalance(chatId, toId)
+	if err != nil {
+		return err
+	}
+
+	_, err = CreditBalance(toBalance, amount)
+	return err
+}
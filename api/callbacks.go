@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	botLogging "github.com/Refreezer/dnd-util-bot/logging"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+)
+
+const (
+	callbackDataSeparator = ":"
+)
+
+// callbackHandler handles inline keyboard button press, params are the callback data without prefix.
+// Returned answer is shown to the user as notification
+type callbackHandler func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, params []string) (answer string, err error)
+
+var (
+	callbackHandlers = map[string]callbackHandler{
+		callbackPrefixCharacterEditor: func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, params []string) (string, error) {
+			return api.characterEditorCallback(upd, params)
+		},
+		callbackPrefixPendingTransfer: func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, params []string) (string, error) {
+			return api.pendingTransferCallback(ctx, upd, params)
+		},
+		callbackPrefixImport: func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, params []string) (string, error) {
+			return api.importCallback(upd, params)
+		},
+	}
+)
+
+// callbackData builds `prefix:param1:param2` callback data, telegram limits it with 64 bytes
+func callbackData(prefix string, params ...any) string {
+	parts := make([]string, 0, len(params)+1)
+	parts = append(parts, prefix)
+	for _, param := range params {
+		parts = append(parts, fmt.Sprint(param))
+	}
+
+	return strings.Join(parts, callbackDataSeparator)
+}
+
+func (api *dndUtilBotApi) handleCallbackQuery(ctx context.Context, upd *tgbotapi.Update) {
+	query := upd.CallbackQuery
+	if query.From == nil || query.Message == nil {
+		return
+	}
+
+	parts := strings.Split(query.Data, callbackDataSeparator)
+	handler, ok := callbackHandlers[parts[0]]
+	if !ok {
+		api.answerCallback(query.ID, messageNotImplemented)
+		return
+	}
+
+	if fields, ok := botLogging.FieldsFromContext(ctx); ok {
+		fields.Command = parts[0]
+	}
+
+	answer, err := handler(ctx, api, upd, parts[1:])
+	if err != nil {
+		api.log(ctx).Errorf("error on executing callback handler: %s", err)
+		answer = callbackErrorAnswer(err)
+	}
+
+	api.answerCallback(query.ID, answer)
+}
+
+func callbackErrorAnswer(err error) string {
+	if errors.Is(err, ErrorNotCharacterOwner) {
+		return messageCallbackNotCharacterOwner
+	} else if errors.Is(err, ErrorNotFound) {
+		return messageCallbackNotFound
+	} else if errors.Is(err, ErrorRightsViolation) {
+		return messageRejectedRightsViolation
+	}
+
+	return ""
+}
+
+func (api *dndUtilBotApi) answerCallback(queryId string, text string) {
+	_, err := api.tgBotApi.Request(tgbotapi.NewCallback(queryId, text))
+	if err != nil {
+		api.logger.Errorf("can't answer callback query %s error: %s", queryId, err)
+	}
+}
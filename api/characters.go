@@ -0,0 +1,692 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	AbilityStrength     = "str"
+	AbilityDexterity    = "dex"
+	AbilityConstitution = "con"
+	AbilityIntelligence = "int"
+	AbilityWisdom       = "wis"
+	AbilityCharisma     = "cha"
+
+	characterFieldName        = "name"
+	characterFieldClass       = "class"
+	characterFieldLevel       = "level"
+	characterFieldArmorClass  = "ac"
+	characterFieldMaxHp       = "hp"
+	characterFieldCurrentHp   = "curhp"
+	characterFieldProficiency = "prof"
+	characterFieldSkill       = "skill"
+	characterFieldSave        = "save"
+
+	characterSubcommandNew    = "new"
+	characterSubcommandList   = "list"
+	characterSubcommandUse    = "use"
+	characterSubcommandSet    = "set"
+	characterSubcommandEdit   = "edit"
+	characterSubcommandDelete = "del"
+	characterSubcommandWeapon = "weapon"
+
+	characterDefaultAbilityScore = 10
+	characterDefaultArmorClass   = 10
+	characterDefaultHp           = 10
+	characterMinAbilityScore     = 1
+	characterMaxAbilityScore     = 30
+	characterMaxLevel            = 20
+	characterMaxNameLength       = 64
+	characterDefaultClass        = "Искатель приключений"
+
+	callbackPrefixCharacterEditor = "ce"
+)
+
+var (
+	abilities = []string{
+		AbilityStrength,
+		AbilityDexterity,
+		AbilityConstitution,
+		AbilityIntelligence,
+		AbilityWisdom,
+		AbilityCharisma,
+	}
+
+	abilityLabels = map[string]string{
+		AbilityStrength:     "СИЛ",
+		AbilityDexterity:    "ЛОВ",
+		AbilityConstitution: "ТЕЛ",
+		AbilityIntelligence: "ИНТ",
+		AbilityWisdom:       "МДР",
+		AbilityCharisma:     "ХАР",
+	}
+
+	// skillToAbility maps skill key to the ability its check is based on
+	skillToAbility = map[string]string{
+		"acrobatics":    AbilityDexterity,
+		"animal":        AbilityWisdom,
+		"arcana":        AbilityIntelligence,
+		"athletics":     AbilityStrength,
+		"deception":     AbilityCharisma,
+		"history":       AbilityIntelligence,
+		"insight":       AbilityWisdom,
+		"intimidation":  AbilityCharisma,
+		"investigation": AbilityIntelligence,
+		"medicine":      AbilityWisdom,
+		"nature":        AbilityIntelligence,
+		"perception":    AbilityWisdom,
+		"performance":   AbilityCharisma,
+		"persuasion":    AbilityCharisma,
+		"religion":      AbilityIntelligence,
+		"sleight":       AbilityDexterity,
+		"stealth":       AbilityDexterity,
+		"survival":      AbilityWisdom,
+	}
+
+	skillLabels = map[string]string{
+		"acrobatics":    "Акробатика",
+		"animal":        "Уход за животными",
+		"arcana":        "Магия",
+		"athletics":     "Атлетика",
+		"deception":     "Обман",
+		"history":       "История",
+		"insight":       "Проницательность",
+		"intimidation":  "Запугивание",
+		"investigation": "Анализ",
+		"medicine":      "Медицина",
+		"nature":        "Природа",
+		"perception":    "Внимательность",
+		"performance":   "Выступление",
+		"persuasion":    "Убеждение",
+		"religion":      "Религия",
+		"sleight":       "Ловкость рук",
+		"stealth":       "Скрытность",
+		"survival":      "Выживание",
+	}
+
+	// characterEditorFields are the numeric fields editable with inline keyboard, in order of rows
+	characterEditorFields = append(
+		slices.Clone(abilities),
+		characterFieldArmorClass,
+		characterFieldMaxHp,
+		characterFieldCurrentHp,
+		characterFieldLevel,
+	)
+
+	characterEditorFieldLabels = map[string]string{
+		characterFieldArmorClass: "КД",
+		characterFieldMaxHp:      "Макс. ХП",
+		characterFieldCurrentHp:  "ХП",
+		characterFieldLevel:      "Уровень",
+	}
+)
+
+type (
+	// Character is a player character sheet, the player may have several characters in the chat
+	// but only one of them is active at a time
+	Character struct {
+		Id           int64          `json:"id"`
+		OwnerId      int64          `json:"ownerId"`
+		Name         string         `json:"name"`
+		Class        string         `json:"class"`
+		Level        int            `json:"level"`
+		Abilities    map[string]int `json:"abilities"`
+		ArmorClass   int            `json:"armorClass"`
+		MaxHp        int            `json:"maxHp"`
+		CurrentHp    int            `json:"currentHp"`
+		Proficiency  int            `json:"proficiency"`
+		Skills       []string       `json:"skills"`
+		SavingThrows []string       `json:"savingThrows"`
+		Attacks      []*Attack      `json:"attacks"`
+		TempHp       int            `json:"tempHp"`
+		DeathSaves   DeathSaves     `json:"deathSaves"`
+		Conditions   []*Condition   `json:"conditions"`
+	}
+)
+
+func NewCharacter(ownerId int64, name string, class string, level int) *Character {
+	character := &Character{
+		OwnerId:      ownerId,
+		Name:         name,
+		Class:        class,
+		Level:        level,
+		Abilities:    make(map[string]int, len(abilities)),
+		ArmorClass:   characterDefaultArmorClass,
+		MaxHp:        characterDefaultHp,
+		CurrentHp:    characterDefaultHp,
+		Skills:       make([]string, 0),
+		SavingThrows: make([]string, 0),
+		Attacks:      make([]*Attack, 0),
+		Conditions:   make([]*Condition, 0),
+	}
+
+	for _, ability := range abilities {
+		character.Abilities[ability] = characterDefaultAbilityScore
+	}
+
+	character.Proficiency = proficiencyByLevel(level)
+	return character
+}
+
+// proficiencyByLevel is the proficiency bonus from the players handbook table
+func proficiencyByLevel(level int) int {
+	return 2 + (max(level, 1)-1)/4
+}
+
+// AbilityModifier is (score - 10) / 2 rounded down
+func AbilityModifier(score int) int {
+	diff := score - 10
+	if diff < 0 {
+		return (diff - 1) / 2
+	}
+
+	return diff / 2
+}
+
+func (c *Character) Modifier(ability string) int {
+	return AbilityModifier(c.Abilities[ability])
+}
+
+func (c *Character) IsSkillProficient(skill string) bool {
+	return slices.Contains(c.Skills, skill)
+}
+
+func (c *Character) SkillBonus(skill string) int {
+	bonus := c.Modifier(skillToAbility[skill])
+	if c.IsSkillProficient(skill) {
+		bonus += c.Proficiency
+	}
+
+	return bonus
+}
+
+// setField validates and sets the field of the sheet from the command parameter
+func (c *Character) setField(field string, value string) error {
+	switch field {
+	case characterFieldName:
+		if value == "" || len([]rune(value)) > characterMaxNameLength {
+			return ErrorInvalidParameters
+		}
+
+		c.Name = value
+		return nil
+	case characterFieldClass:
+		if len([]rune(value)) > characterMaxNameLength {
+			return ErrorInvalidParameters
+		}
+
+		c.Class = value
+		return nil
+	case characterFieldSkill:
+		skill := strings.ToLower(value)
+		if _, ok := skillToAbility[skill]; !ok {
+			return ErrorInvalidParameters
+		}
+
+		if c.IsSkillProficient(skill) {
+			c.Skills = slices.DeleteFunc(c.Skills, func(s string) bool { return s == skill })
+		} else {
+			c.Skills = append(c.Skills, skill)
+		}
+
+		return nil
+	case characterFieldSave:
+		ability, ok := parseAbility(value)
+		if !ok {
+			return ErrorInvalidParameters
+		}
+
+		if c.IsSaveProficient(ability) {
+			c.SavingThrows = slices.DeleteFunc(c.SavingThrows, func(s string) bool { return s == ability })
+		} else {
+			c.SavingThrows = append(c.SavingThrows, ability)
+		}
+
+		return nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return ErrorInvalidIntegerParameter
+	}
+
+	return c.setNumericField(field, number)
+}
+
+func (c *Character) numericField(field string) (int, bool) {
+	if _, ok := abilityLabels[field]; ok {
+		return c.Abilities[field], true
+	}
+
+	switch field {
+	case characterFieldLevel:
+		return c.Level, true
+	case characterFieldArmorClass:
+		return c.ArmorClass, true
+	case characterFieldMaxHp:
+		return c.MaxHp, true
+	case characterFieldCurrentHp:
+		return c.CurrentHp, true
+	case characterFieldProficiency:
+		return c.Proficiency, true
+	}
+
+	return 0, false
+}
+
+func (c *Character) setNumericField(field string, value int) error {
+	if _, ok := abilityLabels[field]; ok {
+		if value < characterMinAbilityScore || value > characterMaxAbilityScore {
+			return ErrorInvalidIntegerParameter
+		}
+
+		c.Abilities[field] = value
+		return nil
+	}
+
+	switch field {
+	case characterFieldLevel:
+		if value < 1 || value > characterMaxLevel {
+			return ErrorInvalidIntegerParameter
+		}
+
+		c.Level = value
+		c.Proficiency = proficiencyByLevel(value)
+	case characterFieldArmorClass:
+		if value < 0 {
+			return ErrorInvalidIntegerParameter
+		}
+
+		c.ArmorClass = value
+	case characterFieldMaxHp:
+		if value < 1 {
+			return ErrorInvalidIntegerParameter
+		}
+
+		c.MaxHp = value
+		c.CurrentHp = min(c.CurrentHp, value)
+	case characterFieldCurrentHp:
+		if value < 0 || value > c.MaxHp {
+			return ErrorInvalidIntegerParameter
+		}
+
+		c.CurrentHp = value
+	case characterFieldProficiency:
+		if value < 0 {
+			return ErrorInvalidIntegerParameter
+		}
+
+		c.Proficiency = value
+	default:
+		return ErrorInvalidParameters
+	}
+
+	return nil
+}
+
+func formatModifier(modifier int) string {
+	if modifier >= 0 {
+		return fmt.Sprintf("+%d", modifier)
+	}
+
+	return strconv.Itoa(modifier)
+}
+
+func (c *Character) sheetText(ownerUserName string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, messageCharacterSheetHeader, c.Name, c.Class, c.Level, addAt(ownerUserName))
+	fmt.Fprintf(&sb, messageCharacterSheetStats, c.CurrentHp, c.MaxHp, c.ArmorClass, formatModifier(c.Proficiency))
+	if c.TempHp > 0 {
+		fmt.Fprintf(&sb, messageCharacterSheetTempHp, c.TempHp)
+	}
+
+	if len(c.Conditions) > 0 {
+		fmt.Fprintf(&sb, messageCharacterSheetConditions, c.conditionsText())
+	}
+
+	for i, ability := range abilities {
+		score := c.Abilities[ability]
+		fmt.Fprintf(&sb, "%s %d (%s)", abilityLabels[ability], score, formatModifier(AbilityModifier(score)))
+		if i%3 == 2 {
+			sb.WriteString("\n")
+		} else {
+			sb.WriteString("  ")
+		}
+	}
+
+	if len(c.Skills) > 0 {
+		skills := make([]string, 0, len(c.Skills))
+		for _, skill := range c.Skills {
+			skills = append(skills, fmt.Sprintf("%s (%s)", skillLabels[skill], formatModifier(c.SkillBonus(skill))))
+		}
+
+		slices.Sort(skills)
+		fmt.Fprintf(&sb, messageCharacterSheetSkills, strings.Join(skills, ", "))
+	}
+
+	if len(c.SavingThrows) > 0 {
+		saves := make([]string, 0, len(c.SavingThrows))
+		for _, ability := range abilities {
+			if c.IsSaveProficient(ability) {
+				saves = append(saves, fmt.Sprintf("%s (%s)", abilityLabels[ability], formatModifier(c.Modifier(ability)+c.Proficiency)))
+			}
+		}
+
+		fmt.Fprintf(&sb, messageCharacterSheetSaves, strings.Join(saves, ", "))
+	}
+
+	if len(c.Attacks) > 0 {
+		fmt.Fprintf(&sb, messageCharacterSheetAttacks, c.attacksText())
+	}
+
+	return sb.String()
+}
+
+func (api *dndUtilBotApi) activeCharacter(chatId int64, userId int64) (*Character, error) {
+	character, err := api.storage.GetActiveCharacter(chatId, userId)
+	if errors.Is(err, ErrorNotFound) {
+		return nil, ErrorNoCharacter
+	}
+
+	return character, err
+}
+
+func (api *dndUtilBotApi) character(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	switch params[1] {
+	case characterSubcommandNew:
+		return api.newCharacter(upd, params[2:])
+	case characterSubcommandList:
+		return api.listCharacters(upd)
+	case characterSubcommandUse:
+		return api.useCharacter(upd, params[2:])
+	case characterSubcommandSet:
+		return api.setCharacterField(upd, params[2:])
+	case characterSubcommandEdit:
+		return api.characterEditor(upd)
+	case characterSubcommandDelete:
+		return api.deleteCharacter(upd, params[2:])
+	case characterSubcommandWeapon:
+		return api.characterWeapon(upd, params[2:])
+	}
+
+	return nil, ErrorInvalidParameters
+}
+
+func (api *dndUtilBotApi) newCharacter(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	if len(params) < 1 {
+		return nil, ErrorInvalidParameters
+	}
+
+	level := 1
+	class := characterDefaultClass
+	if len(params) > 1 {
+		class = params[1]
+	}
+
+	if len(params) > 2 {
+		var err error
+		level, err = strconv.Atoi(params[2])
+		if err != nil || level < 1 || level > characterMaxLevel {
+			return nil, ErrorInvalidIntegerParameter
+		}
+	}
+
+	character := NewCharacter(upd.SentFrom().ID, "", "", level)
+	err := errors.Join(
+		character.setField(characterFieldName, params[0]),
+		character.setField(characterFieldClass, class),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = api.storage.CreateCharacter(upd.FromChat().ID, character)
+	if err != nil {
+		return nil, fmt.Errorf("error during CreateCharacter %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		fmt.Sprintf(messageCharacterCreated, character.Name, character.Id)+character.sheetText(upd.SentFrom().UserName),
+	)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) listCharacters(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	userId := upd.SentFrom().ID
+	characters, err := api.storage.GetCharacters(chatId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetCharacters %w", err)
+	}
+
+	if len(characters) == 0 {
+		msg := tgbotapi.NewMessage(chatId, messageCharacterNotCreated)
+		return &msg, nil
+	}
+
+	var activeId int64
+	active, err := api.storage.GetActiveCharacter(chatId, userId)
+	if err == nil {
+		activeId = active.Id
+	}
+
+	var sb strings.Builder
+	sb.WriteString(messageCharacterList)
+	for _, character := range characters {
+		marker := " "
+		if character.Id == activeId {
+			marker = "⭐"
+		}
+
+		fmt.Fprintf(&sb, "%s #%d %s — %s, ур. %d\n", marker, character.Id, character.Name, character.Class, character.Level)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) ownCharacterByParam(upd *tgbotapi.Update, params []string) (*Character, error) {
+	if len(params) < 1 {
+		return nil, ErrorInvalidParameters
+	}
+
+	characterId, err := strconv.ParseInt(strings.TrimPrefix(params[0], "#"), 10, 64)
+	if err != nil {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	character, err := api.storage.GetCharacter(upd.FromChat().ID, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	if character.OwnerId != upd.SentFrom().ID {
+		return nil, ErrorNotFound
+	}
+
+	return character, nil
+}
+
+func (api *dndUtilBotApi) useCharacter(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	character, err := api.ownCharacterByParam(upd, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.storage.SetActiveCharacter(upd.FromChat().ID, upd.SentFrom().ID, character.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error during SetActiveCharacter %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageCharacterActivated, character.Name))
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) deleteCharacter(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	character, err := api.ownCharacterByParam(upd, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.storage.DeleteCharacter(upd.FromChat().ID, character.Id)
+	if err != nil {
+		return nil, fmt.Errorf("error during DeleteCharacter %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageCharacterDeleted, character.Name))
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) setCharacterField(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	chatId := upd.FromChat().ID
+	active, err := api.activeCharacter(chatId, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated *Character
+	err = api.storage.UpdateCharacter(chatId, active.Id, func(character *Character) error {
+		updated = character
+		return character.setField(strings.ToLower(params[0]), strings.Join(params[1:], " "))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, updated.sheetText(upd.SentFrom().UserName))
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) characterEditor(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	active, err := api.activeCharacter(chatId, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, active.sheetText(upd.SentFrom().UserName))
+	msg.ReplyMarkup = characterEditorKeyboard(active)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) sheet(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	userName := upd.SentFrom().UserName
+	userId := upd.SentFrom().ID
+	params := api.getParams(upd.Message.Text)
+	if len(params) > 1 {
+		var ok bool
+		userName = params[1]
+		userId, ok = api.userIdByUserName(userName)
+		if !ok {
+			msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, userName))
+			return &msg, nil
+		}
+	}
+
+	character, err := api.activeCharacter(upd.FromChat().ID, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, character.sheetText(userName))
+	return &msg, nil
+}
+
+// characterEditorCallback handles `ce:<characterId>:<field>:<delta>` callback of the inline character editor
+func (api *dndUtilBotApi) characterEditorCallback(upd *tgbotapi.Update, params []string) (string, error) {
+	if len(params) < 3 {
+		return "", ErrorInvalidParameters
+	}
+
+	characterId, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		return "", ErrorInvalidParameters
+	}
+
+	delta, err := strconv.Atoi(params[2])
+	if err != nil {
+		return "", ErrorInvalidParameters
+	}
+
+	if delta == 0 {
+		return "", nil
+	}
+
+	chatId := upd.FromChat().ID
+	field := params[1]
+	var updated *Character
+	err = api.storage.UpdateCharacter(chatId, characterId, func(character *Character) error {
+		if character.OwnerId != upd.SentFrom().ID {
+			return ErrorNotCharacterOwner
+		}
+
+		value, ok := character.numericField(field)
+		if !ok {
+			return ErrorInvalidParameters
+		}
+
+		updated = character
+		return character.setNumericField(field, value+delta)
+	})
+	if errors.Is(err, ErrorInvalidIntegerParameter) {
+		return messageCharacterEditorLimit, nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	edit := tgbotapi.NewEditMessageTextAndMarkup(
+		chatId,
+		upd.CallbackQuery.Message.MessageID,
+		updated.sheetText(upd.SentFrom().UserName),
+		*characterEditorKeyboard(updated),
+	)
+	api.sendToChat(edit)
+	return "", nil
+}
+
+func characterEditorKeyboard(character *Character) *tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(characterEditorFields))
+	for _, field := range characterEditorFields {
+		label, ok := abilityLabels[field]
+		if !ok {
+			label = characterEditorFieldLabels[field]
+		}
+
+		value, _ := character.numericField(field)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("➖", callbackData(callbackPrefixCharacterEditor, character.Id, field, -1)),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s %d", label, value), callbackData(callbackPrefixCharacterEditor, character.Id, field, 0)),
+			tgbotapi.NewInlineKeyboardButtonData("➕", callbackData(callbackPrefixCharacterEditor, character.Id, field, 1)),
+		))
+	}
+
+	kb := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &kb
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+)
+
+const (
+	thresholdSubjectSend        = "send"
+	thresholdSubjectTransaction = "transaction"
+)
+
+type (
+	// ChatSettings are the per chat settings changed by admins, zero value is the default for every chat
+	ChatSettings struct {
+		// SendConfirmThreshold is the /send amount above which the sender has to confirm the transfer, zero disables
+		SendConfirmThreshold int64 `json:"sendConfirmThreshold"`
+		// TransactionConfirmThreshold is the /transaction amount above which the transfer has to be approved, zero disables
+		TransactionConfirmThreshold int64 `json:"transactionConfirmThreshold"`
+		// CreditLimit is how deep in debt players may go borrowing from the guild, zero forbids negative balances
+		CreditLimit int64 `json:"creditLimit"`
+	}
+)
+
+func thresholdText(threshold int64) string {
+	if threshold == 0 {
+		return messageThresholdDisabled
+	}
+
+	return fmt.Sprintf(messageThresholdAmount, threshold)
+}
+
+// thresholds handles `/thresholds` and `/thresholds send 100`, changing thresholds is admin only
+func (api *dndUtilBotApi) thresholds(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	settings, err := api.storage.GetChatSettings(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatSettings %w", err)
+	}
+
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(
+			messageThresholds,
+			thresholdText(settings.SendConfirmThreshold),
+			thresholdText(settings.TransactionConfirmThreshold),
+		))
+		return &msg, nil
+	}
+
+	isAdmin, err := api.isRelatedMemberAdmin(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin {
+		return nil, ErrorRightsViolation
+	}
+
+	if len(params) < 3 {
+		return nil, ErrorInvalidParameters
+	}
+
+	threshold, err := strconv.ParseInt(params[2], 10, 64)
+	if err != nil || threshold < 0 || threshold > MaxBalance {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	switch params[1] {
+	case thresholdSubjectSend:
+		settings.SendConfirmThreshold = threshold
+	case thresholdSubjectTransaction:
+		settings.TransactionConfirmThreshold = threshold
+	default:
+		return nil, ErrorInvalidParameters
+	}
+
+	err = api.storage.SaveChatSettings(chatId, settings)
+	if err != nil {
+		return nil, fmt.Errorf("error during SaveChatSettings %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(messageThresholdSaved, addSlash(params[1]), thresholdText(threshold)))
+	return &msg, nil
+}
+
+func creditLimitText(creditLimit int64) string {
+	if creditLimit == 0 {
+		return messageCreditLimitDisabled
+	}
+
+	return fmt.Sprintf(messageCreditLimit, creditLimit)
+}
+
+// creditLimit handles `/credit_limit` and `/credit_limit 100`, changing the limit is admin only
+func (api *dndUtilBotApi) creditLimit(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	settings, err := api.storage.GetChatSettings(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatSettings %w", err)
+	}
+
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		msg := tgbotapi.NewMessage(chatId, creditLimitText(settings.CreditLimit))
+		return &msg, nil
+	}
+
+	isAdmin, err := api.isRelatedMemberAdmin(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin {
+		return nil, ErrorRightsViolation
+	}
+
+	creditLimit, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil || creditLimit < 0 || creditLimit > MaxBalance {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	settings.CreditLimit = creditLimit
+	err = api.storage.SaveChatSettings(chatId, settings)
+	if err != nil {
+		return nil, fmt.Errorf("error during SaveChatSettings %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, creditLimitText(creditLimit))
+	return &msg, nil
+}
@@ -0,0 +1,480 @@
+package api
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	rollModeAdvantage    = "adv"
+	rollModeDisadvantage = "dis"
+
+	d20Sides               = 20
+	diceMaxCount           = 100
+	diceMaxSides           = 1000
+	attackMaxCount         = 20
+	attackNotProficient    = "noprof"
+	attackSubcommandDelete = "del"
+)
+
+var (
+	diceNotationRegexp = regexp.MustCompile(`^(\d*)[dкд](\d+)([+-]\d+)?$`)
+)
+
+type (
+	// Attack is the weapon or spell attack of the character
+	Attack struct {
+		Name       string `json:"name"`
+		Ability    string `json:"ability"`
+		Proficient bool   `json:"proficient"`
+		Damage     string `json:"damage"`
+	}
+
+	// d20Roll is the roll of d20 with all the bonuses applied, kept for breakdown message
+	d20Roll struct {
+		rolls   []int
+		natural int
+		bonuses []*KeyValue[string, int]
+	}
+
+	dice struct {
+		count    int
+		sides    int
+		modifier int
+	}
+)
+
+func (r *d20Roll) addBonus(label string, bonus int) {
+	r.bonuses = append(r.bonuses, NewKeyValue(label, bonus))
+}
+
+func (r *d20Roll) total() int {
+	total := r.natural
+	for _, bonus := range r.bonuses {
+		total += bonus.value
+	}
+
+	return total
+}
+
+func (r *d20Roll) breakdown() string {
+	var sb strings.Builder
+	if len(r.rolls) > 1 {
+		rolls := make([]string, 0, len(r.rolls))
+		for _, roll := range r.rolls {
+			rolls = append(rolls, strconv.Itoa(roll))
+		}
+
+		fmt.Fprintf(&sb, "%d (d20: %s)", r.natural, strings.Join(rolls, "/"))
+	} else {
+		fmt.Fprintf(&sb, "%d (d20)", r.natural)
+	}
+
+	for _, bonus := range r.bonuses {
+		if bonus.value == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&sb, " %s (%s)", formatModifier(bonus.value), bonus.key)
+	}
+
+	fmt.Fprintf(&sb, " = %d", r.total())
+	switch r.natural {
+	case d20Sides:
+		sb.WriteString(messageRollCriticalSuccess)
+	case 1:
+		sb.WriteString(messageRollCriticalFailure)
+	}
+
+	return sb.String()
+}
+
+// rollDie is safe for concurrent use, rand.Rand itself is not
+func (api *dndUtilBotApi) rollDie(sides int) int {
+	api.randomizerMutex.Lock()
+	defer api.randomizerMutex.Unlock()
+	return api.randomizer.Intn(sides) + 1
+}
+
+func (api *dndUtilBotApi) rollD20(mode string) *d20Roll {
+	roll := &d20Roll{rolls: []int{api.rollDie(d20Sides)}}
+	roll.natural = roll.rolls[0]
+	if mode != rollModeAdvantage && mode != rollModeDisadvantage {
+		return roll
+	}
+
+	roll.rolls = append(roll.rolls, api.rollDie(d20Sides))
+	if mode == rollModeAdvantage {
+		roll.natural = slices.Max(roll.rolls)
+	} else {
+		roll.natural = slices.Min(roll.rolls)
+	}
+
+	return roll
+}
+
+func parseDice(notation string) (*dice, error) {
+	matches := diceNotationRegexp.FindStringSubmatch(strings.ToLower(notation))
+	if matches == nil {
+		return nil, ErrorInvalidParameters
+	}
+
+	d := &dice{count: 1}
+	var err error
+	if matches[1] != "" {
+		d.count, err = strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, ErrorInvalidIntegerParameter
+		}
+	}
+
+	d.sides, err = strconv.Atoi(matches[2])
+	if err != nil {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	if matches[3] != "" {
+		d.modifier, err = strconv.Atoi(matches[3])
+		if err != nil {
+			return nil, ErrorInvalidIntegerParameter
+		}
+	}
+
+	if d.count < 1 || d.count > diceMaxCount || d.sides < 1 || d.sides > diceMaxSides {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	return d, nil
+}
+
+func (d *dice) String() string {
+	if d.modifier == 0 {
+		return fmt.Sprintf("%dd%d", d.count, d.sides)
+	}
+
+	return fmt.Sprintf("%dd%d%s", d.count, d.sides, formatModifier(d.modifier))
+}
+
+// rollDice returns the total and the separate rolls, critical hit doubles the dice count
+func (api *dndUtilBotApi) rollDice(d *dice, critical bool) (int, []int) {
+	count := d.count
+	if critical {
+		count *= 2
+	}
+
+	rolls := make([]int, 0, count)
+	total := d.modifier
+	for i := 0; i < count; i++ {
+		roll := api.rollDie(d.sides)
+		rolls = append(rolls, roll)
+		total += roll
+	}
+
+	return total, rolls
+}
+
+// parseAbility accepts both the key (dex) and the label (ЛОВ)
+func parseAbility(param string) (string, bool) {
+	param = strings.ToLower(param)
+	for _, ability := range abilities {
+		if param == ability || param == strings.ToLower(abilityLabels[ability]) {
+			return ability, true
+		}
+	}
+
+	return "", false
+}
+
+// parseSkill accepts both the key (stealth) and the label (Скрытность)
+func parseSkill(param string) (string, bool) {
+	param = strings.ToLower(param)
+	if _, ok := skillToAbility[param]; ok {
+		return param, true
+	}
+
+	for skill, label := range skillLabels {
+		if param == strings.ToLower(label) {
+			return skill, true
+		}
+	}
+
+	return "", false
+}
+
+// parseRollParams splits params to the subject and the optional trailing adv/dis mode
+func parseRollParams(params []string) (subject string, mode string) {
+	if len(params) > 1 {
+		last := strings.ToLower(params[len(params)-1])
+		if last == rollModeAdvantage || last == rollModeDisadvantage {
+			return strings.Join(params[:len(params)-1], " "), last
+		}
+	}
+
+	return strings.Join(params, " "), ""
+}
+
+func (c *Character) IsSaveProficient(ability string) bool {
+	return slices.Contains(c.SavingThrows, ability)
+}
+
+func (c *Character) findAttack(name string) (*Attack, bool) {
+	for _, attack := range c.Attacks {
+		if strings.EqualFold(attack.Name, name) {
+			return attack, true
+		}
+	}
+
+	return nil, false
+}
+
+func (c *Character) attacksText() string {
+	names := make([]string, 0, len(c.Attacks))
+	for _, attack := range c.Attacks {
+		bonus := c.Modifier(attack.Ability)
+		if attack.Proficient {
+			bonus += c.Proficiency
+		}
+
+		if attack.Damage == "" {
+			names = append(names, fmt.Sprintf("%s (%s)", attack.Name, formatModifier(bonus)))
+			continue
+		}
+
+		names = append(names, fmt.Sprintf("%s (%s, %s)", attack.Name, formatModifier(bonus), attack.Damage))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func (api *dndUtilBotApi) rollHeader(upd *tgbotapi.Update, character *Character, subject string) string {
+	return fmt.Sprintf(messageRollHeader, addAt(upd.SentFrom().UserName), character.Name, subject)
+}
+
+// sendD20Sticker shows the natural roll with the d20 sticker before the breakdown message
+func (api *dndUtilBotApi) sendD20Sticker(upd *tgbotapi.Update, d20 int) {
+	sticker, err := api.stickerD20(upd, d20)
+	if err != nil {
+		api.logger.Errorf("couldn't get d20 sticker %s", err)
+		return
+	}
+
+	sticker.ReplyParameters.MessageID = upd.Message.MessageID
+	sticker.MessageThreadID = upd.Message.MessageThreadID
+	api.sendToChat(sticker)
+}
+
+func (api *dndUtilBotApi) skillCheck(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	subject, mode := parseRollParams(params[1:])
+	skill, isSkill := parseSkill(subject)
+	ability, isAbility := parseAbility(subject)
+	if !isSkill && !isAbility {
+		return nil, ErrorInvalidParameters
+	}
+
+	character, err := api.activeCharacter(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roll := api.rollD20(mode)
+	var label string
+	if isSkill {
+		label = skillLabels[skill]
+		ability = skillToAbility[skill]
+		roll.addBonus(abilityLabels[ability], character.Modifier(ability))
+		if character.IsSkillProficient(skill) {
+			roll.addBonus(messageRollProficiency, character.Proficiency)
+		}
+	} else {
+		label = abilityLabels[ability]
+		roll.addBonus(abilityLabels[ability], character.Modifier(ability))
+	}
+
+	api.sendD20Sticker(upd, roll.natural)
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		api.rollHeader(upd, character, fmt.Sprintf(messageRollSubjectCheck, label))+roll.breakdown(),
+	)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) savingThrow(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	subject, mode := parseRollParams(params[1:])
+	ability, ok := parseAbility(subject)
+	if !ok {
+		return nil, ErrorInvalidParameters
+	}
+
+	character, err := api.activeCharacter(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roll := api.rollD20(mode)
+	roll.addBonus(abilityLabels[ability], character.Modifier(ability))
+	if character.IsSaveProficient(ability) {
+		roll.addBonus(messageRollProficiency, character.Proficiency)
+	}
+
+	api.sendD20Sticker(upd, roll.natural)
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		api.rollHeader(upd, character, fmt.Sprintf(messageRollSubjectSave, abilityLabels[ability]))+roll.breakdown(),
+	)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) attack(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	character, err := api.activeCharacter(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, mode := parseRollParams(params[1:])
+	attack, ok := character.findAttack(subject)
+	if !ok {
+		msg := tgbotapi.NewMessage(
+			upd.FromChat().ID,
+			fmt.Sprintf(messageAttackNotFound, subject, character.attacksText()),
+		)
+		return &msg, nil
+	}
+
+	roll := api.rollD20(mode)
+	roll.addBonus(abilityLabels[attack.Ability], character.Modifier(attack.Ability))
+	if attack.Proficient {
+		roll.addBonus(messageRollProficiency, character.Proficiency)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(api.rollHeader(upd, character, fmt.Sprintf(messageRollSubjectAttack, attack.Name)))
+	sb.WriteString(roll.breakdown())
+	damageDice, err := parseDice(attack.Damage)
+	if err == nil && roll.natural != 1 {
+		critical := roll.natural == d20Sides
+		damage, rolls := api.rollDice(damageDice, critical)
+		damage = max(damage+character.Modifier(attack.Ability), 0)
+		fmt.Fprintf(
+			&sb,
+			messageAttackDamage,
+			damage,
+			damageDice,
+			fmt.Sprint(rolls),
+			formatModifier(character.Modifier(attack.Ability)),
+			abilityLabels[attack.Ability],
+		)
+	}
+
+	api.sendD20Sticker(upd, roll.natural)
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, sb.String())
+	return &msg, nil
+}
+
+// characterWeapon handles `/char weapon <name> <ability> [damage]` and `/char weapon del <name>`
+func (api *dndUtilBotApi) characterWeapon(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	chatId := upd.FromChat().ID
+	active, err := api.activeCharacter(chatId, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var update func(character *Character) error
+	if params[0] == attackSubcommandDelete {
+		name := strings.Join(params[1:], " ")
+		update = func(character *Character) error {
+			if _, ok := character.findAttack(name); !ok {
+				return ErrorNotFound
+			}
+
+			character.Attacks = slices.DeleteFunc(character.Attacks, func(a *Attack) bool {
+				return strings.EqualFold(a.Name, name)
+			})
+			return nil
+		}
+	} else {
+		attack, err := parseAttack(params)
+		if err != nil {
+			return nil, err
+		}
+
+		update = func(character *Character) error {
+			character.Attacks = slices.DeleteFunc(character.Attacks, func(a *Attack) bool {
+				return strings.EqualFold(a.Name, attack.Name)
+			})
+			if len(character.Attacks) >= attackMaxCount {
+				return ErrorInvalidParameters
+			}
+
+			character.Attacks = append(character.Attacks, attack)
+			return nil
+		}
+	}
+
+	var updated *Character
+	err = api.storage.UpdateCharacter(chatId, active.Id, func(character *Character) error {
+		updated = character
+		return update(character)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg := tgbotapi.NewMessage(chatId, updated.sheetText(upd.SentFrom().UserName))
+	return &msg, nil
+}
+
+func parseAttack(params []string) (*Attack, error) {
+	if len(params[0]) == 0 || len([]rune(params[0])) > characterMaxNameLength {
+		return nil, ErrorInvalidParameters
+	}
+
+	ability, ok := parseAbility(params[1])
+	if !ok {
+		return nil, ErrorInvalidParameters
+	}
+
+	attack := &Attack{
+		Name:       params[0],
+		Ability:    ability,
+		Proficient: true,
+	}
+
+	for _, param := range params[2:] {
+		if strings.ToLower(param) == attackNotProficient {
+			attack.Proficient = false
+			continue
+		}
+
+		damage, err := parseDice(param)
+		if err != nil {
+			return nil, err
+		}
+
+		attack.Damage = damage.String()
+	}
+
+	return attack, nil
+}
@@ -1,13 +1,68 @@
 package api
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/metrics"
+)
 
 var (
 	ErrorInvalidParameters            = fmt.Errorf("inalid command parameters")
 	ErrorInvalidIntegerParameter      = fmt.Errorf("invalid integer parameter")
 	ErrorInvalidTransactionParameters = fmt.Errorf("invalid transaction parameters")
-	ErrorBalanceOverflow              = fmt.Errorf("balance has exceeded uint32")
+	ErrorBalanceOverflow              = fmt.Errorf("balance has exceeded the limit")
 	ErrorInsufficientMoney            = fmt.Errorf("insufficient pounds")
 	ErrorNotRegistered                = fmt.Errorf("not registered error")
+	ErrorNotFound                     = fmt.Errorf("not found error")
+	ErrorNoCharacter                  = fmt.Errorf("no active character")
+	ErrorNotCharacterOwner            = fmt.Errorf("character belongs to another user")
+	ErrorRightsViolation              = fmt.Errorf("rights violation")
+	ErrorCharacterDead                = fmt.Errorf("character is dead")
+	ErrorNotDying                     = fmt.Errorf("character is not dying")
+	ErrorNotEnoughItems               = fmt.Errorf("not enough items")
+	ErrorItemQuantityOverflow         = fmt.Errorf("item quantity has exceeded the limit")
+	ErrorOutOfStock                   = fmt.Errorf("shop item is out of stock")
+	ErrorQuestNotActive               = fmt.Errorf("quest is already finished")
+	ErrorInsufficientTreasury         = fmt.Errorf("insufficient pounds in treasury")
 	ErrorUsernameHidden               = fmt.Errorf("username is hidden, command is impossible to execute")
 )
+
+// errorCodes are the names of the errors in the commands_executed_total metric and the admin api responses
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrorInvalidParameters, "invalid_parameters"},
+	{ErrorInvalidIntegerParameter, "invalid_integer_parameter"},
+	{ErrorInvalidTransactionParameters, "invalid_transaction_parameters"},
+	{ErrorBalanceOverflow, "balance_overflow"},
+	{ErrorInsufficientTreasury, "insufficient_treasury"},
+	{ErrorInsufficientMoney, "insufficient_money"},
+	{ErrorNotRegistered, "not_registered"},
+	{ErrorNotFound, "not_found"},
+	{ErrorNoCharacter, "no_character"},
+	{ErrorNotCharacterOwner, "not_character_owner"},
+	{ErrorRightsViolation, "rights_violation"},
+	{ErrorCharacterDead, "character_dead"},
+	{ErrorNotDying, "not_dying"},
+	{ErrorNotEnoughItems, "not_enough_items"},
+	{ErrorItemQuantityOverflow, "item_quantity_overflow"},
+	{ErrorOutOfStock, "out_of_stock"},
+	{ErrorQuestNotActive, "quest_not_active"},
+	{ErrorUsernameHidden, "username_hidden"},
+}
+
+// ErrorCode is the name of the api error, metrics.OutcomeError if err isn't one of them
+func ErrorCode(err error) string {
+	if err == nil {
+		return metrics.OutcomeOk
+	}
+
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+
+	return metrics.OutcomeError
+}
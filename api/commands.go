@@ -2,6 +2,7 @@ package api
 
 import (
 	"cmp"
+	"context"
 	"fmt"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"slices"
@@ -23,6 +24,46 @@ const (
 	commandKeyGetUserBalance          = "get_balance"
 	commandKeySetUserBalance          = "set_balance"
 	commandKeyMoveMoneyFromUserToUser = "transaction"
+	commandKeyCancel                  = "cancel"
+	commandKeyCharacter               = "char"
+	commandKeySheet                   = "sheet"
+	commandKeySkillCheck              = "check"
+	commandKeySavingThrow             = "save"
+	commandKeyAttack                  = "attack"
+	commandKeyPartyStatus             = "hp"
+	commandKeyDamage                  = "dmg"
+	commandKeyHealing                 = "heal"
+	commandKeyTemporaryHp             = "temp"
+	commandKeyCondition               = "cond"
+	commandKeyDeathSave               = "deathsave"
+	commandKeyNextRound               = "round"
+	commandKeyInventory               = "inv"
+	commandKeyStash                   = "stash"
+	commandKeyGiveItem                = "give"
+	commandKeyDropItem                = "drop"
+	commandKeyTakeItem                = "take"
+	commandKeySetItem                 = "set_item"
+	commandKeyItemTransfers           = "items_log"
+	commandKeyShop                    = "shop"
+	commandKeyBuy                     = "buy"
+	commandKeyQuest                   = "quest"
+	commandKeyQuests                  = "quests"
+	commandKeyLoot                    = "loot"
+	commandKeyDeposit                 = "deposit"
+	commandKeyWithdraw                = "withdraw"
+	commandKeyTreasury                = "treasury"
+	commandKeyThresholds              = "thresholds"
+	commandKeyCreditLimit             = "credit_limit"
+	commandKeyRich                    = "rich"
+	commandKeyWealth                  = "wealth"
+	commandKeyStats                   = "stats"
+	commandKeyBackup                  = "backup"
+	commandKeyExport                  = "export"
+	commandKeyImport                  = "import"
+	commandKeyConversationStep        = "conversation_step"
+	commandKeyNotImplemented          = "not_implemented"
+	commandKeyRightsViolation         = "rights_violation"
+	commandKeyCanNotResolve           = "can_not_resolve"
 )
 
 type (
@@ -32,7 +73,7 @@ type (
 		messageCache *MessageCache
 	}
 
-	commandHandler func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error)
+	commandHandler func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error)
 	command        struct {
 		commandKey       string
 		handler          commandHandler
@@ -44,7 +85,7 @@ type (
 	}
 
 	builtUpCommand struct {
-		handler func(upd *tgbotapi.Update) error
+		handler func(ctx context.Context, upd *tgbotapi.Update) error
 	}
 
 	KeyValue[TKey any, TValue any] struct {
@@ -196,14 +237,22 @@ func (c *commands) Resolve(upd *tgbotapi.Update) *command {
 	if !ok {
 		cmd, ok = c.findCommandByLabel(upd.Message.Text, commandsMap)
 		if !ok {
-			if commandKey == "" {
-				return commandCanNotResolve
-			} else {
+			if commandKey != "" {
 				return commandNotImplemented
 			}
+
+			if _, ok := c.api.activeConversation(upd); ok {
+				return commandConversationStep
+			}
+
+			return commandCanNotResolve
 		}
 	}
 
+	if c.api.currentSettings().isDisabled(cmd.commandKey) {
+		return commandNotImplemented
+	}
+
 	if cmd.needsAdminRights {
 		isRelatedMemberAdmin, err := c.api.isRelatedMemberAdmin(upd)
 		if err != nil {
@@ -222,8 +271,8 @@ func (c *command) Build(api *dndUtilBotApi) *builtUpCommand {
 	return c.newBuiltUpCommand(api)
 }
 
-func (buc *builtUpCommand) Execute(upd *tgbotapi.Update) error {
-	err := buc.handler(upd)
+func (buc *builtUpCommand) Execute(ctx context.Context, upd *tgbotapi.Update) error {
+	err := buc.handler(ctx, upd)
 	if err != nil {
 		return err
 	}
@@ -233,7 +282,7 @@ func (buc *builtUpCommand) Execute(upd *tgbotapi.Update) error {
 
 func (c *command) newBuiltUpCommand(api *dndUtilBotApi) *builtUpCommand {
 	return &builtUpCommand{
-		handler: func(upd *tgbotapi.Update) error {
+		handler: func(ctx context.Context, upd *tgbotapi.Update) error {
 			if c.messageCache != nil {
 				cached, ok := c.messageCache.Get(c.commandKey, upd.FromChat().ID)
 				if ok {
@@ -243,9 +292,9 @@ func (c *command) newBuiltUpCommand(api *dndUtilBotApi) *builtUpCommand {
 			}
 
 			wrappedHandler := c.handler.setThreadIdForSuperGroup()
-			chattable, err := wrappedHandler(api, upd)
+			chattable, err := wrappedHandler(ctx, api, upd)
 			if err != nil {
-				api.logger.Errorf("error on executing command handler: %s", err)
+				api.log(ctx).Errorf("error on executing command handler: %s", err)
 			}
 
 			if chattable != nil {
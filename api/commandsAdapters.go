@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -8,8 +9,8 @@ type markupProvider func(api *dndUtilBotApi, upd *tgbotapi.Update) *tgbotapi.Rep
 type baseChatModifier func(c *tgbotapi.BaseChat, api *dndUtilBotApi, upd *tgbotapi.Update)
 
 func wrapHandler(handler commandHandler, modifier baseChatModifier) commandHandler {
-	return func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
-		msg, err := handler(api, upd)
+	return func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		msg, err := handler(ctx, api, upd)
 		if err != nil {
 			return nil, err
 		}
@@ -19,13 +20,20 @@ func wrapHandler(handler commandHandler, modifier baseChatModifier) commandHandl
 			modifier(&v.BaseChat, api, upd)
 		case *tgbotapi.StickerConfig:
 			modifier(&v.BaseChat, api, upd)
+		case *tgbotapi.DocumentConfig:
+			modifier(&v.BaseChat, api, upd)
 		}
 		return msg, nil
 	}
 }
 
+// setReplyMarkup sets the markup unless the handler has already attached its own e.g. inline buttons
 func (handler commandHandler) setReplyMarkup(markupProvider markupProvider) commandHandler {
 	return wrapHandler(handler, func(c *tgbotapi.BaseChat, api *dndUtilBotApi, upd *tgbotapi.Update) {
+		if c.ReplyMarkup != nil {
+			return
+		}
+
 		c.ReplyMarkup = markupProvider(api, upd)
 	})
 }
@@ -48,51 +56,199 @@ func (handler commandHandler) setThreadIdForSuperGroup() commandHandler {
 }
 
 var (
-	handlerMoveMoneyFromUserToUser commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
-		return api.Transaction(upd)
+	handlerMoveMoneyFromUserToUser commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.Transaction(ctx, upd)
 	}
 
-	handlerSetUserBalance commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerSetUserBalance commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.setUserBalance(upd)
 	}
 
-	handlerGetUserBalance commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerGetUserBalance commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.getUserBalance(upd)
 	}
 
-	handlerThrowDice commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerThrowDice commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.throwDice(upd)
 	}
 
-	handlerGetBalance commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerGetBalance commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.getBalance(upd)
 	}
 
-	handlerSendMoneyPrompt commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerSendMoneyPrompt commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.sendMoneyPrompt(upd)
 	}
 
-	handlerSendMoney commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
-		return api.sendMoney(upd)
+	handlerSendMoney commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.sendMoney(ctx, upd)
+	}
+
+	handlerCharacter commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.character(upd)
+	}
+
+	handlerSheet commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.sheet(upd)
+	}
+
+	handlerSkillCheck commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.skillCheck(upd)
+	}
+
+	handlerSavingThrow commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.savingThrow(upd)
+	}
+
+	handlerAttack commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.attack(upd)
+	}
+
+	handlerPartyStatus commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.partyStatus(upd)
+	}
+
+	handlerDamage commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.damage(upd)
+	}
+
+	handlerHealing commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.healing(upd)
+	}
+
+	handlerTemporaryHp commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.temporaryHp(upd)
+	}
+
+	handlerCondition commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.condition(upd)
+	}
+
+	handlerDeathSave commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.deathSave(upd)
+	}
+
+	handlerNextRound commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.nextRound(upd)
+	}
+
+	handlerInventory commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.inventory(upd)
+	}
+
+	handlerStash commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.stash(upd)
+	}
+
+	handlerGiveItem commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.giveItem(upd)
+	}
+
+	handlerDropItem commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.dropItem(upd)
+	}
+
+	handlerTakeItem commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.takeItem(upd)
+	}
+
+	handlerSetItem commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.setItem(upd)
+	}
+
+	handlerItemTransfers commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.itemTransfers(upd)
+	}
+
+	handlerShop commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.shop(upd)
+	}
+
+	handlerBuy commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.buy(ctx, upd)
+	}
+
+	handlerQuest commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.quest(upd)
+	}
+
+	handlerQuests commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.quests(upd)
+	}
+
+	handlerLoot commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.loot(upd)
+	}
+
+	handlerDeposit commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.deposit(upd)
+	}
+
+	handlerWithdraw commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.withdraw(upd)
+	}
+
+	handlerTreasury commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.treasury(upd)
+	}
+
+	handlerThresholds commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.thresholds(upd)
+	}
+
+	handlerCreditLimit commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.creditLimit(upd)
+	}
+
+	handlerRich commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.rich(upd)
+	}
+
+	handlerWealth commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.wealth(upd)
+	}
+
+	handlerStats commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.stats(upd)
+	}
+
+	handlerBackup commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.backup(upd)
+	}
+
+	handlerExport commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.export(upd)
+	}
+
+	handlerImport commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.importChat(upd)
+	}
+
+	handlerCancel commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.cancelConversation(upd)
+	}
+
+	handlerConversationStep commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+		return api.continueConversation(ctx, upd)
 	}
 
-	handlerNotImplemented commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerNotImplemented commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return notImplemented(upd)
 	}
 
-	handlerRightsViolation commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerRightsViolation commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return rightsViolation(upd)
 	}
 
-	handlerCantResolve commandHandler = func(_ *dndUtilBotApi, _ *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerCantResolve commandHandler = func(_ context.Context, _ *dndUtilBotApi, _ *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return nil, nil
 	}
 
-	handlerStart commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerStart commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.start(upd)
 	}
 
-	handlerHelp commandHandler = func(api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	handlerHelp commandHandler = func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
 		return api.commands.printHelp(upd)
 	}
 )
@@ -10,12 +10,40 @@ const (
 	commandGetBalanceLabel              = "Мой кошель"
 	commandSendMoneyPromptLabel         = "Передать монеты"
 	commandStartLabel                   = "Начать"
+	commandCancelLabel                  = "Отмена"
+	conversationConfirmLabel            = "Да"
 	commandEmptyLabel                   = "-"
 
 	usageMoveMoneyFromUserToUser = "`%s @sender @recipient 123`"
 	usageSetUserBalance          = "`%s @username 123`"
 	usageGetUserBalance          = "`%s @username`"
 	usageSendMoney               = "`%s @recipient 123`"
+	usageCharacter               = "`%[1]s new \"Имя\" Класс 1`, `%[1]s list`, `%[1]s use 1`, `%[1]s set str 15`, `%[1]s set skill stealth`, `%[1]s set save dex`, `%[1]s weapon longsword str 1d8`, `%[1]s weapon del longsword`, `%[1]s edit`, `%[1]s del 1`"
+	usageSheet                   = "`%s [@username]`"
+	usageSkillCheck              = "`%s stealth [adv|dis]`"
+	usageSavingThrow             = "`%s dex [adv|dis]`"
+	usageAttack                  = "`%s longsword [adv|dis]`"
+	usageDamage                  = "`%s [@username] 7`"
+	usageHealing                 = "`%s [@username] 5`"
+	usageTemporaryHp             = "`%s [@username] 10`"
+	usageInventory               = "`%s [@username|stash]`"
+	usageGiveItem                = "`%s @recipient \"Зелье лечения\" 2`"
+	usageDropItem                = "`%s \"Зелье лечения\" 2`"
+	usageTakeItem                = "`%s \"Зелье лечения\" 2`"
+	usageSetItem                 = "`%s @username|stash \"Зелье лечения\" 2`"
+	usageShop                    = "`%[1]s`, `%[1]s add \"Верёвка 50ft\" 1g stock=5`, `%[1]s del \"Верёвка 50ft\"`"
+	usageBuy                     = "`%s \"Верёвка 50ft\" 2`"
+	usageQuest                   = "`%[1]s add Спасти кота reward=50`, `%[1]s take 1`, `%[1]s complete 1 @a @b`, `%[1]s fail 1`"
+	usageLoot                    = "`%s 1375 [@a @b]`"
+	usageDeposit                 = "`%s 20`"
+	usageWithdraw                = "`%s 20 @username`"
+	usageThresholds              = "`%[1]s`, `%[1]s send 100`, `%[1]s transaction 500`, `%[1]s send 0`"
+	usageCreditLimit             = "`%[1]s`, `%[1]s 100`, `%[1]s 0`"
+	usageRich                    = "`%s [10]`"
+	usageStats                   = "`%s [@username]`"
+	usageExport                  = "`%[1]s`, `%[1]s csv`"
+	usageImport                  = "`%s` ответом на файл из /export"
+	usageCondition               = "`%[1]s [@username] poisoned 3`, `%[1]s [@username] -poisoned`"
 )
 
 var (
@@ -29,11 +57,48 @@ var (
 		commandKeySetUserBalance:          commandSetUserBalance,
 		commandKeyMoveMoneyFromUserToUser: commandMoveMoneyFromUserToUser,
 		commandKeyHelp:                    commandHelp,
+		commandKeyCancel:                  commandCancel,
+		commandKeyCharacter:               commandCharacter,
+		commandKeySheet:                   commandSheet,
+		commandKeySkillCheck:              commandSkillCheck,
+		commandKeySavingThrow:             commandSavingThrow,
+		commandKeyAttack:                  commandAttack,
+		commandKeyPartyStatus:             commandPartyStatus,
+		commandKeyDamage:                  commandDamage,
+		commandKeyHealing:                 commandHealing,
+		commandKeyTemporaryHp:             commandTemporaryHp,
+		commandKeyCondition:               commandCondition,
+		commandKeyDeathSave:               commandDeathSave,
+		commandKeyNextRound:               commandNextRound,
+		commandKeyInventory:               commandInventory,
+		commandKeyStash:                   commandStash,
+		commandKeyGiveItem:                commandGiveItem,
+		commandKeyDropItem:                commandDropItem,
+		commandKeyTakeItem:                commandTakeItem,
+		commandKeySetItem:                 commandSetItem,
+		commandKeyItemTransfers:           commandItemTransfers,
+		commandKeyShop:                    commandShop,
+		commandKeyBuy:                     commandBuy,
+		commandKeyQuest:                   commandQuest,
+		commandKeyQuests:                  commandQuests,
+		commandKeyLoot:                    commandLoot,
+		commandKeyDeposit:                 commandDeposit,
+		commandKeyWithdraw:                commandWithdraw,
+		commandKeyTreasury:                commandTreasury,
+		commandKeyThresholds:              commandThresholds,
+		commandKeyCreditLimit:             commandCreditLimit,
+		commandKeyRich:                    commandRich,
+		commandKeyWealth:                  commandWealth,
+		commandKeyStats:                   commandStats,
+		commandKeyBackup:                  commandBackup,
+		commandKeyExport:                  commandExport,
+		commandKeyImport:                  commandImport,
 	}
 
 	privateCommandsMap = map[string]*command{
-		commandKeyStart: commandStart,
-		commandKeyHelp:  commandHelp,
+		commandKeyStart:  commandStart,
+		commandKeyHelp:   commandHelp,
+		commandKeyBackup: commandBackup,
 	}
 
 	chatTypeToCommandMap = map[string]map[string]*command{
@@ -76,9 +141,9 @@ var (
 		description: "посмотреть свой баланс",
 	}
 	commandSendMoneyPrompt = &command{
-		handler:     handlerSendMoneyPrompt.setReplyMarkup(mainMenu).setReplyToMessageID(),
+		handler:     handlerSendMoneyPrompt.setReplyToMessageID(),
 		label:       commandSendMoneyPromptLabel,
-		description: "посмотреть команду для перевода",
+		description: "перевести деньги игроку по шагам",
 	}
 	commandSendMoney = &command{
 		handler:     handlerSendMoney.setReplyMarkup(mainMenu).setReplyToMessageID(),
@@ -90,6 +155,218 @@ var (
 		handler: handlerStart.setReplyMarkup(mainMenu),
 		label:   commandStartLabel,
 	}
+	commandCharacter = &command{
+		handler:     handlerCharacter.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageCharacter, addSlash(commandKeyCharacter)),
+		label:       commandEmptyLabel,
+		description: "создать и редактировать персонажа",
+	}
+	commandSheet = &command{
+		handler:     handlerSheet.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageSheet, addSlash(commandKeySheet)),
+		label:       commandEmptyLabel,
+		description: "лист персонажа",
+	}
+	commandSkillCheck = &command{
+		handler:     handlerSkillCheck.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageSkillCheck, addSlash(commandKeySkillCheck)),
+		label:       commandEmptyLabel,
+		description: "проверка навыка или характеристики",
+	}
+	commandSavingThrow = &command{
+		handler:     handlerSavingThrow.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageSavingThrow, addSlash(commandKeySavingThrow)),
+		label:       commandEmptyLabel,
+		description: "спасбросок",
+	}
+	commandAttack = &command{
+		handler:     handlerAttack.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageAttack, addSlash(commandKeyAttack)),
+		label:       commandEmptyLabel,
+		description: "бросок атаки и урона",
+	}
+	commandPartyStatus = &command{
+		handler:     handlerPartyStatus.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "состояние отряда",
+	}
+	commandDamage = &command{
+		handler:     handlerDamage.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageDamage, addSlash(commandKeyDamage)),
+		label:       commandEmptyLabel,
+		description: "нанести урон персонажу",
+	}
+	commandHealing = &command{
+		handler:     handlerHealing.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageHealing, addSlash(commandKeyHealing)),
+		label:       commandEmptyLabel,
+		description: "вылечить персонажа",
+	}
+	commandTemporaryHp = &command{
+		handler:     handlerTemporaryHp.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageTemporaryHp, addSlash(commandKeyTemporaryHp)),
+		label:       commandEmptyLabel,
+		description: "дать персонажу временные хиты",
+	}
+	commandCondition = &command{
+		handler:     handlerCondition.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageCondition, addSlash(commandKeyCondition)),
+		label:       commandEmptyLabel,
+		description: "наложить или снять состояние на число раундов",
+	}
+	commandDeathSave = &command{
+		handler:     handlerDeathSave.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "спасбросок от смерти",
+	}
+	commandNextRound = &command{
+		handler:          handlerNextRound.setReplyToMessageID(),
+		needsAdminRights: true,
+		label:            commandEmptyLabel,
+		description:      "следующий раунд, уменьшает длительность состояний",
+	}
+	commandInventory = &command{
+		handler:     handlerInventory.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageInventory, addSlash(commandKeyInventory)),
+		label:       commandEmptyLabel,
+		description: "посмотреть инвентарь",
+	}
+	commandStash = &command{
+		handler:     handlerStash.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "посмотреть общий тайник отряда",
+	}
+	commandGiveItem = &command{
+		handler:     handlerGiveItem.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageGiveItem, addSlash(commandKeyGiveItem)),
+		label:       commandEmptyLabel,
+		description: "передать предмет игроку",
+	}
+	commandDropItem = &command{
+		handler:     handlerDropItem.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageDropItem, addSlash(commandKeyDropItem)),
+		label:       commandEmptyLabel,
+		description: "положить предмет в общий тайник",
+	}
+	commandTakeItem = &command{
+		handler:     handlerTakeItem.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageTakeItem, addSlash(commandKeyTakeItem)),
+		label:       commandEmptyLabel,
+		description: "взять предмет из общего тайника",
+	}
+	commandSetItem = &command{
+		handler:          handlerSetItem.setReplyToMessageID(),
+		needsAdminRights: true,
+		usage:            fmt.Sprintf(usageSetItem, addSlash(commandKeySetItem)),
+		label:            commandEmptyLabel,
+		description:      "задать количество предмета у игрока",
+	}
+	commandItemTransfers = &command{
+		handler:     handlerItemTransfers.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "история передачи предметов",
+	}
+	commandShop = &command{
+		handler:     handlerShop.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageShop, addSlash(commandKeyShop)),
+		label:       commandEmptyLabel,
+		description: "лавка Гильдии, добавлять и убирать товары могут админы",
+	}
+	commandBuy = &command{
+		handler:     handlerBuy.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageBuy, addSlash(commandKeyBuy)),
+		label:       commandEmptyLabel,
+		description: "купить товар в лавке",
+	}
+	commandQuest = &command{
+		handler:     handlerQuest.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageQuest, addSlash(commandKeyQuest)),
+		label:       commandEmptyLabel,
+		description: "квесты Гильдии, добавлять и завершать квесты могут админы",
+	}
+	commandQuests = &command{
+		handler:     handlerQuests.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "доска заданий Гильдии",
+	}
+	commandLoot = &command{
+		handler:          handlerLoot.setReplyToMessageID(),
+		needsAdminRights: true,
+		usage:            fmt.Sprintf(usageLoot, addSlash(commandKeyLoot)),
+		label:            commandEmptyLabel,
+		description:      "поделить добычу поровну между игроками или всем отрядом",
+	}
+	commandDeposit = &command{
+		handler:     handlerDeposit.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageDeposit, addSlash(commandKeyDeposit)),
+		label:       commandEmptyLabel,
+		description: "внести монеты в казну отряда",
+	}
+	commandWithdraw = &command{
+		handler:          handlerWithdraw.setReplyToMessageID(),
+		needsAdminRights: true,
+		usage:            fmt.Sprintf(usageWithdraw, addSlash(commandKeyWithdraw)),
+		label:            commandEmptyLabel,
+		description:      "выдать монеты из казны отряда игроку",
+	}
+	commandTreasury = &command{
+		handler:     handlerTreasury.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "казна отряда и последние движения",
+	}
+	commandThresholds = &command{
+		handler:     handlerThresholds.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageThresholds, addSlash(commandKeyThresholds)),
+		label:       commandEmptyLabel,
+		description: "суммы переводов, которые нужно подтверждать, менять их могут админы",
+	}
+	commandCreditLimit = &command{
+		handler:     handlerCreditLimit.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageCreditLimit, addSlash(commandKeyCreditLimit)),
+		label:       commandEmptyLabel,
+		description: "сколько путники могут занять у Гильдии, менять лимит могут админы",
+	}
+	commandRich = &command{
+		handler:     handlerRich.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageRich, addSlash(commandKeyRich)),
+		label:       commandEmptyLabel,
+		description: "самые богатые путники",
+	}
+	commandWealth = &command{
+		handler:     handlerWealth.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "сколько монет у отряда и как они распределены",
+	}
+	commandStats = &command{
+		handler:     handlerStats.setReplyToMessageID(),
+		usage:       fmt.Sprintf(usageStats, addSlash(commandKeyStats)),
+		label:       commandEmptyLabel,
+		description: "кошель путника, место среди игроков и сколько монет отдано и получено",
+	}
+	commandBackup = &command{
+		handler:     handlerBackup.setReplyToMessageID(),
+		label:       commandEmptyLabel,
+		description: "прислать владельцу бота снимок базы",
+	}
+	commandExport = &command{
+		handler:          handlerExport.setReplyToMessageID(),
+		needsAdminRights: true,
+		usage:            fmt.Sprintf(usageExport, addSlash(commandKeyExport)),
+		label:            commandEmptyLabel,
+		description:      "выгрузить все данные чата в JSON или кошели и журнал в CSV",
+	}
+	commandImport = &command{
+		handler:          handlerImport.setReplyToMessageID(),
+		needsAdminRights: true,
+		usage:            fmt.Sprintf(usageImport, addSlash(commandKeyImport)),
+		label:            commandEmptyLabel,
+		description:      "заменить данные чата выгрузкой из /export",
+	}
+	commandCancel = &command{
+		handler:     handlerCancel.setReplyToMessageID(),
+		label:       commandCancelLabel,
+		description: "отменить начатое действие",
+	}
 	commandHelp = &command{
 		handler:          handlerHelp,
 		needsAdminRights: true,
@@ -99,15 +376,23 @@ var (
 
 	// service commands
 	commandNotImplemented = &command{
-		handler: handlerNotImplemented.setReplyMarkup(mainMenu).setReplyToMessageID(),
-		label:   commandEmptyLabel,
+		commandKey: commandKeyNotImplemented,
+		handler:    handlerNotImplemented.setReplyMarkup(mainMenu).setReplyToMessageID(),
+		label:      commandEmptyLabel,
 	}
 	commandRightsViolation = &command{
-		handler: handlerRightsViolation.setReplyMarkup(mainMenu).setReplyToMessageID(),
-		label:   commandEmptyLabel,
+		commandKey: commandKeyRightsViolation,
+		handler:    handlerRightsViolation.setReplyMarkup(mainMenu).setReplyToMessageID(),
+		label:      commandEmptyLabel,
+	}
+	commandConversationStep = &command{
+		commandKey: commandKeyConversationStep,
+		handler:    handlerConversationStep.setReplyToMessageID(),
+		label:      commandEmptyLabel,
 	}
 	commandCanNotResolve = &command{
-		handler: handlerCantResolve.setReplyMarkup(mainMenu),
+		commandKey: commandKeyCanNotResolve,
+		handler:    handlerCantResolve.setReplyMarkup(mainMenu),
 	}
 )
 
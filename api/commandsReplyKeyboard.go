@@ -7,6 +7,8 @@ var (
 	buttonThrowDice       = tgbotapi.NewKeyboardButton(commandThrowDiceLabel)
 	buttonGetBalance      = tgbotapi.NewKeyboardButton(commandGetBalanceLabel)
 	buttonSendMoneyPrompt = tgbotapi.NewKeyboardButton(commandSendMoneyPromptLabel)
+	buttonCancel          = tgbotapi.NewKeyboardButton(commandCancelLabel)
+	buttonConfirm         = tgbotapi.NewKeyboardButton(conversationConfirmLabel)
 	//buttonGetUserBalance  = tgbotapi.NewKeyboardButton(commandGetUserBalanceLabel)
 	//buttonSetUserBalance          = tgbotapi.NewKeyboardButton(commandSetUserBalanceLabel)
 	//buttonMoveMoneyFromUserToUser = tgbotapi.NewKeyboardButton(commandMoveMoneyFromUserToUserLabel)
@@ -29,3 +31,47 @@ func mainMenu(api *dndUtilBotApi, upd *tgbotapi.Update) *tgbotapi.ReplyKeyboardM
 
 	return &kb
 }
+
+// membersKeyboard lists chat members except the sender so recipient can be chosen by button
+func membersKeyboard(members []*Member, exceptUserId int64) *tgbotapi.ReplyKeyboardMarkup {
+	rows := make([][]tgbotapi.KeyboardButton, 0, conversationMembersLimit/conversationMembersRowLength+1)
+	row := make([]tgbotapi.KeyboardButton, 0, conversationMembersRowLength)
+	count := 0
+	for _, member := range members {
+		if member.UserId == exceptUserId || member.UserName == "" {
+			continue
+		}
+
+		if count == conversationMembersLimit {
+			break
+		}
+
+		row = append(row, tgbotapi.NewKeyboardButton(addAt(member.UserName)))
+		count++
+		if len(row) == conversationMembersRowLength {
+			rows = append(rows, row)
+			row = make([]tgbotapi.KeyboardButton, 0, conversationMembersRowLength)
+		}
+	}
+
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+
+	rows = append(rows, tgbotapi.NewKeyboardButtonRow(buttonCancel))
+	kb := tgbotapi.NewReplyKeyboard(rows...)
+	kb.Selective = true
+	return &kb
+}
+
+func cancelKeyboard() *tgbotapi.ReplyKeyboardMarkup {
+	kb := tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(buttonCancel))
+	kb.Selective = true
+	return &kb
+}
+
+func confirmKeyboard() *tgbotapi.ReplyKeyboardMarkup {
+	kb := tgbotapi.NewReplyKeyboard(tgbotapi.NewKeyboardButtonRow(buttonConfirm, buttonCancel))
+	kb.Selective = true
+	return &kb
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	conversationFlowSendMoney = "send_money"
+
+	conversationStepRecipient = "recipient"
+	conversationStepAmount    = "amount"
+	conversationStepConfirm   = "confirm"
+
+	conversationDataRecipient   = "recipient"
+	conversationDataRecipientId = "recipientId"
+	conversationDataAmount      = "amount"
+
+	conversationTimeout          = 5 * time.Minute
+	conversationMembersRowLength = 2
+	conversationMembersLimit     = 20
+)
+
+type (
+	// Conversation is a state of the multistep command flow of the particular user in the particular chat.
+	// Step is the name of the step the next plain text message of the user is routed to.
+	Conversation struct {
+		Flow      string            `json:"flow"`
+		Step      string            `json:"step"`
+		Data      map[string]string `json:"data"`
+		ExpiresAt time.Time         `json:"expiresAt"`
+	}
+
+	// Member is the registered wallet owner of the chat
+	Member struct {
+		UserId   int64
+		UserName string
+	}
+
+	// conversationStepHandler handles the message routed to the step of the flow.
+	// Handler moves conversation to the next step by changing conv.Step, empty step finishes the conversation.
+	conversationStepHandler func(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, conv *Conversation) (tgbotapi.Chattable, error)
+
+	conversationFlow struct {
+		steps map[string]conversationStepHandler
+	}
+)
+
+var (
+	conversationFlows = map[string]*conversationFlow{
+		conversationFlowSendMoney: {
+			steps: map[string]conversationStepHandler{
+				conversationStepRecipient: sendMoneyRecipientStep,
+				conversationStepAmount:    sendMoneyAmountStep,
+				conversationStepConfirm:   sendMoneyConfirmStep,
+			},
+		},
+	}
+)
+
+func newConversation(flow string, step string, timeout time.Duration) *Conversation {
+	return &Conversation{
+		Flow:      flow,
+		Step:      step,
+		Data:      make(map[string]string),
+		ExpiresAt: time.Now().Add(timeout),
+	}
+}
+
+func (conv *Conversation) isExpired() bool {
+	return time.Now().After(conv.ExpiresAt)
+}
+
+func (conv *Conversation) isFinished() bool {
+	return conv.Step == ""
+}
+
+func (conv *Conversation) finish() {
+	conv.Step = ""
+}
+
+// activeConversation returns conversation of the message sender if there is one
+func (api *dndUtilBotApi) activeConversation(upd *tgbotapi.Update) (*Conversation, bool) {
+	conv, err := api.storage.GetConversation(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		if !errors.Is(err, ErrorNotFound) {
+			api.logger.Errorf("error while getting conversation %s", err)
+		}
+
+		return nil, false
+	}
+
+	return conv, true
+}
+
+func (api *dndUtilBotApi) startConversation(upd *tgbotapi.Update, conv *Conversation) error {
+	return api.storage.SaveConversation(upd.FromChat().ID, upd.SentFrom().ID, conv)
+}
+
+func (api *dndUtilBotApi) continueConversation(ctx context.Context, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	userId := upd.SentFrom().ID
+	conv, ok := api.activeConversation(upd)
+	if !ok {
+		return nil, nil
+	}
+
+	if conv.isExpired() {
+		err := api.storage.DeleteConversation(chatId, userId)
+		if err != nil {
+			return nil, fmt.Errorf("error during DeleteConversation %w", err)
+		}
+
+		return api.messageWithMainMenu(upd, messageConversationExpired), nil
+	}
+
+	flow, ok := conversationFlows[conv.Flow]
+	if !ok {
+		return nil, api.storage.DeleteConversation(chatId, userId)
+	}
+
+	step, ok := flow.steps[conv.Step]
+	if !ok {
+		return nil, api.storage.DeleteConversation(chatId, userId)
+	}
+
+	chattable, err := step(ctx, api, upd, conv)
+	if conv.isFinished() {
+		return chattable, errors.Join(err, api.storage.DeleteConversation(chatId, userId))
+	}
+
+	if err != nil {
+		return chattable, err
+	}
+
+	conv.ExpiresAt = time.Now().Add(api.currentSettings().ConversationTimeout)
+	return chattable, api.storage.SaveConversation(chatId, userId, conv)
+}
+
+func (api *dndUtilBotApi) cancelConversation(upd *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
+	err := api.storage.DeleteConversation(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during DeleteConversation %w", err)
+	}
+
+	return api.messageWithMainMenu(upd, messageConversationCanceled), nil
+}
+
+func (api *dndUtilBotApi) messageWithMainMenu(upd *tgbotapi.Update, text string) *tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, text)
+	msg.ReplyMarkup = mainMenu(api, upd)
+	return &msg
+}
+
+func (api *dndUtilBotApi) sendMoneyPrompt(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.startConversation(upd, newConversation(conversationFlowSendMoney, conversationStepRecipient, api.currentSettings().ConversationTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("error during starting conversation %w", err)
+	}
+
+	members, err := api.storage.GetChatMembers(upd.FromChat().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatMembers %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		messageConversationRecipientPrompt+fmt.Sprintf(messageSendMoneyPrompt, commandSendMoney.usage),
+	)
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	msg.ReplyMarkup = membersKeyboard(members, upd.SentFrom().ID)
+	return &msg, nil
+}
+
+func sendMoneyRecipientStep(_ context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, conv *Conversation) (tgbotapi.Chattable, error) {
+	toUserName := strings.TrimSpace(upd.Message.Text)
+	toId, ok := api.userIdByUserName(toUserName)
+	if ok {
+		ok, _ = api.storage.IsRegistered(upd.FromChat().ID, toId)
+	}
+
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageNotRegistered, toUserName))
+		return &msg, nil
+	}
+
+	if toId == upd.SentFrom().ID {
+		return nil, ErrorInvalidTransactionParameters
+	}
+
+	balance, err := api.storage.GetUserBalance(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetUserBalance %w", err)
+	}
+
+	conv.Data[conversationDataRecipient] = addAt(toUserName)
+	conv.Data[conversationDataRecipientId] = strconv.FormatInt(toId, 10)
+	conv.Step = conversationStepAmount
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		fmt.Sprintf(messageConversationAmountPrompt, conv.Data[conversationDataRecipient], balance),
+	)
+	msg.ReplyMarkup = cancelKeyboard()
+	return &msg, nil
+}
+
+func sendMoneyAmountStep(_ context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, conv *Conversation) (tgbotapi.Chattable, error) {
+	amount, err := parseAmount(strings.TrimSpace(upd.Message.Text))
+	if err != nil {
+		return nil, err
+	}
+
+	settings, err := api.storage.GetChatSettings(upd.FromChat().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatSettings %w", err)
+	}
+
+	balance, err := api.storage.GetUserBalance(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetUserBalance %w", err)
+	}
+
+	_, err = DebitBalance(balance, amount, settings.CreditLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	conv.Data[conversationDataAmount] = strconv.FormatInt(amount, 10)
+	conv.Step = conversationStepConfirm
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		fmt.Sprintf(messageConversationConfirmPrompt, amount, conv.Data[conversationDataRecipient]),
+	)
+	msg.ReplyMarkup = confirmKeyboard()
+	return &msg, nil
+}
+
+func sendMoneyConfirmStep(ctx context.Context, api *dndUtilBotApi, upd *tgbotapi.Update, conv *Conversation) (tgbotapi.Chattable, error) {
+	if strings.TrimSpace(upd.Message.Text) != conversationConfirmLabel {
+		msg := tgbotapi.NewMessage(
+			upd.FromChat().ID,
+			fmt.Sprintf(messageConversationConfirmHint, conversationConfirmLabel, commandCancelLabel),
+		)
+		msg.ReplyMarkup = confirmKeyboard()
+		return &msg, nil
+	}
+
+	toId, err := strconv.ParseInt(conv.Data[conversationDataRecipientId], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conversation recipient %w", err)
+	}
+
+	amount, err := strconv.ParseInt(conv.Data[conversationDataAmount], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid conversation amount %w", err)
+	}
+
+	chatId := upd.FromChat().ID
+	from := upd.SentFrom()
+	conv.finish()
+	// the conversation is deleted in the same transaction so the repeated confirmation can't send the coins twice
+	err = api.storage.WithTx(ctx, func(tx StorageTx) error {
+		stored, err := tx.GetConversation(chatId, from.ID)
+		if err != nil {
+			return err
+		}
+
+		if stored.Flow != conversationFlowSendMoney || stored.Step != conversationStepConfirm {
+			return ErrorNotFound
+		}
+
+		err = tx.DeleteConversation(chatId, from.ID)
+		if err != nil {
+			return err
+		}
+
+		return tx.TransferMoney(chatId, &MoneyTransfer{
+			Kind:    MoneyTransferKindSend,
+			FromId:  from.ID,
+			ToId:    toId,
+			ActorId: from.ID,
+			Amount:  amount,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during TransferMoney %w", err)
+	}
+
+	msg := api.messageSendMoney(upd, amount, from.UserName, conv.Data[conversationDataRecipient])
+	msg.ReplyMarkup = mainMenu(api, upd)
+	return msg, nil
+}
+
+func addAt(userName string) string {
+	return fmt.Sprintf("@%s", strings.TrimPrefix(userName, "@"))
+}
@@ -5,13 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Refreezer/dnd-util-bot/api/listener"
+	botLogging "github.com/Refreezer/dnd-util-bot/logging"
+	"github.com/Refreezer/dnd-util-bot/metrics"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/op/go-logging"
-	"math"
+	"io"
 	"math/rand"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -53,19 +57,137 @@ var (
 type (
 	DndUtilApi interface {
 		listener.UpdateHandler
+		SetSettings(settings *Settings)
 	}
 
 	ResourceProvider interface {
 		get(uri string) ([]byte, error)
 	}
 
+	// Storage runs every call in its own transaction, WithTx groups the calls into a single one
 	Storage interface {
-		MoveMoneyFromUserToUser(chatId int64, fromId int64, toId int64, amount uint) error
-		SetUserBalance(chatId int64, userId int64, amount uint) error
-		GetUserBalance(chatId int64, userId int64) (uint, error)
+		StorageTx
+		// WithTx runs fn in a single transaction which is committed when fn returns nil.
+		// fn has to return the error of any failed call, the changes made before the failure are rolled back only then.
+		// The transaction is rolled back if ctx is canceled. tx must not be used after fn returns
+		// and fn must not call the Storage itself since such calls wait for the transaction to end
+		WithTx(ctx context.Context, fn func(tx StorageTx) error) error
+	}
+
+	// StorageTx is the storage bound to the transaction of Storage.WithTx
+	StorageTx interface {
+		SetUserBalance(chatId int64, userId int64, amount int64) error
+		// CreditUsers atomically adds amounts coming from ExternalAccountId to the wallets and records them to the ledger,
+		// nothing is credited if any of the wallets fails
+		CreditUsers(chatId int64, kind string, actorId int64, credits []*Credit) error
+		GetUserBalance(chatId int64, userId int64) (int64, error)
 		GetIdByUserName(userName string) (userId int64, ok bool)
+		GetUserNameById(userId int64) (userName string, ok bool)
 		SaveUserNameToUserIdMapping(name string, id int64) error
 		IsRegistered(chatId int64, userId int64) (bool, error)
+		GetChatMembers(chatId int64) ([]*Member, error)
+		GetConversation(chatId int64, userId int64) (*Conversation, error)
+		SaveConversation(chatId int64, userId int64, conv *Conversation) error
+		DeleteConversation(chatId int64, userId int64) error
+		CharacterStorage
+		InventoryStorage
+		ShopStorage
+		QuestStorage
+		TreasuryStorage
+		ChatSettingsStorage
+		PendingTransferStorage
+		WealthStorage
+		ExportStorage
+	}
+
+	CharacterStorage interface {
+		CreateCharacter(chatId int64, character *Character) (characterId int64, err error)
+		GetCharacter(chatId int64, characterId int64) (*Character, error)
+		GetCharacters(chatId int64, userId int64) ([]*Character, error)
+		// UpdateCharacter atomically applies update to the stored character, nothing is saved if update fails
+		UpdateCharacter(chatId int64, characterId int64, update func(character *Character) error) error
+		DeleteCharacter(chatId int64, characterId int64) error
+		SetActiveCharacter(chatId int64, userId int64, characterId int64) error
+		GetActiveCharacter(chatId int64, userId int64) (*Character, error)
+		// GetActiveCharacters returns active characters of all the players of the chat
+		GetActiveCharacters(chatId int64) ([]*Character, error)
+		// UpdateChatCharacters atomically applies update to every character of the chat
+		UpdateChatCharacters(chatId int64, update func(character *Character) error) error
+	}
+
+	InventoryStorage interface {
+		// GetInventory returns inventory of the player, StashOwnerId is the owner of the party stash
+		GetInventory(chatId int64, ownerId int64) (*Inventory, error)
+		// MoveItem atomically moves items between inventories and records the transfer
+		MoveItem(chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error
+		SetItemQuantity(chatId int64, ownerId int64, item string, quantity int, actorId int64) error
+		// GetItemTransfers returns the latest transfers of the chat, newest first
+		GetItemTransfers(chatId int64, limit int) ([]*ItemTransfer, error)
+	}
+
+	ShopStorage interface {
+		// SaveShopItem adds the item to the shop catalog or replaces the item with the same ItemKey
+		SaveShopItem(chatId int64, item *ShopItem) error
+		DeleteShopItem(chatId int64, item string) error
+		GetShopItems(chatId int64) ([]*ShopItem, error)
+		// BuyItem atomically debits the wallet, decrements the stock and adds items to the inventory of the buyer
+		BuyItem(chatId int64, userId int64, item string, quantity int) (*ShopItem, error)
+	}
+
+	QuestStorage interface {
+		CreateQuest(chatId int64, quest *Quest) (questId int64, err error)
+		GetQuests(chatId int64) ([]*Quest, error)
+		// UpdateQuest atomically applies update to the stored quest, nothing is saved if update fails
+		UpdateQuest(chatId int64, questId int64, update func(quest *Quest) error) error
+		// CompleteQuest atomically applies complete to the stored quest and pays the returned amounts from the treasury
+		CompleteQuest(chatId int64, questId int64, complete func(quest *Quest) ([]*Credit, error)) error
+	}
+
+	TreasuryStorage interface {
+		GetTreasuryBalance(chatId int64) (int64, error)
+		// TransferMoney atomically moves coins between the accounts and records the transfer to the ledger
+		TransferMoney(chatId int64, transfer *MoneyTransfer) error
+		// GetMoneyTransfers returns the latest ledger records of the account, newest first
+		GetMoneyTransfers(chatId int64, accountId int64, limit int) ([]*MoneyTransfer, error)
+		// GetChatMoneyTransfers returns the latest ledger records of all the accounts of the chat, newest first
+		GetChatMoneyTransfers(chatId int64, limit int) ([]*MoneyTransfer, error)
+	}
+
+	ChatSettingsStorage interface {
+		// GetChatSettings returns the settings of the chat, zero settings if the chat has never changed them
+		GetChatSettings(chatId int64) (*ChatSettings, error)
+		SaveChatSettings(chatId int64, settings *ChatSettings) error
+	}
+
+	PendingTransferStorage interface {
+		CreatePendingTransfer(chatId int64, transfer *PendingTransfer) (transferId int64, err error)
+		GetPendingTransfer(chatId int64, transferId int64) (*PendingTransfer, error)
+		// TakePendingTransfer atomically deletes and returns the pending transfer, ErrorNotFound if it's already taken
+		TakePendingTransfer(chatId int64, transferId int64) (*PendingTransfer, error)
+		DeleteExpiredPendingTransfers(chatId int64, now time.Time) error
+	}
+
+	WealthStorage interface {
+		// GetChatWallets returns wallets of all the players of the chat, the treasury is not included
+		GetChatWallets(chatId int64) ([]*Wallet, error)
+		// GetAccountStats sums up the ledger records of the account
+		GetAccountStats(chatId int64, accountId int64) (*AccountStats, error)
+	}
+
+	ExportStorage interface {
+		// ExportChat returns everything stored for the chat, records are ordered by id
+		ExportChat(chatId int64) (*ChatData, error)
+		// ImportChat atomically replaces everything stored for the chat with the data keeping the ids,
+		// conversations and pending transfers of the chat are dropped
+		ImportChat(chatId int64, data *ChatData) error
+		// ChatIds returns the ids of all the chats with any data stored in ascending order
+		ChatIds() ([]int64, error)
+	}
+
+	// BackupStorage is implemented by the storages which can be saved to a file
+	BackupStorage interface {
+		// Backup writes a consistent snapshot of the storage
+		Backup(w io.Writer) (written int64, err error)
 	}
 
 	LoggerProvider interface {
@@ -78,8 +200,17 @@ type (
 		commands   *commands
 		storage    Storage
 		randomizer *rand.Rand
+		// randomizerMutex guards randomizer, updates are handled concurrently
+		randomizerMutex sync.Mutex
 		//resourceProvider ResourceProvider
 		botName string
+		// pendingImports are the imports waiting for the confirmation by chat id, guarded by pendingImportsMutex
+		pendingImports        map[int64]*pendingImport
+		pendingImportSequence int64
+		pendingImportsMutex   sync.Mutex
+		// ownerId is the telegram user allowed to get the db backups, nobody if zero
+		ownerId  int64
+		settings atomic.Pointer[Settings]
 	}
 )
 
@@ -88,6 +219,7 @@ func NewDndUtilApi(
 	loggerProvider LoggerProvider,
 	storage Storage,
 	botName string,
+	ownerId int64,
 ) DndUtilApi {
 	return newDndUtilApi(
 		tgBotApi,
@@ -95,6 +227,7 @@ func NewDndUtilApi(
 		storage,
 		//resourceProvider,
 		botName,
+		ownerId,
 	)
 }
 
@@ -103,24 +236,37 @@ func newDndUtilApi(
 	loggerProvider LoggerProvider,
 	storage Storage,
 	botName string,
+	ownerId int64,
 ) *dndUtilBotApi {
 	api := &dndUtilBotApi{
-		tgBotApi:   tgBotApi,
-		logger:     loggerProvider.MustGetLogger("dndUtilBotApi"),
-		storage:    storage,
-		randomizer: rand.New(rand.NewSource(time.Now().Unix())),
-		botName:    botName,
+		tgBotApi:       tgBotApi,
+		logger:         loggerProvider.MustGetLogger("dndUtilBotApi"),
+		storage:        storage,
+		randomizer:     rand.New(rand.NewSource(time.Now().Unix())),
+		botName:        botName,
+		ownerId:        ownerId,
+		pendingImports: make(map[int64]*pendingImport),
 		//resourceProvider: resourceProvider,
 	}
 
+	api.settings.Store(DefaultSettings())
 	api.commands = newCommands(api, chatTypeToCommandMap)
 	return api
 }
 
 func (api *dndUtilBotApi) HandleUpdate(ctx context.Context, upd *tgbotapi.Update) {
 	if upd.Message != nil {
-		api.handleUpdate(upd)
+		api.handleUpdate(ctx, upd)
+	} else if upd.CallbackQuery != nil {
+		api.handleCallbackQuery(ctx, upd)
 	}
+
+	api.log(ctx).Infof("update is handled")
+}
+
+// log returns the logger writing the update id, the chat, the user and the command of the update handled with ctx
+func (api *dndUtilBotApi) log(ctx context.Context) *logging.Logger {
+	return botLogging.FromContext(ctx, api.logger)
 }
 
 func validateUsernameIsNotHidden(upd *tgbotapi.Update) error {
@@ -131,16 +277,16 @@ func validateUsernameIsNotHidden(upd *tgbotapi.Update) error {
 	return nil
 }
 
-func (api *dndUtilBotApi) handleUpdate(upd *tgbotapi.Update) {
+func (api *dndUtilBotApi) handleUpdate(ctx context.Context, upd *tgbotapi.Update) {
 	if upd.Message == nil || upd.Message.From == nil {
 		return
 	}
 
 	from := upd.SentFrom()
-	api.registerWalletIfNeeded(upd.FromChat().ID, from)
+	api.registerWalletIfNeeded(ctx, upd.FromChat().ID, from)
 	switch upd.Message.Chat.Type {
 	case ChatTypeGroup, ChatTypeSuperGroup, ChatTypePrivate:
-		api.executeCommand(upd)
+		api.executeCommand(ctx, upd)
 		break
 	case ChatChannel: // not supported
 	default:
@@ -148,33 +294,59 @@ func (api *dndUtilBotApi) handleUpdate(upd *tgbotapi.Update) {
 	}
 }
 
-func (api *dndUtilBotApi) registerWalletIfNeeded(chatId int64, from *tgbotapi.User) {
-	_, mappingRegistered := api.getIdByUserNameSanitized(from.UserName)
-	if !mappingRegistered {
-		err := api.storage.SaveUserNameToUserIdMapping(from.UserName, from.ID)
-		if err != nil {
-			api.logger.Errorf("couldn't save user id mapping for %+v", from)
-		}
-	}
+// registerWalletIfNeeded opens the empty wallet, the registration checks the wallet again in the transaction
+// so the coins received by the user in between aren't reset
+func (api *dndUtilBotApi) registerWalletIfNeeded(ctx context.Context, chatId int64, from *tgbotapi.User) {
+	api.saveUserNameMappingIfNeeded(ctx, from)
 
 	isRegistered, err := api.storage.IsRegistered(chatId, from.ID)
 	if err != nil {
-		api.logger.Errorf("couldn't know if user is registered for chatID=%d username=%s", chatId, from.UserName)
+		api.log(ctx).Errorf("couldn't know if user is registered for chatID=%d username=%s: %s", chatId, from.UserName, err)
+		return
 	}
 
 	if isRegistered {
 		return
 	}
 
-	err = api.storage.SetUserBalance(chatId, from.ID, 0)
+	err = api.storage.WithTx(ctx, func(tx StorageTx) error {
+		isRegistered, err := tx.IsRegistered(chatId, from.ID)
+		if err != nil || isRegistered {
+			return err
+		}
+
+		return tx.SetUserBalance(chatId, from.ID, 0)
+	})
+	if err != nil {
+		api.log(ctx).Errorf("couldn't register wallet for %v: %s", from, err)
+	}
+}
+
+func (api *dndUtilBotApi) saveUserNameMappingIfNeeded(ctx context.Context, from *tgbotapi.User) {
+	if from.UserName == "" {
+		return
+	}
+
+	_, mappingRegistered := api.getIdByUserNameSanitized(from.UserName)
+	userName, reverseMappingRegistered := api.storage.GetUserNameById(from.ID)
+	if mappingRegistered && reverseMappingRegistered && userName == from.UserName {
+		return
+	}
+
+	err := api.storage.SaveUserNameToUserIdMapping(from.UserName, from.ID)
 	if err != nil {
-		api.logger.Errorf("couldn't set balance for %v", from)
+		api.log(ctx).Errorf("couldn't save user id mapping for %+v", from)
 	}
 }
 
-func (api *dndUtilBotApi) executeCommand(upd *tgbotapi.Update) {
+func (api *dndUtilBotApi) executeCommand(ctx context.Context, upd *tgbotapi.Update) {
 	cmd := api.commands.Resolve(upd)
-	err := cmd.Build(api).Execute(upd)
+	if fields, ok := botLogging.FieldsFromContext(ctx); ok {
+		fields.Command = cmd.commandKey
+	}
+
+	err := cmd.Build(api).Execute(ctx, upd)
+	metrics.CommandsExecuted.WithLabelValues(cmd.commandKey, ErrorCode(err)).Inc()
 	if err == nil {
 		return
 	}
@@ -188,12 +360,34 @@ func (api *dndUtilBotApi) executeCommand(upd *tgbotapi.Update) {
 		msg = markdownMessage(chatID, messageId, errorMessageInvalidIntegerParameter)
 	} else if errors.Is(err, ErrorInvalidTransactionParameters) {
 		msg = markdownMessage(chatID, messageId, errorMessageInvalidTransactionParameters)
+	} else if errors.Is(err, ErrorInsufficientTreasury) {
+		msg = markdownMessage(chatID, messageId, errorMessageInsufficientTreasury)
 	} else if errors.Is(err, ErrorInsufficientMoney) {
 		msg = markdownMessage(chatID, messageId, errorMessageInsufficientPounds)
 	} else if errors.Is(err, ErrorBalanceOverflow) {
 		msg = markdownMessage(chatID, messageId, errorMessageBalanceOverflow)
 	} else if errors.Is(err, ErrorUsernameHidden) {
 		msg = markdownMessage(chatID, messageId, messageUsernameHidden)
+	} else if errors.Is(err, ErrorNoCharacter) {
+		msg = markdownMessage(chatID, messageId, errorMessageNoCharacter)
+	} else if errors.Is(err, ErrorNotFound) {
+		msg = markdownMessage(chatID, messageId, errorMessageNotFound)
+	} else if errors.Is(err, ErrorRightsViolation) {
+		msg = markdownMessage(chatID, messageId, tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, messageRejectedRightsViolation))
+	} else if errors.Is(err, ErrorCharacterDead) {
+		msg = markdownMessage(chatID, messageId, errorMessageCharacterDead)
+	} else if errors.Is(err, ErrorNotDying) {
+		msg = markdownMessage(chatID, messageId, errorMessageNotDying)
+	} else if errors.Is(err, ErrorNotEnoughItems) {
+		msg = markdownMessage(chatID, messageId, errorMessageNotEnoughItems)
+	} else if errors.Is(err, ErrorItemQuantityOverflow) {
+		msg = markdownMessage(chatID, messageId, errorMessageItemQuantityOverflow)
+	} else if errors.Is(err, ErrorOutOfStock) {
+		msg = markdownMessage(chatID, messageId, errorMessageOutOfStock)
+	} else if errors.Is(err, ErrorQuestNotActive) {
+		msg = markdownMessage(chatID, messageId, errorMessageQuestNotActive)
+	} else if errors.Is(err, ErrorNotRegistered) {
+		msg = markdownMessage(chatID, messageId, errorMessageNotRegistered)
 	}
 
 	if msg == nil {
@@ -202,7 +396,7 @@ func (api *dndUtilBotApi) executeCommand(upd *tgbotapi.Update) {
 
 	_, err = api.tgBotApi.Send(msg)
 	if err != nil {
-		api.logger.Errorf("couldn't send reply error message %s", err)
+		api.log(ctx).Errorf("couldn't send reply error message %s", err)
 	}
 }
 
@@ -226,7 +420,11 @@ func (api *dndUtilBotApi) isRelatedMemberAdmin(upd *tgbotapi.Update) (bool, erro
 		return true, nil
 	}
 
-	member, err := api.getMember(upd.Message.Chat.ID, upd.Message.From.ID)
+	return api.isChatAdmin(upd.Message.Chat.ID, upd.Message.From.ID)
+}
+
+func (api *dndUtilBotApi) isChatAdmin(chatId int64, userId int64) (bool, error) {
+	member, err := api.getMember(chatId, userId)
 	if err != nil {
 		return false, err
 	}
@@ -262,15 +460,15 @@ func (api *dndUtilBotApi) getIdByUserNameSanitized(userName string) (int64, bool
 	return uid, ok
 }
 
-func (api *dndUtilBotApi) Transaction(upd *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
+func (api *dndUtilBotApi) Transaction(ctx context.Context, upd *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	params := api.getParams(upd.Message.Text)
 	if len(params) < 4 {
 		return nil, ErrorInvalidParameters
 	}
 
-	amount, err := strconv.Atoi(params[3])
-	if err != nil || amount <= 0 {
-		return nil, ErrorInvalidIntegerParameter
+	amount, err := parseAmount(params[3])
+	if err != nil {
+		return nil, err
 	}
 
 	from := params[1]
@@ -299,34 +497,71 @@ func (api *dndUtilBotApi) Transaction(upd *tgbotapi.Update) (*tgbotapi.MessageCo
 		return nil, ErrorInvalidTransactionParameters
 	}
 
+	// the balances are checked and the coins are moved in one transaction so a concurrent transfer
+	// can't spend the coins in between
 	chatId := upd.FromChat().ID
-	fromBalance, err := api.storage.GetUserBalance(chatId, fromId)
-	if err == nil && fromBalance < uint(amount) {
-		return markdownMessage(
-			chatId,
-			upd.Message.MessageID,
-			fmt.Sprintf(
-				errorMessageInsufficientPoundsInUserWallet,
-				from,
-			),
-		), nil
-	}
+	var msg *tgbotapi.MessageConfig
+	var pending *PendingTransfer
+	err = api.storage.WithTx(ctx, func(tx StorageTx) error {
+		err := checkTransaction(tx, chatId, fromId, toId, amount)
+		if errors.Is(err, ErrorInsufficientMoney) {
+			msg = markdownMessage(
+				chatId,
+				upd.Message.MessageID,
+				fmt.Sprintf(
+					errorMessageInsufficientPoundsInUserWallet,
+					from,
+				),
+			)
+			return nil
+		}
+
+		if errors.Is(err, ErrorBalanceOverflow) {
+			msg = markdownMessage(chatId, upd.Message.MessageID, errorMessageBalanceOverflow)
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		pending, err = requestConfirmation(tx, chatId, &PendingTransfer{
+			Kind:    PendingTransferKindTransaction,
+			FromId:  fromId,
+			ToId:    toId,
+			ActorId: upd.SentFrom().ID,
+			Amount:  amount,
+		}, api.currentSettings().PendingTransferTimeout)
+		if err != nil || pending != nil {
+			return err
+		}
 
-	toBalance, err := api.storage.GetUserBalance(chatId, toId)
-	if err == nil && toBalance > math.MaxUint32-uint(amount) {
-		return markdownMessage(chatId, upd.Message.MessageID, errorMessageBalanceOverflow), nil
+		err = tx.TransferMoney(chatId, &MoneyTransfer{
+			Kind:    MoneyTransferKindTransaction,
+			FromId:  fromId,
+			ToId:    toId,
+			ActorId: upd.SentFrom().ID,
+			Amount:  amount,
+		})
+		if err != nil {
+			return fmt.Errorf("error during TransferMoney %w", err)
+		}
+
+		return nil
+	})
+	if err != nil || msg != nil {
+		return msg, err
 	}
 
-	err = api.storage.MoveMoneyFromUserToUser(chatId, fromId, toId, uint(amount))
-	if err != nil {
-		return nil, fmt.Errorf("error during MoveMoneyFromUserToUser %w", err)
+	if pending != nil {
+		return api.messagePendingTransfer(chatId, pending), nil
 	}
 
 	return api.messageSendMoney(upd, amount, from, to), nil
 }
 
 func (api *dndUtilBotApi) getParams(text string) []string {
-	params := strings.Split(text, " ")
+	params := splitParams(text)
 	params = slices.DeleteFunc(params, func(s string) bool {
 		return api.botName == s ||
 			(len(s) > 0 && s[0] == '@' && s[1:] == api.botName) ||
@@ -336,14 +571,50 @@ func (api *dndUtilBotApi) getParams(text string) []string {
 	return params
 }
 
+// splitParams splits text by spaces, text in quotes "..." or «...» is kept as a single parameter
+func splitParams(text string) []string {
+	params := make([]string, 0)
+	var sb strings.Builder
+	var closingQuote rune
+	quoted := false
+	for _, r := range text {
+		switch {
+		case closingQuote == 0 && (r == '"' || r == '«'):
+			closingQuote = '"'
+			if r == '«' {
+				closingQuote = '»'
+			}
+
+			quoted = true
+		case closingQuote != 0 && r == closingQuote:
+			closingQuote = 0
+		case closingQuote == 0 && r == ' ':
+			if sb.Len() > 0 || quoted {
+				params = append(params, sb.String())
+			}
+
+			sb.Reset()
+			quoted = false
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	if sb.Len() > 0 || quoted {
+		params = append(params, sb.String())
+	}
+
+	return params
+}
+
 func (api *dndUtilBotApi) setUserBalance(upd *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	params := api.getParams(upd.Message.Text)
 	if len(params) < 3 {
 		return nil, ErrorInvalidParameters
 	}
 
-	amount, err := strconv.Atoi(params[2])
-	if err != nil || amount < 0 {
+	amount, err := strconv.ParseInt(params[2], 10, 64)
+	if err != nil || ValidateBalance(amount) != nil {
 		return nil, ErrorInvalidIntegerParameter
 	}
 
@@ -358,9 +629,9 @@ func (api *dndUtilBotApi) setUserBalance(upd *tgbotapi.Update) (*tgbotapi.Messag
 		return &msg, nil
 	}
 
-	err = api.storage.SetUserBalance(upd.FromChat().ID, userId, uint(amount))
+	err = SetBalance(api.storage, upd.FromChat().ID, userId, amount)
 	if err != nil {
-		return nil, fmt.Errorf("error during setUserBalance %w", err)
+		return nil, err
 	}
 
 	msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageSetUserBalanceSuccess, userName, amount))
@@ -398,7 +669,10 @@ func (api *dndUtilBotApi) throwDice(upd *tgbotapi.Update) (*tgbotapi.StickerConf
 }
 
 func (api *dndUtilBotApi) stickerThrowDice(upd *tgbotapi.Update) (*tgbotapi.StickerConfig, error) {
-	d20 := api.randomizer.Intn(20) + 1
+	return api.stickerD20(upd, api.rollDie(d20Sides))
+}
+
+func (api *dndUtilBotApi) stickerD20(upd *tgbotapi.Update, d20 int) (*tgbotapi.StickerConfig, error) {
 	emoji, ok := d20NumToEmojiMap[d20]
 	if !ok {
 		return nil, fmt.Errorf("error getting d20 emoji mapping")
@@ -437,7 +711,7 @@ func (api *dndUtilBotApi) getBalance(upd *tgbotapi.Update) (*tgbotapi.MessageCon
 	return api.messageGetUserBalanceSuccess(upd, balance), nil
 }
 
-func (api *dndUtilBotApi) messageGetUserBalanceSuccess(upd *tgbotapi.Update, balance uint) *tgbotapi.MessageConfig {
+func (api *dndUtilBotApi) messageGetUserBalanceSuccess(upd *tgbotapi.Update, balance int64) *tgbotapi.MessageConfig {
 	msg := tgbotapi.NewMessage(
 		upd.Message.Chat.ID,
 		fmt.Sprintf(messageGetUserBalanceSuccess, upd.SentFrom().UserName, balance),
@@ -446,7 +720,7 @@ func (api *dndUtilBotApi) messageGetUserBalanceSuccess(upd *tgbotapi.Update, bal
 	return &msg
 }
 
-func (api *dndUtilBotApi) sendMoney(upd *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
+func (api *dndUtilBotApi) sendMoney(ctx context.Context, upd *tgbotapi.Update) (*tgbotapi.MessageConfig, error) {
 	err := validateUsernameIsNotHidden(upd)
 	if err != nil {
 		return nil, err
@@ -457,9 +731,9 @@ func (api *dndUtilBotApi) sendMoney(upd *tgbotapi.Update) (*tgbotapi.MessageConf
 		return nil, ErrorInvalidParameters
 	}
 
-	amount, err := strconv.Atoi(params[2])
-	if err != nil || amount <= 0 {
-		return nil, ErrorInvalidIntegerParameter
+	amount, err := parseAmount(params[2])
+	if err != nil {
+		return nil, err
 	}
 
 	from := upd.SentFrom()
@@ -479,15 +753,45 @@ func (api *dndUtilBotApi) sendMoney(upd *tgbotapi.Update) (*tgbotapi.MessageConf
 		return nil, ErrorInvalidTransactionParameters
 	}
 
-	err = api.storage.MoveMoneyFromUserToUser(upd.FromChat().ID, fromId, toId, uint(amount))
+	chatId := upd.FromChat().ID
+	var pending *PendingTransfer
+	err = api.storage.WithTx(ctx, func(tx StorageTx) error {
+		pending, err = requestConfirmation(tx, chatId, &PendingTransfer{
+			Kind:    PendingTransferKindSend,
+			FromId:  fromId,
+			ToId:    toId,
+			ActorId: fromId,
+			Amount:  amount,
+		}, api.currentSettings().PendingTransferTimeout)
+		if err != nil || pending != nil {
+			return err
+		}
+
+		err = tx.TransferMoney(chatId, &MoneyTransfer{
+			Kind:    MoneyTransferKindSend,
+			FromId:  fromId,
+			ToId:    toId,
+			ActorId: fromId,
+			Amount:  amount,
+		})
+		if err != nil {
+			return fmt.Errorf("error during TransferMoney %w", err)
+		}
+
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error during MoveMoneyFromUserToUser %w", err)
+		return nil, err
+	}
+
+	if pending != nil {
+		return api.messagePendingTransfer(chatId, pending), nil
 	}
 
 	return api.messageSendMoney(upd, amount, from.UserName, toUserName), nil
 }
 
-func (api *dndUtilBotApi) messageSendMoney(upd *tgbotapi.Update, amount int, fromUserName string, toUserName string) *tgbotapi.MessageConfig {
+func (api *dndUtilBotApi) messageSendMoney(upd *tgbotapi.Update, amount int64, fromUserName string, toUserName string) *tgbotapi.MessageConfig {
 	msg := tgbotapi.NewMessage(
 		upd.FromChat().ID,
 		fmt.Sprintf(
@@ -516,9 +820,3 @@ func (api *dndUtilBotApi) start(upd *tgbotapi.Update) (*tgbotapi.MessageConfig,
 	msg := tgbotapi.NewMessage(chat.ID, fmt.Sprintf(messageStart, balance))
 	return &msg, nil
 }
-
-func (api *dndUtilBotApi) sendMoneyPrompt(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
-	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageSendMoneyPrompt, commandSendMoney.usage))
-	msg.ParseMode = tgbotapi.ModeMarkdownV2
-	return &msg, nil
-}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"time"
+)
+
+const (
+	// ChatDataVersion is the version of the export format, bump it on incompatible changes
+	ChatDataVersion = 1
+
+	exportFormatJson     = "json"
+	exportFormatCsv      = "csv"
+	exportFileNameLayout = "20060102-150405"
+	csvRecordWallet      = "wallet"
+	csvRecordTransfer    = "transfer"
+)
+
+var (
+	csvHeader = []string{
+		"record", "account_id", "account", "balance",
+		"transfer_id", "time", "kind", "from_id", "to_id", "actor_id", "amount",
+	}
+)
+
+type (
+	// ChatData is everything the bot stores for the chat except the transient conversations and pending transfers
+	ChatData struct {
+		Version          int                `json:"version"`
+		ChatId           int64              `json:"chatId"`
+		ExportedAt       time.Time          `json:"exportedAt"`
+		Settings         *ChatSettings      `json:"settings"`
+		Treasury         int64              `json:"treasury"`
+		Wallets          []*Wallet          `json:"wallets"`
+		UserNames        map[int64]string   `json:"userNames,omitempty"`
+		Characters       []*Character       `json:"characters"`
+		ActiveCharacters []*ActiveCharacter `json:"activeCharacters"`
+		Inventories      []*OwnedInventory  `json:"inventories"`
+		ShopItems        []*ShopItem        `json:"shopItems"`
+		Quests           []*Quest           `json:"quests"`
+		MoneyTransfers   []*MoneyTransfer   `json:"moneyTransfers"`
+		ItemTransfers    []*ItemTransfer    `json:"itemTransfers"`
+	}
+
+	ActiveCharacter struct {
+		UserId      int64 `json:"userId"`
+		CharacterId int64 `json:"characterId"`
+	}
+
+	// OwnedInventory is the inventory of the player, StashOwnerId owns the party stash
+	OwnedInventory struct {
+		OwnerId int64 `json:"ownerId"`
+		Inventory
+	}
+)
+
+// Validate checks the data can be stored as is, the error tells the first problem found
+func (data *ChatData) Validate() error {
+	if data.Version != ChatDataVersion {
+		return fmt.Errorf("unsupported version %d", data.Version)
+	}
+
+	if data.Settings == nil {
+		data.Settings = new(ChatSettings)
+	}
+
+	if data.Settings.CreditLimit < 0 || data.Settings.CreditLimit > MaxBalance ||
+		data.Settings.SendConfirmThreshold < 0 || data.Settings.TransactionConfirmThreshold < 0 {
+		return fmt.Errorf("invalid settings")
+	}
+
+	if data.Treasury < 0 || data.Treasury > MaxBalance {
+		return fmt.Errorf("invalid treasury %d", data.Treasury)
+	}
+
+	wallets := make(map[int64]bool, len(data.Wallets))
+	for _, wallet := range data.Wallets {
+		if wallet.UserId == TreasuryAccountId || wallet.UserId == ExternalAccountId || wallets[wallet.UserId] {
+			return fmt.Errorf("invalid wallet %d", wallet.UserId)
+		}
+
+		if wallet.Balance < -MaxBalance || wallet.Balance > MaxBalance {
+			return fmt.Errorf("invalid balance %d of %d", wallet.Balance, wallet.UserId)
+		}
+
+		wallets[wallet.UserId] = true
+	}
+
+	characterOwners := make(map[int64]int64, len(data.Characters))
+	for _, character := range data.Characters {
+		_, duplicate := characterOwners[character.Id]
+		if character.Id <= 0 || duplicate || !wallets[character.OwnerId] {
+			return fmt.Errorf("invalid character %d", character.Id)
+		}
+
+		characterOwners[character.Id] = character.OwnerId
+	}
+
+	for _, active := range data.ActiveCharacters {
+		ownerId, ok := characterOwners[active.CharacterId]
+		if !ok || ownerId != active.UserId {
+			return fmt.Errorf("invalid active character %d of %d", active.CharacterId, active.UserId)
+		}
+	}
+
+	owners := make(map[int64]bool, len(data.Inventories))
+	for _, inventory := range data.Inventories {
+		if owners[inventory.OwnerId] || (inventory.OwnerId != StashOwnerId && !wallets[inventory.OwnerId]) {
+			return fmt.Errorf("invalid inventory owner %d", inventory.OwnerId)
+		}
+
+		owners[inventory.OwnerId] = true
+		items := make(map[string]bool, len(inventory.Items))
+		for _, item := range inventory.Items {
+			key := ItemKey(item.Name)
+			if key == "" || items[key] || item.Quantity <= 0 || item.Quantity > ItemMaxQuantity {
+				return fmt.Errorf("invalid item %q of %d", item.Name, inventory.OwnerId)
+			}
+
+			items[key] = true
+		}
+	}
+
+	shopItems := make(map[string]bool, len(data.ShopItems))
+	for _, item := range data.ShopItems {
+		key := ItemKey(item.Name)
+		if key == "" || shopItems[key] || item.Price < 0 || item.Price > MaxBalance || item.Stock < ShopUnlimitedStock {
+			return fmt.Errorf("invalid shop item %q", item.Name)
+		}
+
+		shopItems[key] = true
+	}
+
+	quests := make(map[int64]bool, len(data.Quests))
+	for _, quest := range data.Quests {
+		_, knownState := questStateLabels[quest.State]
+		if quest.Id <= 0 || quests[quest.Id] || !knownState || quest.Reward < 0 || quest.Reward > MaxBalance {
+			return fmt.Errorf("invalid quest %d", quest.Id)
+		}
+
+		quests[quest.Id] = true
+	}
+
+	moneyTransfers := make(map[int64]bool, len(data.MoneyTransfers))
+	for _, transfer := range data.MoneyTransfers {
+		if transfer.Id <= 0 || moneyTransfers[transfer.Id] || transfer.Amount <= 0 || transfer.Amount > MaxBalance {
+			return fmt.Errorf("invalid ledger record %d", transfer.Id)
+		}
+
+		moneyTransfers[transfer.Id] = true
+	}
+
+	itemTransfers := make(map[int64]bool, len(data.ItemTransfers))
+	for _, transfer := range data.ItemTransfers {
+		if transfer.Id <= 0 || itemTransfers[transfer.Id] {
+			return fmt.Errorf("invalid item transfer %d", transfer.Id)
+		}
+
+		itemTransfers[transfer.Id] = true
+	}
+
+	return nil
+}
+
+func (data *ChatData) totalCoins() int64 {
+	var total int64
+	for _, wallet := range data.Wallets {
+		total += wallet.Balance
+	}
+
+	return total
+}
+
+func (data *ChatData) totalItems() int {
+	var total int
+	for _, inventory := range data.Inventories {
+		for _, item := range inventory.Items {
+			total += item.Quantity
+		}
+	}
+
+	return total
+}
+
+// export handles `/export [json|csv]`, sends everything stored for the chat or the balances and the ledger as a document
+func (api *dndUtilBotApi) export(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	format := exportFormatJson
+	params := api.getParams(upd.Message.Text)
+	if len(params) > 1 {
+		format = params[1]
+	}
+
+	if format != exportFormatJson && format != exportFormatCsv {
+		return nil, ErrorInvalidParameters
+	}
+
+	chatId := upd.FromChat().ID
+	data, err := api.storage.ExportChat(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during ExportChat %w", err)
+	}
+
+	data.Version = ChatDataVersion
+	data.ChatId = chatId
+	data.ExportedAt = time.Now()
+	data.UserNames = make(map[int64]string, len(data.Wallets))
+	for _, wallet := range data.Wallets {
+		userName, ok := api.storage.GetUserNameById(wallet.UserId)
+		if ok {
+			data.UserNames[wallet.UserId] = userName
+		}
+	}
+
+	var file []byte
+	if format == exportFormatJson {
+		file, err = json.MarshalIndent(data, "", "  ")
+	} else {
+		file, err = exportCsv(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := tgbotapi.NewDocument(chatId, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("dndUtil-%d-%s.%s", chatId, data.ExportedAt.Format(exportFileNameLayout), format),
+		Bytes: file,
+	})
+	doc.Caption = fmt.Sprintf(messageExportCaption, len(data.Wallets), len(data.MoneyTransfers))
+	return &doc, nil
+}
+
+// exportCsv writes the wallets including the treasury and then the ledger records
+func exportCsv(data *ChatData) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	formatInt := func(v int64) string {
+		return strconv.FormatInt(v, 10)
+	}
+
+	records := [][]string{csvHeader, {csvRecordWallet, formatInt(TreasuryAccountId), messageTreasuryName, formatInt(data.Treasury)}}
+	for _, wallet := range data.Wallets {
+		records = append(records, []string{csvRecordWallet, formatInt(wallet.UserId), data.UserNames[wallet.UserId], formatInt(wallet.Balance)})
+	}
+
+	for _, transfer := range data.MoneyTransfers {
+		records = append(records, []string{
+			csvRecordTransfer, "", "", "",
+			formatInt(transfer.Id),
+			transfer.Time.Format(time.RFC3339),
+			transfer.Kind,
+			formatInt(transfer.FromId),
+			formatInt(transfer.ToId),
+			formatInt(transfer.ActorId),
+			formatInt(transfer.Amount),
+		})
+	}
+
+	for _, record := range records {
+		for len(record) < len(csvHeader) {
+			record = append(record, "")
+		}
+
+		err := w.Write(record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,86 @@
+package api
+
+import "testing"
+
+// validChatData has one record of every kind, the test cases break one of them
+func validChatData() *ChatData {
+	return &ChatData{
+		Version:          ChatDataVersion,
+		Settings:         &ChatSettings{CreditLimit: 100},
+		Treasury:         50,
+		Wallets:          []*Wallet{{UserId: 10, Balance: 20}, {UserId: 11, Balance: -5}},
+		Characters:       []*Character{{Id: 1, OwnerId: 10}},
+		ActiveCharacters: []*ActiveCharacter{{UserId: 10, CharacterId: 1}},
+		Inventories: []*OwnedInventory{
+			{OwnerId: StashOwnerId, Inventory: Inventory{Items: []*InventoryItem{{Name: "Rope", Quantity: 1}}}},
+			{OwnerId: 11, Inventory: Inventory{Items: []*InventoryItem{{Name: "Torch", Quantity: 3}}}},
+		},
+		ShopItems:      []*ShopItem{{Name: "Potion", Price: 50, Stock: ShopUnlimitedStock}},
+		Quests:         []*Quest{{Id: 1, Title: "Rats", Reward: 3, State: QuestStateOpen}},
+		MoneyTransfers: []*MoneyTransfer{{Id: 1, Amount: 5}},
+		ItemTransfers:  []*ItemTransfer{{Id: 1}},
+	}
+}
+
+func TestChatDataValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(data *ChatData)
+		expected string
+	}{
+		{"valid", func(data *ChatData) {}, ""},
+		{"missing settings", func(data *ChatData) { data.Settings = nil }, ""},
+		{"unsupported version", func(data *ChatData) { data.Version = ChatDataVersion + 1 }, "unsupported version 2"},
+		{"negative credit limit", func(data *ChatData) { data.Settings.CreditLimit = -1 }, "invalid settings"},
+		{"negative confirm threshold", func(data *ChatData) { data.Settings.SendConfirmThreshold = -1 }, "invalid settings"},
+		{"negative treasury", func(data *ChatData) { data.Treasury = -1 }, "invalid treasury -1"},
+		{"treasury wallet", func(data *ChatData) {
+			data.Wallets = append(data.Wallets, &Wallet{UserId: TreasuryAccountId})
+		}, "invalid wallet 0"},
+		{"external wallet", func(data *ChatData) {
+			data.Wallets = append(data.Wallets, &Wallet{UserId: ExternalAccountId})
+		}, "invalid wallet -1"},
+		{"duplicate wallet", func(data *ChatData) {
+			data.Wallets = append(data.Wallets, &Wallet{UserId: 10})
+		}, "invalid wallet 10"},
+		{"balance above max", func(data *ChatData) { data.Wallets[0].Balance = MaxBalance + 1 }, "invalid balance 1000000000001 of 10"},
+		{"character of unknown owner", func(data *ChatData) { data.Characters[0].OwnerId = 12 }, "invalid character 1"},
+		{"duplicate character", func(data *ChatData) {
+			data.Characters = append(data.Characters, &Character{Id: 1, OwnerId: 11})
+		}, "invalid character 1"},
+		{"active character of other owner", func(data *ChatData) { data.ActiveCharacters[0].UserId = 11 }, "invalid active character 1 of 11"},
+		{"active character unknown", func(data *ChatData) { data.ActiveCharacters[0].CharacterId = 2 }, "invalid active character 2 of 10"},
+		{"inventory of unknown owner", func(data *ChatData) { data.Inventories[1].OwnerId = 12 }, "invalid inventory owner 12"},
+		{"duplicate inventory", func(data *ChatData) { data.Inventories[1].OwnerId = StashOwnerId }, "invalid inventory owner 0"},
+		{"duplicate item", func(data *ChatData) {
+			items := &data.Inventories[0].Items
+			*items = append(*items, &InventoryItem{Name: "rope", Quantity: 2})
+		}, `invalid item "rope" of 0`},
+		{"zero quantity", func(data *ChatData) { data.Inventories[1].Items[0].Quantity = 0 }, `invalid item "Torch" of 11`},
+		{"negative price", func(data *ChatData) { data.ShopItems[0].Price = -1 }, `invalid shop item "Potion"`},
+		{"unknown quest state", func(data *ChatData) { data.Quests[0].State = "lost" }, "invalid quest 1"},
+		{"duplicate ledger record", func(data *ChatData) {
+			data.MoneyTransfers = append(data.MoneyTransfers, &MoneyTransfer{Id: 1, Amount: 1})
+		}, "invalid ledger record 1"},
+		{"zero ledger amount", func(data *ChatData) { data.MoneyTransfers[0].Amount = 0 }, "invalid ledger record 1"},
+		{"item transfer without id", func(data *ChatData) { data.ItemTransfers[0].Id = 0 }, "invalid item transfer 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := validChatData()
+			test.change(data)
+			err := data.Validate()
+			if test.expected == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %s", err)
+				}
+
+				return
+			}
+
+			if err == nil || err.Error() != test.expected {
+				t.Fatalf("expected error %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
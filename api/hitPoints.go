@@ -0,0 +1,504 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	deathSavesToStabilize = 3
+	deathSavesToDie       = 3
+	deathSaveDifficulty   = 10
+	conditionRemovePrefix = "-"
+	conditionMaxCount     = 20
+	conditionMaxRounds    = 1000
+)
+
+var (
+	conditionLabels = map[string]string{
+		"blinded":       "Ослеплён",
+		"charmed":       "Очарован",
+		"deafened":      "Оглушён",
+		"frightened":    "Испуган",
+		"grappled":      "Схвачен",
+		"incapacitated": "Недееспособен",
+		"invisible":     "Невидим",
+		"paralyzed":     "Парализован",
+		"petrified":     "Окаменел",
+		"poisoned":      "Отравлен",
+		"prone":         "Сбит с ног",
+		"restrained":    "Опутан",
+		"stunned":       "Ошеломлён",
+		"unconscious":   "Без сознания",
+		"exhaustion":    "Истощение",
+	}
+)
+
+type (
+	// Condition lasts Rounds rounds, zero rounds means until removed manually
+	Condition struct {
+		Name   string `json:"name"`
+		Rounds int    `json:"rounds"`
+	}
+
+	DeathSaves struct {
+		Successes int `json:"successes"`
+		Failures  int `json:"failures"`
+	}
+
+	// hpChange is applied to the target character within UpdateCharacter
+	hpChange func(character *Character) (string, error)
+)
+
+func (c *Character) isDying() bool {
+	return c.CurrentHp == 0 && !c.isDead() && !c.isStable()
+}
+
+func (c *Character) isDead() bool {
+	return c.CurrentHp == 0 && c.DeathSaves.Failures >= deathSavesToDie
+}
+
+func (c *Character) isStable() bool {
+	return c.CurrentHp == 0 && c.DeathSaves.Successes >= deathSavesToStabilize
+}
+
+// takeDamage spends temporary hit points first, damage at 0 hp is the failed death save
+func (c *Character) takeDamage(damage int) string {
+	absorbed := min(c.TempHp, damage)
+	c.TempHp -= absorbed
+	damage -= absorbed
+	if damage == 0 {
+		return messageHpDamageAbsorbed
+	}
+
+	if c.CurrentHp == 0 {
+		c.DeathSaves.Failures = min(c.DeathSaves.Failures+1, deathSavesToDie)
+		c.DeathSaves.Successes = 0
+		if c.isDead() {
+			return messageHpDied
+		}
+
+		return messageHpDeathSaveFailed
+	}
+
+	overflow := damage - c.CurrentHp
+	c.CurrentHp = max(c.CurrentHp-damage, 0)
+	if c.CurrentHp > 0 {
+		return ""
+	}
+
+	c.DeathSaves = DeathSaves{}
+	if overflow >= c.MaxHp {
+		c.DeathSaves.Failures = deathSavesToDie
+		return messageHpDied
+	}
+
+	return messageHpFellUnconscious
+}
+
+func (c *Character) heal(amount int) (string, error) {
+	if c.isDead() {
+		return "", ErrorCharacterDead
+	}
+
+	wasDown := c.CurrentHp == 0
+	c.CurrentHp = min(c.CurrentHp+amount, c.MaxHp)
+	if wasDown && c.CurrentHp > 0 {
+		c.DeathSaves = DeathSaves{}
+		return messageHpRegainedConsciousness, nil
+	}
+
+	return "", nil
+}
+
+func (c *Character) setTempHp(amount int) {
+	c.TempHp = max(c.TempHp, amount)
+}
+
+// rollDeathSave applies the d20 result: 20 regains 1 hp, 1 counts as two failures
+func (c *Character) rollDeathSave(d20 int) string {
+	switch {
+	case d20 == d20Sides:
+		c.CurrentHp = 1
+		c.DeathSaves = DeathSaves{}
+		return messageDeathSaveCriticalSuccess
+	case d20 == 1:
+		c.DeathSaves.Failures = min(c.DeathSaves.Failures+2, deathSavesToDie)
+	case d20 < deathSaveDifficulty:
+		c.DeathSaves.Failures++
+	default:
+		c.DeathSaves.Successes++
+	}
+
+	if c.isDead() {
+		return messageHpDied
+	}
+
+	if c.isStable() {
+		return messageDeathSaveStabilized
+	}
+
+	return ""
+}
+
+func (c *Character) setCondition(name string, rounds int) error {
+	c.Conditions = slices.DeleteFunc(c.Conditions, func(condition *Condition) bool {
+		return condition.Name == name
+	})
+	if len(c.Conditions) >= conditionMaxCount {
+		return ErrorInvalidParameters
+	}
+
+	c.Conditions = append(c.Conditions, &Condition{Name: name, Rounds: rounds})
+	return nil
+}
+
+func (c *Character) removeCondition(name string) error {
+	removed := slices.DeleteFunc(c.Conditions, func(condition *Condition) bool {
+		return condition.Name == name
+	})
+	if len(removed) == len(c.Conditions) {
+		return ErrorNotFound
+	}
+
+	c.Conditions = removed
+	return nil
+}
+
+// advanceRound decrements the round based conditions and returns the expired ones
+func (c *Character) advanceRound() []string {
+	expired := make([]string, 0)
+	conditions := make([]*Condition, 0, len(c.Conditions))
+	for _, condition := range c.Conditions {
+		if condition.Rounds == 0 {
+			conditions = append(conditions, condition)
+			continue
+		}
+
+		condition.Rounds--
+		if condition.Rounds == 0 {
+			expired = append(expired, conditionLabel(condition.Name))
+			continue
+		}
+
+		conditions = append(conditions, condition)
+	}
+
+	c.Conditions = conditions
+	return expired
+}
+
+func conditionLabel(name string) string {
+	label, ok := conditionLabels[name]
+	if !ok {
+		return name
+	}
+
+	return label
+}
+
+// parseCondition accepts both the key (poisoned) and the label (Отравлен)
+func parseCondition(param string) string {
+	param = strings.ToLower(param)
+	for name, label := range conditionLabels {
+		if strings.ToLower(label) == param {
+			return name
+		}
+	}
+
+	return param
+}
+
+func (c *Character) conditionsText() string {
+	conditions := make([]string, 0, len(c.Conditions))
+	for _, condition := range c.Conditions {
+		if condition.Rounds > 0 {
+			conditions = append(conditions, fmt.Sprintf("%s (%d)", conditionLabel(condition.Name), condition.Rounds))
+		} else {
+			conditions = append(conditions, conditionLabel(condition.Name))
+		}
+	}
+
+	return strings.Join(conditions, ", ")
+}
+
+func deathSavesMarks(mark string, count int, total int) string {
+	return strings.Repeat(mark, count) + strings.Repeat("▫️", total-count)
+}
+
+func (c *Character) statusLine(ownerUserName string) string {
+	var sb strings.Builder
+	icon := "🧙"
+	if c.isDead() {
+		icon = "⚰️"
+	} else if c.CurrentHp == 0 {
+		icon = "💀"
+	}
+
+	fmt.Fprintf(&sb, "%s %s (%s) ❤️ %d/%d", icon, c.Name, addAt(ownerUserName), c.CurrentHp, c.MaxHp)
+	if c.TempHp > 0 {
+		fmt.Fprintf(&sb, " +%d", c.TempHp)
+	}
+
+	fmt.Fprintf(&sb, " 🛡 %d", c.ArmorClass)
+	if c.isDying() {
+		fmt.Fprintf(
+			&sb,
+			messageHpDeathSaves,
+			deathSavesMarks("✅", c.DeathSaves.Successes, deathSavesToStabilize),
+			deathSavesMarks("❌", c.DeathSaves.Failures, deathSavesToDie),
+		)
+	} else if c.isStable() {
+		sb.WriteString(messageHpStable)
+	}
+
+	if len(c.Conditions) > 0 {
+		fmt.Fprintf(&sb, " [%s]", c.conditionsText())
+	}
+
+	return sb.String()
+}
+
+func (api *dndUtilBotApi) partyStatus(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	characters, err := api.storage.GetActiveCharacters(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetActiveCharacters %w", err)
+	}
+
+	if len(characters) == 0 {
+		msg := tgbotapi.NewMessage(chatId, messagePartyEmpty)
+		return &msg, nil
+	}
+
+	slices.SortFunc(characters, func(a, b *Character) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	var sb strings.Builder
+	sb.WriteString(messagePartyStatus)
+	for _, character := range characters {
+		userName, _ := api.storage.GetUserNameById(character.OwnerId)
+		sb.WriteString(character.statusLine(userName))
+		sb.WriteString("\n")
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
+
+// authorizeTarget allows to change own character, changing others' characters is for admins only
+func (api *dndUtilBotApi) authorizeTarget(upd *tgbotapi.Update, targetId int64) error {
+	if targetId == upd.SentFrom().ID {
+		return nil
+	}
+
+	isAdmin, err := api.isRelatedMemberAdmin(upd)
+	if err != nil {
+		return err
+	}
+
+	if !isAdmin {
+		return ErrorRightsViolation
+	}
+
+	return nil
+}
+
+// targetParam resolves `@username` parameter to user id, sender is the target if parameter is not a username
+func (api *dndUtilBotApi) targetParam(upd *tgbotapi.Update, params []string) (userId int64, userName string, rest []string, ok bool) {
+	if len(params) > 0 && strings.HasPrefix(params[0], "@") {
+		userId, ok = api.userIdByUserName(params[0])
+		return userId, params[0], params[1:], ok
+	}
+
+	return upd.SentFrom().ID, addAt(upd.SentFrom().UserName), params, true
+}
+
+func (api *dndUtilBotApi) changeHp(upd *tgbotapi.Update, change func(amount int) hpChange) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	targetId, targetName, rest, ok := api.targetParam(upd, params[1:])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, targetName))
+		return &msg, nil
+	}
+
+	if len(rest) < 1 {
+		return nil, ErrorInvalidParameters
+	}
+
+	amount, err := strconv.Atoi(rest[0])
+	if err != nil || amount <= 0 {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	return api.updateTargetCharacter(upd, targetId, targetName, change(amount))
+}
+
+func (api *dndUtilBotApi) updateTargetCharacter(upd *tgbotapi.Update, targetId int64, targetName string, change hpChange) (tgbotapi.Chattable, error) {
+	err := api.authorizeTarget(upd, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	chatId := upd.FromChat().ID
+	active, err := api.activeCharacter(chatId, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated *Character
+	var note string
+	err = api.storage.UpdateCharacter(chatId, active.Id, func(character *Character) error {
+		updated = character
+		var err error
+		note, err = change(character)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	text := updated.statusLine(strings.TrimPrefix(targetName, "@"))
+	if note != "" {
+		text = fmt.Sprintf("%s\n%s", text, note)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) damage(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	return api.changeHp(upd, func(amount int) hpChange {
+		return func(character *Character) (string, error) {
+			if character.isDead() {
+				return "", ErrorCharacterDead
+			}
+
+			return character.takeDamage(amount), nil
+		}
+	})
+}
+
+func (api *dndUtilBotApi) healing(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	return api.changeHp(upd, func(amount int) hpChange {
+		return func(character *Character) (string, error) {
+			return character.heal(amount)
+		}
+	})
+}
+
+func (api *dndUtilBotApi) temporaryHp(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	return api.changeHp(upd, func(amount int) hpChange {
+		return func(character *Character) (string, error) {
+			character.setTempHp(amount)
+			return "", nil
+		}
+	})
+}
+
+// condition handles `/cond @user poisoned 3` and `/cond @user -poisoned`
+func (api *dndUtilBotApi) condition(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	targetId, targetName, rest, ok := api.targetParam(upd, params[1:])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, targetName))
+		return &msg, nil
+	}
+
+	if len(rest) < 1 || rest[0] == conditionRemovePrefix {
+		return nil, ErrorInvalidParameters
+	}
+
+	if strings.HasPrefix(rest[0], conditionRemovePrefix) {
+		name := parseCondition(strings.TrimPrefix(rest[0], conditionRemovePrefix))
+		return api.updateTargetCharacter(upd, targetId, targetName, func(character *Character) (string, error) {
+			return "", character.removeCondition(name)
+		})
+	}
+
+	rounds := 0
+	if len(rest) > 1 {
+		var err error
+		rounds, err = strconv.Atoi(rest[1])
+		if err != nil || rounds < 0 || rounds > conditionMaxRounds {
+			return nil, ErrorInvalidIntegerParameter
+		}
+	}
+
+	name := parseCondition(rest[0])
+	return api.updateTargetCharacter(upd, targetId, targetName, func(character *Character) (string, error) {
+		return "", character.setCondition(name, rounds)
+	})
+}
+
+func (api *dndUtilBotApi) deathSave(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := api.activeCharacter(upd.FromChat().ID, upd.SentFrom().ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !active.isDying() {
+		return nil, ErrorNotDying
+	}
+
+	d20 := api.rollDie(d20Sides)
+	api.sendD20Sticker(upd, d20)
+	return api.updateTargetCharacter(
+		upd,
+		upd.SentFrom().ID,
+		upd.SentFrom().UserName,
+		func(character *Character) (string, error) {
+			if !character.isDying() {
+				return "", ErrorNotDying
+			}
+
+			return strings.TrimSpace(fmt.Sprintf(messageDeathSaveRoll, d20) + " " + character.rollDeathSave(d20)), nil
+		},
+	)
+}
+
+// nextRound advances round based conditions of all the characters in the chat,
+// is also meant to be called by the initiative tracker on the end of the round
+func (api *dndUtilBotApi) nextRound(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	expired, err := api.advanceRound(chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(messageRoundAdvanced)
+	for _, kv := range expired {
+		fmt.Fprintf(&sb, messageRoundConditionsExpired, kv.key, strings.Join(kv.value, ", "))
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) advanceRound(chatId int64) ([]*KeyValue[string, []string], error) {
+	expired := make([]*KeyValue[string, []string], 0)
+	err := api.storage.UpdateChatCharacters(chatId, func(character *Character) error {
+		expiredConditions := character.advanceRound()
+		if len(expiredConditions) > 0 {
+			expired = append(expired, NewKeyValue(character.Name, expiredConditions))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during UpdateChatCharacters %w", err)
+	}
+
+	return expired, nil
+}
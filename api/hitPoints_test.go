@@ -0,0 +1,199 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+type hpState struct {
+	currentHp  int
+	tempHp     int
+	deathSaves DeathSaves
+}
+
+func (c *Character) hpState() hpState {
+	return hpState{c.CurrentHp, c.TempHp, c.DeathSaves}
+}
+
+func TestTakeDamage(t *testing.T) {
+	tests := []struct {
+		name      string
+		character Character
+		damage    int
+		expected  hpState
+		message   string
+	}{
+		{
+			name:      "temporary hp absorb the damage",
+			character: Character{MaxHp: 10, CurrentHp: 10, TempHp: 5},
+			damage:    3,
+			expected:  hpState{currentHp: 10, tempHp: 2},
+			message:   messageHpDamageAbsorbed,
+		},
+		{
+			name:      "temporary hp are spent first",
+			character: Character{MaxHp: 10, CurrentHp: 10, TempHp: 2},
+			damage:    5,
+			expected:  hpState{currentHp: 7},
+		},
+		{
+			name:      "hp don't go below 0",
+			character: Character{MaxHp: 20, CurrentHp: 5},
+			damage:    8,
+			expected:  hpState{},
+			message:   messageHpFellUnconscious,
+		},
+		{
+			name:      "damage exactly to 0 hp",
+			character: Character{MaxHp: 20, CurrentHp: 5},
+			damage:    5,
+			expected:  hpState{},
+			message:   messageHpFellUnconscious,
+		},
+		{
+			name:      "overflow of max hp kills instantly",
+			character: Character{MaxHp: 10, CurrentHp: 5},
+			damage:    15,
+			expected:  hpState{deathSaves: DeathSaves{Failures: deathSavesToDie}},
+			message:   messageHpDied,
+		},
+		{
+			name:      "damage at 0 hp fails the death save and resets the successes",
+			character: Character{MaxHp: 10, DeathSaves: DeathSaves{Successes: 2, Failures: 1}},
+			damage:    1,
+			expected:  hpState{deathSaves: DeathSaves{Failures: 2}},
+			message:   messageHpDeathSaveFailed,
+		},
+		{
+			name:      "the third failed death save kills",
+			character: Character{MaxHp: 10, DeathSaves: DeathSaves{Failures: 2}},
+			damage:    1,
+			expected:  hpState{deathSaves: DeathSaves{Failures: deathSavesToDie}},
+			message:   messageHpDied,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := test.character.takeDamage(test.damage)
+			if message != test.message {
+				t.Errorf("expected message %q, got %q", test.message, message)
+			}
+
+			if state := test.character.hpState(); state != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, state)
+			}
+		})
+	}
+}
+
+func TestRollDeathSave(t *testing.T) {
+	tests := []struct {
+		name       string
+		deathSaves DeathSaves
+		d20        int
+		expected   hpState
+		message    string
+	}{
+		{
+			name:       "20 regains 1 hp",
+			deathSaves: DeathSaves{Successes: 1, Failures: 2},
+			d20:        d20Sides,
+			expected:   hpState{currentHp: 1},
+			message:    messageDeathSaveCriticalSuccess,
+		},
+		{
+			name:     "1 counts as two failures",
+			d20:      1,
+			expected: hpState{deathSaves: DeathSaves{Failures: 2}},
+		},
+		{
+			name:       "1 with two failures kills",
+			deathSaves: DeathSaves{Failures: 2},
+			d20:        1,
+			expected:   hpState{deathSaves: DeathSaves{Failures: deathSavesToDie}},
+			message:    messageHpDied,
+		},
+		{
+			name:     "below the difficulty fails",
+			d20:      deathSaveDifficulty - 1,
+			expected: hpState{deathSaves: DeathSaves{Failures: 1}},
+		},
+		{
+			name:     "the difficulty succeeds",
+			d20:      deathSaveDifficulty,
+			expected: hpState{deathSaves: DeathSaves{Successes: 1}},
+		},
+		{
+			name:       "the third success stabilizes",
+			deathSaves: DeathSaves{Successes: 2, Failures: 2},
+			d20:        15,
+			expected:   hpState{deathSaves: DeathSaves{Successes: deathSavesToStabilize, Failures: 2}},
+			message:    messageDeathSaveStabilized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			character := Character{MaxHp: 10, DeathSaves: test.deathSaves}
+			message := character.rollDeathSave(test.d20)
+			if message != test.message {
+				t.Errorf("expected message %q, got %q", test.message, message)
+			}
+
+			if state := character.hpState(); state != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, state)
+			}
+		})
+	}
+}
+
+func TestAdvanceRound(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []*Condition
+		expected   []*Condition
+		expired    []string
+	}{
+		{
+			name:       "no conditions",
+			conditions: nil,
+			expected:   []*Condition{},
+			expired:    []string{},
+		},
+		{
+			name:       "conditions without rounds last until removed",
+			conditions: []*Condition{{Name: "prone"}},
+			expected:   []*Condition{{Name: "prone"}},
+			expired:    []string{},
+		},
+		{
+			name:       "rounds are decremented",
+			conditions: []*Condition{{Name: "stunned", Rounds: 3}},
+			expected:   []*Condition{{Name: "stunned", Rounds: 2}},
+			expired:    []string{},
+		},
+		{
+			name: "the last round expires the condition",
+			conditions: []*Condition{
+				{Name: "poisoned", Rounds: 1},
+				{Name: "prone"},
+				{Name: "stunned", Rounds: 2},
+				{Name: "custom", Rounds: 1},
+			},
+			expected: []*Condition{{Name: "prone"}, {Name: "stunned", Rounds: 1}},
+			expired:  []string{conditionLabels["poisoned"], "custom"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			character := Character{Conditions: test.conditions}
+			expired := character.advanceRound()
+			if !reflect.DeepEqual(expired, test.expired) {
+				t.Errorf("expected expired %v, got %v", test.expired, expired)
+			}
+
+			if !reflect.DeepEqual(character.Conditions, test.expected) {
+				t.Errorf("expected conditions %v, got %v", test.expected, character.Conditions)
+			}
+		})
+	}
+}
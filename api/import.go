@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	callbackPrefixImport = "im"
+	importActionConfirm  = "ok"
+	importActionCancel   = "no"
+	importTimeout        = 15 * time.Minute
+	// importMaxFileSize is the largest file the bot api lets bots download
+	importMaxFileSize = 20 << 20
+)
+
+type (
+	// pendingImport is the validated chat data waiting for the confirmation of the admin who started the import,
+	// the chat has at most one pending import
+	pendingImport struct {
+		Id        int64
+		ActorId   int64
+		Data      *ChatData
+		ExpiresAt time.Time
+	}
+)
+
+// importChat handles `/import` sent as a reply to the JSON document made by /export,
+// validates the document and shows the preview of the changes with Confirm/Cancel buttons
+func (api *dndUtilBotApi) importChat(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	reply := upd.Message.ReplyToMessage
+	if reply == nil || reply.Document == nil {
+		return nil, ErrorInvalidParameters
+	}
+
+	chatId := upd.FromChat().ID
+	if reply.Document.FileSize > importMaxFileSize {
+		msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(messageImportInvalid, "file is too large"))
+		return &msg, nil
+	}
+
+	file, err := api.downloadFile(reply.Document.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("error during downloadFile %w", err)
+	}
+
+	data := new(ChatData)
+	err = json.Unmarshal(file, data)
+	if err == nil {
+		err = data.Validate()
+	}
+
+	if err != nil {
+		msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(messageImportInvalid, err))
+		return &msg, nil
+	}
+
+	current, err := api.storage.ExportChat(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during ExportChat %w", err)
+	}
+
+	pending := &pendingImport{
+		ActorId:   upd.SentFrom().ID,
+		Data:      data,
+		ExpiresAt: time.Now().Add(api.currentSettings().ImportTimeout),
+	}
+	api.pendingImportsMutex.Lock()
+	api.pendingImportSequence++
+	pending.Id = api.pendingImportSequence
+	api.pendingImports[chatId] = pending
+	api.pendingImportsMutex.Unlock()
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(
+		messageImportPreview,
+		data.ChatId,
+		data.ExportedAt.Format(time.DateTime),
+		len(data.Wallets), len(current.Wallets),
+		data.totalCoins(), current.totalCoins(),
+		data.Treasury, current.Treasury,
+		len(data.Characters), len(current.Characters),
+		data.totalItems(), current.totalItems(),
+		len(data.ShopItems), len(current.ShopItems),
+		len(data.Quests), len(current.Quests),
+		len(data.MoneyTransfers), len(current.MoneyTransfers),
+		pending.ExpiresAt.Format(pendingTransferTimeLayout),
+		addAt(upd.SentFrom().UserName),
+	))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(
+			messagePendingTransferConfirmButton,
+			callbackData(callbackPrefixImport, pending.Id, importActionConfirm),
+		),
+		tgbotapi.NewInlineKeyboardButtonData(
+			messagePendingTransferCancelButton,
+			callbackData(callbackPrefixImport, pending.Id, importActionCancel),
+		),
+	))
+	return &msg, nil
+}
+
+// downloadFile fetches the file sent to the bot with the client of the bot api
+func (api *dndUtilBotApi) downloadFile(fileId string) ([]byte, error) {
+	url, err := api.tgBotApi.GetFileDirectURL(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := api.tgBotApi.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, importMaxFileSize))
+}
+
+// takePendingImport removes and returns the pending import of the chat if it has the id
+func (api *dndUtilBotApi) takePendingImport(chatId int64, importId int64) (*pendingImport, bool) {
+	api.pendingImportsMutex.Lock()
+	defer api.pendingImportsMutex.Unlock()
+	pending, ok := api.pendingImports[chatId]
+	if !ok || pending.Id != importId {
+		return nil, false
+	}
+
+	delete(api.pendingImports, chatId)
+	return pending, true
+}
+
+// importCallback handles `im:<importId>:<ok|no>` callback of the import preview buttons
+func (api *dndUtilBotApi) importCallback(upd *tgbotapi.Update, params []string) (string, error) {
+	if len(params) < 2 {
+		return "", ErrorInvalidParameters
+	}
+
+	importId, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		return "", ErrorInvalidParameters
+	}
+
+	if params[1] != importActionConfirm && params[1] != importActionCancel {
+		return "", ErrorInvalidParameters
+	}
+
+	chatId := upd.FromChat().ID
+	api.pendingImportsMutex.Lock()
+	pending, ok := api.pendingImports[chatId]
+	api.pendingImportsMutex.Unlock()
+	if !ok || pending.Id != importId {
+		return "", ErrorNotFound
+	}
+
+	if upd.SentFrom().ID != pending.ActorId {
+		return "", ErrorRightsViolation
+	}
+
+	pending, ok = api.takePendingImport(chatId, importId)
+	if !ok {
+		return "", ErrorNotFound
+	}
+
+	if time.Now().After(pending.ExpiresAt) {
+		api.resolvePendingTransferMessage(upd, messageImportExpired)
+		return messagePendingTransferExpiredAnswer, nil
+	}
+
+	if params[1] == importActionCancel {
+		api.resolvePendingTransferMessage(upd, messageImportCanceled)
+		return "", nil
+	}
+
+	err = api.storage.ImportChat(chatId, pending.Data)
+	if err != nil {
+		api.resolvePendingTransferMessage(upd, fmt.Sprintf(messageImportInvalid, err))
+		return "", fmt.Errorf("error during ImportChat %w", err)
+	}
+
+	api.resolvePendingTransferMessage(upd, messageImportDone)
+	return "", nil
+}
@@ -0,0 +1,388 @@
+package api
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StashOwnerId is the owner id of the shared party stash, telegram user ids are always positive
+	StashOwnerId int64 = 0
+
+	ItemTransferKindMove = "move"
+	ItemTransferKindSet  = "set"
+
+	ItemMaxQuantity        = 1_000_000
+	itemMaxNameLength      = 64
+	itemTransfersLogLength = 15
+	stashParam             = "stash"
+	itemTransferTimeLayout = "02.01 15:04"
+)
+
+type (
+	InventoryItem struct {
+		Name     string `json:"name"`
+		Quantity int    `json:"quantity"`
+	}
+
+	// Inventory is the set of items of the player or of the party stash, items are matched by ItemKey
+	Inventory struct {
+		Items []*InventoryItem `json:"items"`
+	}
+
+	// ItemTransfer is the history record of the item movement or of the admin override,
+	// for ItemTransferKindSet Quantity is the new quantity of the item owned by ToId
+	ItemTransfer struct {
+		Id       int64     `json:"id"`
+		Kind     string    `json:"kind"`
+		FromId   int64     `json:"fromId"`
+		ToId     int64     `json:"toId"`
+		ActorId  int64     `json:"actorId"`
+		Item     string    `json:"item"`
+		Quantity int       `json:"quantity"`
+		Time     time.Time `json:"time"`
+	}
+)
+
+func NewInventory() *Inventory {
+	return &Inventory{Items: make([]*InventoryItem, 0)}
+}
+
+// ItemKey normalizes item name so "Зелье лечения" and "зелье  лечения" are the same item
+func ItemKey(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func (inv *Inventory) find(name string) (int, *InventoryItem) {
+	key := ItemKey(name)
+	for i, item := range inv.Items {
+		if ItemKey(item.Name) == key {
+			return i, item
+		}
+	}
+
+	return -1, nil
+}
+
+// ItemName returns the name the item is stored with, name itself if there is no such item
+func (inv *Inventory) ItemName(name string) string {
+	_, item := inv.find(name)
+	if item == nil {
+		return name
+	}
+
+	return item.Name
+}
+
+func (inv *Inventory) Quantity(name string) int {
+	_, item := inv.find(name)
+	if item == nil {
+		return 0
+	}
+
+	return item.Quantity
+}
+
+func (inv *Inventory) Add(name string, quantity int) error {
+	_, item := inv.find(name)
+	if item == nil {
+		if quantity > ItemMaxQuantity {
+			return ErrorItemQuantityOverflow
+		}
+
+		inv.Items = append(inv.Items, &InventoryItem{Name: name, Quantity: quantity})
+		return nil
+	}
+
+	if quantity > ItemMaxQuantity-item.Quantity {
+		return ErrorItemQuantityOverflow
+	}
+
+	item.Quantity += quantity
+	return nil
+}
+
+func (inv *Inventory) Remove(name string, quantity int) error {
+	i, item := inv.find(name)
+	if item == nil || item.Quantity < quantity {
+		return ErrorNotEnoughItems
+	}
+
+	item.Quantity -= quantity
+	if item.Quantity == 0 {
+		inv.Items = slices.Delete(inv.Items, i, i+1)
+	}
+
+	return nil
+}
+
+// Set overrides the quantity of the item, zero quantity removes the item
+func (inv *Inventory) Set(name string, quantity int) error {
+	if quantity > ItemMaxQuantity {
+		return ErrorItemQuantityOverflow
+	}
+
+	i, item := inv.find(name)
+	switch {
+	case item == nil && quantity > 0:
+		inv.Items = append(inv.Items, &InventoryItem{Name: name, Quantity: quantity})
+	case item != nil && quantity == 0:
+		inv.Items = slices.Delete(inv.Items, i, i+1)
+	case item != nil:
+		item.Quantity = quantity
+	}
+
+	return nil
+}
+
+func (inv *Inventory) text() string {
+	items := slices.Clone(inv.Items)
+	slices.SortFunc(items, func(a, b *InventoryItem) int {
+		return strings.Compare(ItemKey(a.Name), ItemKey(b.Name))
+	})
+
+	var sb strings.Builder
+	for _, item := range items {
+		fmt.Fprintf(&sb, messageInventoryItem, item.Name, item.Quantity)
+	}
+
+	return sb.String()
+}
+
+// parseItemParams parses `"Зелье лечения" 2` as well as unquoted `Зелье лечения 2`, quantity is 1 by default
+func parseItemParams(params []string) (name string, quantity int, err error) {
+	if len(params) == 0 {
+		return "", 0, ErrorInvalidParameters
+	}
+
+	quantity = 1
+	if len(params) > 1 {
+		last := params[len(params)-1]
+		parsed, parseErr := strconv.Atoi(last)
+		if parseErr == nil {
+			quantity = parsed
+			params = params[:len(params)-1]
+		}
+	}
+
+	name = strings.Join(strings.Fields(strings.Join(params, " ")), " ")
+	if name == "" || len([]rune(name)) > itemMaxNameLength {
+		return "", 0, ErrorInvalidParameters
+	}
+
+	if quantity <= 0 || quantity > ItemMaxQuantity {
+		return "", 0, ErrorInvalidIntegerParameter
+	}
+
+	return name, quantity, nil
+}
+
+// ownerParam resolves `@username` or `stash` parameter to the inventory owner id
+func (api *dndUtilBotApi) ownerParam(param string) (int64, bool) {
+	if strings.ToLower(param) == stashParam {
+		return StashOwnerId, true
+	}
+
+	return api.userIdByUserName(param)
+}
+
+func (api *dndUtilBotApi) ownerName(ownerId int64) string {
+	if ownerId == StashOwnerId {
+		return messageStashName
+	}
+
+	userName, ok := api.storage.GetUserNameById(ownerId)
+	if !ok {
+		return strconv.FormatInt(ownerId, 10)
+	}
+
+	return addAt(userName)
+}
+
+func (api *dndUtilBotApi) inventoryMessage(chatId int64, ownerId int64) (*tgbotapi.MessageConfig, error) {
+	inventory, err := api.storage.GetInventory(chatId, ownerId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetInventory %w", err)
+	}
+
+	text := fmt.Sprintf(messageInventoryEmpty, api.ownerName(ownerId))
+	if len(inventory.Items) > 0 {
+		text = fmt.Sprintf(messageInventoryHeader, api.ownerName(ownerId)) + inventory.text()
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) inventory(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerId := upd.SentFrom().ID
+	params := api.getParams(upd.Message.Text)
+	if len(params) > 1 {
+		var ok bool
+		ownerId, ok = api.ownerParam(params[1])
+		if !ok {
+			msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, params[1]))
+			return &msg, nil
+		}
+	}
+
+	return api.inventoryMessage(upd.FromChat().ID, ownerId)
+}
+
+func (api *dndUtilBotApi) stash(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	return api.inventoryMessage(upd.FromChat().ID, StashOwnerId)
+}
+
+func (api *dndUtilBotApi) moveItem(upd *tgbotapi.Update, fromId int64, toId int64, itemParams []string) (tgbotapi.Chattable, error) {
+	name, quantity, err := parseItemParams(itemParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if fromId == toId {
+		return nil, ErrorInvalidTransactionParameters
+	}
+
+	err = api.storage.MoveItem(upd.FromChat().ID, fromId, toId, name, quantity, upd.SentFrom().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during MoveItem %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		fmt.Sprintf(messageItemMoved, api.ownerName(fromId), api.ownerName(toId), name, quantity),
+	)
+	return &msg, nil
+}
+
+// giveItem handles `/give @user "Зелье лечения" 2`
+func (api *dndUtilBotApi) giveItem(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 3 {
+		return nil, ErrorInvalidParameters
+	}
+
+	toId, ok := api.ownerParam(params[1])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, params[1]))
+		return &msg, nil
+	}
+
+	return api.moveItem(upd, upd.SentFrom().ID, toId, params[2:])
+}
+
+// dropItem puts the item to the party stash
+func (api *dndUtilBotApi) dropItem(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.moveItem(upd, upd.SentFrom().ID, StashOwnerId, api.getParams(upd.Message.Text)[1:])
+}
+
+// takeItem takes the item from the party stash
+func (api *dndUtilBotApi) takeItem(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.moveItem(upd, StashOwnerId, upd.SentFrom().ID, api.getParams(upd.Message.Text)[1:])
+}
+
+// setItem is the admin override of the item quantity, handles `/set_item @user "Верёвка" 3`
+func (api *dndUtilBotApi) setItem(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 4 {
+		return nil, ErrorInvalidParameters
+	}
+
+	ownerId, ok := api.ownerParam(params[1])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, params[1]))
+		return &msg, nil
+	}
+
+	quantity, err := strconv.Atoi(params[len(params)-1])
+	if err != nil || quantity < 0 || quantity > ItemMaxQuantity {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	name, _, err := parseItemParams(params[2 : len(params)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.storage.SetItemQuantity(upd.FromChat().ID, ownerId, name, quantity, upd.SentFrom().ID)
+	if err != nil {
+		return nil, fmt.Errorf("error during SetItemQuantity %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		fmt.Sprintf(messageItemSet, api.ownerName(ownerId), name, quantity),
+	)
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) itemTransfers(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	transfers, err := api.storage.GetItemTransfers(chatId, itemTransfersLogLength)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetItemTransfers %w", err)
+	}
+
+	if len(transfers) == 0 {
+		msg := tgbotapi.NewMessage(chatId, messageItemTransfersEmpty)
+		return &msg, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(messageItemTransfersHeader)
+	for _, transfer := range transfers {
+		sb.WriteString(transfer.Time.Format(itemTransferTimeLayout))
+		sb.WriteString(" ")
+		switch transfer.Kind {
+		case ItemTransferKindSet:
+			fmt.Fprintf(
+				&sb,
+				messageItemTransferSet,
+				api.ownerName(transfer.ActorId),
+				api.ownerName(transfer.ToId),
+				transfer.Item,
+				transfer.Quantity,
+			)
+		case ItemTransferKindBuy:
+			fmt.Fprintf(&sb, messageItemTransferBuy, api.ownerName(transfer.ToId), transfer.Item, transfer.Quantity)
+		default:
+			fmt.Fprintf(
+				&sb,
+				messageItemTransferMove,
+				api.ownerName(transfer.FromId),
+				api.ownerName(transfer.ToId),
+				transfer.Item,
+				transfer.Quantity,
+			)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
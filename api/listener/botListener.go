@@ -2,17 +2,32 @@ package listener
 
 import (
 	"context"
+	"fmt"
+	botLogging "github.com/Refreezer/dnd-util-bot/logging"
+	"github.com/Refreezer/dnd-util-bot/metrics"
 	"github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/op/go-logging"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// pollRetryInterval is the pause after the failed getUpdates
+	pollRetryInterval = 3 * time.Second
+	// pollStallTimeout is added to the long polling timeout, the listener is unhealthy if getUpdates isn't done for longer
+	pollStallTimeout = time.Minute
+)
+
 type (
 	ShutDown    func()
 	BotListener interface {
 		ListenForUpdates(ctx context.Context) (waitForShutDown ShutDown, err error)
+		// Healthy fails if the long poll or the workers are stuck
+		Healthy() error
+		// SetRateLimitRps changes the rate of the running listener, the burst stays the initial RateLimitRps
+		SetRateLimitRps(rps int)
 	}
 
 	UpdateHandler interface {
@@ -33,6 +48,10 @@ type (
 		updatesChannel tgbotapi.UpdatesChannel
 		done           chan struct{}
 		logger         *logging.Logger
+		// lastPoll is the unix nano time of the last getUpdates
+		lastPoll atomic.Int64
+		// rateLimitRps is Config.RateLimitRps which can be changed by SetRateLimitRps
+		rateLimitRps atomic.Int64
 	}
 )
 
@@ -46,21 +65,25 @@ func NewBotListener(
 	loggerProvider LoggerProvider,
 ) BotListener {
 	logger := loggerProvider.MustGetLogger("botListenerApi")
-	return &dndUtilBotListener{
+	l := &dndUtilBotListener{
 		conf:         conf,
 		tgBotApi:     tgBotApi,
 		lastUpdateId: 0,
 		logger:       logger,
 		done:         make(chan struct{}),
 	}
+	l.rateLimitRps.Store(int64(conf.RateLimitRps))
+	return l
 }
 
 func (l *dndUtilBotListener) ListenForUpdates(ctx context.Context) (ShutDown, error) {
-	updates := l.tgBotApi.GetUpdatesChan(tgbotapi.UpdateConfig{
+	updates := make(chan tgbotapi.Update, l.tgBotApi.Buffer)
+	l.lastPoll.Store(time.Now().UnixNano())
+	go l.poll(ctx, tgbotapi.UpdateConfig{
 		Offset:         l.lastUpdateId + 1,
 		Timeout:        l.conf.TgTimeout,
 		AllowedUpdates: l.conf.AllowedUpdates,
-	})
+	}, updates)
 
 	l.updatesChannel = updates
 	tasks := make(chan *tgbotapi.Update, runtime.NumCPU())
@@ -70,6 +93,47 @@ func (l *dndUtilBotListener) ListenForUpdates(ctx context.Context) (ShutDown, er
 	return l.waitForShutDown(), nil
 }
 
+func (l *dndUtilBotListener) Healthy() error {
+	sinceLastPoll := time.Since(time.Unix(0, l.lastPoll.Load()))
+	if sinceLastPoll > time.Duration(l.conf.TgTimeout)*time.Second+pollStallTimeout {
+		return fmt.Errorf("no updates were polled for %s", sinceLastPoll.Round(time.Second))
+	}
+
+	return nil
+}
+
+// poll works like GetUpdatesChan and records the time of every getUpdates,
+// the time stops when the event loop doesn't take the updates since the workers are stuck
+func (l *dndUtilBotListener) poll(ctx context.Context, config tgbotapi.UpdateConfig, updates chan<- tgbotapi.Update) {
+	defer close(updates)
+	for ctx.Err() == nil {
+		received, err := l.tgBotApi.GetUpdates(config)
+		l.lastPoll.Store(time.Now().UnixNano())
+		if err != nil {
+			l.logger.Errorf("error while getting updates, retrying in %s: %s", pollRetryInterval, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pollRetryInterval):
+			}
+
+			continue
+		}
+
+		for _, update := range received {
+			if update.UpdateID < config.Offset {
+				continue
+			}
+
+			config.Offset = update.UpdateID + 1
+			select {
+			case <-ctx.Done():
+				return
+			case updates <- update:
+			}
+		}
+	}
+}
+
 func (l *dndUtilBotListener) waitForShutDown() func() {
 	return func() {
 		<-l.done
@@ -86,7 +150,6 @@ func (l *dndUtilBotListener) eventLoop(ctx context.Context, tasks chan<- *tgbota
 	for {
 		select {
 		case <-ctx.Done():
-			l.tgBotApi.StopReceivingUpdates()
 			l.logger.Info("exiting listen for updates loop due to canceled context")
 			wg.Wait()
 			l.logger.Info("Shutting down gracefully")
@@ -97,7 +160,9 @@ func (l *dndUtilBotListener) eventLoop(ctx context.Context, tasks chan<- *tgbota
 			}
 
 			l.lastUpdateId = max(update.UpdateID, l.lastUpdateId)
+			metrics.UpdatesReceived.WithLabelValues(updateType(&update)).Inc()
 			tasks <- &update
+			metrics.WorkerQueueDepth.Set(float64(len(tasks)))
 			continue
 		}
 	}
@@ -116,31 +181,39 @@ func (l *dndUtilBotListener) worker(ctx context.Context, tasks <-chan *tgbotapi.
 			l.logger.Info("worker exits due to canceled context")
 			return
 		case update, ok := <-tasks:
+			metrics.WorkerQueueDepth.Set(float64(len(tasks)))
+			waitStart := time.Now()
 			if _, ok := <-rl; !ok { // rate limit
 				l.logger.Info("worker exits due to rateLimit channel was closed")
 				return
 			}
+
+			metrics.RateLimiterWaitDuration.Observe(time.Since(waitStart).Seconds())
 			if !ok {
 				l.logger.Info("worker exits due to input channel was closed")
 				return
 			}
 
 			func() {
+				updateCtx := botLogging.WithFields(ctx, updateFields(update))
 				defer func() {
 					if r := recover(); r != nil {
-						l.logger.Warning("recovered after update handler failed %s", r)
+						botLogging.FromContext(updateCtx, l.logger).Warningf("recovered after update handler failed %s", r)
 					}
 				}()
 
-				l.conf.UpdateHandler.HandleUpdate(ctx, update)
+				l.conf.UpdateHandler.HandleUpdate(updateCtx, update)
 			}()
 			continue
 		}
 	}
 }
 
+func (l *dndUtilBotListener) SetRateLimitRps(rps int) {
+	l.rateLimitRps.Store(int64(rps))
+}
+
 func (l *dndUtilBotListener) rateLimit(ctx context.Context) <-chan struct{} {
-	tokenRateMs := 1000 / l.conf.RateLimitRps
 	rl := make(chan struct{}, l.conf.RateLimitRps)
 	go func(ctx context.Context, tokens chan<- struct{}) {
 		defer close(tokens)
@@ -149,7 +222,7 @@ func (l *dndUtilBotListener) rateLimit(ctx context.Context) <-chan struct{} {
 			case <-ctx.Done():
 				return
 			case tokens <- struct{}{}:
-				time.Sleep(time.Millisecond * time.Duration(tokenRateMs))
+				time.Sleep(time.Second / time.Duration(l.rateLimitRps.Load()))
 				continue
 			}
 		}
@@ -158,3 +231,41 @@ func (l *dndUtilBotListener) rateLimit(ctx context.Context) <-chan struct{} {
 
 	return rl
 }
+
+// updateFields are the log fields of the update, the handler adds the command
+func updateFields(update *tgbotapi.Update) *botLogging.Fields {
+	fields := &botLogging.Fields{UpdateId: update.UpdateID, Start: time.Now()}
+	if chat := update.FromChat(); chat != nil {
+		fields.ChatId = chat.ID
+	}
+
+	if user := update.SentFrom(); user != nil {
+		fields.UserId = user.ID
+	}
+
+	return fields
+}
+
+// updateType is the name of the update field which is set, the names match the allowed updates
+func updateType(update *tgbotapi.Update) string {
+	switch {
+	case update.Message != nil:
+		return tgbotapi.UpdateTypeMessage
+	case update.EditedMessage != nil:
+		return tgbotapi.UpdateTypeEditedMessage
+	case update.CallbackQuery != nil:
+		return tgbotapi.UpdateTypeCallbackQuery
+	case update.ChannelPost != nil:
+		return tgbotapi.UpdateTypeChannelPost
+	case update.EditedChannelPost != nil:
+		return tgbotapi.UpdateTypeEditedChannelPost
+	case update.InlineQuery != nil:
+		return tgbotapi.UpdateTypeInlineQuery
+	case update.MyChatMember != nil:
+		return tgbotapi.UpdateTypeMyChatMember
+	case update.ChatMember != nil:
+		return tgbotapi.UpdateTypeChatMember
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+)
+
+// loot handles `/loot 1375 @a @b`, without usernames coins are split among all the members of the chat.
+// Every recipient gets the equal share, the remainder which can't be split evenly goes to the treasury
+func (api *dndUtilBotApi) loot(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	amount, err := parsePrice(params[1])
+	if err != nil || amount == 0 {
+		return nil, ErrorInvalidIntegerParameter
+	}
+
+	chatId := upd.FromChat().ID
+	recipients, unknown, ok := api.userIdsParams(params[2:])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, unknown))
+		return &msg, nil
+	}
+
+	if len(recipients) == 0 {
+		members, err := api.storage.GetChatMembers(chatId)
+		if err != nil {
+			return nil, fmt.Errorf("error during GetChatMembers %w", err)
+		}
+
+		slices.SortFunc(members, func(a, b *Member) int {
+			return cmp.Compare(a.UserName, b.UserName)
+		})
+
+		for _, member := range members {
+			recipients = append(recipients, member.UserId)
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil, ErrorInvalidParameters
+	}
+
+	credits, share, remainder := splitLoot(amount, recipients)
+	if share == 0 {
+		return nil, ErrorInvalidTransactionParameters
+	}
+
+	err = api.storage.CreditUsers(chatId, MoneyTransferKindLoot, upd.SentFrom().ID, credits)
+	if err != nil {
+		return nil, fmt.Errorf("error during CreditUsers %w", err)
+	}
+
+	text := fmt.Sprintf(messageLootSplit, amount, len(recipients), share, api.userNamesText(recipients))
+	if remainder > 0 {
+		text += fmt.Sprintf(messageLootRemainder, remainder)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, text)
+	return &msg, nil
+}
+
+// splitLoot credits the equal share to every recipient and the remainder to the treasury
+func splitLoot(amount int64, recipients []int64) (credits []*Credit, share int64, remainder int64) {
+	share = amount / int64(len(recipients))
+	remainder = amount % int64(len(recipients))
+	credits = make([]*Credit, 0, len(recipients)+1)
+	for _, userId := range recipients {
+		credits = append(credits, &Credit{UserId: userId, Amount: share})
+	}
+
+	if remainder > 0 {
+		credits = append(credits, &Credit{UserId: TreasuryAccountId, Amount: remainder})
+	}
+
+	return credits, share, remainder
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLoot(t *testing.T) {
+	tests := []struct {
+		name       string
+		amount     int64
+		recipients []int64
+		credits    []*Credit
+		share      int64
+		remainder  int64
+	}{
+		{
+			name:       "single recipient gets everything",
+			amount:     7,
+			recipients: []int64{10},
+			credits:    []*Credit{{UserId: 10, Amount: 7}},
+			share:      7,
+		},
+		{
+			name:       "even split",
+			amount:     90,
+			recipients: []int64{10, 11, 12},
+			credits:    []*Credit{{UserId: 10, Amount: 30}, {UserId: 11, Amount: 30}, {UserId: 12, Amount: 30}},
+			share:      30,
+		},
+		{
+			name:       "remainder goes to the treasury",
+			amount:     1375,
+			recipients: []int64{10, 11, 12},
+			credits: []*Credit{
+				{UserId: 10, Amount: 458},
+				{UserId: 11, Amount: 458},
+				{UserId: 12, Amount: 458},
+				{UserId: TreasuryAccountId, Amount: 1},
+			},
+			share:     458,
+			remainder: 1,
+		},
+		{
+			name:       "less coins than recipients",
+			amount:     2,
+			recipients: []int64{10, 11, 12},
+			credits:    []*Credit{{UserId: 10}, {UserId: 11}, {UserId: 12}, {UserId: TreasuryAccountId, Amount: 2}},
+			remainder:  2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			credits, share, remainder := splitLoot(test.amount, test.recipients)
+			if share != test.share || remainder != test.remainder {
+				t.Errorf("expected share %d and remainder %d, got %d and %d", test.share, test.remainder, share, remainder)
+			}
+
+			if !reflect.DeepEqual(credits, test.credits) {
+				t.Errorf("expected credits %v, got %v", test.credits, credits)
+			}
+		})
+	}
+}
@@ -13,12 +13,141 @@ const (
 		" Открой нам свое лицо и тогда сможешь вступить в наши ряды 😎\\." +
 		"\n\n \\(Ваш username скрыт, это не позволяет собрать необходимую иформацию\\. Вам придется его открыть, чтобы бот работал корректно\\)"
 
+	messageConversationRecipientPrompt = "Кому передать золотые монеты 🟡? Выбери путника на клавиатуре или напиши его @username\\.\n\n"
+	messageConversationAmountPrompt    = "Сколько золотых монет 🟡 передать %s? В твоём кошеле %d 🟡"
+	messageConversationConfirmPrompt   = "Передать %d 🟡 золотых монет %s?"
+	messageConversationConfirmHint     = "Путник, ответь «%s» или «%s»"
+	messageConversationCanceled        = "Хорошо, путник, забудем об этом 🍃"
+	messageConversationExpired         = "Путник, ты слишком долго думал, и я забыл, о чём мы говорили 🍃"
+
+	messageCharacterSheetHeader             = "🧙 %s — %s, ур. %d (%s)\n"
+	messageCharacterSheetStats              = "❤️ ХП %d/%d   🛡 КД %d   ⭐ Бонус мастерства %s\n"
+	messageCharacterSheetSkills             = "Навыки: %s\n"
+	messageCharacterSheetSaves              = "Спасброски: %s\n"
+	messageCharacterSheetAttacks            = "Атаки: %s\n"
+	messageCharacterCreated                 = "Персонаж %s (#%d) вступил в Гильдию Приключений ⚔️\n\n"
+	messageCharacterNotCreated              = "У тебя пока нет персонажа, путник. Создай его командой /char new"
+	messageCharacterList                    = "Твои персонажи:\n"
+	messageCharacterActivated               = "Теперь ты играешь за %s ⚔️"
+	messageCharacterDeleted                 = "Персонаж %s покинул Гильдию Приключений 🍃"
+	messageCharacterEditorLimit             = "Дальше нельзя"
+	messageRollHeader                       = "🎲 %s (%s) — %s: "
+	messageRollSubjectCheck                 = "проверка «%s»"
+	messageRollSubjectSave                  = "спасбросок %s"
+	messageRollSubjectAttack                = "атака «%s»"
+	messageRollProficiency                  = "мастерство"
+	messageRollCriticalSuccess              = " 💥 Критический успех!"
+	messageRollCriticalFailure              = " 💀 Критический провал!"
+	messageAttackDamage                     = "\n🗡 Урон: %d (%s: %s %s %s)"
+	messageAttackNotFound                   = "Путник, у твоего персонажа нет атаки «%s». Доступные атаки: %s"
+	messageCharacterSheetTempHp             = "Временные ХП: %d\n"
+	messageCharacterSheetConditions         = "Состояния: %s\n"
+	messagePartyStatus                      = "⚔️ Состояние отряда:\n"
+	messagePartyEmpty                       = "В отряде пока нет ни одного персонажа. Создать его можно командой /char new"
+	messageHpDeathSaves                     = " спасброски от смерти: %s / %s"
+	messageHpStable                         = " стабилизирован"
+	messageHpDamageAbsorbed                 = "Временные ХП поглотили весь урон 🛡"
+	messageHpFellUnconscious                = "💀 Персонаж падает без сознания! Пора делать спасброски от смерти: /deathsave"
+	messageHpDeathSaveFailed                = "❌ Урон по лежащему без сознания — провал спасброска от смерти"
+	messageHpDied                           = "⚰️ Персонаж погиб. Да упокоится он с миром..."
+	messageHpRegainedConsciousness          = "💚 Персонаж приходит в сознание!"
+	messageDeathSaveRoll                    = "🎲 Спасбросок от смерти: %d."
+	messageDeathSaveCriticalSuccess         = "💥 Персонаж приходит в сознание с 1 ХП!"
+	messageDeathSaveStabilized              = "💚 Персонаж стабилизирован"
+	messageRoundAdvanced                    = "⏳ Начинается новый раунд\n"
+	messageRoundConditionsExpired           = "У %s закончилось: %s\n"
+	messageStashName                        = "🎒 общий тайник"
+	messageInventoryHeader                  = "Инвентарь %s:\n"
+	messageInventoryEmpty                   = "Инвентарь %s пуст 🍃"
+	messageInventoryItem                    = "• %s ×%d\n"
+	messageItemMoved                        = "📦 %s → %s: %s ×%d"
+	messageItemSet                          = "📦 %s: %s ×%d"
+	messageItemTransfersHeader              = "📜 История предметов:\n"
+	messageItemTransfersEmpty               = "Предметы пока никто не передавал 🍃"
+	messageItemTransferMove                 = "%s → %s: %s ×%d"
+	messageItemTransferSet                  = "%s задал %s: %s ×%d"
+	messageItemTransferBuy                  = "%s купил в лавке: %s ×%d"
+	messageShopHeader                       = "🏪 Лавка Гильдии:\n"
+	messageShopEmpty                        = "Лавка Гильдии пока пуста 🍃"
+	messageShopItem                         = "• %s — %d 🟡"
+	messageShopItemStock                    = " (осталось %d)"
+	messageShopItemOutOfStock               = " (распродано)"
+	messageShopBuyHint                      = "\nЧтобы купить, напиши /buy <предмет> [количество]"
+	messageShopItemSaved                    = "🏪 %s теперь продаётся в лавке за %d 🟡"
+	messageShopItemDeleted                  = "🏪 %s больше не продаётся в лавке"
+	messageShopBought                       = "🛍 Куплено: %s ×%d за %d 🟡. В кошеле осталось %d 🟡"
+	messageQuestCreated                     = "📜 Новый квест #%d: %s. Награда %d 🟡"
+	messageQuestTaken                       = "⚔️ %s взялся за квест #%d: %s"
+	messageQuestCompleted                   = "✅ Квест #%d выполнен: %s\n"
+	messageQuestReward                      = "%s получает %d 🟡\n"
+	messageQuestFailed                      = "❌ Квест #%d провален: %s"
+	messageQuestsHeader                     = "📋 Доска заданий Гильдии:\n"
+	messageQuestsEmpty                      = "На доске заданий Гильдии пока пусто 🍃"
+	messageQuestsItem                       = "#%d %s — %d 🟡, %s"
+	messageQuestsParticipants               = " (%s)"
+	messageLootSplit                        = "💎 Добыча %d 🟡 поделена на %d: по %d 🟡\n%s"
+	messageLootRemainder                    = "\nОстаток %d 🟡 не делится поровну и отправлен в казну отряда"
+	messageTreasuryName                     = "🏦 казна отряда"
+	messageTreasuryBalance                  = "🏦 В казне отряда %d 🟡\n"
+	messageTreasuryTransfersHeader          = "\nПоследние движения:\n"
+	messageTreasuryTransfer                 = "%s %s%d 🟡 %s %s"
+	messageTreasuryDeposit                  = "🏦 %s внёс в казну отряда %d 🟡"
+	messageTreasuryWithdraw                 = "🏦 Из казны отряда выдано %d 🟡 %s"
+	messageQuestRewardFromTreasury          = "Награда выплачена из казны отряда 🏦\n"
+	messageThresholds                       = "⚖️ Подтверждение крупных переводов:\n/send — %s\n/transaction — %s"
+	messageThresholdAmount                  = "больше %d 🟡"
+	messageThresholdDisabled                = "не требуется"
+	messageThresholdSaved                   = "⚖️ Подтверждение для %s: %s"
+	messagePendingTransferAmount            = "%d 🟡 от %s к %s"
+	messagePendingTransfer                  = "⏳ Перевод %s ждёт подтверждения %s до %s"
+	messagePendingTransferSender            = "отправителя"
+	messagePendingTransferSourceOrAdmin     = "%s или другого админа"
+	messagePendingTransferConfirmButton     = "✅ Подтвердить"
+	messagePendingTransferCancelButton      = "🚫 Отменить"
+	messagePendingTransferConfirmed         = "✅ Перевод %s выполнен, подтвердил %s"
+	messagePendingTransferCanceled          = "🚫 Перевод %s отменён, отменил %s"
+	messagePendingTransferExpired           = "⌛ Перевод %s не подтверждён вовремя и отменён"
+	messagePendingTransferExpiredAnswer     = "Время на подтверждение вышло ⌛"
+	messagePendingTransferFailed            = "❌ Перевод %s не выполнен: %s"
+	messagePendingTransferInsufficientMoney = "не хватает монет"
+	messagePendingTransferBalanceOverflow   = "кошель получателя переполнен"
+	messagePendingTransferNotRegistered     = "путник не зарегистрирован в Гильдии"
+	messagePendingTransferError             = "что-то пошло не так"
+	messageRichHeader                       = "💰 Самые богатые путники:\n"
+	messageRichItem                         = "%d. %s — %d 🟡\n"
+	messageWealth                           = "💰 У %[2]d путников %[1]d 🟡\nМедианный кошель %[3]d 🟡\n🏦 В казне отряда %[4]d 🟡\n\nКошели:\n"
+	messageCreditLimit                      = "🏛 Гильдия даёт путникам в долг до %d 🟡"
+	messageCreditLimitDisabled              = "🏛 Гильдия не даёт путникам в долг"
+	messageWealthDebtors                    = "меньше 0"
+	messageWealthBracket                    = "%s 🟡 — %d\n"
+	messageStats                            = "📊 %s: %d 🟡, %d место из %d\nОтдано %d 🟡 (%d)\nПолучено %d 🟡 (%d)"
+	messageBackupCaption                    = "💾 Снимок базы от %s, %d байт"
+	messageBackupSentPrivately              = "💾 Снимок базы отправлен владельцу лично"
+	messageExportCaption                    = "📦 Данные чата: %d путников, %d записей журнала"
+	messageImportInvalid                    = "❌ Этот файл не подходит для импорта: %s"
+	messageImportPreview                    = "📦 Импорт данных чата %d от %s\nПутники: %d (сейчас %d)\nМонет у путников: %d 🟡 (сейчас %d)\nКазна: %d 🟡 (сейчас %d)\nПерсонажи: %d (сейчас %d)\nПредметы: %d (сейчас %d)\nТовары в лавке: %d (сейчас %d)\nКвесты: %d (сейчас %d)\nЗаписи журнала: %d (сейчас %d)\n\n⚠️ Все текущие данные чата будут заменены. Подтвердить импорт до %s может %s"
+	messageImportDone                       = "✅ Данные чата импортированы"
+	messageImportCanceled                   = "🚫 Импорт отменён"
+	messageImportExpired                    = "⌛ Время на подтверждение импорта вышло"
+	messageCallbackNotCharacterOwner        = "Это не твой персонаж, путник 👿"
+	messageCallbackNotFound                 = "Кажется, этого уже нет 🍃"
+
 	errorMessageBalanceOverflow                = "Кажется кошель путника\\-получателя сейчас лопнет\\. Ему явно не нужно СТОЛЬКО денег\\!😬"
 	errorMessageInsufficientPounds             = "Путник, да ты гол, как сокол, побереги кошелек\\! 🤣"
 	errorMessageInsufficientPoundsInUserWallet = "У %s не хватает монет 🟡\\!"
 	errorMessageInvalidIntegerParameter        = "Путник, кажется твоё число неправильное 🤨\\. Попробуй иначе\\!"
 	errorMessageInvalidTransactionParameters   = "Думаешь, что перехитрил меня 😠? Чтобы я такого больше не видел\\!"
 	errorMessageInvalidParametersFormat        = "Путник, кажется твои параметры неправильные ☹️\\. Смотри как надо:\n%s"
+	errorMessageNoCharacter                    = "У путника пока нет персонажа\\. Создать его можно командой /char new"
+	errorMessageNotFound                       = "Путник, я не нашёл того, что ты ищешь 🔍"
+	errorMessageCharacterDead                  = "Этот персонаж уже мёртв ⚰️ Тут поможет только воскрешение\\."
+	errorMessageNotEnoughItems                 = "Путник, столько таких предметов нет 🎒"
+	errorMessageItemQuantityOverflow           = "Столько предметов не унести даже всей Гильдией 😬"
+	errorMessageNotRegistered                  = "Кажется путник ещё не зарегистрировался в Гильдии Приключений, так что я не могу это сделать 😓"
+	errorMessageOutOfStock                     = "Путник, столько таких товаров в лавке нет 🏪"
+	errorMessageQuestNotActive                 = "Путник, этот квест уже завершён 📜"
+	errorMessageInsufficientTreasury           = "В казне отряда не хватает монет 🏦"
+	errorMessageNotDying                       = "Путник, твой персонаж не при смерти, спасброски от смерти ему ни к чему 💚"
 
 	administrativeCommandsSeparatorString = "*Административные команды:*"
 	userCommandsSeparatorString           = "*Команды пользователя:*"
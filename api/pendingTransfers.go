@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strconv"
+	"time"
+)
+
+const (
+	PendingTransferKindSend        = MoneyTransferKindSend
+	PendingTransferKindTransaction = MoneyTransferKindTransaction
+
+	callbackPrefixPendingTransfer = "pt"
+	pendingTransferActionConfirm  = "ok"
+	pendingTransferActionCancel   = "no"
+	pendingTransferTimeout        = 15 * time.Minute
+	pendingTransferTimeLayout     = "15:04"
+)
+
+type (
+	// PendingTransfer is the transfer above the chat threshold waiting for the approval.
+	// /send is approved by the sender, /transaction by the source player or by an admin other than the initiator
+	PendingTransfer struct {
+		Id        int64     `json:"id"`
+		Kind      string    `json:"kind"`
+		FromId    int64     `json:"fromId"`
+		ToId      int64     `json:"toId"`
+		ActorId   int64     `json:"actorId"`
+		Amount    int64     `json:"amount"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+)
+
+func (transfer *PendingTransfer) isExpired(now time.Time) bool {
+	return now.After(transfer.ExpiresAt)
+}
+
+func (transfer *PendingTransfer) canConfirm(userId int64, isAdmin func() bool) bool {
+	if userId == transfer.FromId {
+		return true
+	}
+
+	return transfer.Kind == PendingTransferKindTransaction && userId != transfer.ActorId && isAdmin()
+}
+
+func (transfer *PendingTransfer) canCancel(userId int64, isAdmin func() bool) bool {
+	if userId == transfer.FromId || userId == transfer.ActorId {
+		return true
+	}
+
+	return transfer.Kind == PendingTransferKindTransaction && isAdmin()
+}
+
+func confirmThreshold(settings *ChatSettings, kind string) int64 {
+	if kind == PendingTransferKindTransaction {
+		return settings.TransactionConfirmThreshold
+	}
+
+	return settings.SendConfirmThreshold
+}
+
+// requestConfirmation stores the pending transfer expiring after timeout in the transaction if the amount is above
+// the chat threshold, nil means the transfer can be executed right away
+func requestConfirmation(tx StorageTx, chatId int64, transfer *PendingTransfer, timeout time.Duration) (*PendingTransfer, error) {
+	settings, err := tx.GetChatSettings(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatSettings %w", err)
+	}
+
+	threshold := confirmThreshold(settings, transfer.Kind)
+	if threshold == 0 || transfer.Amount <= threshold {
+		return nil, nil
+	}
+
+	now := time.Now()
+	err = tx.DeleteExpiredPendingTransfers(chatId, now)
+	if err != nil {
+		return nil, fmt.Errorf("error during DeleteExpiredPendingTransfers %w", err)
+	}
+
+	transfer.ExpiresAt = now.Add(timeout)
+	transfer.Id, err = tx.CreatePendingTransfer(chatId, transfer)
+	if err != nil {
+		return nil, fmt.Errorf("error during CreatePendingTransfer %w", err)
+	}
+
+	return transfer, nil
+}
+
+// messagePendingTransfer returns the message with Confirm/Cancel buttons of the stored pending transfer
+func (api *dndUtilBotApi) messagePendingTransfer(chatId int64, transfer *PendingTransfer) *tgbotapi.MessageConfig {
+	approver := messagePendingTransferSender
+	if transfer.Kind == PendingTransferKindTransaction {
+		approver = fmt.Sprintf(messagePendingTransferSourceOrAdmin, api.ownerName(transfer.FromId))
+	}
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(
+		messagePendingTransfer,
+		api.pendingTransferText(transfer),
+		approver,
+		transfer.ExpiresAt.Format(pendingTransferTimeLayout),
+	))
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(
+			messagePendingTransferConfirmButton,
+			callbackData(callbackPrefixPendingTransfer, transfer.Id, pendingTransferActionConfirm),
+		),
+		tgbotapi.NewInlineKeyboardButtonData(
+			messagePendingTransferCancelButton,
+			callbackData(callbackPrefixPendingTransfer, transfer.Id, pendingTransferActionCancel),
+		),
+	))
+	return &msg
+}
+
+func (api *dndUtilBotApi) pendingTransferText(transfer *PendingTransfer) string {
+	return fmt.Sprintf(messagePendingTransferAmount, transfer.Amount, api.ownerName(transfer.FromId), api.ownerName(transfer.ToId))
+}
+
+// pendingTransferCallback handles `pt:<transferId>:<ok|no>` callback of the pending transfer buttons
+func (api *dndUtilBotApi) pendingTransferCallback(ctx context.Context, upd *tgbotapi.Update, params []string) (string, error) {
+	if len(params) < 2 {
+		return "", ErrorInvalidParameters
+	}
+
+	transferId, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		return "", ErrorInvalidParameters
+	}
+
+	chatId := upd.FromChat().ID
+	transfer, err := api.storage.GetPendingTransfer(chatId, transferId)
+	if err != nil {
+		return "", err
+	}
+
+	if transfer.isExpired(time.Now()) {
+		_, err = api.storage.TakePendingTransfer(chatId, transferId)
+		if err != nil {
+			return "", err
+		}
+
+		api.resolvePendingTransferMessage(upd, fmt.Sprintf(messagePendingTransferExpired, api.pendingTransferText(transfer)))
+		return messagePendingTransferExpiredAnswer, nil
+	}
+
+	userId := upd.SentFrom().ID
+	isAdmin := func() bool {
+		isAdmin, err := api.isChatAdmin(chatId, userId)
+		if err != nil {
+			api.log(ctx).Errorf("can't check admin rights of %d in %d: %s", userId, chatId, err)
+		}
+
+		return isAdmin
+	}
+
+	switch params[1] {
+	case pendingTransferActionConfirm:
+		if !transfer.canConfirm(userId, isAdmin) {
+			return "", ErrorRightsViolation
+		}
+	case pendingTransferActionCancel:
+		if !transfer.canCancel(userId, isAdmin) {
+			return "", ErrorRightsViolation
+		}
+	default:
+		return "", ErrorInvalidParameters
+	}
+
+	// taking the transfer out of the storage guarantees it's resolved once even if buttons are pressed concurrently,
+	// the transfer is taken and executed in one transaction so the coins can't be lost in between
+	var transferErr error
+	err = api.storage.WithTx(ctx, func(tx StorageTx) error {
+		transfer, err = tx.TakePendingTransfer(chatId, transferId)
+		if err != nil || params[1] == pendingTransferActionCancel {
+			return err
+		}
+
+		transferErr = tx.TransferMoney(chatId, &MoneyTransfer{
+			Kind:    transfer.Kind,
+			FromId:  transfer.FromId,
+			ToId:    transfer.ToId,
+			ActorId: transfer.ActorId,
+			Amount:  transfer.Amount,
+		})
+		return transferErr
+	})
+	if transferErr != nil {
+		// the failed transfer is dropped anyway, the players start over if they still want it
+		_, err = api.storage.TakePendingTransfer(chatId, transferId)
+		api.resolvePendingTransferMessage(upd, fmt.Sprintf(
+			messagePendingTransferFailed,
+			api.pendingTransferText(transfer),
+			pendingTransferFailureReason(transferErr),
+		))
+		return "", errors.Join(fmt.Errorf("error during TransferMoney %w", transferErr), err)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if params[1] == pendingTransferActionCancel {
+		api.resolvePendingTransferMessage(upd, fmt.Sprintf(
+			messagePendingTransferCanceled,
+			api.pendingTransferText(transfer),
+			addAt(upd.SentFrom().UserName),
+		))
+		return "", nil
+	}
+
+	api.resolvePendingTransferMessage(upd, fmt.Sprintf(
+		messagePendingTransferConfirmed,
+		api.pendingTransferText(transfer),
+		addAt(upd.SentFrom().UserName),
+	))
+	return "", nil
+}
+
+func pendingTransferFailureReason(err error) string {
+	if errors.Is(err, ErrorInsufficientMoney) {
+		return messagePendingTransferInsufficientMoney
+	} else if errors.Is(err, ErrorBalanceOverflow) {
+		return messagePendingTransferBalanceOverflow
+	} else if errors.Is(err, ErrorNotRegistered) {
+		return messagePendingTransferNotRegistered
+	}
+
+	return messagePendingTransferError
+}
+
+// resolvePendingTransferMessage replaces the pending transfer message with the outcome and removes the buttons
+func (api *dndUtilBotApi) resolvePendingTransferMessage(upd *tgbotapi.Update, text string) {
+	api.sendToChat(tgbotapi.NewEditMessageText(upd.FromChat().ID, upd.CallbackQuery.Message.MessageID, text))
+}
@@ -0,0 +1,43 @@
+package api
+
+import "testing"
+
+func TestPendingTransferPermissions(t *testing.T) {
+	const (
+		sender int64 = 10
+		actor  int64 = 11
+		other  int64 = 12
+	)
+
+	tests := []struct {
+		name       string
+		kind       string
+		actorId    int64
+		userId     int64
+		isAdmin    bool
+		canConfirm bool
+		canCancel  bool
+	}{
+		{"sender of the send", PendingTransferKindSend, sender, sender, false, true, true},
+		{"admin of the send", PendingTransferKindSend, sender, other, true, false, false},
+		{"member of the send", PendingTransferKindSend, sender, other, false, false, false},
+		{"sender of the transaction", PendingTransferKindTransaction, actor, sender, false, true, true},
+		{"admin who made the transaction", PendingTransferKindTransaction, actor, actor, true, false, true},
+		{"member who made the transaction", PendingTransferKindTransaction, actor, actor, false, false, true},
+		{"other admin of the transaction", PendingTransferKindTransaction, actor, other, true, true, true},
+		{"member of the transaction", PendingTransferKindTransaction, actor, other, false, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transfer := &PendingTransfer{Kind: test.kind, FromId: sender, ToId: 20, ActorId: test.actorId, Amount: 5}
+			isAdmin := func() bool { return test.isAdmin }
+			if confirm := transfer.canConfirm(test.userId, isAdmin); confirm != test.canConfirm {
+				t.Errorf("expected canConfirm %t, got %t", test.canConfirm, confirm)
+			}
+
+			if cancel := transfer.canCancel(test.userId, isAdmin); cancel != test.canCancel {
+				t.Errorf("expected canCancel %t, got %t", test.canCancel, cancel)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	QuestStateOpen  = "open"
+	QuestStateTaken = "taken"
+	QuestStateDone  = "done"
+	QuestStateFail  = "failed"
+
+	questSubcommandAdd      = "add"
+	questSubcommandTake     = "take"
+	questSubcommandComplete = "complete"
+	questSubcommandFail     = "fail"
+	questRewardParamPrefix  = "reward="
+	questMaxTitleLength     = 128
+	questsListFinishedLimit = 5
+)
+
+var (
+	questStateLabels = map[string]string{
+		QuestStateOpen:  "📜 открыт",
+		QuestStateTaken: "⚔️ взят",
+		QuestStateDone:  "✅ выполнен",
+		QuestStateFail:  "❌ провален",
+	}
+)
+
+type (
+	// Quest is the guild board quest, the reward is paid from the treasury and split among the participants on completion
+	Quest struct {
+		Id           int64   `json:"id"`
+		Title        string  `json:"title"`
+		Reward       int64   `json:"reward"`
+		State        string  `json:"state"`
+		CreatedBy    int64   `json:"createdBy"`
+		TakenBy      []int64 `json:"takenBy"`
+		Participants []int64 `json:"participants"`
+	}
+
+	// Credit is the amount of coins to add to the wallet of the user
+	Credit struct {
+		UserId int64
+		Amount int64
+	}
+)
+
+func NewQuest(title string, reward int64, createdBy int64) *Quest {
+	return &Quest{
+		Title:        title,
+		Reward:       reward,
+		State:        QuestStateOpen,
+		CreatedBy:    createdBy,
+		TakenBy:      make([]int64, 0),
+		Participants: make([]int64, 0),
+	}
+}
+
+func (q *Quest) isActive() bool {
+	return q.State == QuestStateOpen || q.State == QuestStateTaken
+}
+
+func (q *Quest) take(userId int64) error {
+	if !q.isActive() {
+		return ErrorQuestNotActive
+	}
+
+	if !slices.Contains(q.TakenBy, userId) {
+		q.TakenBy = append(q.TakenBy, userId)
+	}
+
+	q.State = QuestStateTaken
+	return nil
+}
+
+// complete marks the quest done and splits the reward among participants
+func (q *Quest) complete(participants []int64) ([]*Credit, error) {
+	if !q.isActive() {
+		return nil, ErrorQuestNotActive
+	}
+
+	if len(participants) == 0 {
+		return nil, ErrorInvalidParameters
+	}
+
+	q.State = QuestStateDone
+	q.Participants = participants
+	shares := SplitAmount(q.Reward, len(participants))
+	credits := make([]*Credit, 0, len(participants))
+	for i, userId := range participants {
+		credits = append(credits, &Credit{UserId: userId, Amount: shares[i]})
+	}
+
+	return credits, nil
+}
+
+func (q *Quest) fail() error {
+	if !q.isActive() {
+		return ErrorQuestNotActive
+	}
+
+	q.State = QuestStateFail
+	return nil
+}
+
+// SplitAmount splits amount into n equal shares, the remainder is given by one coin to the first shares
+func SplitAmount(amount int64, n int) []int64 {
+	shares := make([]int64, n)
+	share := amount / int64(n)
+	remainder := amount % int64(n)
+	for i := range shares {
+		shares[i] = share
+		if int64(i) < remainder {
+			shares[i]++
+		}
+	}
+
+	return shares
+}
+
+func (api *dndUtilBotApi) userNamesText(userIds []int64) string {
+	names := make([]string, 0, len(userIds))
+	for _, userId := range userIds {
+		names = append(names, api.ownerName(userId))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// userIdsParams resolves `@a @b` parameters, duplicates are ignored
+func (api *dndUtilBotApi) userIdsParams(params []string) (userIds []int64, unknown string, ok bool) {
+	userIds = make([]int64, 0, len(params))
+	for _, param := range params {
+		userId, ok := api.userIdByUserName(param)
+		if !ok {
+			return nil, param, false
+		}
+
+		if !slices.Contains(userIds, userId) {
+			userIds = append(userIds, userId)
+		}
+	}
+
+	return userIds, "", true
+}
+
+func (api *dndUtilBotApi) quest(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return api.quests(upd)
+	}
+
+	if params[1] == questSubcommandTake {
+		return api.questTake(upd, params[2:])
+	}
+
+	isAdmin, err := api.isRelatedMemberAdmin(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin {
+		return nil, ErrorRightsViolation
+	}
+
+	switch params[1] {
+	case questSubcommandAdd:
+		return api.questAdd(upd, params[2:])
+	case questSubcommandComplete:
+		return api.questComplete(upd, params[2:])
+	case questSubcommandFail:
+		return api.questFail(upd, params[2:])
+	default:
+		return nil, ErrorInvalidParameters
+	}
+}
+
+func parseQuestId(params []string) (int64, error) {
+	if len(params) < 1 {
+		return 0, ErrorInvalidParameters
+	}
+
+	questId, err := strconv.ParseInt(strings.TrimPrefix(params[0], "#"), 10, 64)
+	if err != nil {
+		return 0, ErrorInvalidIntegerParameter
+	}
+
+	return questId, nil
+}
+
+// questAdd handles `/quest add Спасти кота reward=50`
+func (api *dndUtilBotApi) questAdd(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	if len(params) < 2 || !strings.HasPrefix(params[len(params)-1], questRewardParamPrefix) {
+		return nil, ErrorInvalidParameters
+	}
+
+	reward, err := parsePrice(strings.TrimPrefix(params[len(params)-1], questRewardParamPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.Join(params[:len(params)-1], " ")
+	if len([]rune(title)) > questMaxTitleLength {
+		return nil, ErrorInvalidParameters
+	}
+
+	quest := NewQuest(title, reward, upd.SentFrom().ID)
+	questId, err := api.storage.CreateQuest(upd.FromChat().ID, quest)
+	if err != nil {
+		return nil, fmt.Errorf("error during CreateQuest %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageQuestCreated, questId, title, reward))
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) questTake(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	questId, err := parseQuestId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var title string
+	err = api.storage.UpdateQuest(upd.FromChat().ID, questId, func(quest *Quest) error {
+		title = quest.Title
+		return quest.take(upd.SentFrom().ID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during UpdateQuest %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(
+		upd.FromChat().ID,
+		fmt.Sprintf(messageQuestTaken, addAt(upd.SentFrom().UserName), questId, title),
+	)
+	return &msg, nil
+}
+
+// questComplete handles `/quest complete 3 @a @b`, without usernames the reward is split among those who took the quest
+func (api *dndUtilBotApi) questComplete(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	questId, err := parseQuestId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	participants, unknown, ok := api.userIdsParams(params[1:])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, unknown))
+		return &msg, nil
+	}
+
+	var completed *Quest
+	var credits []*Credit
+	err = api.storage.CompleteQuest(upd.FromChat().ID, questId, func(quest *Quest) ([]*Credit, error) {
+		if len(participants) == 0 {
+			participants = quest.TakenBy
+		}
+
+		var err error
+		credits, err = quest.complete(participants)
+		completed = quest
+		return credits, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during CompleteQuest %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, messageQuestCompleted, questId, completed.Title)
+	sb.WriteString(messageQuestRewardFromTreasury)
+	for _, credit := range credits {
+		fmt.Fprintf(&sb, messageQuestReward, api.ownerName(credit.UserId), credit.Amount)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, sb.String())
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) questFail(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	questId, err := parseQuestId(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var title string
+	err = api.storage.UpdateQuest(upd.FromChat().ID, questId, func(quest *Quest) error {
+		title = quest.Title
+		return quest.fail()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during UpdateQuest %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageQuestFailed, questId, title))
+	return &msg, nil
+}
+
+// quests lists active quests and the last finished ones
+func (api *dndUtilBotApi) quests(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	quests, err := api.storage.GetQuests(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetQuests %w", err)
+	}
+
+	if len(quests) == 0 {
+		msg := tgbotapi.NewMessage(chatId, messageQuestsEmpty)
+		return &msg, nil
+	}
+
+	slices.SortFunc(quests, func(a, b *Quest) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+
+	active := make([]*Quest, 0, len(quests))
+	finished := make([]*Quest, 0, len(quests))
+	for _, quest := range quests {
+		if quest.isActive() {
+			active = append(active, quest)
+		} else {
+			finished = append(finished, quest)
+		}
+	}
+
+	finished = finished[max(len(finished)-questsListFinishedLimit, 0):]
+	var sb strings.Builder
+	sb.WriteString(messageQuestsHeader)
+	for _, quest := range append(active, finished...) {
+		fmt.Fprintf(&sb, messageQuestsItem, quest.Id, quest.Title, quest.Reward, questStateLabels[quest.State])
+		switch {
+		case quest.State == QuestStateDone:
+			fmt.Fprintf(&sb, messageQuestsParticipants, api.userNamesText(quest.Participants))
+		case len(quest.TakenBy) > 0 && quest.isActive():
+			fmt.Fprintf(&sb, messageQuestsParticipants, api.userNamesText(quest.TakenBy))
+		}
+
+		sb.WriteString("\n")
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
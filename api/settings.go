@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Settings are the settings of the running bot, SetSettings replaces them without the restart
+type Settings struct {
+	// ConversationTimeout is the time the conversation waits for the next message
+	ConversationTimeout time.Duration
+	// PendingTransferTimeout is the time the pending transfer waits for the confirmation
+	PendingTransferTimeout time.Duration
+	// ImportTimeout is the time the import preview waits for the confirmation
+	ImportTimeout time.Duration
+	// DisabledCommands are the command keys the bot answers as not implemented
+	DisabledCommands []string
+}
+
+func DefaultSettings() *Settings {
+	return &Settings{
+		ConversationTimeout:    conversationTimeout,
+		PendingTransferTimeout: pendingTransferTimeout,
+		ImportTimeout:          importTimeout,
+	}
+}
+
+// Validate returns all the problems of the settings at once
+func (s *Settings) Validate() error {
+	var errs []error
+	for name, timeout := range map[string]time.Duration{
+		"conversation timeout":     s.ConversationTimeout,
+		"pending transfer timeout": s.PendingTransferTimeout,
+		"import timeout":           s.ImportTimeout,
+	} {
+		if timeout <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", name, timeout))
+		}
+	}
+
+	for _, commandKey := range s.DisabledCommands {
+		if !isKnownCommandKey(commandKey) {
+			errs = append(errs, fmt.Errorf("unknown command %s can't be disabled", commandKey))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Settings) isDisabled(commandKey string) bool {
+	return slices.Contains(s.DisabledCommands, commandKey)
+}
+
+func isKnownCommandKey(commandKey string) bool {
+	for _, commandsMap := range chatTypeToCommandMap {
+		if _, ok := commandsMap[commandKey]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetSettings replaces the settings, it is safe while the updates are handled
+func (api *dndUtilBotApi) SetSettings(settings *Settings) {
+	api.settings.Store(settings)
+}
+
+func (api *dndUtilBotApi) currentSettings() *Settings {
+	return api.settings.Load()
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ShopUnlimitedStock is the stock of the item which never runs out
+	ShopUnlimitedStock = -1
+
+	ItemTransferKindBuy = "buy"
+
+	shopSubcommandAdd    = "add"
+	shopSubcommandDelete = "del"
+	shopStockParamPrefix = "stock="
+	shopGoldSuffix       = "g"
+)
+
+type (
+	// ShopItem is the position of the chat shop catalog, items are matched by ItemKey
+	ShopItem struct {
+		Name  string `json:"name"`
+		Price int64  `json:"price"`
+		Stock int    `json:"stock"`
+	}
+)
+
+// TotalPrice returns the price of quantity items, ErrorInsufficientMoney if it exceeds any possible balance
+func (item *ShopItem) TotalPrice(quantity int) (int64, error) {
+	if item.Price > 0 && int64(quantity) > MaxBalance/item.Price {
+		return 0, ErrorInsufficientMoney
+	}
+
+	return item.Price * int64(quantity), nil
+}
+
+// TakeFromStock decrements the stock, unlimited stock is kept as is
+func (item *ShopItem) TakeFromStock(quantity int) error {
+	if item.Stock == ShopUnlimitedStock {
+		return nil
+	}
+
+	if item.Stock < quantity {
+		return ErrorOutOfStock
+	}
+
+	item.Stock -= quantity
+	return nil
+}
+
+// parsePrice parses price in gold coins: `15g` or `15`
+func parsePrice(param string) (int64, error) {
+	price, err := strconv.ParseInt(strings.TrimSuffix(strings.ToLower(param), shopGoldSuffix), 10, 64)
+	if err != nil || price < 0 || price > MaxBalance {
+		return 0, ErrorInvalidIntegerParameter
+	}
+
+	return price, nil
+}
+
+func (api *dndUtilBotApi) shop(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return api.shopCatalog(upd)
+	}
+
+	isAdmin, err := api.isRelatedMemberAdmin(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isAdmin {
+		return nil, ErrorRightsViolation
+	}
+
+	switch params[1] {
+	case shopSubcommandAdd:
+		return api.shopAdd(upd, params[2:])
+	case shopSubcommandDelete:
+		return api.shopDelete(upd, params[2:])
+	default:
+		return nil, ErrorInvalidParameters
+	}
+}
+
+func (api *dndUtilBotApi) shopCatalog(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	items, err := api.storage.GetShopItems(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetShopItems %w", err)
+	}
+
+	if len(items) == 0 {
+		msg := tgbotapi.NewMessage(chatId, messageShopEmpty)
+		return &msg, nil
+	}
+
+	slices.SortFunc(items, func(a, b *ShopItem) int {
+		return strings.Compare(ItemKey(a.Name), ItemKey(b.Name))
+	})
+
+	var sb strings.Builder
+	sb.WriteString(messageShopHeader)
+	for _, item := range items {
+		fmt.Fprintf(&sb, messageShopItem, item.Name, item.Price)
+		switch item.Stock {
+		case ShopUnlimitedStock:
+		case 0:
+			sb.WriteString(messageShopItemOutOfStock)
+		default:
+			fmt.Fprintf(&sb, messageShopItemStock, item.Stock)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(messageShopBuyHint)
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
+
+// shopAdd handles `/shop add "Верёвка 50ft" 1g stock=5`, adding existing item updates its price and stock
+func (api *dndUtilBotApi) shopAdd(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	stock := ShopUnlimitedStock
+	if len(params) > 0 && strings.HasPrefix(params[len(params)-1], shopStockParamPrefix) {
+		var err error
+		stock, err = strconv.Atoi(strings.TrimPrefix(params[len(params)-1], shopStockParamPrefix))
+		if err != nil || stock < 0 || stock > ItemMaxQuantity {
+			return nil, ErrorInvalidIntegerParameter
+		}
+
+		params = params[:len(params)-1]
+	}
+
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	price, err := parsePrice(params[len(params)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name, _, err := parseItemParams(params[:len(params)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	item := &ShopItem{Name: name, Price: price, Stock: stock}
+	err = api.storage.SaveShopItem(upd.FromChat().ID, item)
+	if err != nil {
+		return nil, fmt.Errorf("error during SaveShopItem %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageShopItemSaved, item.Name, item.Price))
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) shopDelete(upd *tgbotapi.Update, params []string) (tgbotapi.Chattable, error) {
+	name, _, err := parseItemParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = api.storage.DeleteShopItem(upd.FromChat().ID, name)
+	if err != nil {
+		return nil, fmt.Errorf("error during DeleteShopItem %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageShopItemDeleted, name))
+	return &msg, nil
+}
+
+// buy handles `/buy "Верёвка 50ft" 2`
+func (api *dndUtilBotApi) buy(ctx context.Context, upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	name, quantity, err := parseItemParams(api.getParams(upd.Message.Text)[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	// the balance is read in the same transaction so the message shows what's left right after the purchase
+	chatId := upd.FromChat().ID
+	var item *ShopItem
+	var balance int64
+	err = api.storage.WithTx(ctx, func(tx StorageTx) error {
+		item, err = tx.BuyItem(chatId, upd.SentFrom().ID, name, quantity)
+		if err != nil {
+			return fmt.Errorf("error during BuyItem %w", err)
+		}
+
+		balance, err = tx.GetUserBalance(chatId, upd.SentFrom().ID)
+		if err != nil {
+			return fmt.Errorf("error during GetUserBalance %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	total, _ := item.TotalPrice(quantity)
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(messageShopBought, item.Name, quantity, total, balance))
+	return &msg, nil
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		param    string
+		expected int64
+		err      error
+	}{
+		{"15", 15, nil},
+		{"15g", 15, nil},
+		{"15G", 15, nil},
+		{"0", 0, nil},
+		{"1000000000000g", MaxBalance, nil},
+		{"1000000000001", 0, ErrorInvalidIntegerParameter},
+		{"-1", 0, ErrorInvalidIntegerParameter},
+		{"g", 0, ErrorInvalidIntegerParameter},
+		{"15gg", 0, ErrorInvalidIntegerParameter},
+		{"1.5", 0, ErrorInvalidIntegerParameter},
+		{"", 0, ErrorInvalidIntegerParameter},
+	}
+	for _, test := range tests {
+		t.Run(test.param, func(t *testing.T) {
+			price, err := parsePrice(test.param)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+
+			if price != test.expected {
+				t.Errorf("expected price %d, got %d", test.expected, price)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"strings"
+	"time"
+)
+
+const (
+	// TreasuryAccountId is the wallet of the party, it lives in the balances keyspace along with the players' wallets
+	// and is shared with the party stash
+	TreasuryAccountId = StashOwnerId
+	// ExternalAccountId is the source of coins coming from outside of the chat economy e.g. loot
+	ExternalAccountId int64 = -1
+
+	MoneyTransferKindDeposit     = "deposit"
+	MoneyTransferKindWithdraw    = "withdraw"
+	MoneyTransferKindQuest       = "quest"
+	MoneyTransferKindLoot        = "loot"
+	MoneyTransferKindSend        = "send"
+	MoneyTransferKindTransaction = "transaction"
+	MoneyTransferKindBuy         = ItemTransferKindBuy
+
+	treasuryTransfersLogLength = 10
+)
+
+var (
+	moneyTransferKindLabels = map[string]string{
+		MoneyTransferKindDeposit:     "взнос",
+		MoneyTransferKindWithdraw:    "выдача",
+		MoneyTransferKindQuest:       "награда за квест",
+		MoneyTransferKindLoot:        "добыча",
+		MoneyTransferKindSend:        "перевод",
+		MoneyTransferKindTransaction: "перевод админом",
+		MoneyTransferKindBuy:         "покупка",
+	}
+)
+
+type (
+	// MoneyTransfer is the ledger record of the coins movement between accounts
+	MoneyTransfer struct {
+		Id      int64     `json:"id"`
+		Kind    string    `json:"kind"`
+		FromId  int64     `json:"fromId"`
+		ToId    int64     `json:"toId"`
+		ActorId int64     `json:"actorId"`
+		Amount  int64     `json:"amount"`
+		Time    time.Time `json:"time"`
+	}
+)
+
+func (api *dndUtilBotApi) accountName(accountId int64) string {
+	switch accountId {
+	case TreasuryAccountId:
+		return messageTreasuryName
+	case ExternalAccountId:
+		return ""
+	default:
+		return api.ownerName(accountId)
+	}
+}
+
+// deposit handles `/deposit 20`, coins go from the wallet of the sender to the treasury
+func (api *dndUtilBotApi) deposit(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 2 {
+		return nil, ErrorInvalidParameters
+	}
+
+	amount, err := parseAmount(params[1])
+	if err != nil {
+		return nil, err
+	}
+
+	from := upd.SentFrom()
+	err = api.storage.TransferMoney(upd.FromChat().ID, &MoneyTransfer{
+		Kind:    MoneyTransferKindDeposit,
+		FromId:  from.ID,
+		ToId:    TreasuryAccountId,
+		ActorId: from.ID,
+		Amount:  amount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during TransferMoney %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageTreasuryDeposit, addAt(from.UserName), amount))
+	return &msg, nil
+}
+
+// withdraw handles `/withdraw 20 @user`, coins go from the treasury to the wallet of the user
+func (api *dndUtilBotApi) withdraw(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	params := api.getParams(upd.Message.Text)
+	if len(params) < 3 {
+		return nil, ErrorInvalidParameters
+	}
+
+	amount, err := parseAmount(params[1])
+	if err != nil {
+		return nil, err
+	}
+
+	toId, ok := api.userIdByUserName(params[2])
+	if !ok {
+		msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, params[2]))
+		return &msg, nil
+	}
+
+	err = api.storage.TransferMoney(upd.FromChat().ID, &MoneyTransfer{
+		Kind:    MoneyTransferKindWithdraw,
+		FromId:  TreasuryAccountId,
+		ToId:    toId,
+		ActorId: upd.SentFrom().ID,
+		Amount:  amount,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error during TransferMoney %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(upd.FromChat().ID, fmt.Sprintf(messageTreasuryWithdraw, amount, addAt(params[2])))
+	return &msg, nil
+}
+
+func (api *dndUtilBotApi) treasury(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	balance, err := api.storage.GetTreasuryBalance(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetTreasuryBalance %w", err)
+	}
+
+	transfers, err := api.storage.GetMoneyTransfers(chatId, TreasuryAccountId, treasuryTransfersLogLength)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetMoneyTransfers %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, messageTreasuryBalance, balance)
+	if len(transfers) > 0 {
+		sb.WriteString(messageTreasuryTransfersHeader)
+	}
+
+	for _, transfer := range transfers {
+		sign := "+"
+		counterpart := transfer.FromId
+		if transfer.FromId == TreasuryAccountId {
+			sign = "−"
+			counterpart = transfer.ToId
+		}
+
+		line := fmt.Sprintf(
+			messageTreasuryTransfer,
+			transfer.Time.Format(itemTransferTimeLayout),
+			sign,
+			transfer.Amount,
+			moneyTransferKindLabels[transfer.Kind],
+			api.accountName(counterpart),
+		)
+		sb.WriteString(strings.TrimSpace(line))
+		sb.WriteString("\n")
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	richDefaultLimit = 10
+	richMaxLimit     = 50
+)
+
+var (
+	// wealthBrackets are the lower bounds of the wallet distribution brackets, the first one counts debtors
+	wealthBrackets = []int64{-MaxBalance, 0, 1, 10, 100, 1000, 10000}
+)
+
+type (
+	// Wallet is the balance of the player in the chat
+	Wallet struct {
+		UserId  int64 `json:"userId"`
+		Balance int64 `json:"balance"`
+	}
+
+	// AccountStats are the totals of the ledger records of the account
+	AccountStats struct {
+		Sent          int64
+		SentCount     int
+		Received      int64
+		ReceivedCount int
+	}
+)
+
+// Add counts the ledger record if the account is its sender or recipient
+func (stats *AccountStats) Add(accountId int64, transfer *MoneyTransfer) {
+	if transfer.FromId == accountId {
+		stats.Sent += transfer.Amount
+		stats.SentCount++
+	}
+
+	if transfer.ToId == accountId {
+		stats.Received += transfer.Amount
+		stats.ReceivedCount++
+	}
+}
+
+// sortWallets sorts wallets from the richest one, equal balances are ordered by user id to keep places stable
+func sortWallets(wallets []*Wallet) {
+	slices.SortFunc(wallets, func(a, b *Wallet) int {
+		if a.Balance != b.Balance {
+			return cmp.Compare(b.Balance, a.Balance)
+		}
+
+		return cmp.Compare(a.UserId, b.UserId)
+	})
+}
+
+func median(wallets []*Wallet) int64 {
+	if len(wallets) == 0 {
+		return 0
+	}
+
+	balances := make([]int64, 0, len(wallets))
+	for _, wallet := range wallets {
+		balances = append(balances, wallet.Balance)
+	}
+
+	slices.Sort(balances)
+	middle := len(balances) / 2
+	if len(balances)%2 == 1 {
+		return balances[middle]
+	}
+
+	return (balances[middle-1] + balances[middle]) / 2
+}
+
+func wealthBracketLabel(i int) string {
+	lower := wealthBrackets[i]
+	if i == 0 {
+		return messageWealthDebtors
+	}
+
+	if i == len(wealthBrackets)-1 {
+		return fmt.Sprintf("%d+", lower)
+	}
+
+	upper := wealthBrackets[i+1] - 1
+	if lower == upper {
+		return strconv.FormatInt(lower, 10)
+	}
+
+	return fmt.Sprintf("%d–%d", lower, upper)
+}
+
+// rich handles `/rich [N]`, the top N wallets of the chat
+func (api *dndUtilBotApi) rich(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	limit := richDefaultLimit
+	params := api.getParams(upd.Message.Text)
+	if len(params) > 1 {
+		var err error
+		limit, err = strconv.Atoi(params[1])
+		if err != nil || limit <= 0 || limit > richMaxLimit {
+			return nil, ErrorInvalidIntegerParameter
+		}
+	}
+
+	chatId := upd.FromChat().ID
+	wallets, err := api.storage.GetChatWallets(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatWallets %w", err)
+	}
+
+	sortWallets(wallets)
+	var sb strings.Builder
+	sb.WriteString(messageRichHeader)
+	for i, wallet := range wallets[:min(limit, len(wallets))] {
+		fmt.Fprintf(&sb, messageRichItem, i+1, api.ownerName(wallet.UserId), wallet.Balance)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
+
+// wealth handles `/wealth`, total coins of the players, the median wallet and the distribution of wallets
+func (api *dndUtilBotApi) wealth(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	chatId := upd.FromChat().ID
+	wallets, err := api.storage.GetChatWallets(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatWallets %w", err)
+	}
+
+	treasury, err := api.storage.GetTreasuryBalance(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetTreasuryBalance %w", err)
+	}
+
+	var total int64
+	distribution := make([]int, len(wealthBrackets))
+	for _, wallet := range wallets {
+		total += wallet.Balance
+		bracket, found := slices.BinarySearch(wealthBrackets, wallet.Balance)
+		if !found {
+			bracket--
+		}
+
+		distribution[bracket]++
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, messageWealth, total, len(wallets), median(wallets), treasury)
+	for i, count := range distribution {
+		if count > 0 {
+			fmt.Fprintf(&sb, messageWealthBracket, wealthBracketLabel(i), count)
+		}
+	}
+
+	msg := tgbotapi.NewMessage(chatId, sb.String())
+	return &msg, nil
+}
+
+// stats handles `/stats [@username]`, the balance, the place among the players and the totals of the ledger
+func (api *dndUtilBotApi) stats(upd *tgbotapi.Update) (tgbotapi.Chattable, error) {
+	err := validateUsernameIsNotHidden(upd)
+	if err != nil {
+		return nil, err
+	}
+
+	userId := upd.SentFrom().ID
+	params := api.getParams(upd.Message.Text)
+	if len(params) > 1 {
+		var ok bool
+		userId, ok = api.userIdByUserName(params[1])
+		if !ok {
+			msg := tgbotapi.NewMessage(upd.Message.Chat.ID, fmt.Sprintf(messageNotRegistered, params[1]))
+			return &msg, nil
+		}
+	}
+
+	chatId := upd.FromChat().ID
+	wallets, err := api.storage.GetChatWallets(chatId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetChatWallets %w", err)
+	}
+
+	sortWallets(wallets)
+	place := slices.IndexFunc(wallets, func(wallet *Wallet) bool {
+		return wallet.UserId == userId
+	})
+	if place < 0 {
+		return nil, ErrorNotRegistered
+	}
+
+	stats, err := api.storage.GetAccountStats(chatId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error during GetAccountStats %w", err)
+	}
+
+	msg := tgbotapi.NewMessage(chatId, fmt.Sprintf(
+		messageStats,
+		api.ownerName(userId),
+		wallets[place].Balance,
+		place+1,
+		len(wallets),
+		stats.Sent,
+		stats.SentCount,
+		stats.Received,
+		stats.ReceivedCount,
+	))
+	return &msg, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/admin"
+	"github.com/Refreezer/dnd-util-bot/api"
+	. "github.com/Refreezer/dnd-util-bot/internal"
+	"github.com/Refreezer/dnd-util-bot/internal/boltStorage"
+	"github.com/Refreezer/dnd-util-bot/internal/mapStorage"
+	"github.com/Refreezer/dnd-util-bot/internal/sqliteStorage"
+	. "github.com/Refreezer/dnd-util-bot/logging"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	backupDownloadTimeout = 5 * time.Minute
+)
+
+const (
+	subcommandsUsage = "usage: dnd-util-bot backup <file> | restore <file> | migrate-to-sqlite <sqlite file> | healthcheck |\n" +
+		"\tbalances list --chat <id> | balances set --chat <id> <@user name or user id> <balance> |\n" +
+		"\tusers lookup <user name> | db stats | db compact"
+)
+
+// runSubcommand runs `backup <file>` or `restore <file>` against the db at DND_UTIL_DB_PATH
+// or `migrate-to-sqlite <sqlite file>` which copies the bolt db at DND_UTIL_DB_PATH to the new sqlite db.
+// `healthcheck` exits with 1 if the running bot isn't healthy or ready, manageCommands fix the bolt db of the stopped bot
+func runSubcommand(debug bool, config *Config, args []string) {
+	provider := &loggerProvider{Debug: debug}
+	if runManageCommand(provider, config, args) {
+		return
+	}
+
+	if len(args) == 1 && args[0] == "healthcheck" {
+		err := healthcheck(config)
+		if err != nil {
+			Logger.Fatalf("healthcheck failed %s", err)
+		}
+
+		return
+	}
+
+	if len(args) != 2 {
+		Logger.Fatal(subcommandsUsage)
+	}
+
+	dbname := config.Storage.Path
+	driver := config.Storage.Driver
+	switch args[0] {
+	case "backup":
+		backupDbFile := boltStorage.BackupDbFile
+		switch driver {
+		case dbDriverSqlite:
+			backupDbFile = sqliteStorage.BackupDbFile
+		case dbDriverMemory:
+			backupDbFile = mapStorage.BackupDbFile
+		}
+
+		err := backupDbFile(provider, dbname, args[1])
+		if errors.Is(err, boltStorage.ErrorDbLocked) && config.Admin.Addr != EmptyString {
+			Logger.Infof("%s, downloading the snapshot from the running bot", err)
+			err = downloadBackup(config.Admin, args[1])
+		} else if errors.Is(err, boltStorage.ErrorDbLocked) {
+			Logger.Fatal(lockedBackupHint(err, config.Storage))
+		}
+
+		if err != nil {
+			Logger.Fatalf("backup failed %s", err)
+		}
+
+		Logger.Infof("db %s is saved to %s", dbname, args[1])
+	case "restore":
+		restore := boltStorage.Restore
+		switch driver {
+		case dbDriverSqlite:
+			restore = sqliteStorage.Restore
+		case dbDriverMemory:
+			restore = mapStorage.Restore
+		}
+
+		err := restore(provider, dbname, args[1])
+		if errors.Is(err, boltStorage.ErrorDbLocked) {
+			Logger.Fatalf("%s. Stop the bot before restoring the db", err)
+		}
+
+		if err != nil {
+			Logger.Fatalf("restore failed %s", err)
+		}
+	case "migrate-to-sqlite":
+		err := migrateBoltToSqlite(provider, dbname, args[1])
+		if errors.Is(err, boltStorage.ErrorDbLocked) {
+			Logger.Fatalf("%s. Stop the bot before migrating the db", err)
+		}
+
+		if err != nil {
+			Logger.Fatalf("migration failed %s", err)
+		}
+	default:
+		Logger.Fatalf("unknown command %s, %s", args[0], subcommandsUsage)
+	}
+}
+
+// lockedBackupHint explains how to back up the db locked by the running bot, SIGUSR1 is handled
+// only when the scheduled backups are configured
+func lockedBackupHint(err error, config StorageConfig) string {
+	hint := fmt.Sprintf("%s. Set admin.addr (%s) so the backup is downloaded from the running bot", err, DndUtilAdminAddr)
+	if config.BackupDir == EmptyString {
+		return hint
+	}
+
+	return fmt.Sprintf("%s or send it SIGUSR1 to write a snapshot to %s, e.g. `docker kill --signal=USR1 dnd-util-bot`", hint, config.BackupDir)
+}
+
+// downloadBackup saves the snapshot taken by the bot running the admin api at config.Addr
+func downloadBackup(config AdminConfig, path string) error {
+	host, port, _ := net.SplitHostPort(config.Addr)
+	if ip := net.ParseIP(host); host == EmptyString || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	request, err := http.NewRequest(http.MethodGet, "http://"+net.JoinHostPort(host, port)+admin.Prefix+"/backup", nil)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", "Bearer "+config.Token)
+	client := &http.Client{Timeout: backupDownloadTimeout}
+	resp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %d: %s", request.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, resp.Body)
+	if err == nil && resp.ContentLength >= 0 && written != resp.ContentLength {
+		err = fmt.Errorf("the snapshot is cut off at %d of %d bytes", written, resp.ContentLength)
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// scheduleBackups writes a snapshot to the backup dir every interval and on SIGUSR1 and keeps the latest retention ones
+func scheduleBackups(ctx context.Context, storage botStorage, config StorageConfig) {
+	if config.BackupDir == EmptyString {
+		return
+	}
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGUSR1)
+	var tick <-chan time.Time
+	if config.BackupInterval > 0 {
+		ticker := time.NewTicker(config.BackupInterval)
+		tick = ticker.C
+		defer ticker.Stop()
+	}
+
+	defer signal.Stop(signalChannel)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+		case <-signalChannel:
+		}
+
+		err := backup(storage, config.BackupDir, config.BackupRetention)
+		if err != nil {
+			Logger.Errorf("scheduled backup failed %s", err)
+		}
+	}
+}
+
+func backup(storage botStorage, dir string, retention int) error {
+	path := filepath.Join(dir, time.Now().Format(api.BackupFileNameLayout))
+	err := storage.BackupToFile(path)
+	if err != nil {
+		return err
+	}
+
+	Logger.Infof("db is saved to %s", path)
+	return pruneBackups(dir, retention)
+}
+
+// pruneBackups removes all but the latest retention backups, the file names sort by time
+func pruneBackups(dir string, retention int) error {
+	backups, err := filepath.Glob(filepath.Join(dir, api.BackupFileNameGlob))
+	if err != nil || len(backups) <= retention {
+		return err
+	}
+
+	slices.Sort(backups)
+	for _, path := range backups[:len(backups)-retention] {
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
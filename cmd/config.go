@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	. "github.com/Refreezer/dnd-util-bot/internal"
+	. "github.com/Refreezer/dnd-util-bot/logging"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	dbDriverBolt   = "bolt"
+	dbDriverSqlite = "sqlite"
+	// dbDriverMemory keeps the storage in memory, the storage path is the snapshot and the write-ahead log is next to it
+	dbDriverMemory = "memory"
+
+	localeRu = "ru"
+
+	maxRateLimitRps = 1000
+	// minAdminTokenLength keeps the admin token from being guessed
+	minAdminTokenLength = 16
+)
+
+type (
+	// Config is read from the yaml file, the environment variables override it. The settings of Listener.RateLimitRps,
+	// Limits, Logging.Format and Features are reloaded on SIGHUP, the others need the restart
+	Config struct {
+		Telegram TelegramConfig `yaml:"telegram" json:"telegram"`
+		Listener ListenerConfig `yaml:"listener" json:"listener"`
+		Limits   LimitsConfig   `yaml:"limits" json:"limits"`
+		Storage  StorageConfig  `yaml:"storage" json:"storage"`
+		Http     HttpConfig     `yaml:"http" json:"http"`
+		Admin    AdminConfig    `yaml:"admin" json:"admin"`
+		Logging  LoggingConfig  `yaml:"logging" json:"logging"`
+		// Locale is the language of the bot messages, only ru is supported
+		Locale   string         `yaml:"locale" json:"locale"`
+		Features FeaturesConfig `yaml:"features" json:"features"`
+	}
+
+	TelegramConfig struct {
+		ApiKey  string `yaml:"apiKey" json:"-"`
+		BotName string `yaml:"botName" json:"botName"`
+		// OwnerId is the user allowed to get the db backups, nobody if zero
+		OwnerId int64 `yaml:"ownerId" json:"ownerId"`
+	}
+
+	ListenerConfig struct {
+		// LongPollingTimeout is the getUpdates timeout in seconds
+		LongPollingTimeout int `yaml:"longPollingTimeout" json:"longPollingTimeout"`
+		RateLimitRps       int `yaml:"rateLimitRps" json:"rateLimitRps"`
+	}
+
+	LimitsConfig struct {
+		ConversationTimeout    time.Duration `yaml:"conversationTimeout" json:"conversationTimeout"`
+		PendingTransferTimeout time.Duration `yaml:"pendingTransferTimeout" json:"pendingTransferTimeout"`
+		ImportTimeout          time.Duration `yaml:"importTimeout" json:"importTimeout"`
+	}
+
+	StorageConfig struct {
+		Driver           string        `yaml:"driver" json:"driver"`
+		Path             string        `yaml:"path" json:"path"`
+		SnapshotInterval time.Duration `yaml:"snapshotInterval" json:"snapshotInterval"`
+		BackupDir        string        `yaml:"backupDir" json:"backupDir"`
+		BackupInterval   time.Duration `yaml:"backupInterval" json:"backupInterval"`
+		BackupRetention  int           `yaml:"backupRetention" json:"backupRetention"`
+	}
+
+	HttpConfig struct {
+		// Addr enables /metrics, /healthz and /readyz, e.g. :9090
+		Addr string `yaml:"addr" json:"addr"`
+	}
+
+	AdminConfig struct {
+		// Addr enables the admin api, keep it on the loopback interface e.g. 127.0.0.1:9091
+		Addr string `yaml:"addr" json:"addr"`
+		// Token is the bearer token of the admin api requests
+		Token string `yaml:"token" json:"-"`
+	}
+
+	LoggingConfig struct {
+		Format string `yaml:"format" json:"format"`
+		Debug  bool   `yaml:"debug" json:"debug"`
+	}
+
+	FeaturesConfig struct {
+		// DisabledCommands are the command keys the bot answers as not implemented, e.g. import
+		DisabledCommands []string `yaml:"disabledCommands" json:"disabledCommands"`
+	}
+
+	envOverride struct {
+		key   EnvKey
+		apply func(value string) error
+	}
+)
+
+func defaultConfig() *Config {
+	settings := api.DefaultSettings()
+	return &Config{
+		Listener: ListenerConfig{
+			LongPollingTimeout: 60,
+			RateLimitRps:       100,
+		},
+		Limits: LimitsConfig{
+			ConversationTimeout:    settings.ConversationTimeout,
+			PendingTransferTimeout: settings.PendingTransferTimeout,
+			ImportTimeout:          settings.ImportTimeout,
+		},
+		Storage: StorageConfig{
+			Driver:           dbDriverBolt,
+			SnapshotInterval: 5 * time.Minute,
+			BackupRetention:  7,
+		},
+		Logging: LoggingConfig{
+			Format: FormatText,
+		},
+		Locale: localeRu,
+	}
+}
+
+// loadConfig reads the file at path if it's set, applies the environment variables and validates the result,
+// all the problems are returned at once
+func loadConfig(path string) (*Config, error) {
+	config := defaultConfig()
+	if path != EmptyString {
+		err := config.readFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+
+	err := errors.Join(config.applyEnv(), config.validate())
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// readFile decodes the yaml strictly, the unknown keys are errors
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+func (c *Config) envOverrides() []envOverride {
+	return []envOverride{
+		{DndUtilTgApiKey, overrideString(&c.Telegram.ApiKey)},
+		{DndUtilBotName, overrideString(&c.Telegram.BotName)},
+		{DndUtilOwnerId, overrideInt64(&c.Telegram.OwnerId)},
+		{DndUtilLongPollingTimeout, overrideInt(&c.Listener.LongPollingTimeout)},
+		{DndUtilRateLimitRps, overrideInt(&c.Listener.RateLimitRps)},
+		{DndUtilConversationTimeout, overrideDuration(&c.Limits.ConversationTimeout)},
+		{DndUtilPendingTransferTimeout, overrideDuration(&c.Limits.PendingTransferTimeout)},
+		{DndUtilImportTimeout, overrideDuration(&c.Limits.ImportTimeout)},
+		{DndUtilDbDriver, overrideString(&c.Storage.Driver)},
+		{DndUtilDbPath, overrideString(&c.Storage.Path)},
+		{DndUtilSnapshotInterval, overrideDuration(&c.Storage.SnapshotInterval)},
+		{DndUtilBackupDir, overrideString(&c.Storage.BackupDir)},
+		{DndUtilBackupInterval, overrideDuration(&c.Storage.BackupInterval)},
+		{DndUtilBackupRetention, overrideInt(&c.Storage.BackupRetention)},
+		{DndUtilHttpAddr, overrideString(&c.Http.Addr)},
+		{DndUtilAdminAddr, overrideString(&c.Admin.Addr)},
+		{DndUtilAdminToken, overrideString(&c.Admin.Token)},
+		{DndUtilLogFormat, overrideString(&c.Logging.Format)},
+		{DndUtilLocale, overrideString(&c.Locale)},
+		{DndUtilDisabledCommands, overrideList(&c.Features.DisabledCommands)},
+	}
+}
+
+// applyEnv overrides the config with the environment variables, the empty ones are ignored
+func (c *Config) applyEnv() error {
+	var errs []error
+	for _, override := range c.envOverrides() {
+		value := os.Getenv(string(override.key))
+		if value == EmptyString {
+			continue
+		}
+
+		err := override.apply(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s Environment variable is invalid %q: %w", override.key, value, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func overrideString(field *string) func(string) error {
+	return func(value string) error {
+		*field = value
+		return nil
+	}
+}
+
+func overrideInt(field *int) func(string) error {
+	return overrideParsed(field, strconv.Atoi)
+}
+
+func overrideInt64(field *int64) func(string) error {
+	return overrideParsed(field, func(value string) (int64, error) {
+		return strconv.ParseInt(value, 10, 64)
+	})
+}
+
+func overrideDuration(field *time.Duration) func(string) error {
+	return overrideParsed(field, time.ParseDuration)
+}
+
+// overrideParsed keeps the field if the value can't be parsed, so the error isn't followed by the validation one
+func overrideParsed[T any](field *T, parse func(string) (T, error)) func(string) error {
+	return func(value string) error {
+		parsed, err := parse(value)
+		if err != nil {
+			return err
+		}
+
+		*field = parsed
+		return nil
+	}
+}
+
+// overrideList splits the comma separated values
+func overrideList(field *[]string) func(string) error {
+	return func(value string) error {
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != EmptyString {
+				*field = append(*field, item)
+			}
+		}
+
+		return nil
+	}
+}
+
+// validate checks everything the subcommands and the bot need, validateBot checks the rest
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Telegram.OwnerId >= 0, "telegram.ownerId must not be negative, got %d", c.Telegram.OwnerId)
+	check(c.Listener.LongPollingTimeout >= 0, "listener.longPollingTimeout must not be negative, got %d", c.Listener.LongPollingTimeout)
+	check(
+		c.Listener.RateLimitRps > 0 && c.Listener.RateLimitRps <= maxRateLimitRps,
+		"listener.rateLimitRps must be from 1 to %d, got %d",
+		maxRateLimitRps,
+		c.Listener.RateLimitRps,
+	)
+	check(
+		c.Storage.Driver == dbDriverBolt || c.Storage.Driver == dbDriverSqlite || c.Storage.Driver == dbDriverMemory,
+		"storage.driver must be %s, %s or %s, got %q",
+		dbDriverBolt,
+		dbDriverSqlite,
+		dbDriverMemory,
+		c.Storage.Driver,
+	)
+	check(c.Storage.Path != EmptyString, "storage.path isn't set, set it or %s", DndUtilDbPath)
+	check(c.Storage.SnapshotInterval >= 0, "storage.snapshotInterval must not be negative, got %s", c.Storage.SnapshotInterval)
+	check(c.Storage.BackupInterval >= 0, "storage.backupInterval must not be negative, got %s", c.Storage.BackupInterval)
+	check(c.Storage.BackupRetention > 0, "storage.backupRetention must be positive, got %d", c.Storage.BackupRetention)
+	if c.Http.Addr != EmptyString {
+		_, _, err := net.SplitHostPort(c.Http.Addr)
+		check(err == nil, "http.addr is invalid %q: %v", c.Http.Addr, err)
+	}
+
+	if c.Admin.Addr != EmptyString {
+		_, _, err := net.SplitHostPort(c.Admin.Addr)
+		check(err == nil, "admin.addr is invalid %q: %v", c.Admin.Addr, err)
+		check(
+			len(c.Admin.Token) >= minAdminTokenLength,
+			"admin.token must be at least %d characters long when admin.addr is set, set it or %s",
+			minAdminTokenLength,
+			DndUtilAdminToken,
+		)
+		check(c.Admin.Addr != c.Http.Addr, "admin.addr and http.addr must differ, got %q", c.Admin.Addr)
+	}
+
+	check(
+		c.Logging.Format == FormatText || c.Logging.Format == FormatJson,
+		"logging.format must be %s or %s, got %q",
+		FormatText,
+		FormatJson,
+		c.Logging.Format,
+	)
+	check(c.Locale == localeRu, "locale %q isn't supported, use %s", c.Locale, localeRu)
+	err := c.settings().Validate()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("limits or features: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateBot checks the settings only the running bot needs
+func (c *Config) validateBot(debug bool) error {
+	var errs []error
+	if c.Telegram.ApiKey == EmptyString {
+		errs = append(errs, fmt.Errorf("telegram.apiKey isn't set, set it or %s", DndUtilTgApiKey))
+	}
+
+	if c.Telegram.BotName == EmptyString {
+		errs = append(errs, fmt.Errorf("telegram.botName isn't set, set it or %s", DndUtilBotName))
+	}
+
+	if !debug && c.Listener.LongPollingTimeout == 0 {
+		errs = append(errs, errors.New("listener.longPollingTimeout can't be zero in production mode"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// settings are the api settings reloaded on SIGHUP
+func (c *Config) settings() *api.Settings {
+	return &api.Settings{
+		ConversationTimeout:    c.Limits.ConversationTimeout,
+		PendingTransferTimeout: c.Limits.PendingTransferTimeout,
+		ImportTimeout:          c.Limits.ImportTimeout,
+		DisabledCommands:       c.Features.DisabledCommands,
+	}
+}
+
+// restartRequired returns the sections which changed but are applied after the restart only
+func (c *Config) restartRequired(next *Config) []string {
+	var sections []string
+	for name, fields := range map[string][2]any{
+		"telegram":                    {c.Telegram, next.Telegram},
+		"listener.longPollingTimeout": {c.Listener.LongPollingTimeout, next.Listener.LongPollingTimeout},
+		"storage":                     {c.Storage, next.Storage},
+		"http":                        {c.Http, next.Http},
+		"admin":                       {c.Admin, next.Admin},
+		"logging.debug":               {c.Logging.Debug, next.Logging.Debug},
+		"locale":                      {c.Locale, next.Locale},
+	} {
+		if !reflect.DeepEqual(fields[0], fields[1]) {
+			sections = append(sections, name)
+		}
+	}
+
+	slices.Sort(sections)
+	return sections
+}
+
+// reloaded returns the running config with the settings of next which are reloaded on SIGHUP,
+// the sections needing the restart keep the running values
+func (c *Config) reloaded(next *Config) *Config {
+	running := *c
+	running.Listener.RateLimitRps = next.Listener.RateLimitRps
+	running.Limits = next.Limits
+	running.Logging.Format = next.Logging.Format
+	running.Features = next.Features
+	return &running
+}
+
+// reloadConfigOnSighup reads the config again on SIGHUP and applies the settings which don't need the restart,
+// the invalid config is rejected and the previous one stays
+func reloadConfigOnSighup(ctx context.Context, path string, current *Config, apply func(next *Config)) {
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGHUP)
+	defer signal.Stop(signalChannel)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signalChannel:
+		}
+
+		next, err := loadConfig(path)
+		if err != nil {
+			Logger.Errorf("config isn't reloaded:\n%s", err)
+			continue
+		}
+
+		restartRequired := current.restartRequired(next)
+		if len(restartRequired) > 0 {
+			Logger.Warningf("%s changed, restart the bot to apply it", strings.Join(restartRequired, ", "))
+		}
+
+		current = current.reloaded(next)
+		apply(current)
+		Logger.Infof("config is reloaded")
+	}
+}
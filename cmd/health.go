@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api/listener"
+	. "github.com/Refreezer/dnd-util-bot/internal"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	readinessTimeout   = 3 * time.Second
+	healthcheckTimeout = 5 * time.Second
+)
+
+type (
+	// health is filled in while the bot starts, /healthz and /readyz are served before it's done
+	health struct {
+		mu       sync.RWMutex
+		botReady bool
+		storage  botStorage
+		listener listener.BotListener
+	}
+)
+
+// setBotReady is called after getMe succeeded
+func (h *health) setBotReady() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.botReady = true
+}
+
+func (h *health) setStorage(storage botStorage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.storage = storage
+}
+
+func (h *health) setListener(botListener listener.BotListener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listener = botListener
+}
+
+// alive fails if the listener is stuck, the starting bot is alive
+func (h *health) alive() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.listener == nil {
+		return nil
+	}
+
+	return h.listener.Healthy()
+}
+
+// ready fails until getMe succeeded, the db is open and the listener is started
+func (h *health) ready(ctx context.Context) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.botReady {
+		return errors.New("telegram getMe didn't succeed yet")
+	}
+
+	if h.storage == nil {
+		return errors.New("db isn't open yet")
+	}
+
+	err := h.storage.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	if h.listener == nil {
+		return errors.New("listener isn't started yet")
+	}
+
+	return nil
+}
+
+func (h *health) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	writeProbeResult(w, h.alive())
+}
+
+func (h *health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	writeProbeResult(w, h.ready(ctx))
+}
+
+func writeProbeResult(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, err.Error())
+		return
+	}
+
+	_, _ = io.WriteString(w, "ok")
+}
+
+// healthcheck requests /healthz and /readyz of the bot running at http.addr, it's the Dockerfile HEALTHCHECK
+func healthcheck(config *Config) error {
+	if config.Http.Addr == EmptyString {
+		return fmt.Errorf("http.addr isn't set, set it or %s", DndUtilHttpAddr)
+	}
+
+	host, port, _ := net.SplitHostPort(config.Http.Addr)
+	if host == EmptyString {
+		host = "127.0.0.1"
+	}
+
+	client := &http.Client{Timeout: healthcheckTimeout}
+	for _, probe := range []string{"/healthz", "/readyz"} {
+		resp, err := client.Get("http://" + net.JoinHostPort(host, port) + probe)
+		if err != nil {
+			return err
+		}
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s %d: %s", probe, resp.StatusCode, body)
+		}
+	}
+
+	return nil
+}
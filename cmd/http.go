@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/Refreezer/dnd-util-bot/admin"
+	"github.com/Refreezer/dnd-util-bot/api"
+	. "github.com/Refreezer/dnd-util-bot/internal"
+	. "github.com/Refreezer/dnd-util-bot/logging"
+	"github.com/Refreezer/dnd-util-bot/metrics"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	httpShutdownTimeout = 5 * time.Second
+)
+
+// serveHttp serves /metrics, /healthz and /readyz on addr until ctx is canceled, the empty addr disables the server
+func serveHttp(ctx context.Context, addr string, h *health) {
+	if addr == EmptyString {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+	listenAndServe(ctx, "http", addr, mux)
+}
+
+// serveAdmin serves the admin api until ctx is canceled, the empty addr disables it
+func serveAdmin(ctx context.Context, config AdminConfig, storage api.Storage, provider api.LoggerProvider) {
+	if config.Addr == EmptyString {
+		return
+	}
+
+	host, _, _ := net.SplitHostPort(config.Addr)
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		Logger.Warningf("admin api listens on %s which isn't the loopback interface", config.Addr)
+	}
+
+	listenAndServe(ctx, "admin", config.Addr, admin.NewHandler(storage, config.Token, provider))
+}
+
+func listenAndServe(ctx context.Context, name string, addr string, handler http.Handler) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: httpShutdownTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+		defer cancel()
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			Logger.Errorf("error while shutting down %s server %s", name, err)
+		}
+	}()
+
+	Logger.Infof("%s server listens on %s", name, addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		Logger.Errorf("%s server failed %s", name, err)
+	}
+}
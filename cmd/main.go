@@ -9,12 +9,13 @@ import (
 	"github.com/Refreezer/dnd-util-bot/api/listener"
 	. "github.com/Refreezer/dnd-util-bot/internal"
 	"github.com/Refreezer/dnd-util-bot/internal/boltStorage"
+	"github.com/Refreezer/dnd-util-bot/internal/sqliteStorage"
 	. "github.com/Refreezer/dnd-util-bot/logging"
+	"github.com/Refreezer/dnd-util-bot/metrics"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/op/go-logging"
 	"os"
 	"os/signal"
-	"strconv"
 	"syscall"
 )
 
@@ -22,13 +23,6 @@ type (
 	loggerProvider struct {
 		Debug bool
 	}
-	Environment struct {
-		tgApiKey       string
-		DndUtilBotName string `json:"dndUtilBotName"`
-		Timeout        int    `json:"timeout"`
-		RateLimitRps   int    `json:"rateLimitRps"`
-		DBname         string `json:"DBname"`
-	}
 )
 
 func (lp *loggerProvider) MustGetLogger(moduleName string) *logging.Logger {
@@ -38,49 +32,95 @@ func (lp *loggerProvider) MustGetLogger(moduleName string) *logging.Logger {
 }
 
 func main() {
-	env := parseEnvironmentVariables()
-	envJson, _ := json.MarshalIndent(&env, "", "    ")
-	Logger.Infof("Environment: %s", envJson)
-	debug := parseFlags()
-	validateConfiguration(debug, env.Timeout)
+	debug, migrateDryRun, configPath := parseFlags()
+	config, err := loadConfig(configPath)
+	if err != nil {
+		Logger.Fatalf("invalid configuration:\n%s", err)
+	}
+
+	debug = debug || config.Logging.Debug
+	initLogging(debug, config)
+	if migrateDryRun {
+		dryRunMigrations(debug, config)
+		return
+	}
+
+	if flag.NArg() > 0 {
+		runSubcommand(debug, config, flag.Args())
+		return
+	}
 
-	tgBotApi, err := tgbotapi.NewBotAPI(env.tgApiKey)
+	err = config.validateBot(debug)
+	if err != nil {
+		Logger.Fatalf("invalid configuration:\n%s", err)
+	}
+
+	configJson, _ := json.MarshalIndent(config, "", "    ")
+	Logger.Infof("Configuration: %s", configJson)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &health{}
+	go serveHttp(ctx, config.Http.Addr, h)
+
+	tgBotApi, err := tgbotapi.NewBotAPIWithClient(config.Telegram.ApiKey, tgbotapi.APIEndpoint, metrics.NewTelegramClient())
 	if err != nil {
 		Logger.Fatalf("error while initializing telegram bot api %s", err)
 	}
 
+	h.setBotReady()
+
 	loggerProvider := &loggerProvider{
 		Debug: debug,
 	}
-	storage, disposeStorage := boltStorage.NewBoltStorage(loggerProvider, env.DBname)
+	storage, disposeStorage := newStorage(loggerProvider, config.Storage.Driver, config.Storage.Path)
 	defer disposeStorage()
+	h.setStorage(storage)
+	go serveAdmin(ctx, config.Admin, storage, loggerProvider)
 
+	dndUtilApi := api.NewDndUtilApi(
+		tgBotApi,
+		loggerProvider,
+		storage,
+		config.Telegram.BotName,
+		config.Telegram.OwnerId,
+	)
+	dndUtilApi.SetSettings(config.settings())
 	botListener := listener.NewBotListener(
 		tgBotApi,
 		&listener.Config{
-			RateLimitRps:   100,
-			TgTimeout:      2,
-			AllowedUpdates: []string{tgbotapi.UpdateTypeMessage},
-			UpdateHandler: api.NewDndUtilApi(
-				tgBotApi,
-				loggerProvider,
-				storage,
-				env.DndUtilBotName,
-			),
+			RateLimitRps:   config.Listener.RateLimitRps,
+			TgTimeout:      config.Listener.LongPollingTimeout,
+			AllowedUpdates: []string{tgbotapi.UpdateTypeMessage, tgbotapi.UpdateTypeCallbackQuery},
+			UpdateHandler:  dndUtilApi,
 		},
 		loggerProvider,
 	)
 
-	ctx, cancel := context.WithCancel(context.Background())
 	waitForShutDown, err := botListener.ListenForUpdates(ctx)
 	listenForCancelContextRequest(cancel)
 	if err != nil {
 		Logger.Fatalf("error while starting bot listener %s", err)
 	}
 
+	h.setListener(botListener)
+
+	go scheduleBackups(ctx, storage, config.Storage)
+	go scheduleSnapshots(ctx, storage, config.Storage.SnapshotInterval)
+	go reloadConfigOnSighup(ctx, configPath, config, func(next *Config) {
+		botListener.SetRateLimitRps(next.Listener.RateLimitRps)
+		dndUtilApi.SetSettings(next.settings())
+		_ = SetFormat(next.Logging.Format)
+	})
+
 	defer waitForShutDown()
 }
 
+// initLogging applies the logging config to the global logger, the other loggers are initialized by loggerProvider
+func initLogging(debug bool, config *Config) {
+	_ = SetFormat(config.Logging.Format)
+	InitGlobalLogger(debug)
+}
+
 func listenForCancelContextRequest(cancel context.CancelFunc) {
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
@@ -103,51 +143,39 @@ func listenOsSignals(signalChannel chan os.Signal, cancel context.CancelFunc) {
 	}(signalChannel, cancel)
 }
 
-func validateConfiguration(debug bool, timeout int) {
-	if !debug && timeout == 0 {
-		Logger.Fatal("Timeout can't be zero in production mode")
-	}
-}
-
-func parseFlags() bool {
-	debug := flag.Bool("d", false, "Debug mode")
+// parseFlags parses the flags, the config path is -config or DND_UTIL_CONFIG, no config file if neither is set
+func parseFlags() (debug bool, migrateDryRun bool, configPath string) {
+	flag.BoolVar(&debug, "d", false, "Debug mode")
+	flag.BoolVar(&migrateDryRun, "migrate-dry-run", false, "Print pending db migrations and exit without applying them")
+	flag.StringVar(&configPath, "config", os.Getenv(string(DndUtilConfig)), "Path to the yaml config file")
 	flag.Parse()
-	InitGlobalLogger(*debug)
-	return *debug
+	InitGlobalLogger(debug)
+	return debug, migrateDryRun, configPath
 }
 
-func parseEnvironmentVariables() *Environment {
-	tgApiKey := mustGetEnv(DndUtilTgApiKey)
-	dndUtilBotName := mustGetEnv(DndUtilBotName)
-	dbname := mustGetEnv(DndUtilDbPath)
-	timeoutStr := os.Getenv(string(DndUtilLongPollingTimeout))
-	timeout, err := strconv.Atoi(timeoutStr)
-	if err != nil {
-		Logger.Errorf("%s Environment variable is invalid %s. use 60", DndUtilLongPollingTimeout, timeoutStr)
-		timeout = 60
+func dryRunMigrations(debug bool, config *Config) {
+	provider := &loggerProvider{Debug: debug}
+	dryRun, schemaVersion := boltStorage.DryRunMigrations, boltStorage.SchemaVersion()
+	switch config.Storage.Driver {
+	case dbDriverSqlite:
+		dryRun, schemaVersion = sqliteStorage.DryRunMigrations, sqliteStorage.SchemaVersion()
+	case dbDriverMemory:
+		Logger.Infof("%s storage has no db migrations", dbDriverMemory)
+		return
 	}
 
-	rateLimitRpsStr := os.Getenv(string(DndUtilRateLimitRps))
-	rateLimitRps, err := strconv.Atoi(rateLimitRpsStr)
+	pending, err := dryRun(provider, config.Storage.Path)
 	if err != nil {
-		Logger.Errorf("%s Environment variable is invalid %s. use 100", DndUtilRateLimitRps, timeoutStr)
-		rateLimitRps = 100
+		Logger.Fatalf("db migrations dry run failed %s", err)
 	}
 
-	return &Environment{
-		tgApiKey,
-		dndUtilBotName,
-		timeout,
-		rateLimitRps,
-		dbname,
+	if len(pending) == 0 {
+		Logger.Infof("db schema is up to date, version %d", schemaVersion)
+		return
 	}
-}
 
-func mustGetEnv(key EnvKey) string {
-	env := os.Getenv(string(key))
-	if env == EmptyString {
-		Logger.Fatalf("%s not set", key)
+	Logger.Infof("%d pending db migrations to schema version %d:", len(pending), schemaVersion)
+	for _, description := range pending {
+		Logger.Infof("- %s", description)
 	}
-
-	return env
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	. "github.com/Refreezer/dnd-util-bot/internal"
+	"github.com/Refreezer/dnd-util-bot/internal/boltStorage"
+	. "github.com/Refreezer/dnd-util-bot/logging"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+type (
+	// manageCommand works on the bolt db at storage.path while the bot is stopped, args follow the command name
+	manageCommand struct {
+		usage string
+		run   func(provider api.LoggerProvider, dbName string, args []string, out io.Writer) error
+	}
+
+	openBolt func(provider api.LoggerProvider, dbName string) (*boltStorage.BoltStorage, func() error, error)
+)
+
+var (
+	manageCommands = map[string]*manageCommand{
+		"balances list": {"balances list --chat <id>", withStorage(boltStorage.OpenReadOnly, listBalances)},
+		"balances set":  {"balances set --chat <id> <@user name or user id> <balance>", withStorage(boltStorage.Open, setBalance)},
+		"users lookup":  {"users lookup <user name>", withStorage(boltStorage.OpenReadOnly, lookupUser)},
+		"db stats":      {"db stats", printDbStats},
+		"db compact":    {"db compact", compactDb},
+	}
+)
+
+// runManageCommand runs the management subcommand, ok is false if args aren't one of them
+func runManageCommand(provider api.LoggerProvider, config *Config, args []string) (ok bool) {
+	if len(args) < 2 {
+		return false
+	}
+
+	name := args[0] + " " + args[1]
+	command, ok := manageCommands[name]
+	if !ok {
+		return false
+	}
+
+	if config.Storage.Driver != dbDriverBolt {
+		Logger.Fatalf("%s works with the bolt db only, storage.driver is %s", name, config.Storage.Driver)
+	}
+
+	err := command.run(provider, config.Storage.Path, args[2:], os.Stdout)
+	if errors.Is(err, boltStorage.ErrorDbLocked) {
+		Logger.Fatalf("%s. Stop the bot before running %s", err, name)
+	}
+
+	if err != nil {
+		Logger.Fatalf("%s failed %s, usage: dnd-util-bot %s", name, err, command.usage)
+	}
+
+	return true
+}
+
+// withStorage opens the db for run, OpenReadOnly doesn't migrate the db and Open does it like the bot on startup
+func withStorage(
+	open openBolt,
+	run func(storage *boltStorage.BoltStorage, args []string, out io.Writer) error,
+) func(provider api.LoggerProvider, dbName string, args []string, out io.Writer) error {
+	return func(provider api.LoggerProvider, dbName string, args []string, out io.Writer) error {
+		storage, closeDb, err := open(provider, dbName)
+		if err != nil {
+			return err
+		}
+
+		defer closeDb()
+		return run(storage, args, out)
+	}
+}
+
+// parseChatFlag parses --chat, the chat id is never zero
+func parseChatFlag(name string, args []string) (chatId int64, rest []string, err error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Int64Var(&chatId, "chat", 0, "chat id")
+	err = flags.Parse(args)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if chatId == 0 {
+		return 0, nil, errors.New("--chat isn't set")
+	}
+
+	return chatId, flags.Args(), nil
+}
+
+func listBalances(storage *boltStorage.BoltStorage, args []string, out io.Writer) error {
+	chatId, rest, err := parseChatFlag("balances list", args)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) > 0 {
+		return fmt.Errorf("unexpected arguments %s", strings.Join(rest, " "))
+	}
+
+	wallets, err := storage.GetChatWallets(chatId)
+	if err != nil {
+		return err
+	}
+
+	treasury, err := storage.GetTreasuryBalance(chatId)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER ID\tUSER NAME\tBALANCE")
+	for _, wallet := range wallets {
+		userName, _ := storage.GetUserNameById(wallet.UserId)
+		fmt.Fprintf(w, "%d\t%s\t%d\n", wallet.UserId, userName, wallet.Balance)
+	}
+
+	fmt.Fprintf(w, "%d\ttreasury\t%d\n", api.TreasuryAccountId, treasury)
+	return w.Flush()
+}
+
+// setBalance is /set_balance of the player registered in the chat
+func setBalance(storage *boltStorage.BoltStorage, args []string, out io.Writer) error {
+	chatId, rest, err := parseChatFlag("balances set", args)
+	if err != nil {
+		return err
+	}
+
+	if len(rest) != 2 {
+		return errors.New("user and balance are expected")
+	}
+
+	userId, userName, err := resolvePlayer(storage, chatId, rest[0])
+	if err != nil {
+		return err
+	}
+
+	balance, err := strconv.ParseInt(rest[1], 10, 64)
+	if err != nil {
+		return api.ErrorInvalidIntegerParameter
+	}
+
+	err = api.SetBalance(storage, chatId, userId, balance)
+	if err != nil {
+		return err
+	}
+
+	player := strconv.FormatInt(userId, 10)
+	if userName != EmptyString {
+		player = fmt.Sprintf("%s (%d)", userName, userId)
+	}
+
+	_, err = fmt.Fprintf(out, "balance of %s in chat %d is set to %d\n", player, chatId, balance)
+	return err
+}
+
+// resolvePlayer accepts the user name with or without @ or the user id of the wallet in the chat,
+// the user name is empty if the user id isn't mapped to one
+func resolvePlayer(storage *boltStorage.BoltStorage, chatId int64, user string) (userId int64, userName string, err error) {
+	userId, err = strconv.ParseInt(user, 10, 64)
+	if err == nil && userId == api.TreasuryAccountId {
+		return 0, EmptyString, errors.New("the treasury isn't a player, it changes through the transactions only")
+	}
+
+	if err == nil {
+		userName, _ = storage.GetUserNameById(userId)
+	} else {
+		userName = strings.TrimPrefix(user, "@")
+		var ok bool
+		userId, ok = storage.GetIdByUserName(userName)
+		if !ok {
+			return 0, EmptyString, fmt.Errorf("user name %s is unknown to the bot", userName)
+		}
+	}
+
+	isRegistered, err := storage.IsRegistered(chatId, userId)
+	if err != nil {
+		return 0, EmptyString, err
+	}
+
+	if !isRegistered {
+		return 0, EmptyString, fmt.Errorf("user %s has no wallet in chat %d", user, chatId)
+	}
+
+	return userId, userName, nil
+}
+
+func lookupUser(storage *boltStorage.BoltStorage, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("user name is expected")
+	}
+
+	userName := strings.TrimPrefix(args[0], "@")
+	userId, ok := storage.GetIdByUserName(userName)
+	if !ok {
+		return fmt.Errorf("user name %s is unknown to the bot", userName)
+	}
+
+	_, err := fmt.Fprintf(out, "%d\t%s\n", userId, userName)
+	return err
+}
+
+func printDbStats(provider api.LoggerProvider, dbName string, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %s", strings.Join(args, " "))
+	}
+
+	stats, err := boltStorage.ReadStats(provider, dbName)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "file size\t%d bytes\n", stats.Size)
+	fmt.Fprintf(w, "schema version\t%d of %d\n", stats.SchemaVersion, boltStorage.SchemaVersion())
+	fmt.Fprintf(w, "chats\t%d\n", stats.Chats)
+	fmt.Fprintf(w, "free pages\t%d, %d bytes\n", stats.FreePages, stats.FreeBytes)
+	for _, bucket := range stats.Buckets {
+		fmt.Fprintf(w, "%s\t%d keys\n", bucket.Name, bucket.Keys)
+	}
+
+	return w.Flush()
+}
+
+func compactDb(_ api.LoggerProvider, dbName string, args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %s", strings.Join(args, " "))
+	}
+
+	before, after, err := boltStorage.Compact(dbName)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(out, "%s is compacted from %d to %d bytes\n", dbName, before, after)
+	return err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/Refreezer/dnd-util-bot/internal/boltStorage"
+	"github.com/Refreezer/dnd-util-bot/internal/mapStorage"
+	"github.com/Refreezer/dnd-util-bot/internal/sqliteStorage"
+	. "github.com/Refreezer/dnd-util-bot/logging"
+	"os"
+	"time"
+)
+
+type (
+	// botStorage is the storage the bot runs with, scheduled backups need BackupToFile and /readyz needs Ping
+	botStorage interface {
+		api.Storage
+		BackupToFile(path string) error
+		Ping(ctx context.Context) error
+	}
+
+	snapshotter interface {
+		Snapshot() error
+	}
+)
+
+func newStorage(provider api.LoggerProvider, driver string, dbName string) (botStorage, func()) {
+	switch driver {
+	case dbDriverSqlite:
+		return sqliteStorage.NewSqliteStorage(provider, dbName)
+	case dbDriverMemory:
+		return mapStorage.NewPersistentMapStorage(provider, dbName)
+	default:
+		return boltStorage.NewBoltStorage(provider, dbName)
+	}
+}
+
+// scheduleSnapshots saves the snapshot of the in-memory storage every interval so the write-ahead log stays short
+func scheduleSnapshots(ctx context.Context, storage botStorage, interval time.Duration) {
+	s, ok := storage.(snapshotter)
+	if !ok || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.Snapshot()
+		if err != nil {
+			Logger.Errorf("scheduled snapshot failed %s", err)
+		}
+	}
+}
+
+// migrateBoltToSqlite copies every chat and the user name mappings from the bolt db to the new sqlite db,
+// conversations and pending transfers are transient and aren't copied
+func migrateBoltToSqlite(provider api.LoggerProvider, boltPath string, sqlitePath string) error {
+	_, err := os.Stat(sqlitePath)
+	if err == nil {
+		return fmt.Errorf("%s already exists", sqlitePath)
+	}
+
+	source, closeSource, err := boltStorage.OpenReadOnly(provider, boltPath)
+	if err != nil {
+		return err
+	}
+
+	defer closeSource()
+	target, closeTarget := sqliteStorage.NewSqliteStorage(provider, sqlitePath)
+	defer closeTarget()
+	userNames, err := source.UserNames()
+	if err != nil {
+		return err
+	}
+
+	err = target.ImportUserNames(userNames)
+	if err != nil {
+		return err
+	}
+
+	chatIds, err := source.ChatIds()
+	if err != nil {
+		return err
+	}
+
+	for _, chatId := range chatIds {
+		data, err := source.ExportChat(chatId)
+		if err != nil {
+			return fmt.Errorf("chat %d: %w", chatId, err)
+		}
+
+		err = target.ImportChat(chatId, data)
+		if err != nil {
+			return fmt.Errorf("chat %d: %w", chatId, err)
+		}
+
+		Logger.Infof("chat %d: %d wallets, %d characters, %d ledger records", chatId, len(data.Wallets), len(data.Characters), len(data.MoneyTransfers))
+	}
+
+	Logger.Infof("%d chats and %d user names are copied from %s to %s", len(chatIds), len(userNames), boltPath, sqlitePath)
+	return nil
+}
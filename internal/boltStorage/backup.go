@@ -0,0 +1,184 @@
+package boltStorage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	lockTimeout = 1 * time.Second
+)
+
+var (
+	// ErrorDbLocked means another process, most likely the running bot, holds the db file
+	ErrorDbLocked = errors.New("db is locked by another process")
+)
+
+// Backup writes a consistent snapshot of the db, the bot keeps serving updates meanwhile
+func (b *BoltStorage) Backup(w io.Writer) (int64, error) {
+	var written int64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		written, err = tx.WriteTo(w)
+		return err
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while Backup: %s", err)
+	}
+
+	return written, err
+}
+
+// BackupToFile writes the snapshot next to the path first so a half written file never shows up as a backup
+func (b *BoltStorage) BackupToFile(path string) error {
+	return writeFileAtomically(path, func(w io.Writer) error {
+		_, err := b.Backup(w)
+		return err
+	})
+}
+
+// BackupDbFile writes a snapshot of the db file which isn't opened by the bot
+func BackupDbFile(provider api.LoggerProvider, dbName string, path string) error {
+	db, err := openDb(dbName, true)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+	storage := &BoltStorage{db: db, logger: provider.MustGetLogger("boltStorage")}
+	return storage.BackupToFile(path)
+}
+
+// Restore replaces the db file with the backup, the previous db is kept with the .before-restore suffix.
+// The bot has to be stopped
+func Restore(provider api.LoggerProvider, dbName string, backupPath string) error {
+	logger := provider.MustGetLogger("boltStorage")
+	backup, err := openDb(backupPath, true)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	var version uint64
+	err = backup.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(metaBucketKey) != nil {
+			version = getSchemaVersion(tx)
+		}
+
+		return nil
+	})
+	backup.Close()
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	if version > SchemaVersion() {
+		return fmt.Errorf("backup schema version %d is newer than supported %d", version, SchemaVersion())
+	}
+
+	_, err = os.Stat(dbName)
+	if err == nil {
+		// holding the lock guarantees the bot is not running while the file is swapped
+		db, err := openDb(dbName, false)
+		if err != nil {
+			return err
+		}
+
+		defer db.Close()
+		err = copyFile(dbName, dbName+".before-restore")
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err = writeFileAtomically(dbName, func(w io.Writer) error {
+		f, err := os.Open(backupPath)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("db %s is restored from %s, schema version %d", dbName, backupPath, version)
+	return nil
+}
+
+func openDb(path string, readOnly bool) (*bolt.DB, error) {
+	_, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s %w", path, ErrorDbLocked)
+	}
+
+	return db, err
+}
+
+func copyFile(from string, to string) error {
+	return writeFileAtomically(to, func(w io.Writer) error {
+		f, err := os.Open(from)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+}
+
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Chmod(tmp.Name(), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// OpenReadOnly opens the existing db file without migrating it, the file must not be opened by the bot
+func OpenReadOnly(provider api.LoggerProvider, dbName string) (storage *BoltStorage, close func() error, err error) {
+	db, err := openDb(dbName, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &BoltStorage{db: db, logger: provider.MustGetLogger("boltStorage")}, db.Close, nil
+}
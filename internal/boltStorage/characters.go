@@ -0,0 +1,286 @@
+package boltStorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+)
+
+const (
+	characterEncodingVersion1 byte = 1
+	characterEncodingVersion       = characterEncodingVersion1
+)
+
+var (
+	charactersBucketKey       = []byte("characters")
+	activeCharactersBucketKey = []byte("activeCharacters")
+)
+
+// encodeCharacter prepends json with the encoding version byte so the sheet layout can evolve
+func encodeCharacter(character *api.Character) ([]byte, error) {
+	characterBytes, err := json.Marshal(character)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{characterEncodingVersion}, characterBytes...), nil
+}
+
+func decodeCharacter(data []byte) (*api.Character, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty character data")
+	}
+
+	character := new(api.Character)
+	switch data[0] {
+	case characterEncodingVersion1:
+		err := json.Unmarshal(data[1:], character)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported character encoding version %d", data[0])
+	}
+
+	return character, nil
+}
+
+func getCharacter(tx *bolt.Tx, chatId int64, characterId int64) (*api.Character, error) {
+	characterBytes := tx.Bucket(charactersBucketKey).Get(chatUserKey(chatId, characterId))
+	if characterBytes == nil {
+		return nil, fmt.Errorf("character %d %w", characterId, api.ErrorNotFound)
+	}
+
+	return decodeCharacter(characterBytes)
+}
+
+func putCharacter(tx *bolt.Tx, chatId int64, character *api.Character) error {
+	characterBytes, err := encodeCharacter(character)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(charactersBucketKey).Put(chatUserKey(chatId, character.Id), characterBytes)
+}
+
+func (b *BoltStorage) CreateCharacter(chatId int64, character *api.Character) (int64, error) {
+	err := b.update("CreateCharacter", func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(charactersBucketKey).NextSequence()
+		if err != nil {
+			return err
+		}
+
+		character.Id = int64(id)
+		err = putCharacter(tx, chatId, character)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(activeCharactersBucketKey).Put(
+			chatUserKey(chatId, character.OwnerId),
+			int64ToByteArr(character.Id),
+		)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while CreateCharacter: %s", err)
+	}
+
+	return character.Id, err
+}
+
+func (b *BoltStorage) GetCharacter(chatId int64, characterId int64) (*api.Character, error) {
+	var character *api.Character
+	err := b.view("GetCharacter", func(tx *bolt.Tx) error {
+		var err error
+		character, err = getCharacter(tx, chatId, characterId)
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Errorf("error while GetCharacter: %s", err)
+	}
+
+	return character, err
+}
+
+func (b *BoltStorage) GetCharacters(chatId int64, userId int64) ([]*api.Character, error) {
+	characters := make([]*api.Character, 0)
+	err := b.view("GetCharacters", func(tx *bolt.Tx) error {
+		return forEachWithPrefix(tx.Bucket(charactersBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			character, err := decodeCharacter(v)
+			if err != nil {
+				return err
+			}
+
+			if character.OwnerId == userId {
+				characters = append(characters, character)
+			}
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetCharacters: %s", err)
+	}
+
+	return characters, err
+}
+
+func (b *BoltStorage) UpdateCharacter(chatId int64, characterId int64, update func(character *api.Character) error) error {
+	err := b.update("UpdateCharacter", func(tx *bolt.Tx) error {
+		character, err := getCharacter(tx, chatId, characterId)
+		if err != nil {
+			return err
+		}
+
+		err = update(character)
+		if err != nil {
+			return err
+		}
+
+		character.Id = characterId
+		return putCharacter(tx, chatId, character)
+	})
+
+	if err != nil {
+		b.logger.Debugf("error while UpdateCharacter: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) DeleteCharacter(chatId int64, characterId int64) error {
+	err := b.update("DeleteCharacter", func(tx *bolt.Tx) error {
+		character, err := getCharacter(tx, chatId, characterId)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(charactersBucketKey).Delete(chatUserKey(chatId, characterId))
+		if err != nil {
+			return err
+		}
+
+		activeKey := chatUserKey(chatId, character.OwnerId)
+		active := tx.Bucket(activeCharactersBucketKey)
+		activeIdBytes := active.Get(activeKey)
+		if activeIdBytes == nil || int64FromByteArr(activeIdBytes) != characterId {
+			return nil
+		}
+
+		return active.Delete(activeKey)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while DeleteCharacter: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) SetActiveCharacter(chatId int64, userId int64, characterId int64) error {
+	err := b.update("SetActiveCharacter", func(tx *bolt.Tx) error {
+		character, err := getCharacter(tx, chatId, characterId)
+		if err != nil {
+			return err
+		}
+
+		if character.OwnerId != userId {
+			return api.ErrorNotCharacterOwner
+		}
+
+		return tx.Bucket(activeCharactersBucketKey).Put(chatUserKey(chatId, userId), int64ToByteArr(characterId))
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while SetActiveCharacter: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) GetActiveCharacter(chatId int64, userId int64) (*api.Character, error) {
+	var character *api.Character
+	err := b.view("GetActiveCharacter", func(tx *bolt.Tx) error {
+		activeIdBytes := tx.Bucket(activeCharactersBucketKey).Get(chatUserKey(chatId, userId))
+		if activeIdBytes == nil {
+			return fmt.Errorf("active character %w", api.ErrorNotFound)
+		}
+
+		var err error
+		character, err = getCharacter(tx, chatId, int64FromByteArr(activeIdBytes))
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Errorf("error while GetActiveCharacter: %s", err)
+	}
+
+	return character, err
+}
+
+func (b *BoltStorage) GetActiveCharacters(chatId int64) ([]*api.Character, error) {
+	characters := make([]*api.Character, 0)
+	err := b.view("GetActiveCharacters", func(tx *bolt.Tx) error {
+		return forEachWithPrefix(tx.Bucket(activeCharactersBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			character, err := getCharacter(tx, chatId, int64FromByteArr(v))
+			if err != nil {
+				return err
+			}
+
+			characters = append(characters, character)
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetActiveCharacters: %s", err)
+	}
+
+	return characters, err
+}
+
+func (b *BoltStorage) UpdateChatCharacters(chatId int64, update func(character *api.Character) error) error {
+	err := b.update("UpdateChatCharacters", func(tx *bolt.Tx) error {
+		// characters are collected first since bucket modification invalidates the cursor
+		characters := make([]*api.Character, 0)
+		err := forEachWithPrefix(tx.Bucket(charactersBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			character, err := decodeCharacter(v)
+			if err != nil {
+				return err
+			}
+
+			characters = append(characters, character)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, character := range characters {
+			characterId := character.Id
+			err = update(character)
+			if err != nil {
+				return err
+			}
+
+			character.Id = characterId
+			err = putCharacter(tx, chatId, character)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while UpdateChatCharacters: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,58 @@
+package boltStorage
+
+import (
+	"encoding/json"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	chatSettingsBucketKey = []byte("chatSettings")
+)
+
+func getChatSettings(tx *bolt.Tx, chatId int64) (*api.ChatSettings, error) {
+	settings := new(api.ChatSettings)
+	settingsBytes := tx.Bucket(chatSettingsBucketKey).Get(chatKeyPrefix(chatId))
+	if settingsBytes == nil {
+		return settings, nil
+	}
+
+	err := json.Unmarshal(settingsBytes, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (b *BoltStorage) GetChatSettings(chatId int64) (*api.ChatSettings, error) {
+	var settings *api.ChatSettings
+	err := b.view("GetChatSettings", func(tx *bolt.Tx) error {
+		var err error
+		settings, err = getChatSettings(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetChatSettings: %s", err)
+	}
+
+	return settings, err
+}
+
+func (b *BoltStorage) SaveChatSettings(chatId int64, settings *api.ChatSettings) error {
+	err := b.update("SaveChatSettings", func(tx *bolt.Tx) error {
+		settingsBytes, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(chatSettingsBucketKey).Put(chatKeyPrefix(chatId), settingsBytes)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while SaveChatSettings: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,345 @@
+package boltStorage
+
+import (
+	"encoding/json"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"slices"
+)
+
+var (
+	// chatBucketsKeys are the buckets with chat prefixed keys, the user name mappings are global
+	chatBucketsKeys = [][]byte{
+		userIdToBalanceBucketKey,
+		conversationsBucketKey,
+		charactersBucketKey,
+		activeCharactersBucketKey,
+		inventoriesBucketKey,
+		itemTransfersBucketKey,
+		shopItemsBucketKey,
+		questsBucketKey,
+		moneyTransfersBucketKey,
+		chatSettingsBucketKey,
+		pendingTransfersBucketKey,
+	}
+)
+
+// getAllWithPrefix unmarshals the json values of the keys with the prefix in the key order
+func getAllWithPrefix[T any](bucket *bolt.Bucket, prefix []byte) ([]*T, error) {
+	values := make([]*T, 0)
+	err := forEachWithPrefix(bucket, prefix, func(_ []byte, v []byte) error {
+		value := new(T)
+		err := json.Unmarshal(v, value)
+		if err != nil {
+			return err
+		}
+
+		values = append(values, value)
+		return nil
+	})
+
+	return values, err
+}
+
+func putJson(bucket *bolt.Bucket, key []byte, value any) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(key, valueBytes)
+}
+
+// setSequenceAtLeast keeps NextSequence from returning the imported ids
+func setSequenceAtLeast(bucket *bolt.Bucket, id int64) error {
+	if uint64(id) <= bucket.Sequence() {
+		return nil
+	}
+
+	return bucket.SetSequence(uint64(id))
+}
+
+func exportChat(tx *bolt.Tx, chatId int64) (*api.ChatData, error) {
+	prefix := chatKeyPrefix(chatId)
+	data := &api.ChatData{
+		Wallets:          make([]*api.Wallet, 0),
+		ActiveCharacters: make([]*api.ActiveCharacter, 0),
+		Inventories:      make([]*api.OwnedInventory, 0),
+	}
+
+	var err error
+	data.Settings, err = getChatSettings(tx, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = forEachWithPrefix(tx.Bucket(userIdToBalanceBucketKey), prefix, func(k []byte, v []byte) error {
+		userId := userIdFromChatUserKey(k)
+		if userId == api.TreasuryAccountId {
+			data.Treasury = balanceFromByteArr(v)
+			return nil
+		}
+
+		data.Wallets = append(data.Wallets, &api.Wallet{UserId: userId, Balance: balanceFromByteArr(v)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = forEachWithPrefix(tx.Bucket(activeCharactersBucketKey), prefix, func(k []byte, v []byte) error {
+		data.ActiveCharacters = append(data.ActiveCharacters, &api.ActiveCharacter{
+			UserId:      userIdFromChatUserKey(k),
+			CharacterId: int64FromByteArr(v),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = forEachWithPrefix(tx.Bucket(inventoriesBucketKey), prefix, func(k []byte, v []byte) error {
+		inventory := &api.OwnedInventory{OwnerId: userIdFromChatUserKey(k)}
+		err := json.Unmarshal(v, &inventory.Inventory)
+		if err != nil {
+			return err
+		}
+
+		data.Inventories = append(data.Inventories, inventory)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data.Characters = make([]*api.Character, 0)
+	err = forEachWithPrefix(tx.Bucket(charactersBucketKey), prefix, func(_ []byte, v []byte) error {
+		character, err := decodeCharacter(v)
+		if err != nil {
+			return err
+		}
+
+		data.Characters = append(data.Characters, character)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data.ShopItems, err = getAllWithPrefix[api.ShopItem](tx.Bucket(shopItemsBucketKey), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Quests, err = getAllWithPrefix[api.Quest](tx.Bucket(questsBucketKey), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	data.MoneyTransfers, err = getAllWithPrefix[api.MoneyTransfer](tx.Bucket(moneyTransfersBucketKey), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	data.ItemTransfers, err = getAllWithPrefix[api.ItemTransfer](tx.Bucket(itemTransfersBucketKey), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// deleteChat removes everything stored for the chat
+func deleteChat(tx *bolt.Tx, chatId int64) error {
+	prefix := chatKeyPrefix(chatId)
+	for _, bucketKey := range chatBucketsKeys {
+		bucket := tx.Bucket(bucketKey)
+		keys := make([][]byte, 0)
+		err := forEachWithPrefix(bucket, prefix, func(k []byte, _ []byte) error {
+			keys = append(keys, k)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// deleting under the cursor skips keys, so the keys are collected first
+		for _, k := range keys {
+			err = bucket.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func importChat(tx *bolt.Tx, chatId int64, data *api.ChatData) error {
+	err := deleteChat(tx, chatId)
+	if err != nil {
+		return err
+	}
+
+	err = putJson(tx.Bucket(chatSettingsBucketKey), chatKeyPrefix(chatId), data.Settings)
+	if err != nil {
+		return err
+	}
+
+	err = putBalance(tx, chatId, api.TreasuryAccountId, data.Treasury)
+	if err != nil {
+		return err
+	}
+
+	for _, wallet := range data.Wallets {
+		err = putBalance(tx, chatId, wallet.UserId, wallet.Balance)
+		if err != nil {
+			return err
+		}
+	}
+
+	characters := tx.Bucket(charactersBucketKey)
+	for _, character := range data.Characters {
+		err = putCharacter(tx, chatId, character)
+		if err == nil {
+			err = setSequenceAtLeast(characters, character.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, active := range data.ActiveCharacters {
+		err = tx.Bucket(activeCharactersBucketKey).Put(chatUserKey(chatId, active.UserId), int64ToByteArr(active.CharacterId))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, inventory := range data.Inventories {
+		err = putInventory(tx, chatId, inventory.OwnerId, &inventory.Inventory)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range data.ShopItems {
+		err = putShopItem(tx, chatId, item)
+		if err != nil {
+			return err
+		}
+	}
+
+	quests := tx.Bucket(questsBucketKey)
+	for _, quest := range data.Quests {
+		err = putQuest(tx, chatId, quest)
+		if err == nil {
+			err = setSequenceAtLeast(quests, quest.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	moneyTransfers := tx.Bucket(moneyTransfersBucketKey)
+	for _, transfer := range data.MoneyTransfers {
+		err = putJson(moneyTransfers, moneyTransferKey(chatId, transfer.Id), transfer)
+		if err == nil {
+			err = setSequenceAtLeast(moneyTransfers, transfer.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	itemTransfers := tx.Bucket(itemTransfersBucketKey)
+	for _, transfer := range data.ItemTransfers {
+		err = putJson(itemTransfers, itemTransferKey(chatId, transfer.Id), transfer)
+		if err == nil {
+			err = setSequenceAtLeast(itemTransfers, transfer.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *BoltStorage) ExportChat(chatId int64) (*api.ChatData, error) {
+	var data *api.ChatData
+	err := b.view("ExportChat", func(tx *bolt.Tx) error {
+		var err error
+		data, err = exportChat(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while ExportChat: %s", err)
+	}
+
+	return data, err
+}
+
+func (b *BoltStorage) ImportChat(chatId int64, data *api.ChatData) error {
+	err := b.update("ImportChat", func(tx *bolt.Tx) error {
+		return importChat(tx, chatId, data)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while ImportChat: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) ChatIds() ([]int64, error) {
+	chatIds := make([]int64, 0)
+	err := b.view("ChatIds", func(tx *bolt.Tx) error {
+		seen := make(map[int64]bool)
+		for _, bucketKey := range chatBucketsKeys {
+			err := tx.Bucket(bucketKey).ForEach(func(k []byte, _ []byte) error {
+				chatId := int64FromByteArr(k[:8])
+				if !seen[chatId] {
+					seen[chatId] = true
+					chatIds = append(chatIds, chatId)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while ChatIds: %s", err)
+	}
+
+	slices.Sort(chatIds)
+	return chatIds, err
+}
+
+// UserNames returns all the user name mappings
+func (b *BoltStorage) UserNames() (map[int64]string, error) {
+	userNames := make(map[int64]string)
+	err := b.view("UserNames", func(tx *bolt.Tx) error {
+		return tx.Bucket(userIdToUserNameBucketKey).ForEach(func(k []byte, v []byte) error {
+			userNames[int64FromByteArr(k)] = string(v)
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while UserNames: %s", err)
+	}
+
+	return userNames, err
+}
@@ -0,0 +1,224 @@
+package boltStorage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+var (
+	inventoriesBucketKey   = []byte("inventories")
+	itemTransfersBucketKey = []byte("itemTransfers")
+)
+
+func getInventory(tx *bolt.Tx, chatId int64, ownerId int64) (*api.Inventory, error) {
+	inventoryBytes := tx.Bucket(inventoriesBucketKey).Get(chatUserKey(chatId, ownerId))
+	if inventoryBytes == nil {
+		return api.NewInventory(), nil
+	}
+
+	inventory := api.NewInventory()
+	err := json.Unmarshal(inventoryBytes, inventory)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+func putInventory(tx *bolt.Tx, chatId int64, ownerId int64, inventory *api.Inventory) error {
+	bucket := tx.Bucket(inventoriesBucketKey)
+	if len(inventory.Items) == 0 {
+		return bucket.Delete(chatUserKey(chatId, ownerId))
+	}
+
+	inventoryBytes, err := json.Marshal(inventory)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(chatUserKey(chatId, ownerId), inventoryBytes)
+}
+
+// checkInventoryOwner checks the owner has a wallet in the chat, the party stash always exists
+func checkInventoryOwner(tx *bolt.Tx, chatId int64, ownerId int64) error {
+	if ownerId == api.StashOwnerId {
+		return nil
+	}
+
+	if tx.Bucket(userIdToBalanceBucketKey).Get(balanceBucketKey(chatId, ownerId)) == nil {
+		return fmt.Errorf("inventory owner %d %w", ownerId, api.ErrorNotRegistered)
+	}
+
+	return nil
+}
+
+// itemTransferKey is chat prefix followed by big endian sequence so transfers of the chat are ordered by time
+func itemTransferKey(chatId int64, id int64) []byte {
+	return binary.BigEndian.AppendUint64(chatKeyPrefix(chatId), uint64(id))
+}
+
+func addItemTransfer(tx *bolt.Tx, chatId int64, transfer *api.ItemTransfer) error {
+	bucket := tx.Bucket(itemTransfersBucketKey)
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	transfer.Id = int64(id)
+	transfer.Time = time.Now()
+	transferBytes, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(itemTransferKey(chatId, transfer.Id), transferBytes)
+}
+
+func moveItem(tx *bolt.Tx, chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error {
+	if fromId == toId {
+		return api.ErrorInvalidTransactionParameters
+	}
+
+	for _, ownerId := range []int64{fromId, toId} {
+		err := checkInventoryOwner(tx, chatId, ownerId)
+		if err != nil {
+			return err
+		}
+	}
+
+	from, err := getInventory(tx, chatId, fromId)
+	if err != nil {
+		return err
+	}
+
+	to, err := getInventory(tx, chatId, toId)
+	if err != nil {
+		return err
+	}
+
+	item = from.ItemName(item)
+	err = from.Remove(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	err = to.Add(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	err = putInventory(tx, chatId, fromId, from)
+	if err != nil {
+		return err
+	}
+
+	err = putInventory(tx, chatId, toId, to)
+	if err != nil {
+		return err
+	}
+
+	return addItemTransfer(tx, chatId, &api.ItemTransfer{
+		Kind:     api.ItemTransferKindMove,
+		FromId:   fromId,
+		ToId:     toId,
+		ActorId:  actorId,
+		Item:     item,
+		Quantity: quantity,
+	})
+}
+
+func (b *BoltStorage) GetInventory(chatId int64, ownerId int64) (*api.Inventory, error) {
+	var inventory *api.Inventory
+	err := b.view("GetInventory", func(tx *bolt.Tx) error {
+		var err error
+		inventory, err = getInventory(tx, chatId, ownerId)
+		return err
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetInventory: %s", err)
+	}
+
+	return inventory, err
+}
+
+func (b *BoltStorage) MoveItem(chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error {
+	err := b.update("MoveItem", func(tx *bolt.Tx) error {
+		return moveItem(tx, chatId, fromId, toId, item, quantity, actorId)
+	})
+
+	if err != nil {
+		b.logger.Debugf("error while MoveItem: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) SetItemQuantity(chatId int64, ownerId int64, item string, quantity int, actorId int64) error {
+	err := b.update("SetItemQuantity", func(tx *bolt.Tx) error {
+		err := checkInventoryOwner(tx, chatId, ownerId)
+		if err != nil {
+			return err
+		}
+
+		inventory, err := getInventory(tx, chatId, ownerId)
+		if err != nil {
+			return err
+		}
+
+		err = inventory.Set(item, quantity)
+		if err != nil {
+			return err
+		}
+
+		err = putInventory(tx, chatId, ownerId, inventory)
+		if err != nil {
+			return err
+		}
+
+		return addItemTransfer(tx, chatId, &api.ItemTransfer{
+			Kind:     api.ItemTransferKindSet,
+			FromId:   ownerId,
+			ToId:     ownerId,
+			ActorId:  actorId,
+			Item:     item,
+			Quantity: quantity,
+		})
+	})
+
+	if err != nil {
+		b.logger.Debugf("error while SetItemQuantity: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) GetItemTransfers(chatId int64, limit int) ([]*api.ItemTransfer, error) {
+	transfers := make([]*api.ItemTransfer, 0, limit)
+	err := b.view("GetItemTransfers", func(tx *bolt.Tx) error {
+		return forEachWithPrefixReverse(tx.Bucket(itemTransfersBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			if len(transfers) >= limit {
+				return errStopIteration
+			}
+
+			transfer := new(api.ItemTransfer)
+			err := json.Unmarshal(v, transfer)
+			if err != nil {
+				return err
+			}
+
+			transfers = append(transfers, transfer)
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetItemTransfers: %s", err)
+	}
+
+	return transfers, err
+}
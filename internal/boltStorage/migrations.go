@@ -0,0 +1,101 @@
+package boltStorage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"github.com/op/go-logging"
+)
+
+var (
+	metaBucketKey    = []byte("meta")
+	schemaVersionKey = []byte("schemaVersion")
+
+	// errDryRun rolls back the migration transaction in the dry run mode
+	errDryRun = errors.New("dry run")
+
+	// migrations are applied in order, the schema version is the number of the applied ones.
+	// Never reorder or remove entries, append new ones to the end
+	migrations = []migration{
+		{"widen balances to int64", migrateBalancesToInt64},
+	}
+)
+
+type migration struct {
+	description string
+	migrate     func(tx *bolt.Tx) error
+}
+
+// SchemaVersion is the schema version the storage works with
+func SchemaVersion() uint64 {
+	return uint64(len(migrations))
+}
+
+func getSchemaVersion(tx *bolt.Tx) uint64 {
+	version := tx.Bucket(metaBucketKey).Get(schemaVersionKey)
+	if version == nil {
+		return 0
+	}
+
+	return uint64(int64FromByteArr(version))
+}
+
+func putSchemaVersion(tx *bolt.Tx, version uint64) error {
+	return tx.Bucket(metaBucketKey).Put(schemaVersionKey, int64ToByteArr(int64(version)))
+}
+
+// migrate creates missing buckets and applies pending migrations, returns descriptions of the applied ones
+func migrate(tx *bolt.Tx, logger *logging.Logger) ([]string, error) {
+	for _, key := range bucketsKeys {
+		err := initBucket(tx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	version := getSchemaVersion(tx)
+	if version > SchemaVersion() {
+		return nil, fmt.Errorf("db schema version %d is newer than supported %d", version, SchemaVersion())
+	}
+
+	applied := make([]string, 0, len(migrations))
+	for i, m := range migrations[version:] {
+		logger.Infof("applying migration %d: %s", version+uint64(i)+1, m.description)
+		err := m.migrate(tx)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: %w", m.description, err)
+		}
+
+		applied = append(applied, m.description)
+	}
+
+	return applied, putSchemaVersion(tx, SchemaVersion())
+}
+
+// DryRunMigrations applies pending migrations to the db and rolls them back, returns descriptions of the pending ones
+func DryRunMigrations(provider api.LoggerProvider, dbName string) ([]string, error) {
+	logger := provider.MustGetLogger("boltStorage")
+	db, err := openDb(dbName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+	var pending []string
+	err = db.Update(func(tx *bolt.Tx) error {
+		applied, err := migrate(tx, logger)
+		if err != nil {
+			return err
+		}
+
+		pending = applied
+		return errDryRun
+	})
+
+	if !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,135 @@
+package boltStorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/boltdb/bolt"
+	"github.com/op/go-logging"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+type loggerProvider struct{}
+
+func (lp loggerProvider) MustGetLogger(moduleName string) *logging.Logger {
+	return logging.MustGetLogger(moduleName)
+}
+
+const (
+	fixtureChatId int64 = -100
+)
+
+var (
+	// fixtureBalances are the uint32 balances of the schema version 0
+	fixtureBalances = map[int64]uint32{
+		10: 0,
+		11: 42,
+		12: math.MaxUint32,
+	}
+)
+
+// newV0Db writes the db the way the bot did before the schema version, without the meta bucket and with 4 byte balances
+func newV0Db(t *testing.T) string {
+	dbName := filepath.Join(t.TempDir(), "db")
+	db, err := bolt.Open(dbName, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, key := range [][]byte{userNameToUserIdBucketKey, userIdToBalanceBucketKey, userIdToUserNameBucketKey, conversationsBucketKey} {
+			_, err := tx.CreateBucket(key)
+			if err != nil {
+				return err
+			}
+		}
+
+		for userId, balance := range fixtureBalances {
+			err := tx.Bucket(userIdToBalanceBucketKey).Put(balanceBucketKey(fixtureChatId, userId), binary.LittleEndian.AppendUint32(nil, balance))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dbName
+}
+
+func TestMigrateV0(t *testing.T) {
+	storage, closeDb := NewBoltStorage(loggerProvider{}, newV0Db(t))
+	defer closeDb()
+	err := storage.db.View(func(tx *bolt.Tx) error {
+		if version := getSchemaVersion(tx); version != SchemaVersion() {
+			t.Errorf("expected schema version %d, got %d", SchemaVersion(), version)
+		}
+
+		for userId, balance := range fixtureBalances {
+			balanceBytes := tx.Bucket(userIdToBalanceBucketKey).Get(balanceBucketKey(fixtureChatId, userId))
+			if len(balanceBytes) != 8 {
+				t.Errorf("expected the balance of %d to be widened to 8 bytes, got %d", userId, len(balanceBytes))
+				continue
+			}
+
+			if got := int64FromByteArr(balanceBytes); got != int64(balance) {
+				t.Errorf("expected the balance of %d to be %d, got %d", userId, balance, got)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDryRunMigrations(t *testing.T) {
+	dbName := newV0Db(t)
+	before, err := os.ReadFile(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := DryRunMigrations(loggerProvider{}, dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]string, 0, len(migrations))
+	for _, m := range migrations {
+		expected = append(expected, m.description)
+	}
+
+	if !slices.Equal(pending, expected) {
+		t.Errorf("expected pending migrations %q, got %q", expected, pending)
+	}
+
+	after, err := os.ReadFile(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(before, after) {
+		t.Error("dry run has changed the db file")
+	}
+
+	_, closeDb := NewBoltStorage(loggerProvider{}, dbName)
+	closeDb()
+	pending, err = DryRunMigrations(loggerProvider{}, dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations after the migration, got %q", pending)
+	}
+}
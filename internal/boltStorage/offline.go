@@ -0,0 +1,194 @@
+package boltStorage
+
+import (
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"os"
+)
+
+type (
+	// Stats describe the db file for `db stats`
+	Stats struct {
+		Size          int64
+		SchemaVersion uint64
+		Chats         int
+		Buckets       []*BucketStats
+		// FreePages are the pages `db compact` gives back to the file system
+		FreePages int
+		FreeBytes int
+	}
+
+	BucketStats struct {
+		Name string
+		Keys int
+	}
+)
+
+// Open opens the existing db file for writing and migrates it like the bot does on startup,
+// ErrorDbLocked means the bot is running
+func Open(provider api.LoggerProvider, dbName string) (storage *BoltStorage, close func() error, err error) {
+	db, err := openDb(dbName, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger := provider.MustGetLogger("boltStorage")
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := migrate(tx, logger)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+
+	return &BoltStorage{db: db, logger: logger}, db.Close, nil
+}
+
+// ReadStats counts the keys of every bucket and the free pages of the db file which isn't opened by the bot.
+// The db is opened for writing without migrating it, bolt reads the free pages in this mode only
+func ReadStats(provider api.LoggerProvider, dbName string) (*Stats, error) {
+	db, err := openDb(dbName, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+	// the free pages stats are updated when a writable transaction is closed
+	tx, err := db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Rollback()
+	if err != nil {
+		return nil, err
+	}
+
+	storage := &BoltStorage{db: db, logger: provider.MustGetLogger("boltStorage")}
+	return storage.stats()
+}
+
+func (b *BoltStorage) stats() (*Stats, error) {
+	info, err := os.Stat(b.db.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	chatIds, err := b.ChatIds()
+	if err != nil {
+		return nil, err
+	}
+
+	dbStats := b.db.Stats()
+	stats := &Stats{
+		Size:      info.Size(),
+		Chats:     len(chatIds),
+		FreePages: dbStats.FreePageN + dbStats.PendingPageN,
+		FreeBytes: dbStats.FreeAlloc,
+	}
+
+	err = b.view("Stats", func(tx *bolt.Tx) error {
+		if tx.Bucket(metaBucketKey) != nil {
+			stats.SchemaVersion = getSchemaVersion(tx)
+		}
+
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			stats.Buckets = append(stats.Buckets, &BucketStats{Name: string(name), Keys: bucket.Stats().KeyN})
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while Stats: %s", err)
+	}
+
+	return stats, err
+}
+
+// Compact rewrites the db to a new file without the free pages and replaces the db with it,
+// the bot has to be stopped. It returns the file sizes before and after
+func Compact(dbName string) (before int64, after int64, err error) {
+	// holding the lock guarantees the bot is not running while the file is swapped
+	src, err := openDb(dbName, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer src.Close()
+	info, err := os.Stat(dbName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	compactedPath := dbName + ".compact"
+	err = compactTo(src, compactedPath)
+	if err != nil {
+		_ = os.Remove(compactedPath)
+		return 0, 0, fmt.Errorf("error during compaction %w", err)
+	}
+
+	err = os.Rename(compactedPath, dbName)
+	if err != nil {
+		_ = os.Remove(compactedPath)
+		return 0, 0, err
+	}
+
+	compacted, err := os.Stat(dbName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return info.Size(), compacted.Size(), nil
+}
+
+// compactTo copies every bucket of src to the new db at path in a single transaction
+func compactTo(src *bolt.DB, path string) error {
+	dst, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return err
+	}
+
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, srcBucket *bolt.Bucket) error {
+				dstBucket, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+
+				return copyBucket(dstBucket, srcBucket)
+			})
+		})
+	})
+
+	closeErr := dst.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+// copyBucket copies the keys, the nested buckets and the sequence, the values of src stay valid
+// since its transaction outlives the one of dst
+func copyBucket(dst *bolt.Bucket, src *bolt.Bucket) error {
+	err := dst.SetSequence(src.Sequence())
+	if err != nil {
+		return err
+	}
+
+	return src.ForEach(func(k []byte, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
@@ -0,0 +1,131 @@
+package boltStorage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+var (
+	pendingTransfersBucketKey = []byte("pendingTransfers")
+)
+
+func pendingTransferKey(chatId int64, id int64) []byte {
+	return binary.BigEndian.AppendUint64(chatKeyPrefix(chatId), uint64(id))
+}
+
+func getPendingTransfer(tx *bolt.Tx, chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	transferBytes := tx.Bucket(pendingTransfersBucketKey).Get(pendingTransferKey(chatId, transferId))
+	if transferBytes == nil {
+		return nil, fmt.Errorf("pending transfer %d %w", transferId, api.ErrorNotFound)
+	}
+
+	transfer := new(api.PendingTransfer)
+	err := json.Unmarshal(transferBytes, transfer)
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func (b *BoltStorage) CreatePendingTransfer(chatId int64, transfer *api.PendingTransfer) (int64, error) {
+	err := b.update("CreatePendingTransfer", func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pendingTransfersBucketKey)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		transfer.Id = int64(id)
+		transferBytes, err := json.Marshal(transfer)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(pendingTransferKey(chatId, transfer.Id), transferBytes)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while CreatePendingTransfer: %s", err)
+	}
+
+	return transfer.Id, err
+}
+
+func (b *BoltStorage) GetPendingTransfer(chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	var transfer *api.PendingTransfer
+	err := b.view("GetPendingTransfer", func(tx *bolt.Tx) error {
+		var err error
+		transfer, err = getPendingTransfer(tx, chatId, transferId)
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Errorf("error while GetPendingTransfer: %s", err)
+	}
+
+	return transfer, err
+}
+
+func (b *BoltStorage) TakePendingTransfer(chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	var transfer *api.PendingTransfer
+	err := b.update("TakePendingTransfer", func(tx *bolt.Tx) error {
+		var err error
+		transfer, err = getPendingTransfer(tx, chatId, transferId)
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(pendingTransfersBucketKey).Delete(pendingTransferKey(chatId, transferId))
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Errorf("error while TakePendingTransfer: %s", err)
+	}
+
+	return transfer, err
+}
+
+func (b *BoltStorage) DeleteExpiredPendingTransfers(chatId int64, now time.Time) error {
+	err := b.update("DeleteExpiredPendingTransfers", func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pendingTransfersBucketKey)
+		expired := make([][]byte, 0)
+		err := forEachWithPrefix(bucket, chatKeyPrefix(chatId), func(k []byte, v []byte) error {
+			transfer := new(api.PendingTransfer)
+			err := json.Unmarshal(v, transfer)
+			if err != nil {
+				return err
+			}
+
+			if now.After(transfer.ExpiresAt) {
+				expired = append(expired, bytes.Clone(k))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			err = bucket.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while DeleteExpiredPendingTransfers: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,141 @@
+package boltStorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	questsBucketKey = []byte("quests")
+)
+
+func getQuest(tx *bolt.Tx, chatId int64, questId int64) (*api.Quest, error) {
+	questBytes := tx.Bucket(questsBucketKey).Get(chatUserKey(chatId, questId))
+	if questBytes == nil {
+		return nil, fmt.Errorf("quest %d %w", questId, api.ErrorNotFound)
+	}
+
+	quest := new(api.Quest)
+	err := json.Unmarshal(questBytes, quest)
+	if err != nil {
+		return nil, err
+	}
+
+	return quest, nil
+}
+
+func putQuest(tx *bolt.Tx, chatId int64, quest *api.Quest) error {
+	questBytes, err := json.Marshal(quest)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(questsBucketKey).Put(chatUserKey(chatId, quest.Id), questBytes)
+}
+
+func (b *BoltStorage) CreateQuest(chatId int64, quest *api.Quest) (int64, error) {
+	err := b.update("CreateQuest", func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(questsBucketKey).NextSequence()
+		if err != nil {
+			return err
+		}
+
+		quest.Id = int64(id)
+		return putQuest(tx, chatId, quest)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while CreateQuest: %s", err)
+	}
+
+	return quest.Id, err
+}
+
+func (b *BoltStorage) GetQuests(chatId int64) ([]*api.Quest, error) {
+	quests := make([]*api.Quest, 0)
+	err := b.view("GetQuests", func(tx *bolt.Tx) error {
+		return forEachWithPrefix(tx.Bucket(questsBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			quest := new(api.Quest)
+			err := json.Unmarshal(v, quest)
+			if err != nil {
+				return err
+			}
+
+			quests = append(quests, quest)
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetQuests: %s", err)
+	}
+
+	return quests, err
+}
+
+func (b *BoltStorage) UpdateQuest(chatId int64, questId int64, update func(quest *api.Quest) error) error {
+	err := b.update("UpdateQuest", func(tx *bolt.Tx) error {
+		quest, err := getQuest(tx, chatId, questId)
+		if err != nil {
+			return err
+		}
+
+		err = update(quest)
+		if err != nil {
+			return err
+		}
+
+		quest.Id = questId
+		return putQuest(tx, chatId, quest)
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Debugf("error while UpdateQuest: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) CompleteQuest(chatId int64, questId int64, complete func(quest *api.Quest) ([]*api.Credit, error)) error {
+	err := b.update("CompleteQuest", func(tx *bolt.Tx) error {
+		quest, err := getQuest(tx, chatId, questId)
+		if err != nil {
+			return err
+		}
+
+		credits, err := complete(quest)
+		if err != nil {
+			return err
+		}
+
+		quest.Id = questId
+		err = putQuest(tx, chatId, quest)
+		if err != nil {
+			return err
+		}
+
+		for _, credit := range credits {
+			err = transferMoney(tx, chatId, &api.MoneyTransfer{
+				Kind:    api.MoneyTransferKindQuest,
+				FromId:  api.TreasuryAccountId,
+				ToId:    credit.UserId,
+				ActorId: quest.CreatedBy,
+				Amount:  credit.Amount,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Debugf("error while CompleteQuest: %s", err)
+	}
+
+	return err
+}
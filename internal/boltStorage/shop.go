@@ -0,0 +1,166 @@
+package boltStorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+)
+
+var (
+	shopItemsBucketKey = []byte("shopItems")
+)
+
+func shopItemKey(chatId int64, item string) []byte {
+	return append(chatKeyPrefix(chatId), []byte(api.ItemKey(item))...)
+}
+
+func getShopItem(tx *bolt.Tx, chatId int64, item string) (*api.ShopItem, error) {
+	itemBytes := tx.Bucket(shopItemsBucketKey).Get(shopItemKey(chatId, item))
+	if itemBytes == nil {
+		return nil, fmt.Errorf("shop item %s %w", item, api.ErrorNotFound)
+	}
+
+	shopItem := new(api.ShopItem)
+	err := json.Unmarshal(itemBytes, shopItem)
+	if err != nil {
+		return nil, err
+	}
+
+	return shopItem, nil
+}
+
+func putShopItem(tx *bolt.Tx, chatId int64, item *api.ShopItem) error {
+	itemBytes, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(shopItemsBucketKey).Put(shopItemKey(chatId, item.Name), itemBytes)
+}
+
+func (b *BoltStorage) SaveShopItem(chatId int64, item *api.ShopItem) error {
+	err := b.update("SaveShopItem", func(tx *bolt.Tx) error {
+		return putShopItem(tx, chatId, item)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while SaveShopItem: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) DeleteShopItem(chatId int64, item string) error {
+	err := b.update("DeleteShopItem", func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(shopItemsBucketKey)
+		key := shopItemKey(chatId, item)
+		if bucket.Get(key) == nil {
+			return fmt.Errorf("shop item %s %w", item, api.ErrorNotFound)
+		}
+
+		return bucket.Delete(key)
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Errorf("error while DeleteShopItem: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) GetShopItems(chatId int64) ([]*api.ShopItem, error) {
+	items := make([]*api.ShopItem, 0)
+	err := b.view("GetShopItems", func(tx *bolt.Tx) error {
+		return forEachWithPrefix(tx.Bucket(shopItemsBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			item := new(api.ShopItem)
+			err := json.Unmarshal(v, item)
+			if err != nil {
+				return err
+			}
+
+			items = append(items, item)
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetShopItems: %s", err)
+	}
+
+	return items, err
+}
+
+func (b *BoltStorage) BuyItem(chatId int64, userId int64, item string, quantity int) (*api.ShopItem, error) {
+	var shopItem *api.ShopItem
+	err := b.update("BuyItem", func(tx *bolt.Tx) error {
+		var err error
+		shopItem, err = getShopItem(tx, chatId, item)
+		if err != nil {
+			return err
+		}
+
+		err = shopItem.TakeFromStock(quantity)
+		if err != nil {
+			return err
+		}
+
+		total, err := shopItem.TotalPrice(quantity)
+		if err != nil {
+			return err
+		}
+
+		err = debitBalance(tx, chatId, userId, total)
+		if err != nil {
+			return err
+		}
+
+		err = addMoneyTransfer(tx, chatId, &api.MoneyTransfer{
+			Kind:    api.MoneyTransferKindBuy,
+			FromId:  userId,
+			ToId:    api.ExternalAccountId,
+			ActorId: userId,
+			Amount:  total,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = putShopItem(tx, chatId, shopItem)
+		if err != nil {
+			return err
+		}
+
+		inventory, err := getInventory(tx, chatId, userId)
+		if err != nil {
+			return err
+		}
+
+		err = inventory.Add(shopItem.Name, quantity)
+		if err != nil {
+			return err
+		}
+
+		err = putInventory(tx, chatId, userId, inventory)
+		if err != nil {
+			return err
+		}
+
+		return addItemTransfer(tx, chatId, &api.ItemTransfer{
+			Kind:     api.ItemTransferKindBuy,
+			FromId:   userId,
+			ToId:     userId,
+			ActorId:  userId,
+			Item:     shopItem.Name,
+			Quantity: quantity,
+		})
+	})
+
+	if err != nil {
+		b.logger.Debugf("error while BuyItem: %s", err)
+		return nil, err
+	}
+
+	return shopItem, nil
+}
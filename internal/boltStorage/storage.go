@@ -1,33 +1,60 @@
 package boltStorage
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/Refreezer/dnd-util-bot/metrics"
 	"github.com/boltdb/bolt"
 	"github.com/op/go-logging"
-	"math"
 	"time"
 )
 
+const (
+	// legacyBalanceLength is the length of the uint32 balance
+	legacyBalanceLength = 4
+)
+
 var (
 	userNameToUserIdBucketKey = []byte("userNameToUserId")
 	userIdToBalanceBucketKey  = []byte("userIdToBalance")
+	userIdToUserNameBucketKey = []byte("userIdToUserName")
+	conversationsBucketKey    = []byte("conversations")
 	bucketsKeys               = [][]byte{
 		userNameToUserIdBucketKey,
 		userIdToBalanceBucketKey,
+		userIdToUserNameBucketKey,
+		conversationsBucketKey,
+		charactersBucketKey,
+		activeCharactersBucketKey,
+		inventoriesBucketKey,
+		itemTransfersBucketKey,
+		shopItemsBucketKey,
+		questsBucketKey,
+		moneyTransfersBucketKey,
+		chatSettingsBucketKey,
+		pendingTransfersBucketKey,
+		metaBucketKey,
 	}
+
+	// errStopIteration stops forEachWithPrefixReverse without an error
+	errStopIteration = errors.New("stop iteration")
 )
 
 type BoltStorage struct {
 	db     *bolt.DB
 	logger *logging.Logger
+	// tx is the transaction of WithTx the storage is bound to, nil if every call runs its own transaction
+	tx *bolt.Tx
 }
 
 func (b *BoltStorage) IsRegistered(chatId int64, userId int64) (bool, error) {
 	var ok bool
-	err := b.db.View(func(tx *bolt.Tx) error {
+	err := b.view("IsRegistered", func(tx *bolt.Tx) error {
 		balance := tx.Bucket(userIdToBalanceBucketKey).Get(balanceBucketKey(chatId, userId))
 		ok = balance != nil
 		return nil
@@ -39,12 +66,13 @@ func (b *BoltStorage) IsRegistered(chatId int64, userId int64) (bool, error) {
 func NewBoltStorage(provider api.LoggerProvider, dbName string) (storage *BoltStorage, close func()) {
 	logger := provider.MustGetLogger("boltStorage")
 	logger.Debugf("Db path is %s", dbName)
-	db, err := bolt.Open(dbName, 0600, &bolt.Options{Timeout: 1 * time.Second})
-	Init(db, logger)
+	db, err := bolt.Open(dbName, 0600, &bolt.Options{Timeout: lockTimeout})
 	if err != nil {
 		logger.Fatalf("error while opening db connection %s", err)
 	}
 
+	Init(db, logger)
+
 	return &BoltStorage{
 			db:     db,
 			logger: logger,
@@ -57,23 +85,90 @@ func NewBoltStorage(provider api.LoggerProvider, dbName string) (storage *BoltSt
 		}
 }
 
+// Init creates missing buckets and migrates the db to the current schema version in a single transaction
 func Init(db *bolt.DB, logger *logging.Logger) {
 	err := db.Update(func(tx *bolt.Tx) error {
-		for _, key := range bucketsKeys {
-			err := initBucket(tx, key)
-			if err != nil {
-				return err
-			}
-		}
+		_, err := migrate(tx, logger)
+		return err
+	})
+
+	if err != nil {
+		logger.Fatalf("error during db initialization %s", err)
+	}
+}
 
+// Ping fails if the db is closed
+func (b *BoltStorage) Ping(_ context.Context) error {
+	return b.view("Ping", func(tx *bolt.Tx) error {
 		return nil
 	})
+}
+
+// WithTx runs fn in the single write transaction, bolt can't interrupt the running transaction
+// so ctx is checked before it starts and before the commit
+func (b *BoltStorage) WithTx(ctx context.Context, fn func(tx api.StorageTx) error) error {
+	if b.tx != nil {
+		return fn(b)
+	}
 
+	err := ctx.Err()
 	if err != nil {
+		return err
+	}
+
+	defer metrics.ObserveStorageOperation("WithTx", time.Now())
+	return b.db.Update(func(tx *bolt.Tx) error {
+		err := fn(&BoltStorage{db: b.db, logger: b.logger, tx: tx})
 		if err != nil {
-			logger.Fatalf("error during db initialization")
+			return err
 		}
+
+		return ctx.Err()
+	})
+}
+
+// update runs fn in the write transaction, the operation is the name of the Storage method for the latency metric
+func (b *BoltStorage) update(operation string, fn func(tx *bolt.Tx) error) error {
+	defer metrics.ObserveStorageOperation(operation, time.Now())
+	if b.tx != nil {
+		return fn(b.tx)
 	}
+
+	return b.db.Update(fn)
+}
+
+func (b *BoltStorage) view(operation string, fn func(tx *bolt.Tx) error) error {
+	defer metrics.ObserveStorageOperation(operation, time.Now())
+	if b.tx != nil {
+		return fn(b.tx)
+	}
+
+	return b.db.View(fn)
+}
+
+// migrateBalancesToInt64 rewrites 4 byte unsigned balances to 8 byte signed ones
+func migrateBalancesToInt64(tx *bolt.Tx) error {
+	bucket := tx.Bucket(userIdToBalanceBucketKey)
+	legacy := make(map[string]int64)
+	err := bucket.ForEach(func(k []byte, v []byte) error {
+		if len(v) == legacyBalanceLength {
+			legacy[string(k)] = balanceFromByteArr(v)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for k, balance := range legacy {
+		err = bucket.Put([]byte(k), int64ToByteArr(balance))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func initBucket(tx *bolt.Tx, bucketKey []byte) error {
@@ -87,100 +182,139 @@ func initBucket(tx *bolt.Tx, bucketKey []byte) error {
 }
 
 func balanceBucketKey(chatId, userId int64) []byte {
-	bytes := make([]byte, 0)
-	bytes = binary.LittleEndian.AppendUint64(bytes, uint64(chatId))
-	return binary.LittleEndian.AppendUint64(bytes, uint64(userId))
+	return chatUserKey(chatId, userId)
 }
 
-func int64ToByteArr(value int64) []byte {
-	b := make([]byte, 8)
-	binary.LittleEndian.PutUint64(b, uint64(value))
-	return b
+// chatUserKey is chatId||userId, fixed width chat prefix allows to iterate over the users of one chat with cursor
+func chatUserKey(chatId, userId int64) []byte {
+	bytes := chatKeyPrefix(chatId)
+	return binary.LittleEndian.AppendUint64(bytes, uint64(userId))
 }
 
-func uintToByteArr(value uint) []byte {
-	b := make([]byte, 4)
-	binary.LittleEndian.PutUint32(b, uint32(value))
-	return b
+func chatKeyPrefix(chatId int64) []byte {
+	bytes := make([]byte, 0)
+	return binary.LittleEndian.AppendUint64(bytes, uint64(chatId))
 }
 
-func uintFromByteArr(arr []byte) uint {
-	return uint(binary.LittleEndian.Uint32(arr))
+func userIdFromChatUserKey(key []byte) int64 {
+	return int64FromByteArr(key[8:])
 }
 
-func int64FromByteArr(arr []byte) int64 {
-	return int64(binary.LittleEndian.Uint64(arr))
+func forEachWithPrefix(bucket *bolt.Bucket, prefix []byte, fn func(k []byte, v []byte) error) error {
+	c := bucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		err := fn(k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (b *BoltStorage) MoveMoneyFromUserToUser(chatId int64, fromId int64, toId int64, amount uint) error {
-	if toId == fromId {
-		return api.ErrorInvalidTransactionParameters
+// forEachWithPrefixReverse iterates keys with the prefix from the last one to the first one
+func forEachWithPrefixReverse(bucket *bolt.Bucket, prefix []byte, fn func(k []byte, v []byte) error) error {
+	c := bucket.Cursor()
+	upperBound := append(bytes.Clone(prefix), bytes.Repeat([]byte{0xff}, 8)...)
+	k, v := c.Seek(upperBound)
+	if k == nil {
+		k, v = c.Last()
+	} else if !bytes.Equal(k, upperBound) {
+		k, v = c.Prev()
 	}
 
-	err := b.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(userIdToBalanceBucketKey)
-		fromKey := balanceBucketKey(chatId, fromId)
-		fromBalanceBytes := bucket.Get(fromKey)
-		if fromBalanceBytes == nil {
-			return fmt.Errorf("error while MoveMoneyFromUserToUser (sender) %w", api.ErrorNotRegistered)
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+		err := fn(k, v)
+		if errors.Is(err, errStopIteration) {
+			return nil
 		}
 
-		toKey := balanceBucketKey(chatId, toId)
-		toBalanceBytes := bucket.Get(toKey)
-		if toBalanceBytes == nil {
-			return fmt.Errorf("error while MoveMoneyFromUserToUser (recepient) %w", api.ErrorNotRegistered)
+		if err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+func int64ToByteArr(value int64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(value))
+	return b
+}
+
+// balanceFromByteArr decodes the balance, 4 byte values are unsigned balances stored before int64 balances
+func balanceFromByteArr(arr []byte) int64 {
+	if len(arr) == legacyBalanceLength {
+		return int64(binary.LittleEndian.Uint32(arr))
+	}
 
-		fromBalance := uintFromByteArr(fromBalanceBytes)
-		toBalance := uintFromByteArr(toBalanceBytes)
-		if fromBalance < amount {
-			return api.ErrorInsufficientMoney
+	return int64FromByteArr(arr)
+}
+
+func int64FromByteArr(arr []byte) int64 {
+	return int64(binary.LittleEndian.Uint64(arr))
+}
+
+// creditUsers adds amounts coming from api.ExternalAccountId to the wallets,
+// fails if any of the users is not registered or the wallet overflows
+func creditUsers(tx *bolt.Tx, chatId int64, kind string, actorId int64, credits []*api.Credit) error {
+	for _, credit := range credits {
+		balance, err := getBalance(tx, chatId, credit.UserId)
+		if err != nil {
+			return err
 		}
 
-		newFromBalanceBytes := uintToByteArr(fromBalance - amount)
-		err := bucket.Put(fromKey, newFromBalanceBytes)
+		balance, err = api.CreditBalance(balance, credit.Amount)
 		if err != nil {
 			return err
 		}
 
-		if amount > math.MaxUint32-toBalance {
-			return api.ErrorBalanceOverflow
+		err = putBalance(tx, chatId, credit.UserId, balance)
+		if err != nil {
+			return err
 		}
 
-		err = bucket.Put(toKey, uintToByteArr(amount+toBalance))
+		err = addMoneyTransfer(tx, chatId, &api.MoneyTransfer{
+			Kind:    kind,
+			FromId:  api.ExternalAccountId,
+			ToId:    credit.UserId,
+			ActorId: actorId,
+			Amount:  credit.Amount,
+		})
 		if err != nil {
 			return err
 		}
+	}
 
-		return nil
+	return nil
+}
+
+func (b *BoltStorage) CreditUsers(chatId int64, kind string, actorId int64, credits []*api.Credit) error {
+	err := b.update("CreditUsers", func(tx *bolt.Tx) error {
+		return creditUsers(tx, chatId, kind, actorId, credits)
 	})
 
 	if err != nil {
-		b.logger.Errorf("error while MoveMoneyFromUserToUser %s", err)
+		b.logger.Errorf("error while CreditUsers %s", err)
 	}
 
 	return err
 }
 
-func (b *BoltStorage) SetUserBalance(chatId int64, userId int64, amount uint) error {
-	if amount < 0 {
-		return api.ErrorInsufficientMoney
-	}
-
-	if amount > math.MaxUint32 {
+func (b *BoltStorage) SetUserBalance(chatId int64, userId int64, amount int64) error {
+	if amount < -api.MaxBalance || amount > api.MaxBalance {
 		return api.ErrorBalanceOverflow
 	}
 
-	return b.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(userIdToBalanceBucketKey)
-		userIdKey := balanceBucketKey(chatId, userId)
-		return bucket.Put(userIdKey, uintToByteArr(amount))
+	return b.update("SetUserBalance", func(tx *bolt.Tx) error {
+		return putBalance(tx, chatId, userId, amount)
 	})
 }
 
-func (b *BoltStorage) GetUserBalance(chatId int64, userId int64) (uint, error) {
-	var balance uint
-	err := b.db.View(func(tx *bolt.Tx) error {
+func (b *BoltStorage) GetUserBalance(chatId int64, userId int64) (int64, error) {
+	var balance int64
+	err := b.view("GetUserBalance", func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(userIdToBalanceBucketKey)
 		userKey := balanceBucketKey(chatId, userId)
 		balanceBytes := bucket.Get(userKey)
@@ -188,7 +322,7 @@ func (b *BoltStorage) GetUserBalance(chatId int64, userId int64) (uint, error) {
 			return fmt.Errorf("error while GetUserBalance %w", api.ErrorNotRegistered)
 		}
 
-		balance = uintFromByteArr(balanceBytes)
+		balance = balanceFromByteArr(balanceBytes)
 		return nil
 	})
 
@@ -200,7 +334,7 @@ func (b *BoltStorage) GetUserBalance(chatId int64, userId int64) (uint, error) {
 }
 
 func (b *BoltStorage) GetIdByUserName(userName string) (userId int64, ok bool) {
-	err := b.db.View(func(tx *bolt.Tx) error {
+	err := b.view("GetIdByUserName", func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(userNameToUserIdBucketKey)
 		userIdBytes := bucket.Get([]byte(userName))
 		if userIdBytes == nil {
@@ -221,9 +355,25 @@ func (b *BoltStorage) GetIdByUserName(userName string) (userId int64, ok bool) {
 }
 
 func (b *BoltStorage) SaveUserNameToUserIdMapping(userName string, id int64) error {
-	err := b.db.Update(func(tx *bolt.Tx) error {
+	err := b.update("SaveUserNameToUserIdMapping", func(tx *bolt.Tx) error {
 		bucket := tx.Bucket(userNameToUserIdBucketKey)
-		return bucket.Put([]byte(userName), int64ToByteArr(id))
+		userIds := tx.Bucket(userIdToUserNameBucketKey)
+		idBytes := int64ToByteArr(id)
+		// the previous name of the renamed user is deleted unless another user has taken it
+		previousName := string(userIds.Get(idBytes))
+		if previousName != "" && previousName != userName && bytes.Equal(bucket.Get([]byte(previousName)), idBytes) {
+			err := bucket.Delete([]byte(previousName))
+			if err != nil {
+				return err
+			}
+		}
+
+		err := bucket.Put([]byte(userName), idBytes)
+		if err != nil {
+			return err
+		}
+
+		return userIds.Put(idBytes, []byte(userName))
 	})
 
 	if err != nil {
@@ -232,3 +382,97 @@ func (b *BoltStorage) SaveUserNameToUserIdMapping(userName string, id int64) err
 
 	return err
 }
+
+func (b *BoltStorage) GetUserNameById(userId int64) (userName string, ok bool) {
+	err := b.view("GetUserNameById", func(tx *bolt.Tx) error {
+		userNameBytes := tx.Bucket(userIdToUserNameBucketKey).Get(int64ToByteArr(userId))
+		if userNameBytes == nil {
+			return nil
+		}
+
+		userName = string(userNameBytes)
+		ok = true
+		return nil
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetUserNameById: %s", err)
+		return "", false
+	}
+
+	return userName, ok
+}
+
+func (b *BoltStorage) GetChatMembers(chatId int64) ([]*api.Member, error) {
+	members := make([]*api.Member, 0)
+	err := b.view("GetChatMembers", func(tx *bolt.Tx) error {
+		userNames := tx.Bucket(userIdToUserNameBucketKey)
+		return forEachWithPrefix(tx.Bucket(userIdToBalanceBucketKey), chatKeyPrefix(chatId), func(k []byte, _ []byte) error {
+			userId := userIdFromChatUserKey(k)
+			if userId == api.TreasuryAccountId {
+				return nil
+			}
+
+			members = append(members, &api.Member{
+				UserId:   userId,
+				UserName: string(userNames.Get(int64ToByteArr(userId))),
+			})
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetChatMembers: %s", err)
+	}
+
+	return members, err
+}
+
+func (b *BoltStorage) GetConversation(chatId int64, userId int64) (*api.Conversation, error) {
+	var conv *api.Conversation
+	err := b.view("GetConversation", func(tx *bolt.Tx) error {
+		convBytes := tx.Bucket(conversationsBucketKey).Get(chatUserKey(chatId, userId))
+		if convBytes == nil {
+			return fmt.Errorf("error while GetConversation %w", api.ErrorNotFound)
+		}
+
+		conv = new(api.Conversation)
+		return json.Unmarshal(convBytes, conv)
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		b.logger.Errorf("error while GetConversation: %s", err)
+	}
+
+	return conv, err
+}
+
+func (b *BoltStorage) SaveConversation(chatId int64, userId int64, conv *api.Conversation) error {
+	convBytes, err := json.Marshal(conv)
+	if err != nil {
+		return err
+	}
+
+	err = b.update("SaveConversation", func(tx *bolt.Tx) error {
+		return tx.Bucket(conversationsBucketKey).Put(chatUserKey(chatId, userId), convBytes)
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while SaveConversation: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) DeleteConversation(chatId int64, userId int64) error {
+	err := b.update("DeleteConversation", func(tx *bolt.Tx) error {
+		return tx.Bucket(conversationsBucketKey).Delete(chatUserKey(chatId, userId))
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while DeleteConversation: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,16 @@
+package boltStorage
+
+import (
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/Refreezer/dnd-util-bot/internal/storagetest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) api.Storage {
+		storage, closeDb := NewBoltStorage(loggerProvider{}, filepath.Join(t.TempDir(), "db"))
+		t.Cleanup(closeDb)
+		return storage
+	})
+}
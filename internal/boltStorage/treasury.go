@@ -0,0 +1,190 @@
+package boltStorage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+	"time"
+)
+
+var (
+	moneyTransfersBucketKey = []byte("moneyTransfers")
+)
+
+// getBalance returns the wallet balance, the treasury wallet is created on the first deposit
+func getBalance(tx *bolt.Tx, chatId int64, accountId int64) (int64, error) {
+	balanceBytes := tx.Bucket(userIdToBalanceBucketKey).Get(balanceBucketKey(chatId, accountId))
+	if balanceBytes != nil {
+		return balanceFromByteArr(balanceBytes), nil
+	}
+
+	if accountId == api.TreasuryAccountId {
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("wallet %d %w", accountId, api.ErrorNotRegistered)
+}
+
+func putBalance(tx *bolt.Tx, chatId int64, accountId int64, balance int64) error {
+	return tx.Bucket(userIdToBalanceBucketKey).Put(balanceBucketKey(chatId, accountId), int64ToByteArr(balance))
+}
+
+// debitBalance takes amount from the wallet, players may go in debt up to the credit limit of the chat,
+// the treasury never goes in debt
+func debitBalance(tx *bolt.Tx, chatId int64, accountId int64, amount int64) error {
+	balance, err := getBalance(tx, chatId, accountId)
+	if err != nil {
+		return err
+	}
+
+	if accountId == api.TreasuryAccountId {
+		balance, err = api.DebitBalance(balance, amount, 0)
+		if err != nil {
+			return api.ErrorInsufficientTreasury
+		}
+
+		return putBalance(tx, chatId, accountId, balance)
+	}
+
+	settings, err := getChatSettings(tx, chatId)
+	if err != nil {
+		return err
+	}
+
+	balance, err = api.DebitBalance(balance, amount, settings.CreditLimit)
+	if err != nil {
+		return err
+	}
+
+	return putBalance(tx, chatId, accountId, balance)
+}
+
+func creditBalance(tx *bolt.Tx, chatId int64, accountId int64, amount int64) error {
+	balance, err := getBalance(tx, chatId, accountId)
+	if err != nil {
+		return err
+	}
+
+	balance, err = api.CreditBalance(balance, amount)
+	if err != nil {
+		return err
+	}
+
+	return putBalance(tx, chatId, accountId, balance)
+}
+
+// moneyTransferKey is chat prefix followed by big endian sequence so the ledger of the chat is ordered by time
+func moneyTransferKey(chatId int64, id int64) []byte {
+	return binary.BigEndian.AppendUint64(chatKeyPrefix(chatId), uint64(id))
+}
+
+func addMoneyTransfer(tx *bolt.Tx, chatId int64, transfer *api.MoneyTransfer) error {
+	bucket := tx.Bucket(moneyTransfersBucketKey)
+	id, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	transfer.Id = int64(id)
+	transfer.Time = time.Now()
+	transferBytes, err := json.Marshal(transfer)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(moneyTransferKey(chatId, transfer.Id), transferBytes)
+}
+
+func transferMoney(tx *bolt.Tx, chatId int64, transfer *api.MoneyTransfer) error {
+	if transfer.FromId == transfer.ToId {
+		return api.ErrorInvalidTransactionParameters
+	}
+
+	err := debitBalance(tx, chatId, transfer.FromId, transfer.Amount)
+	if err != nil {
+		return err
+	}
+
+	err = creditBalance(tx, chatId, transfer.ToId, transfer.Amount)
+	if err != nil {
+		return err
+	}
+
+	return addMoneyTransfer(tx, chatId, transfer)
+}
+
+func (b *BoltStorage) GetTreasuryBalance(chatId int64) (int64, error) {
+	var balance int64
+	err := b.view("GetTreasuryBalance", func(tx *bolt.Tx) error {
+		var err error
+		balance, err = getBalance(tx, chatId, api.TreasuryAccountId)
+		return err
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetTreasuryBalance: %s", err)
+	}
+
+	return balance, err
+}
+
+func (b *BoltStorage) TransferMoney(chatId int64, transfer *api.MoneyTransfer) error {
+	err := b.update("TransferMoney", func(tx *bolt.Tx) error {
+		return transferMoney(tx, chatId, transfer)
+	})
+
+	if err != nil {
+		b.logger.Debugf("error while TransferMoney: %s", err)
+	}
+
+	return err
+}
+
+func (b *BoltStorage) GetMoneyTransfers(chatId int64, accountId int64, limit int) ([]*api.MoneyTransfer, error) {
+	return b.getMoneyTransfers("GetMoneyTransfers", chatId, limit, func(transfer *api.MoneyTransfer) bool {
+		return transfer.FromId == accountId || transfer.ToId == accountId
+	})
+}
+
+func (b *BoltStorage) GetChatMoneyTransfers(chatId int64, limit int) ([]*api.MoneyTransfer, error) {
+	return b.getMoneyTransfers("GetChatMoneyTransfers", chatId, limit, func(_ *api.MoneyTransfer) bool {
+		return true
+	})
+}
+
+// getMoneyTransfers returns the latest ledger records of the chat matching the filter, newest first
+func (b *BoltStorage) getMoneyTransfers(
+	name string,
+	chatId int64,
+	limit int,
+	matches func(transfer *api.MoneyTransfer) bool,
+) ([]*api.MoneyTransfer, error) {
+	transfers := make([]*api.MoneyTransfer, 0, limit)
+	err := b.view(name, func(tx *bolt.Tx) error {
+		return forEachWithPrefixReverse(tx.Bucket(moneyTransfersBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			if len(transfers) >= limit {
+				return errStopIteration
+			}
+
+			transfer := new(api.MoneyTransfer)
+			err := json.Unmarshal(v, transfer)
+			if err != nil {
+				return err
+			}
+
+			if matches(transfer) {
+				transfers = append(transfers, transfer)
+			}
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while %s: %s", name, err)
+	}
+
+	return transfers, err
+}
@@ -0,0 +1,54 @@
+package boltStorage
+
+import (
+	"encoding/json"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/boltdb/bolt"
+)
+
+func (b *BoltStorage) GetChatWallets(chatId int64) ([]*api.Wallet, error) {
+	wallets := make([]*api.Wallet, 0)
+	err := b.view("GetChatWallets", func(tx *bolt.Tx) error {
+		return forEachWithPrefix(tx.Bucket(userIdToBalanceBucketKey), chatKeyPrefix(chatId), func(k []byte, v []byte) error {
+			userId := userIdFromChatUserKey(k)
+			if userId == api.TreasuryAccountId {
+				return nil
+			}
+
+			wallets = append(wallets, &api.Wallet{
+				UserId:  userId,
+				Balance: balanceFromByteArr(v),
+			})
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetChatWallets: %s", err)
+	}
+
+	return wallets, err
+}
+
+func (b *BoltStorage) GetAccountStats(chatId int64, accountId int64) (*api.AccountStats, error) {
+	stats := new(api.AccountStats)
+	err := b.view("GetAccountStats", func(tx *bolt.Tx) error {
+		return forEachWithPrefix(tx.Bucket(moneyTransfersBucketKey), chatKeyPrefix(chatId), func(_ []byte, v []byte) error {
+			transfer := new(api.MoneyTransfer)
+			err := json.Unmarshal(v, transfer)
+			if err != nil {
+				return err
+			}
+
+			stats.Add(accountId, transfer)
+			return nil
+		})
+	})
+
+	if err != nil {
+		b.logger.Errorf("error while GetAccountStats: %s", err)
+	}
+
+	return stats, err
+}
@@ -10,7 +10,25 @@ type EnvKey string
 const (
 	DndUtilRateLimitRps       EnvKey = "DND_UTIL_RATE_LIMIT_RPS"
 	DndUtilDbPath             EnvKey = "DND_UTIL_DB_PATH"
+	DndUtilDbDriver           EnvKey = "DND_UTIL_DB_DRIVER"
 	DndUtilTgApiKey           EnvKey = "DND_UTIL_TG_API_KEY"
 	DndUtilLongPollingTimeout EnvKey = "DND_UTIL_LONG_POLLING_TIMEOUT"
 	DndUtilBotName            EnvKey = "DND_UTIL_BOT_NAME"
+	DndUtilOwnerId            EnvKey = "DND_UTIL_OWNER_ID"
+	DndUtilBackupDir          EnvKey = "DND_UTIL_BACKUP_DIR"
+	DndUtilBackupInterval     EnvKey = "DND_UTIL_BACKUP_INTERVAL"
+	DndUtilBackupRetention    EnvKey = "DND_UTIL_BACKUP_RETENTION"
+	DndUtilSnapshotInterval   EnvKey = "DND_UTIL_SNAPSHOT_INTERVAL"
+	DndUtilHttpAddr           EnvKey = "DND_UTIL_HTTP_ADDR"
+	DndUtilLogFormat          EnvKey = "DND_UTIL_LOG_FORMAT"
+	DndUtilConfig             EnvKey = "DND_UTIL_CONFIG"
+	DndUtilLocale             EnvKey = "DND_UTIL_LOCALE"
+	DndUtilDisabledCommands   EnvKey = "DND_UTIL_DISABLED_COMMANDS"
+
+	DndUtilConversationTimeout    EnvKey = "DND_UTIL_CONVERSATION_TIMEOUT"
+	DndUtilPendingTransferTimeout EnvKey = "DND_UTIL_PENDING_TRANSFER_TIMEOUT"
+	DndUtilImportTimeout          EnvKey = "DND_UTIL_IMPORT_TIMEOUT"
+
+	DndUtilAdminAddr  EnvKey = "DND_UTIL_ADMIN_ADDR"
+	DndUtilAdminToken EnvKey = "DND_UTIL_ADMIN_TOKEN"
 )
@@ -0,0 +1,184 @@
+package mapStorage
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+type characterKey struct {
+	chatId      int64
+	characterId int64
+}
+
+// cloneCharacter deep copies the character so callers can't modify stored state
+func cloneCharacter(character *api.Character) *api.Character {
+	characterBytes, err := json.Marshal(character)
+	if err != nil {
+		panic(fmt.Errorf("character is not serializable %w", err))
+	}
+
+	clone := new(api.Character)
+	err = json.Unmarshal(characterBytes, clone)
+	if err != nil {
+		panic(fmt.Errorf("character is not deserializable %w", err))
+	}
+
+	return clone
+}
+
+func (m *MapStorage) getCharacter(chatId int64, characterId int64) (*api.Character, error) {
+	character, ok := m.characters[characterKey{chatId, characterId}]
+	if !ok {
+		return nil, fmt.Errorf("character %d %w", characterId, api.ErrorNotFound)
+	}
+
+	return character, nil
+}
+
+func (m *MapStorage) CreateCharacter(chatId int64, character *api.Character) (int64, error) {
+	m.lock()
+	defer m.unlock()
+	character.Id = m.nextSequence(sequenceCharacters)
+	put(m, tableCharacters, m.characters, characterKey{chatId, character.Id}, cloneCharacter(character))
+	put(m, tableActiveCharacters, m.activeCharacters, balanceBucketKey{chatId, character.OwnerId}, character.Id)
+	return character.Id, nil
+}
+
+func (m *MapStorage) GetCharacter(chatId int64, characterId int64) (*api.Character, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	character, err := m.getCharacter(chatId, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloneCharacter(character), nil
+}
+
+func (m *MapStorage) GetCharacters(chatId int64, userId int64) ([]*api.Character, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	characters := make([]*api.Character, 0)
+	for key, character := range m.characters {
+		if key.chatId == chatId && character.OwnerId == userId {
+			characters = append(characters, cloneCharacter(character))
+		}
+	}
+
+	return characters, nil
+}
+
+func (m *MapStorage) UpdateCharacter(chatId int64, characterId int64, update func(character *api.Character) error) error {
+	m.lock()
+	defer m.unlock()
+	character, err := m.getCharacter(chatId, characterId)
+	if err != nil {
+		return err
+	}
+
+	updated := cloneCharacter(character)
+	err = update(updated)
+	if err != nil {
+		return err
+	}
+
+	updated.Id = characterId
+	put(m, tableCharacters, m.characters, characterKey{chatId, characterId}, cloneCharacter(updated))
+	return nil
+}
+
+func (m *MapStorage) DeleteCharacter(chatId int64, characterId int64) error {
+	m.lock()
+	defer m.unlock()
+	character, err := m.getCharacter(chatId, characterId)
+	if err != nil {
+		return err
+	}
+
+	remove(m, tableCharacters, m.characters, characterKey{chatId, characterId})
+	activeKey := balanceBucketKey{chatId, character.OwnerId}
+	if m.activeCharacters[activeKey] == characterId {
+		remove(m, tableActiveCharacters, m.activeCharacters, activeKey)
+	}
+
+	return nil
+}
+
+func (m *MapStorage) SetActiveCharacter(chatId int64, userId int64, characterId int64) error {
+	m.lock()
+	defer m.unlock()
+	character, err := m.getCharacter(chatId, characterId)
+	if err != nil {
+		return err
+	}
+
+	if character.OwnerId != userId {
+		return api.ErrorNotCharacterOwner
+	}
+
+	put(m, tableActiveCharacters, m.activeCharacters, balanceBucketKey{chatId, userId}, characterId)
+	return nil
+}
+
+func (m *MapStorage) GetActiveCharacter(chatId int64, userId int64) (*api.Character, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	characterId, ok := m.activeCharacters[balanceBucketKey{chatId, userId}]
+	if !ok {
+		return nil, fmt.Errorf("active character %w", api.ErrorNotFound)
+	}
+
+	character, err := m.getCharacter(chatId, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloneCharacter(character), nil
+}
+
+func (m *MapStorage) GetActiveCharacters(chatId int64) ([]*api.Character, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	characters := make([]*api.Character, 0)
+	for key, characterId := range m.activeCharacters {
+		if key.chatId != chatId {
+			continue
+		}
+
+		character, err := m.getCharacter(chatId, characterId)
+		if err != nil {
+			return nil, err
+		}
+
+		characters = append(characters, cloneCharacter(character))
+	}
+
+	return characters, nil
+}
+
+func (m *MapStorage) UpdateChatCharacters(chatId int64, update func(character *api.Character) error) error {
+	m.lock()
+	defer m.unlock()
+	updated := make(map[characterKey]*api.Character)
+	for key, character := range m.characters {
+		if key.chatId != chatId {
+			continue
+		}
+
+		clone := cloneCharacter(character)
+		err := update(clone)
+		if err != nil {
+			return err
+		}
+
+		clone.Id = key.characterId
+		updated[key] = clone
+	}
+
+	for key, character := range updated {
+		put(m, tableCharacters, m.characters, key, character)
+	}
+
+	return nil
+}
@@ -0,0 +1,25 @@
+package mapStorage
+
+import (
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+func (m *MapStorage) GetChatSettings(chatId int64) (*api.ChatSettings, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	settings, ok := m.chatSettings[chatId]
+	if !ok {
+		return new(api.ChatSettings), nil
+	}
+
+	clone := *settings
+	return &clone, nil
+}
+
+func (m *MapStorage) SaveChatSettings(chatId int64, settings *api.ChatSettings) error {
+	m.lock()
+	defer m.unlock()
+	clone := *settings
+	put(m, tableChatSettings, m.chatSettings, chatId, &clone)
+	return nil
+}
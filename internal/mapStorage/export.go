@@ -0,0 +1,228 @@
+package mapStorage
+
+import (
+	"cmp"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"slices"
+)
+
+func (m *MapStorage) ExportChat(chatId int64) (*api.ChatData, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	data := &api.ChatData{
+		Settings:         new(api.ChatSettings),
+		Wallets:          make([]*api.Wallet, 0),
+		Characters:       make([]*api.Character, 0),
+		ActiveCharacters: make([]*api.ActiveCharacter, 0),
+		Inventories:      make([]*api.OwnedInventory, 0),
+		ShopItems:        make([]*api.ShopItem, 0),
+		Quests:           make([]*api.Quest, 0),
+		MoneyTransfers:   make([]*api.MoneyTransfer, 0),
+		ItemTransfers:    make([]*api.ItemTransfer, 0),
+	}
+
+	if settings, ok := m.chatSettings[chatId]; ok {
+		*data.Settings = *settings
+	}
+
+	for userId, balance := range m.balances[chatId] {
+		if userId == api.TreasuryAccountId {
+			data.Treasury = balance
+			continue
+		}
+
+		data.Wallets = append(data.Wallets, &api.Wallet{UserId: userId, Balance: balance})
+	}
+
+	for key, character := range m.characters {
+		if key.chatId == chatId {
+			data.Characters = append(data.Characters, cloneCharacter(character))
+		}
+	}
+
+	for key, characterId := range m.activeCharacters {
+		if key.chatId == chatId {
+			data.ActiveCharacters = append(data.ActiveCharacters, &api.ActiveCharacter{UserId: key.userId, CharacterId: characterId})
+		}
+	}
+
+	for key, inventory := range m.inventories {
+		if key.chatId == chatId {
+			data.Inventories = append(data.Inventories, &api.OwnedInventory{OwnerId: key.userId, Inventory: *cloneInventory(inventory)})
+		}
+	}
+
+	for key, item := range m.shopItems {
+		if key.chatId == chatId {
+			clone := *item
+			data.ShopItems = append(data.ShopItems, &clone)
+		}
+	}
+
+	for key, quest := range m.quests {
+		if key.chatId == chatId {
+			data.Quests = append(data.Quests, cloneQuest(quest))
+		}
+	}
+
+	for _, transfer := range m.moneyTransfers[chatId] {
+		clone := *transfer
+		data.MoneyTransfers = append(data.MoneyTransfers, &clone)
+	}
+
+	for _, transfer := range m.itemTransfers[chatId] {
+		clone := *transfer
+		data.ItemTransfers = append(data.ItemTransfers, &clone)
+	}
+
+	slices.SortFunc(data.Wallets, func(a, b *api.Wallet) int { return cmp.Compare(a.UserId, b.UserId) })
+	slices.SortFunc(data.Characters, func(a, b *api.Character) int { return cmp.Compare(a.Id, b.Id) })
+	slices.SortFunc(data.ActiveCharacters, func(a, b *api.ActiveCharacter) int { return cmp.Compare(a.UserId, b.UserId) })
+	slices.SortFunc(data.Inventories, func(a, b *api.OwnedInventory) int { return cmp.Compare(a.OwnerId, b.OwnerId) })
+	slices.SortFunc(data.ShopItems, func(a, b *api.ShopItem) int { return cmp.Compare(api.ItemKey(a.Name), api.ItemKey(b.Name)) })
+	slices.SortFunc(data.Quests, func(a, b *api.Quest) int { return cmp.Compare(a.Id, b.Id) })
+	return data, nil
+}
+
+// deleteChat removes everything stored for the chat, the user name mappings are global and stay
+func (m *MapStorage) deleteChat(chatId int64) {
+	m.journal(walOpDelete, tableChats, chatId, nil)
+	removeFunc(m, m.conversations, func(key balanceBucketKey) bool { return key.chatId == chatId })
+	removeFunc(m, m.characters, func(key characterKey) bool { return key.chatId == chatId })
+	removeFunc(m, m.activeCharacters, func(key balanceBucketKey) bool { return key.chatId == chatId })
+	removeFunc(m, m.inventories, func(key balanceBucketKey) bool { return key.chatId == chatId })
+	removeFunc(m, m.shopItems, func(key shopItemKey) bool { return key.chatId == chatId })
+	removeFunc(m, m.quests, func(key questKey) bool { return key.chatId == chatId })
+	removeFunc(m, m.pendingTransfers, func(key pendingTransferKey) bool { return key.chatId == chatId })
+	saveUndo(m, m.balances, chatId)
+	delete(m.balances, chatId)
+	saveUndo(m, m.itemTransfers, chatId)
+	delete(m.itemTransfers, chatId)
+	saveUndo(m, m.moneyTransfers, chatId)
+	delete(m.moneyTransfers, chatId)
+	saveUndo(m, m.chatSettings, chatId)
+	delete(m.chatSettings, chatId)
+}
+
+// removeFunc deletes the entries of the chat without journaling each of them, deleteChat journals the chat at once
+func removeFunc[K comparable, V any](m *MapStorage, entries map[K]V, del func(key K) bool) {
+	for key := range entries {
+		if del(key) {
+			saveUndo(m, entries, key)
+			delete(entries, key)
+		}
+	}
+}
+
+func (m *MapStorage) ImportChat(chatId int64, data *api.ChatData) error {
+	m.lock()
+	defer m.unlock()
+	m.deleteChat(chatId)
+	settings := *data.Settings
+	put(m, tableChatSettings, m.chatSettings, chatId, &settings)
+	m.putBalance(balanceBucketKey{chatId, api.TreasuryAccountId}, data.Treasury)
+	for _, wallet := range data.Wallets {
+		m.putBalance(balanceBucketKey{chatId, wallet.UserId}, wallet.Balance)
+	}
+
+	for _, character := range data.Characters {
+		put(m, tableCharacters, m.characters, characterKey{chatId, character.Id}, cloneCharacter(character))
+		m.setSequenceAtLeast(sequenceCharacters, character.Id)
+	}
+
+	for _, active := range data.ActiveCharacters {
+		put(m, tableActiveCharacters, m.activeCharacters, balanceBucketKey{chatId, active.UserId}, active.CharacterId)
+	}
+
+	for _, inventory := range data.Inventories {
+		m.putInventory(chatId, inventory.OwnerId, cloneInventory(&inventory.Inventory))
+	}
+
+	for _, item := range data.ShopItems {
+		clone := *item
+		put(m, tableShopItems, m.shopItems, shopItemKey{chatId, api.ItemKey(item.Name)}, &clone)
+	}
+
+	for _, quest := range data.Quests {
+		put(m, tableQuests, m.quests, questKey{chatId, quest.Id}, cloneQuest(quest))
+		m.setSequenceAtLeast(sequenceQuests, quest.Id)
+	}
+
+	moneyTransfers := make([]*api.MoneyTransfer, 0, len(data.MoneyTransfers))
+	for _, transfer := range data.MoneyTransfers {
+		clone := *transfer
+		moneyTransfers = append(moneyTransfers, &clone)
+		m.setSequenceAtLeast(sequenceMoneyTransfers, transfer.Id)
+	}
+
+	itemTransfers := make([]*api.ItemTransfer, 0, len(data.ItemTransfers))
+	for _, transfer := range data.ItemTransfers {
+		clone := *transfer
+		itemTransfers = append(itemTransfers, &clone)
+		m.setSequenceAtLeast(sequenceItemTransfers, transfer.Id)
+	}
+
+	// the ledgers are read newest last
+	slices.SortFunc(moneyTransfers, func(a, b *api.MoneyTransfer) int { return cmp.Compare(a.Id, b.Id) })
+	slices.SortFunc(itemTransfers, func(a, b *api.ItemTransfer) int { return cmp.Compare(a.Id, b.Id) })
+	put(m, tableMoneyTransfers, m.moneyTransfers, chatId, moneyTransfers)
+	put(m, tableItemTransfers, m.itemTransfers, chatId, itemTransfers)
+	return nil
+}
+
+func (m *MapStorage) ChatIds() ([]int64, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	seen := make(map[int64]bool)
+	for chatId := range m.balances {
+		seen[chatId] = true
+	}
+
+	for key := range m.conversations {
+		seen[key.chatId] = true
+	}
+
+	for key := range m.characters {
+		seen[key.chatId] = true
+	}
+
+	for key := range m.activeCharacters {
+		seen[key.chatId] = true
+	}
+
+	for key := range m.inventories {
+		seen[key.chatId] = true
+	}
+
+	for key := range m.shopItems {
+		seen[key.chatId] = true
+	}
+
+	for key := range m.quests {
+		seen[key.chatId] = true
+	}
+
+	for key := range m.pendingTransfers {
+		seen[key.chatId] = true
+	}
+
+	for chatId := range m.itemTransfers {
+		seen[chatId] = true
+	}
+
+	for chatId := range m.moneyTransfers {
+		seen[chatId] = true
+	}
+
+	for chatId := range m.chatSettings {
+		seen[chatId] = true
+	}
+
+	chatIds := make([]int64, 0, len(seen))
+	for chatId := range seen {
+		chatIds = append(chatIds, chatId)
+	}
+
+	slices.Sort(chatIds)
+	return chatIds, nil
+}
@@ -0,0 +1,144 @@
+package mapStorage
+
+import (
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"time"
+)
+
+func cloneInventory(inventory *api.Inventory) *api.Inventory {
+	clone := api.NewInventory()
+	for _, item := range inventory.Items {
+		clone.Items = append(clone.Items, &api.InventoryItem{Name: item.Name, Quantity: item.Quantity})
+	}
+
+	return clone
+}
+
+func (m *MapStorage) getInventory(chatId int64, ownerId int64) *api.Inventory {
+	inventory, ok := m.inventories[balanceBucketKey{chatId, ownerId}]
+	if !ok {
+		return api.NewInventory()
+	}
+
+	return cloneInventory(inventory)
+}
+
+func (m *MapStorage) putInventory(chatId int64, ownerId int64, inventory *api.Inventory) {
+	if len(inventory.Items) == 0 {
+		remove(m, tableInventories, m.inventories, balanceBucketKey{chatId, ownerId})
+		return
+	}
+
+	put(m, tableInventories, m.inventories, balanceBucketKey{chatId, ownerId}, inventory)
+}
+
+func (m *MapStorage) checkInventoryOwner(chatId int64, ownerId int64) error {
+	if ownerId == api.StashOwnerId {
+		return nil
+	}
+
+	_, ok := m.balance(chatId, ownerId)
+	if !ok {
+		return fmt.Errorf("inventory owner %d %w", ownerId, api.ErrorNotRegistered)
+	}
+
+	return nil
+}
+
+func (m *MapStorage) addItemTransfer(chatId int64, transfer *api.ItemTransfer) {
+	transfer.Id = m.nextSequence(sequenceItemTransfers)
+	transfer.Time = time.Now()
+	appendTo(m, tableItemTransfers, m.itemTransfers, chatId, transfer.Id, transfer)
+}
+
+func (m *MapStorage) moveItem(chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error {
+	if fromId == toId {
+		return api.ErrorInvalidTransactionParameters
+	}
+
+	for _, ownerId := range []int64{fromId, toId} {
+		err := m.checkInventoryOwner(chatId, ownerId)
+		if err != nil {
+			return err
+		}
+	}
+
+	from := m.getInventory(chatId, fromId)
+	to := m.getInventory(chatId, toId)
+	item = from.ItemName(item)
+	err := from.Remove(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	err = to.Add(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	m.putInventory(chatId, fromId, from)
+	m.putInventory(chatId, toId, to)
+	m.addItemTransfer(chatId, &api.ItemTransfer{
+		Kind:     api.ItemTransferKindMove,
+		FromId:   fromId,
+		ToId:     toId,
+		ActorId:  actorId,
+		Item:     item,
+		Quantity: quantity,
+	})
+
+	return nil
+}
+
+func (m *MapStorage) GetInventory(chatId int64, ownerId int64) (*api.Inventory, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	return m.getInventory(chatId, ownerId), nil
+}
+
+func (m *MapStorage) MoveItem(chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error {
+	m.lock()
+	defer m.unlock()
+	return m.moveItem(chatId, fromId, toId, item, quantity, actorId)
+}
+
+func (m *MapStorage) SetItemQuantity(chatId int64, ownerId int64, item string, quantity int, actorId int64) error {
+	m.lock()
+	defer m.unlock()
+	err := m.checkInventoryOwner(chatId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	inventory := m.getInventory(chatId, ownerId)
+	err = inventory.Set(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	m.putInventory(chatId, ownerId, inventory)
+	m.addItemTransfer(chatId, &api.ItemTransfer{
+		Kind:     api.ItemTransferKindSet,
+		FromId:   ownerId,
+		ToId:     ownerId,
+		ActorId:  actorId,
+		Item:     item,
+		Quantity: quantity,
+	})
+
+	return nil
+}
+
+func (m *MapStorage) GetItemTransfers(chatId int64, limit int) ([]*api.ItemTransfer, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	chatTransfers := m.itemTransfers[chatId]
+	transfers := make([]*api.ItemTransfer, 0, limit)
+	for i := len(chatTransfers) - 1; i >= 0 && len(transfers) < limit; i-- {
+		clone := *chatTransfers[i]
+		transfers = append(transfers, &clone)
+	}
+
+	return transfers, nil
+}
@@ -0,0 +1,58 @@
+package mapStorage
+
+import (
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"time"
+)
+
+type pendingTransferKey struct {
+	chatId     int64
+	transferId int64
+}
+
+func (m *MapStorage) CreatePendingTransfer(chatId int64, transfer *api.PendingTransfer) (int64, error) {
+	m.lock()
+	defer m.unlock()
+	transfer.Id = m.nextSequence(sequencePendingTransfers)
+	clone := *transfer
+	put(m, tablePendingTransfers, m.pendingTransfers, pendingTransferKey{chatId, transfer.Id}, &clone)
+	return transfer.Id, nil
+}
+
+func (m *MapStorage) GetPendingTransfer(chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	transfer, ok := m.pendingTransfers[pendingTransferKey{chatId, transferId}]
+	if !ok {
+		return nil, fmt.Errorf("pending transfer %d %w", transferId, api.ErrorNotFound)
+	}
+
+	clone := *transfer
+	return &clone, nil
+}
+
+func (m *MapStorage) TakePendingTransfer(chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	m.lock()
+	defer m.unlock()
+	key := pendingTransferKey{chatId, transferId}
+	transfer, ok := m.pendingTransfers[key]
+	if !ok {
+		return nil, fmt.Errorf("pending transfer %d %w", transferId, api.ErrorNotFound)
+	}
+
+	remove(m, tablePendingTransfers, m.pendingTransfers, key)
+	return transfer, nil
+}
+
+func (m *MapStorage) DeleteExpiredPendingTransfers(chatId int64, now time.Time) error {
+	m.lock()
+	defer m.unlock()
+	for key, transfer := range m.pendingTransfers {
+		if key.chatId == chatId && now.After(transfer.ExpiresAt) {
+			remove(m, tablePendingTransfers, m.pendingTransfers, key)
+		}
+	}
+
+	return nil
+}
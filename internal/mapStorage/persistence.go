@@ -0,0 +1,274 @@
+package mapStorage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/op/go-logging"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	errNotPersistent = errors.New("the storage isn't persistent")
+)
+
+// NewPersistentMapStorage loads the snapshot at path and replays the write-ahead log at path.wal,
+// every change is appended to the log until the next Snapshot. close saves the final snapshot
+func NewPersistentMapStorage(provider api.LoggerProvider, path string) (storage *MapStorage, close func()) {
+	logger := provider.MustGetLogger("mapStorage")
+	logger.Debugf("Snapshot path is %s", path)
+	m, err := load(path, logger)
+	if err != nil {
+		logger.Fatalf("error while loading the snapshot %s", err)
+	}
+
+	m.wal, err = openWriteAheadLog(path, logger)
+	if err != nil {
+		logger.Fatalf("error while opening the write-ahead log %s", err)
+	}
+
+	m.journaling = true
+	// the replayed log is saved right away so a torn last line isn't followed by the new records
+	err = m.Snapshot()
+	if err != nil {
+		logger.Fatalf("error while saving the snapshot %s", err)
+	}
+
+	return m, func() {
+		err := m.Snapshot()
+		if err != nil {
+			logger.Errorf("error while saving the snapshot %s", err)
+		}
+
+		err = m.wal.close()
+		if err != nil {
+			logger.Fatalf("error while closing the write-ahead log %s", err)
+		}
+	}
+}
+
+// load reads the snapshot and replays the log written after it
+func load(path string, logger *logging.Logger) (*MapStorage, error) {
+	m := NewMapStorage()
+	records, err := m.replay(path)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("%d records are loaded from %s", records, path)
+	records, err = m.replay(walPath(path))
+	if errors.Is(err, errTornWrite) {
+		logger.Warningf("the last write-ahead log record is skipped %s", err)
+		err = nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("%d write-ahead log records are replayed", records)
+	return m, nil
+}
+
+// Snapshot saves the whole persistent storage and truncates the log, the writes wait meanwhile
+func (m *MapStorage) Snapshot() error {
+	m.lock()
+	defer m.unlock()
+	if m.wal == nil {
+		return errNotPersistent
+	}
+
+	err := writeFileAtomically(m.wal.snapshotPath, func(w io.Writer) error {
+		_, err := m.backup(w)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return m.wal.truncate()
+}
+
+// Backup writes the puts recreating the storage, the snapshot can be restored or loaded by the persistent storage
+func (m *MapStorage) Backup(w io.Writer) (int64, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	return m.backup(w)
+}
+
+// BackupToFile writes the snapshot next to the path first so a half written file never shows up as a backup
+func (m *MapStorage) BackupToFile(path string) error {
+	return writeFileAtomically(path, func(w io.Writer) error {
+		_, err := m.Backup(w)
+		return err
+	})
+}
+
+// backup writes the records of every table, one line per table
+func (m *MapStorage) backup(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: bufio.NewWriter(w)}
+	for _, batch := range m.snapshot() {
+		data, err := json.Marshal(batch)
+		if err != nil {
+			return counter.written, err
+		}
+
+		_, err = counter.Write(append(data, '\n'))
+		if err != nil {
+			return counter.written, err
+		}
+	}
+
+	return counter.written, counter.w.Flush()
+}
+
+// snapshot returns the records of every table, the caller holds the lock
+func (m *MapStorage) snapshot() [][]*walRecord {
+	return [][]*walRecord{
+		snapshotTable(tableBalances, flattenBalances(m.balances)),
+		snapshotTable(tableUserNames, m.userNameToUserId),
+		snapshotTable(tableUserIds, m.userIdToUserName),
+		snapshotTable(tableConversations, m.conversations),
+		snapshotTable(tableCharacters, m.characters),
+		snapshotTable(tableActiveCharacters, m.activeCharacters),
+		snapshotTable(tableInventories, m.inventories),
+		snapshotTable(tableItemTransfers, m.itemTransfers),
+		snapshotTable(tableShopItems, m.shopItems),
+		snapshotTable(tableQuests, m.quests),
+		snapshotTable(tableMoneyTransfers, m.moneyTransfers),
+		snapshotTable(tableChatSettings, m.chatSettings),
+		snapshotTable(tablePendingTransfers, m.pendingTransfers),
+		snapshotTable(tableSequences, m.sequences()),
+	}
+}
+
+// flattenBalances returns the wallets by the key of the wallet table records
+func flattenBalances(balances map[int64]map[int64]int64) map[balanceBucketKey]int64 {
+	flat := make(map[balanceBucketKey]int64)
+	for chatId, wallets := range balances {
+		for userId, balance := range wallets {
+			flat[balanceBucketKey{chatId, userId}] = balance
+		}
+	}
+
+	return flat
+}
+
+func snapshotTable[K comparable, V any](table string, entries map[K]V) []*walRecord {
+	records := make([]*walRecord, 0, len(entries))
+	for key, value := range entries {
+		record, err := newWalRecord(walOpPut, table, key, value)
+		if err != nil {
+			panic(fmt.Sprintf("can't snapshot %s: %s", table, err))
+		}
+
+		records = append(records, record)
+	}
+
+	return records
+}
+
+// BackupDbFile writes a snapshot of the storage saved at dbName, the bot has to be stopped
+func BackupDbFile(provider api.LoggerProvider, dbName string, path string) error {
+	m, err := load(dbName, provider.MustGetLogger("mapStorage"))
+	if err != nil {
+		return err
+	}
+
+	return m.BackupToFile(path)
+}
+
+// Restore replaces the snapshot with the backup, the previous snapshot is kept with the .before-restore suffix.
+// The bot has to be stopped, it leaves the empty write-ahead log after the final snapshot
+func Restore(provider api.LoggerProvider, dbName string, backupPath string) error {
+	logger := provider.MustGetLogger("mapStorage")
+	_, err := os.Stat(backupPath)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	_, err = load(backupPath, logger)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	info, err := os.Stat(walPath(dbName))
+	if err == nil && info.Size() > 0 {
+		return fmt.Errorf("%s isn't empty, the bot is running or wasn't stopped cleanly", walPath(dbName))
+	}
+
+	_, err = os.Stat(dbName)
+	if err == nil {
+		err = copyFile(dbName, dbName+".before-restore")
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	err = copyFile(backupPath, dbName)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("snapshot %s is restored from %s", dbName, backupPath)
+	return nil
+}
+
+type countingWriter struct {
+	w       *bufio.Writer
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+func copyFile(from string, to string) error {
+	return writeFileAtomically(to, func(w io.Writer) error {
+		f, err := os.Open(from)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+}
+
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Chmod(tmp.Name(), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
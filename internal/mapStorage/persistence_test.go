@@ -0,0 +1,73 @@
+package mapStorage
+
+import (
+	"github.com/Refreezer/dnd-util-bot/api"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const (
+	chatId int64 = -100
+	alice  int64 = 10
+	bob    int64 = 11
+)
+
+// TestSnapshotBeforeWalTruncate reloads the storage crashed after the snapshot is saved but before the log is truncated
+func TestSnapshotBeforeWalTruncate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	storage, closeStorage := NewPersistentMapStorage(loggerProvider{}, path)
+	for _, userId := range []int64{alice, bob} {
+		err := storage.SetUserBalance(chatId, userId, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := storage.TransferMoney(chatId, &api.MoneyTransfer{
+		Kind:    api.MoneyTransferKindTransaction,
+		FromId:  alice,
+		ToId:    bob,
+		ActorId: alice,
+		Amount:  3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wal, err := os.ReadFile(walPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = storage.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeStorage()
+	err = os.WriteFile(walPath(path), wal, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage, closeStorage = NewPersistentMapStorage(loggerProvider{}, path)
+	defer closeStorage()
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(transfers) != 1 {
+		t.Fatalf("expected 1 ledger record, got %d", len(transfers))
+	}
+
+	balance, err := storage.GetUserBalance(chatId, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if balance != 13 {
+		t.Fatalf("expected balance 13, got %d", balance)
+	}
+}
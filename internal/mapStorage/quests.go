@@ -0,0 +1,101 @@
+package mapStorage
+
+import (
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"slices"
+)
+
+type questKey struct {
+	chatId  int64
+	questId int64
+}
+
+func cloneQuest(quest *api.Quest) *api.Quest {
+	clone := *quest
+	clone.TakenBy = slices.Clone(quest.TakenBy)
+	clone.Participants = slices.Clone(quest.Participants)
+	return &clone
+}
+
+func (m *MapStorage) getQuest(chatId int64, questId int64) (*api.Quest, error) {
+	quest, ok := m.quests[questKey{chatId, questId}]
+	if !ok {
+		return nil, fmt.Errorf("quest %d %w", questId, api.ErrorNotFound)
+	}
+
+	return cloneQuest(quest), nil
+}
+
+func (m *MapStorage) CreateQuest(chatId int64, quest *api.Quest) (int64, error) {
+	m.lock()
+	defer m.unlock()
+	quest.Id = m.nextSequence(sequenceQuests)
+	put(m, tableQuests, m.quests, questKey{chatId, quest.Id}, cloneQuest(quest))
+	return quest.Id, nil
+}
+
+func (m *MapStorage) GetQuests(chatId int64) ([]*api.Quest, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	quests := make([]*api.Quest, 0)
+	for key, quest := range m.quests {
+		if key.chatId == chatId {
+			quests = append(quests, cloneQuest(quest))
+		}
+	}
+
+	return quests, nil
+}
+
+func (m *MapStorage) UpdateQuest(chatId int64, questId int64, update func(quest *api.Quest) error) error {
+	m.lock()
+	defer m.unlock()
+	quest, err := m.getQuest(chatId, questId)
+	if err != nil {
+		return err
+	}
+
+	err = update(quest)
+	if err != nil {
+		return err
+	}
+
+	quest.Id = questId
+	put(m, tableQuests, m.quests, questKey{chatId, questId}, cloneQuest(quest))
+	return nil
+}
+
+func (m *MapStorage) CompleteQuest(chatId int64, questId int64, complete func(quest *api.Quest) ([]*api.Credit, error)) error {
+	m.lock()
+	defer m.unlock()
+	quest, err := m.getQuest(chatId, questId)
+	if err != nil {
+		return err
+	}
+
+	credits, err := complete(quest)
+	if err != nil {
+		return err
+	}
+
+	transfers := make([]*api.MoneyTransfer, 0, len(credits))
+	for _, credit := range credits {
+		transfers = append(transfers, &api.MoneyTransfer{
+			Kind:    api.MoneyTransferKindQuest,
+			FromId:  api.TreasuryAccountId,
+			ToId:    credit.UserId,
+			ActorId: quest.CreatedBy,
+			Amount:  credit.Amount,
+		})
+	}
+
+	err = m.transferMoney(chatId, transfers...)
+	if err != nil {
+		return err
+	}
+
+	quest.Id = questId
+	put(m, tableQuests, m.quests, questKey{chatId, questId}, cloneQuest(quest))
+	return nil
+}
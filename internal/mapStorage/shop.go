@@ -0,0 +1,104 @@
+package mapStorage
+
+import (
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+type shopItemKey struct {
+	chatId int64
+	item   string
+}
+
+func (m *MapStorage) SaveShopItem(chatId int64, item *api.ShopItem) error {
+	m.lock()
+	defer m.unlock()
+	clone := *item
+	put(m, tableShopItems, m.shopItems, shopItemKey{chatId, api.ItemKey(item.Name)}, &clone)
+	return nil
+}
+
+func (m *MapStorage) DeleteShopItem(chatId int64, item string) error {
+	m.lock()
+	defer m.unlock()
+	key := shopItemKey{chatId, api.ItemKey(item)}
+	if _, ok := m.shopItems[key]; !ok {
+		return fmt.Errorf("shop item %s %w", item, api.ErrorNotFound)
+	}
+
+	remove(m, tableShopItems, m.shopItems, key)
+	return nil
+}
+
+func (m *MapStorage) GetShopItems(chatId int64) ([]*api.ShopItem, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	items := make([]*api.ShopItem, 0)
+	for key, item := range m.shopItems {
+		if key.chatId == chatId {
+			clone := *item
+			items = append(items, &clone)
+		}
+	}
+
+	return items, nil
+}
+
+func (m *MapStorage) BuyItem(chatId int64, userId int64, item string, quantity int) (*api.ShopItem, error) {
+	m.lock()
+	defer m.unlock()
+	key := shopItemKey{chatId, api.ItemKey(item)}
+	stored, ok := m.shopItems[key]
+	if !ok {
+		return nil, fmt.Errorf("shop item %s %w", item, api.ErrorNotFound)
+	}
+
+	shopItem := *stored
+	err := shopItem.TakeFromStock(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := shopItem.TotalPrice(quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := m.getBalance(chatId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err = api.DebitBalance(balance, total, m.creditLimit(chatId, userId))
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := m.getInventory(chatId, userId)
+	err = inventory.Add(shopItem.Name, quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	m.putBalance(balanceBucketKey{chatId, userId}, balance)
+	m.addMoneyTransfer(chatId, &api.MoneyTransfer{
+		Kind:    api.MoneyTransferKindBuy,
+		FromId:  userId,
+		ToId:    api.ExternalAccountId,
+		ActorId: userId,
+		Amount:  total,
+	})
+	put(m, tableShopItems, m.shopItems, key, &shopItem)
+	m.putInventory(chatId, userId, inventory)
+	m.addItemTransfer(chatId, &api.ItemTransfer{
+		Kind:     api.ItemTransferKindBuy,
+		FromId:   userId,
+		ToId:     userId,
+		ActorId:  userId,
+		Item:     shopItem.Name,
+		Quantity: quantity,
+	})
+
+	clone := shopItem
+	return &clone, nil
+}
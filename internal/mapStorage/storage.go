@@ -1,8 +1,10 @@
 package mapStorage
 
 import (
+	"context"
 	"fmt"
 	"github.com/Refreezer/dnd-util-bot/api"
+	"maps"
 	"sync"
 )
 
@@ -12,63 +14,230 @@ type balanceBucketKey struct {
 }
 
 type MapStorage struct {
-	rwMutex               *sync.RWMutex
-	userNameToUserId      map[string]int64
-	chatIdUserIdToBalance map[balanceBucketKey]uint
+	rwMutex          *sync.RWMutex
+	userNameToUserId map[string]int64
+	userIdToUserName map[int64]string
+	// balances are the wallets by chat id and user id so the wallets of the chat are read without the full scan
+	balances                map[int64]map[int64]int64
+	conversations           map[balanceBucketKey]api.Conversation
+	characters              map[characterKey]*api.Character
+	activeCharacters        map[balanceBucketKey]int64
+	characterSequence       int64
+	inventories             map[balanceBucketKey]*api.Inventory
+	itemTransfers           map[int64][]*api.ItemTransfer
+	itemTransferSequence    int64
+	shopItems               map[shopItemKey]*api.ShopItem
+	quests                  map[questKey]*api.Quest
+	questSequence           int64
+	moneyTransfers          map[int64][]*api.MoneyTransfer
+	moneyTransferSequence   int64
+	chatSettings            map[int64]*api.ChatSettings
+	pendingTransfers        map[pendingTransferKey]*api.PendingTransfer
+	pendingTransferSequence int64
+	// journaling records the writes to changes, it's set for the persistent storage and its transactions
+	journaling bool
+	// changes are the writes made under the lock, unlock appends them to the wal
+	changes []*walRecord
+	// transaction records the undo of every write so WithTx rolls the writes back if fn fails
+	transaction bool
+	undo        []func()
+	wal         *writeAheadLog
 }
 
 func (m *MapStorage) IsRegistered(chatId int64, userId int64) (bool, error) {
 	m.rwMutex.RLock()
 	defer m.rwMutex.RUnlock()
-	_, ok := m.chatIdUserIdToBalance[balanceBucketKey{chatId, userId}]
+	_, ok := m.balance(chatId, userId)
 	return ok, nil
 }
 
 func NewMapStorage() *MapStorage {
 	return &MapStorage{
-		rwMutex:               new(sync.RWMutex),
-		userNameToUserId:      make(map[string]int64),
-		chatIdUserIdToBalance: make(map[balanceBucketKey]uint),
+		rwMutex:          new(sync.RWMutex),
+		userNameToUserId: make(map[string]int64),
+		userIdToUserName: make(map[int64]string),
+		balances:         make(map[int64]map[int64]int64),
+		conversations:    make(map[balanceBucketKey]api.Conversation),
+		characters:       make(map[characterKey]*api.Character),
+		activeCharacters: make(map[balanceBucketKey]int64),
+		inventories:      make(map[balanceBucketKey]*api.Inventory),
+		itemTransfers:    make(map[int64][]*api.ItemTransfer),
+		shopItems:        make(map[shopItemKey]*api.ShopItem),
+		quests:           make(map[questKey]*api.Quest),
+		moneyTransfers:   make(map[int64][]*api.MoneyTransfer),
+		chatSettings:     make(map[int64]*api.ChatSettings),
+		pendingTransfers: make(map[pendingTransferKey]*api.PendingTransfer),
 	}
 }
 
-func (m *MapStorage) MoveMoneyFromUserToUser(chatId int64, fromId int64, toId int64, amount uint) error {
+// Ping never fails, the storage is always in memory
+func (m *MapStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+// WithTx runs fn on the transaction sharing the maps with the storage holding the write lock,
+// the writes of fn are undone if it fails. The stored values are never changed in place so the undo restores the pointers
+func (m *MapStorage) WithTx(ctx context.Context, fn func(tx api.StorageTx) error) error {
+	m.lock()
+	defer m.unlock()
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	tx := m.begin()
+	committed := false
+	defer func() {
+		if !committed {
+			tx.rollback()
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	m.commit(tx)
+	committed = true
+	return nil
+}
+
+// begin returns the transaction writing to the maps of the storage, it has its own lock
+// since the lock of the storage is held until the end of WithTx
+func (m *MapStorage) begin() *MapStorage {
+	tx := *m
+	tx.rwMutex = new(sync.RWMutex)
+	tx.changes = nil
+	tx.wal = nil
+	tx.transaction = true
+	return &tx
+}
+
+// commit copies the sequences of the transaction to the storage, the maps are already written
+func (m *MapStorage) commit(tx *MapStorage) {
+	m.characterSequence = tx.characterSequence
+	m.itemTransferSequence = tx.itemTransferSequence
+	m.questSequence = tx.questSequence
+	m.moneyTransferSequence = tx.moneyTransferSequence
+	m.pendingTransferSequence = tx.pendingTransferSequence
+	m.changes = append(m.changes, tx.changes...)
+}
+
+// rollback undoes the writes of the transaction, the last one first
+func (m *MapStorage) rollback() {
+	for i := len(m.undo) - 1; i >= 0; i-- {
+		m.undo[i]()
+	}
+
+	m.undo = nil
+}
+
+func (m *MapStorage) lock() {
 	m.rwMutex.Lock()
-	defer m.rwMutex.Unlock()
-	fromKey := balanceBucketKey{chatId, fromId}
-	fromBalance, ok := m.chatIdUserIdToBalance[fromKey]
+}
+
+// unlock appends the writes made under the lock to the wal as a single record so they are replayed all or nothing.
+// The transaction has no wal and keeps its changes until the commit
+func (m *MapStorage) unlock() {
+	if m.wal != nil && len(m.changes) > 0 {
+		m.wal.append(m.changes)
+		m.changes = nil
+	}
+
+	m.rwMutex.Unlock()
+}
+
+// balance returns the wallet of the user in the chat
+func (m *MapStorage) balance(chatId int64, userId int64) (int64, bool) {
+	balance, ok := m.balances[chatId][userId]
+	return balance, ok
+}
+
+func (m *MapStorage) putBalance(key balanceBucketKey, balance int64) {
+	wallets, ok := m.balances[key.chatId]
 	if !ok {
-		return api.ErrorNotRegistered
+		saveUndo(m, m.balances, key.chatId)
+		wallets = make(map[int64]int64)
+		m.balances[key.chatId] = wallets
 	}
 
-	if fromBalance < amount {
-		return api.ErrorInsufficientMoney
+	saveUndo(m, wallets, key.userId)
+	wallets[key.userId] = balance
+	m.journal(walOpPut, tableBalances, key, balance)
+}
+
+func (m *MapStorage) putBalances(balances map[balanceBucketKey]int64) {
+	for key, balance := range balances {
+		m.putBalance(key, balance)
 	}
+}
 
-	toKey := balanceBucketKey{chatId, toId}
-	toBalance, ok := m.chatIdUserIdToBalance[toKey]
-	if !ok {
-		return api.ErrorNotRegistered
+// creditUsers validates all the credits first so the wallets are changed all or nothing,
+// the coins come from api.ExternalAccountId
+func (m *MapStorage) creditUsers(chatId int64, kind string, actorId int64, credits []*api.Credit) error {
+	balances := make(map[balanceBucketKey]int64, len(credits))
+	for _, credit := range credits {
+		key := balanceBucketKey{chatId, credit.UserId}
+		balance, ok := balances[key]
+		if !ok {
+			var err error
+			balance, err = m.getBalance(chatId, credit.UserId)
+			if err != nil {
+				return err
+			}
+		}
+
+		balance, err := api.CreditBalance(balance, credit.Amount)
+		if err != nil {
+			return err
+		}
+
+		balances[key] = balance
+	}
+
+	m.putBalances(balances)
+	for _, credit := range credits {
+		m.addMoneyTransfer(chatId, &api.MoneyTransfer{
+			Kind:    kind,
+			FromId:  api.ExternalAccountId,
+			ToId:    credit.UserId,
+			ActorId: actorId,
+			Amount:  credit.Amount,
+		})
 	}
 
-	m.chatIdUserIdToBalance[fromKey] = fromBalance - amount
-	m.chatIdUserIdToBalance[toKey] = amount + toBalance
 	return nil
 }
 
-func (m *MapStorage) SetUserBalance(chatId int64, userId int64, amount uint) error {
-	m.rwMutex.Lock()
-	defer m.rwMutex.Unlock()
-	m.chatIdUserIdToBalance[balanceBucketKey{chatId, userId}] = amount
+func (m *MapStorage) CreditUsers(chatId int64, kind string, actorId int64, credits []*api.Credit) error {
+	m.lock()
+	defer m.unlock()
+	return m.creditUsers(chatId, kind, actorId, credits)
+}
+
+func (m *MapStorage) SetUserBalance(chatId int64, userId int64, amount int64) error {
+	if amount < -api.MaxBalance || amount > api.MaxBalance {
+		return api.ErrorBalanceOverflow
+	}
+
+	m.lock()
+	defer m.unlock()
+	m.putBalance(balanceBucketKey{chatId, userId}, amount)
 	return nil
 }
 
-func (m *MapStorage) GetUserBalance(chatId int64, userId int64) (uint, error) {
+func (m *MapStorage) GetUserBalance(chatId int64, userId int64) (int64, error) {
 	m.rwMutex.RLock()
 	defer m.rwMutex.RUnlock()
-	balance, ok := m.chatIdUserIdToBalance[balanceBucketKey{chatId, userId}]
+	balance, ok := m.balance(chatId, userId)
 	if !ok {
-		return 0, fmt.Errorf("no wallet for %d", userId)
+		return 0, fmt.Errorf("error while GetUserBalance %w", api.ErrorNotRegistered)
 	}
 
 	return balance, nil
@@ -82,8 +251,68 @@ func (m *MapStorage) GetIdByUserName(userName string) (userId int64, ok bool) {
 }
 
 func (m *MapStorage) SaveUserNameToUserIdMapping(userName string, userId int64) error {
-	m.rwMutex.Lock()
-	defer m.rwMutex.Unlock()
-	m.userNameToUserId[userName] = userId
+	m.lock()
+	defer m.unlock()
+	// the previous name of the renamed user is deleted unless another user has taken it
+	previousName, ok := m.userIdToUserName[userId]
+	if ok && previousName != userName && m.userNameToUserId[previousName] == userId {
+		remove(m, tableUserNames, m.userNameToUserId, previousName)
+	}
+
+	put(m, tableUserNames, m.userNameToUserId, userName, userId)
+	put(m, tableUserIds, m.userIdToUserName, userId, userName)
+	return nil
+}
+
+func (m *MapStorage) GetUserNameById(userId int64) (userName string, ok bool) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	userName, ok = m.userIdToUserName[userId]
+	return userName, ok
+}
+
+func (m *MapStorage) GetChatMembers(chatId int64) ([]*api.Member, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	members := make([]*api.Member, 0)
+	for userId := range m.balances[chatId] {
+		if userId == api.TreasuryAccountId {
+			continue
+		}
+
+		members = append(members, &api.Member{
+			UserId:   userId,
+			UserName: m.userIdToUserName[userId],
+		})
+	}
+
+	return members, nil
+}
+
+func (m *MapStorage) GetConversation(chatId int64, userId int64) (*api.Conversation, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	conv, ok := m.conversations[balanceBucketKey{chatId, userId}]
+	if !ok {
+		return nil, api.ErrorNotFound
+	}
+
+	conv.Data = maps.Clone(conv.Data)
+	return &conv, nil
+}
+
+func (m *MapStorage) SaveConversation(chatId int64, userId int64, conv *api.Conversation) error {
+	m.lock()
+	defer m.unlock()
+	saved := *conv
+	saved.Data = maps.Clone(conv.Data)
+	put(m, tableConversations, m.conversations, balanceBucketKey{chatId, userId}, saved)
+	return nil
+}
+
+func (m *MapStorage) DeleteConversation(chatId int64, userId int64) error {
+	m.lock()
+	defer m.unlock()
+	remove(m, tableConversations, m.conversations, balanceBucketKey{chatId, userId})
 	return nil
 }
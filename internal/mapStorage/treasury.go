@@ -0,0 +1,129 @@
+package mapStorage
+
+import (
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"time"
+)
+
+// getBalance returns the wallet balance, the treasury wallet is created on the first deposit
+func (m *MapStorage) getBalance(chatId int64, accountId int64) (int64, error) {
+	balance, ok := m.balance(chatId, accountId)
+	if ok || accountId == api.TreasuryAccountId {
+		return balance, nil
+	}
+
+	return 0, fmt.Errorf("wallet %d %w", accountId, api.ErrorNotRegistered)
+}
+
+// creditLimit returns how deep in debt the account may go, the treasury never goes in debt
+func (m *MapStorage) creditLimit(chatId int64, accountId int64) int64 {
+	settings, ok := m.chatSettings[chatId]
+	if !ok || accountId == api.TreasuryAccountId {
+		return 0
+	}
+
+	return settings.CreditLimit
+}
+
+func (m *MapStorage) addMoneyTransfer(chatId int64, transfer *api.MoneyTransfer) {
+	transfer.Id = m.nextSequence(sequenceMoneyTransfers)
+	transfer.Time = time.Now()
+	appendTo(m, tableMoneyTransfers, m.moneyTransfers, chatId, transfer.Id, transfer)
+}
+
+// transferMoney validates all the transfers first so the wallets are changed all or nothing
+func (m *MapStorage) transferMoney(chatId int64, transfers ...*api.MoneyTransfer) error {
+	balances := make(map[balanceBucketKey]int64, 2*len(transfers))
+	balance := func(accountId int64) (int64, error) {
+		balance, ok := balances[balanceBucketKey{chatId, accountId}]
+		if ok {
+			return balance, nil
+		}
+
+		return m.getBalance(chatId, accountId)
+	}
+
+	for _, transfer := range transfers {
+		if transfer.FromId == transfer.ToId {
+			return api.ErrorInvalidTransactionParameters
+		}
+
+		fromBalance, err := balance(transfer.FromId)
+		if err != nil {
+			return err
+		}
+
+		toBalance, err := balance(transfer.ToId)
+		if err != nil {
+			return err
+		}
+
+		fromBalance, err = api.DebitBalance(fromBalance, transfer.Amount, m.creditLimit(chatId, transfer.FromId))
+		if err != nil && transfer.FromId == api.TreasuryAccountId {
+			return api.ErrorInsufficientTreasury
+		}
+
+		if err != nil {
+			return err
+		}
+
+		toBalance, err = api.CreditBalance(toBalance, transfer.Amount)
+		if err != nil {
+			return err
+		}
+
+		balances[balanceBucketKey{chatId, transfer.FromId}] = fromBalance
+		balances[balanceBucketKey{chatId, transfer.ToId}] = toBalance
+	}
+
+	m.putBalances(balances)
+	for _, transfer := range transfers {
+		m.addMoneyTransfer(chatId, transfer)
+	}
+
+	return nil
+}
+
+func (m *MapStorage) GetTreasuryBalance(chatId int64) (int64, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	return m.getBalance(chatId, api.TreasuryAccountId)
+}
+
+func (m *MapStorage) TransferMoney(chatId int64, transfer *api.MoneyTransfer) error {
+	m.lock()
+	defer m.unlock()
+	return m.transferMoney(chatId, transfer)
+}
+
+func (m *MapStorage) GetMoneyTransfers(chatId int64, accountId int64, limit int) ([]*api.MoneyTransfer, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	return m.getMoneyTransfers(chatId, limit, func(transfer *api.MoneyTransfer) bool {
+		return transfer.FromId == accountId || transfer.ToId == accountId
+	}), nil
+}
+
+func (m *MapStorage) GetChatMoneyTransfers(chatId int64, limit int) ([]*api.MoneyTransfer, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	return m.getMoneyTransfers(chatId, limit, func(_ *api.MoneyTransfer) bool {
+		return true
+	}), nil
+}
+
+// getMoneyTransfers copies the latest ledger records of the chat matching the filter, newest first
+func (m *MapStorage) getMoneyTransfers(chatId int64, limit int, matches func(transfer *api.MoneyTransfer) bool) []*api.MoneyTransfer {
+	transfers := make([]*api.MoneyTransfer, 0, limit)
+	chatTransfers := m.moneyTransfers[chatId]
+	for i := len(chatTransfers) - 1; i >= 0 && len(transfers) < limit; i-- {
+		transfer := chatTransfers[i]
+		if matches(transfer) {
+			copied := *transfer
+			transfers = append(transfers, &copied)
+		}
+	}
+
+	return transfers
+}
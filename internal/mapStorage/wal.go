@@ -0,0 +1,398 @@
+package mapStorage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/op/go-logging"
+	"io"
+	"os"
+)
+
+const (
+	walOpPut    = "put"
+	walOpDelete = "delete"
+	walOpAppend = "append"
+
+	tableBalances         = "balances"
+	tableUserNames        = "userNames"
+	tableUserIds          = "userIds"
+	tableConversations    = "conversations"
+	tableCharacters       = "characters"
+	tableActiveCharacters = "activeCharacters"
+	tableInventories      = "inventories"
+	tableItemTransfers    = "itemTransfers"
+	tableShopItems        = "shopItems"
+	tableQuests           = "quests"
+	tableMoneyTransfers   = "moneyTransfers"
+	tableChatSettings     = "chatSettings"
+	tablePendingTransfers = "pendingTransfers"
+	tableSequences        = "sequences"
+	// tableChats has the deletions of everything stored for the chat only
+	tableChats = "chats"
+
+	sequenceCharacters       = "characters"
+	sequenceItemTransfers    = "itemTransfers"
+	sequenceQuests           = "quests"
+	sequenceMoneyTransfers   = "moneyTransfers"
+	sequencePendingTransfers = "pendingTransfers"
+)
+
+var (
+	// errTornWrite means the last line of the wal is incomplete, the bot crashed while writing it
+	errTornWrite = errors.New("torn write")
+)
+
+type (
+	// ledgerKey is the key of the appended ledger record, the id makes the replay of the append idempotent
+	ledgerKey struct {
+		chatId int64
+		id     int64
+	}
+
+	// walKey is the key of any of the maps, the fields the key doesn't have are zero
+	walKey struct {
+		ChatId int64  `json:"chatId,omitempty"`
+		Id     int64  `json:"id,omitempty"`
+		Name   string `json:"name,omitempty"`
+	}
+
+	// walRecord is a single write to one of the maps, the snapshot is the list of puts recreating the storage
+	walRecord struct {
+		Op    string          `json:"op"`
+		Table string          `json:"table"`
+		Key   walKey          `json:"key"`
+		Value json.RawMessage `json:"value,omitempty"`
+	}
+
+	// writeAheadLog is the file with the writes made since the last snapshot, one json line per unlock
+	writeAheadLog struct {
+		file *os.File
+		// snapshotPath is the snapshot the log is written after
+		snapshotPath string
+		logger       *logging.Logger
+	}
+)
+
+func newWalKey(key any) walKey {
+	switch key := key.(type) {
+	case string:
+		return walKey{Name: key}
+	case int64:
+		return walKey{Id: key}
+	case balanceBucketKey:
+		return walKey{ChatId: key.chatId, Id: key.userId}
+	case characterKey:
+		return walKey{ChatId: key.chatId, Id: key.characterId}
+	case questKey:
+		return walKey{ChatId: key.chatId, Id: key.questId}
+	case pendingTransferKey:
+		return walKey{ChatId: key.chatId, Id: key.transferId}
+	case shopItemKey:
+		return walKey{ChatId: key.chatId, Name: key.item}
+	case ledgerKey:
+		return walKey{ChatId: key.chatId, Id: key.id}
+	default:
+		panic(fmt.Sprintf("unsupported wal key %T", key))
+	}
+}
+
+func newWalRecord(op string, table string, key any, value any) (*walRecord, error) {
+	record := &walRecord{Op: op, Table: table, Key: newWalKey(key)}
+	if op == walOpDelete {
+		return record, nil
+	}
+
+	var err error
+	record.Value, err = json.Marshal(value)
+	return record, err
+}
+
+// journal records the write if the storage is journaling, the stored types always marshal
+func (m *MapStorage) journal(op string, table string, key any, value any) {
+	if !m.journaling {
+		return
+	}
+
+	record, err := newWalRecord(op, table, key, value)
+	if err != nil {
+		panic(fmt.Sprintf("can't journal %s %s: %s", op, table, err))
+	}
+
+	m.changes = append(m.changes, record)
+}
+
+// saveUndo records how to restore the entry before it's written, only the transaction records it
+func saveUndo[K comparable, V any](m *MapStorage, entries map[K]V, key K) {
+	if !m.transaction {
+		return
+	}
+
+	previous, ok := entries[key]
+	m.undo = append(m.undo, func() {
+		if ok {
+			entries[key] = previous
+		} else {
+			delete(entries, key)
+		}
+	})
+}
+
+func put[K comparable, V any](m *MapStorage, table string, entries map[K]V, key K, value V) {
+	saveUndo(m, entries, key)
+	entries[key] = value
+	m.journal(walOpPut, table, key, value)
+}
+
+func remove[K comparable, V any](m *MapStorage, table string, entries map[K]V, key K) {
+	_, ok := entries[key]
+	if !ok {
+		return
+	}
+
+	saveUndo(m, entries, key)
+	delete(entries, key)
+	m.journal(walOpDelete, table, key, nil)
+}
+
+// appendTo adds the record with the id to the ledger of the chat, the undo cuts the ledger back to its length
+func appendTo[V any](m *MapStorage, table string, ledgers map[int64][]V, chatId int64, id int64, value V) {
+	saveUndo(m, ledgers, chatId)
+	ledgers[chatId] = append(ledgers[chatId], value)
+	m.journal(walOpAppend, table, ledgerKey{chatId, id}, value)
+}
+
+func (m *MapStorage) sequences() map[string]*int64 {
+	return map[string]*int64{
+		sequenceCharacters:       &m.characterSequence,
+		sequenceItemTransfers:    &m.itemTransferSequence,
+		sequenceQuests:           &m.questSequence,
+		sequenceMoneyTransfers:   &m.moneyTransferSequence,
+		sequencePendingTransfers: &m.pendingTransferSequence,
+	}
+}
+
+// nextSequence works like the bolt bucket sequence, ids are unique across the chats
+func (m *MapStorage) nextSequence(name string) int64 {
+	sequence := m.sequences()[name]
+	*sequence++
+	m.journal(walOpPut, tableSequences, name, *sequence)
+	return *sequence
+}
+
+func (m *MapStorage) setSequenceAtLeast(name string, value int64) {
+	sequence := m.sequences()[name]
+	if *sequence >= value {
+		return
+	}
+
+	*sequence = value
+	m.journal(walOpPut, tableSequences, name, value)
+}
+
+// apply replays the record, the storage mustn't be journaling
+func (m *MapStorage) apply(record *walRecord) error {
+	key := record.Key
+	switch record.Table {
+	case tableBalances:
+		return m.applyBalanceRecord(record)
+	case tableUserNames:
+		return applyRecord(record, m.userNameToUserId, key.Name)
+	case tableUserIds:
+		return applyRecord(record, m.userIdToUserName, key.Id)
+	case tableConversations:
+		return applyRecord(record, m.conversations, balanceBucketKey{key.ChatId, key.Id})
+	case tableCharacters:
+		return applyRecord(record, m.characters, characterKey{key.ChatId, key.Id})
+	case tableActiveCharacters:
+		return applyRecord(record, m.activeCharacters, balanceBucketKey{key.ChatId, key.Id})
+	case tableInventories:
+		return applyRecord(record, m.inventories, balanceBucketKey{key.ChatId, key.Id})
+	case tableItemTransfers:
+		return applyLedgerRecord(record, m.itemTransfers, func(transfer *api.ItemTransfer) int64 { return transfer.Id })
+	case tableShopItems:
+		return applyRecord(record, m.shopItems, shopItemKey{key.ChatId, key.Name})
+	case tableQuests:
+		return applyRecord(record, m.quests, questKey{key.ChatId, key.Id})
+	case tableMoneyTransfers:
+		return applyLedgerRecord(record, m.moneyTransfers, func(transfer *api.MoneyTransfer) int64 { return transfer.Id })
+	case tableChatSettings:
+		return applyRecord(record, m.chatSettings, key.Id)
+	case tablePendingTransfers:
+		return applyRecord(record, m.pendingTransfers, pendingTransferKey{key.ChatId, key.Id})
+	case tableSequences:
+		sequence, ok := m.sequences()[key.Name]
+		if !ok || record.Op != walOpPut {
+			return fmt.Errorf("unknown sequence %s %s", record.Op, key.Name)
+		}
+
+		return json.Unmarshal(record.Value, sequence)
+	case tableChats:
+		if record.Op != walOpDelete {
+			return fmt.Errorf("unknown chats operation %s", record.Op)
+		}
+
+		m.deleteChat(key.Id)
+		return nil
+	default:
+		return fmt.Errorf("unknown table %s", record.Table)
+	}
+}
+
+func applyRecord[K comparable, V any](record *walRecord, entries map[K]V, key K) error {
+	switch record.Op {
+	case walOpPut:
+		var value V
+		err := json.Unmarshal(record.Value, &value)
+		if err != nil {
+			return err
+		}
+
+		entries[key] = value
+		return nil
+	case walOpDelete:
+		delete(entries, key)
+		return nil
+	default:
+		return fmt.Errorf("unknown %s operation %s", record.Table, record.Op)
+	}
+}
+
+// applyBalanceRecord replays the write of the wallet, the index by chat id is kept
+func (m *MapStorage) applyBalanceRecord(record *walRecord) error {
+	key := record.Key
+	switch record.Op {
+	case walOpPut:
+		var balance int64
+		err := json.Unmarshal(record.Value, &balance)
+		if err != nil {
+			return err
+		}
+
+		m.putBalance(balanceBucketKey{key.ChatId, key.Id}, balance)
+		return nil
+	case walOpDelete:
+		delete(m.balances[key.ChatId], key.Id)
+		if len(m.balances[key.ChatId]) == 0 {
+			delete(m.balances, key.ChatId)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown %s operation %s", record.Table, record.Op)
+	}
+}
+
+// applyLedgerRecord skips the append of the record the ledger already has, the log isn't truncated yet
+// if the bot crashes right after the snapshot is saved, ids only grow so the last entry is enough to compare with
+func applyLedgerRecord[V any](record *walRecord, ledgers map[int64][]V, id func(value V) int64) error {
+	if record.Op != walOpAppend {
+		return applyRecord(record, ledgers, record.Key.Id)
+	}
+
+	var value V
+	err := json.Unmarshal(record.Value, &value)
+	if err != nil {
+		return err
+	}
+
+	chatId := record.Key.ChatId
+	ledger := ledgers[chatId]
+	if len(ledger) > 0 && id(ledger[len(ledger)-1]) >= record.Key.Id {
+		return nil
+	}
+
+	ledgers[chatId] = append(ledgers[chatId], value)
+	return nil
+}
+
+// replay applies the records of the file, the last line is skipped if it's cut off by the crash during the write
+func (m *MapStorage) replay(path string) (records int, err error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(data) > 0 {
+				return records, fmt.Errorf("%w: %s line %d is incomplete", errTornWrite, path, line)
+			}
+
+			return records, nil
+		}
+
+		if err != nil {
+			return records, err
+		}
+
+		var batch []*walRecord
+		err = json.Unmarshal(data, &batch)
+		if err != nil {
+			return records, fmt.Errorf("%s line %d: %w", path, line, err)
+		}
+
+		for _, record := range batch {
+			err = m.apply(record)
+			if err != nil {
+				return records, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+		}
+
+		records += len(batch)
+	}
+}
+
+func openWriteAheadLog(snapshotPath string, logger *logging.Logger) (*writeAheadLog, error) {
+	file, err := os.OpenFile(walPath(snapshotPath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writeAheadLog{file: file, snapshotPath: snapshotPath, logger: logger}, nil
+}
+
+// append writes the records as a single line and syncs the file. The storage is already changed
+// so the failure is only logged, the next snapshot saves the changes anyway
+func (w *writeAheadLog) append(records []*walRecord) {
+	data, err := json.Marshal(records)
+	if err == nil {
+		_, err = w.file.Write(append(data, '\n'))
+	}
+
+	if err == nil {
+		err = w.file.Sync()
+	}
+
+	if err != nil {
+		w.logger.Errorf("error while appending to the write-ahead log: %s", err)
+	}
+}
+
+// truncate drops the records saved by the snapshot
+func (w *writeAheadLog) truncate() error {
+	err := w.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	return w.file.Sync()
+}
+
+func (w *writeAheadLog) close() error {
+	return w.file.Close()
+}
+
+// walPath returns the path of the log written after the snapshot
+func walPath(snapshotPath string) string {
+	return snapshotPath + ".wal"
+}
@@ -0,0 +1,34 @@
+package mapStorage
+
+import (
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+func (m *MapStorage) GetChatWallets(chatId int64) ([]*api.Wallet, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	wallets := make([]*api.Wallet, 0)
+	for userId, balance := range m.balances[chatId] {
+		if userId == api.TreasuryAccountId {
+			continue
+		}
+
+		wallets = append(wallets, &api.Wallet{
+			UserId:  userId,
+			Balance: balance,
+		})
+	}
+
+	return wallets, nil
+}
+
+func (m *MapStorage) GetAccountStats(chatId int64, accountId int64) (*api.AccountStats, error) {
+	m.rwMutex.RLock()
+	defer m.rwMutex.RUnlock()
+	stats := new(api.AccountStats)
+	for _, transfer := range m.moneyTransfers[chatId] {
+		stats.Add(accountId, transfer)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,162 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Backup writes a consistent snapshot of the db, the bot keeps serving updates meanwhile.
+// VACUUM INTO writes the snapshot to a temporary file which is then copied to w
+func (s *SqliteStorage) Backup(w io.Writer) (int64, error) {
+	written, err := backup(s.db, w)
+	if err != nil {
+		s.logger.Errorf("error while Backup: %s", err)
+	}
+
+	return written, err
+}
+
+// BackupToFile writes the snapshot next to the path first so a half written file never shows up as a backup
+func (s *SqliteStorage) BackupToFile(path string) error {
+	return writeFileAtomically(path, func(w io.Writer) error {
+		_, err := s.Backup(w)
+		return err
+	})
+}
+
+func backup(db *sql.DB, w io.Writer) (int64, error) {
+	dir, err := os.MkdirTemp("", "dndUtil-backup-*")
+	if err != nil {
+		return 0, err
+	}
+
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "snapshot.db")
+	_, err = db.Exec(`VACUUM INTO ?`, snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(snapshot)
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// BackupDbFile writes a snapshot of the db file, sqlite allows it while the bot is running
+func BackupDbFile(provider api.LoggerProvider, dbName string, path string) error {
+	_, err := os.Stat(dbName)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDb(dbName)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+	storage := &SqliteStorage{db: db, logger: provider.MustGetLogger("sqliteStorage")}
+	return storage.BackupToFile(path)
+}
+
+// Restore replaces the db file with the backup, the previous db is kept with the .before-restore suffix.
+// The bot has to be stopped, sqlite doesn't lock the file of the idle bot so it can't be checked here
+func Restore(provider api.LoggerProvider, dbName string, backupPath string) error {
+	logger := provider.MustGetLogger("sqliteStorage")
+	_, err := os.Stat(backupPath)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	backupDb, err := openDb(backupPath)
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	var version uint64
+	err = view(backupDb, func(tx *sql.Tx) error {
+		version, err = getSchemaVersion(tx)
+		return err
+	})
+	backupDb.Close()
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", backupPath, err)
+	}
+
+	if version > SchemaVersion() {
+		return fmt.Errorf("backup schema version %d is newer than supported %d", version, SchemaVersion())
+	}
+
+	_, err = os.Stat(dbName + "-wal")
+	if err == nil {
+		return fmt.Errorf("%s-wal exists, the bot is running or wasn't stopped cleanly", dbName)
+	}
+
+	_, err = os.Stat(dbName)
+	if err == nil {
+		err = copyFile(dbName, dbName+".before-restore")
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	err = copyFile(backupPath, dbName)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("db %s is restored from %s, schema version %d", dbName, backupPath, version)
+	return nil
+}
+
+func copyFile(from string, to string) error {
+	return writeFileAtomically(to, func(w io.Writer) error {
+		f, err := os.Open(from)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+}
+
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	if closeErr != nil {
+		return closeErr
+	}
+
+	err = os.Chmod(tmp.Name(), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
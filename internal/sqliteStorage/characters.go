@@ -0,0 +1,290 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+const (
+	charactersSequence = "characters"
+)
+
+func getCharacter(tx *sql.Tx, chatId int64, characterId int64) (*api.Character, error) {
+	character := new(api.Character)
+	ok, err := getJson(tx, character, `SELECT data FROM characters WHERE chat_id = ? AND id = ?`, chatId, characterId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("character %d %w", characterId, api.ErrorNotFound)
+	}
+
+	return character, nil
+}
+
+// queryCharacters unmarshals the data column of the selected rows
+func queryCharacters(tx *sql.Tx, query string, args ...any) ([]*api.Character, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	characters := make([]*api.Character, 0)
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		character := new(api.Character)
+		err = json.Unmarshal(data, character)
+		if err != nil {
+			return nil, err
+		}
+
+		characters = append(characters, character)
+	}
+
+	return characters, rows.Err()
+}
+
+func putCharacter(tx *sql.Tx, chatId int64, character *api.Character) error {
+	characterBytes, err := json.Marshal(character)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO characters (chat_id, id, owner_id, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id, id) DO UPDATE SET owner_id = excluded.owner_id, data = excluded.data`,
+		chatId,
+		character.Id,
+		character.OwnerId,
+		characterBytes,
+	)
+	return err
+}
+
+func putActiveCharacter(tx *sql.Tx, chatId int64, userId int64, characterId int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO active_characters (chat_id, user_id, character_id) VALUES (?, ?, ?)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET character_id = excluded.character_id`,
+		chatId,
+		userId,
+		characterId,
+	)
+	return err
+}
+
+func (s *SqliteStorage) CreateCharacter(chatId int64, character *api.Character) (int64, error) {
+	err := s.update(func(tx *sql.Tx) error {
+		id, err := nextSequence(tx, charactersSequence)
+		if err != nil {
+			return err
+		}
+
+		character.Id = id
+		err = putCharacter(tx, chatId, character)
+		if err != nil {
+			return err
+		}
+
+		return putActiveCharacter(tx, chatId, character.OwnerId, character.Id)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while CreateCharacter: %s", err)
+	}
+
+	return character.Id, err
+}
+
+func (s *SqliteStorage) GetCharacter(chatId int64, characterId int64) (*api.Character, error) {
+	var character *api.Character
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		character, err = getCharacter(tx, chatId, characterId)
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Errorf("error while GetCharacter: %s", err)
+	}
+
+	return character, err
+}
+
+func (s *SqliteStorage) GetCharacters(chatId int64, userId int64) ([]*api.Character, error) {
+	characters := make([]*api.Character, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		characters, err = queryCharacters(tx, `SELECT data FROM characters WHERE chat_id = ? AND owner_id = ? ORDER BY id`, chatId, userId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetCharacters: %s", err)
+	}
+
+	return characters, err
+}
+
+func (s *SqliteStorage) UpdateCharacter(chatId int64, characterId int64, update func(character *api.Character) error) error {
+	err := s.update(func(tx *sql.Tx) error {
+		character, err := getCharacter(tx, chatId, characterId)
+		if err != nil {
+			return err
+		}
+
+		err = update(character)
+		if err != nil {
+			return err
+		}
+
+		character.Id = characterId
+		return putCharacter(tx, chatId, character)
+	})
+
+	if err != nil {
+		s.logger.Debugf("error while UpdateCharacter: %s", err)
+	}
+
+	return err
+}
+
+// DeleteCharacter deletes the character, the active character reference is deleted by the foreign key cascade
+func (s *SqliteStorage) DeleteCharacter(chatId int64, characterId int64) error {
+	err := s.update(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM characters WHERE chat_id = ? AND id = ?`, chatId, characterId)
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return fmt.Errorf("character %d %w", characterId, api.ErrorNotFound)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while DeleteCharacter: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) SetActiveCharacter(chatId int64, userId int64, characterId int64) error {
+	err := s.update(func(tx *sql.Tx) error {
+		character, err := getCharacter(tx, chatId, characterId)
+		if err != nil {
+			return err
+		}
+
+		if character.OwnerId != userId {
+			return api.ErrorNotCharacterOwner
+		}
+
+		return putActiveCharacter(tx, chatId, userId, characterId)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while SetActiveCharacter: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) GetActiveCharacter(chatId int64, userId int64) (*api.Character, error) {
+	var character *api.Character
+	err := s.view(func(tx *sql.Tx) error {
+		characters, err := queryCharacters(
+			tx,
+			`SELECT c.data FROM active_characters a
+			JOIN characters c ON c.chat_id = a.chat_id AND c.id = a.character_id
+			WHERE a.chat_id = ? AND a.user_id = ?`,
+			chatId,
+			userId,
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(characters) == 0 {
+			return fmt.Errorf("active character %w", api.ErrorNotFound)
+		}
+
+		character = characters[0]
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Errorf("error while GetActiveCharacter: %s", err)
+	}
+
+	return character, err
+}
+
+func (s *SqliteStorage) GetActiveCharacters(chatId int64) ([]*api.Character, error) {
+	characters := make([]*api.Character, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		characters, err = queryCharacters(
+			tx,
+			`SELECT c.data FROM active_characters a
+			JOIN characters c ON c.chat_id = a.chat_id AND c.id = a.character_id
+			WHERE a.chat_id = ?
+			ORDER BY a.user_id`,
+			chatId,
+		)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetActiveCharacters: %s", err)
+	}
+
+	return characters, err
+}
+
+func (s *SqliteStorage) UpdateChatCharacters(chatId int64, update func(character *api.Character) error) error {
+	err := s.update(func(tx *sql.Tx) error {
+		characters, err := queryCharacters(tx, `SELECT data FROM characters WHERE chat_id = ? ORDER BY id`, chatId)
+		if err != nil {
+			return err
+		}
+
+		for _, character := range characters {
+			characterId := character.Id
+			err = update(character)
+			if err != nil {
+				return err
+			}
+
+			character.Id = characterId
+			err = putCharacter(tx, chatId, character)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while UpdateChatCharacters: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,59 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+func getChatSettings(tx *sql.Tx, chatId int64) (*api.ChatSettings, error) {
+	settings := new(api.ChatSettings)
+	_, err := getJson(tx, settings, `SELECT data FROM chat_settings WHERE chat_id = ?`, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func putChatSettings(tx *sql.Tx, chatId int64, settings *api.ChatSettings) error {
+	settingsBytes, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO chat_settings (chat_id, data) VALUES (?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET data = excluded.data`,
+		chatId,
+		settingsBytes,
+	)
+	return err
+}
+
+func (s *SqliteStorage) GetChatSettings(chatId int64) (*api.ChatSettings, error) {
+	var settings *api.ChatSettings
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		settings, err = getChatSettings(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetChatSettings: %s", err)
+	}
+
+	return settings, err
+}
+
+func (s *SqliteStorage) SaveChatSettings(chatId int64, settings *api.ChatSettings) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return putChatSettings(tx, chatId, settings)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while SaveChatSettings: %s", err)
+	}
+
+	return err
+}
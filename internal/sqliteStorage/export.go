@@ -0,0 +1,324 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"strings"
+)
+
+var (
+	// chatTables are the tables with the chat_id column, the user name mappings are global
+	chatTables = []string{
+		"wallets",
+		"conversations",
+		"chat_settings",
+		"active_characters",
+		"characters",
+		"inventory_items",
+		"item_transfers",
+		"shop_items",
+		"quests",
+		"money_transfers",
+		"pending_transfers",
+	}
+)
+
+func exportChat(tx *sql.Tx, chatId int64) (*api.ChatData, error) {
+	data := &api.ChatData{
+		ActiveCharacters: make([]*api.ActiveCharacter, 0),
+		Inventories:      make([]*api.OwnedInventory, 0),
+	}
+
+	var err error
+	data.Settings, err = getChatSettings(tx, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Treasury, err = getBalance(tx, chatId, api.TreasuryAccountId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Wallets, err = queryWallets(tx, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Characters, err = queryCharacters(tx, `SELECT data FROM characters WHERE chat_id = ? ORDER BY id`, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT user_id, character_id FROM active_characters WHERE chat_id = ? ORDER BY user_id`, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		active := new(api.ActiveCharacter)
+		err = rows.Scan(&active.UserId, &active.CharacterId)
+		if err != nil {
+			break
+		}
+
+		data.ActiveCharacters = append(data.ActiveCharacters, active)
+	}
+
+	_ = rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make([]int64, 0)
+	rows, err = tx.Query(`SELECT DISTINCT owner_id FROM inventory_items WHERE chat_id = ? ORDER BY owner_id`, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var ownerId int64
+		err = rows.Scan(&ownerId)
+		if err != nil {
+			break
+		}
+
+		owners = append(owners, ownerId)
+	}
+
+	_ = rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ownerId := range owners {
+		inventory, err := getInventory(tx, chatId, ownerId)
+		if err != nil {
+			return nil, err
+		}
+
+		data.Inventories = append(data.Inventories, &api.OwnedInventory{OwnerId: ownerId, Inventory: *inventory})
+	}
+
+	data.ShopItems, err = queryShopItems(tx, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.Quests, err = queryQuests(tx, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	data.MoneyTransfers, err = queryMoneyTransfers(
+		tx,
+		`SELECT `+moneyTransferColumns+` FROM money_transfers WHERE chat_id = ? ORDER BY id`,
+		chatId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	data.ItemTransfers, err = queryItemTransfers(
+		tx,
+		`SELECT `+itemTransferColumns+` FROM item_transfers WHERE chat_id = ? ORDER BY id`,
+		chatId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// deleteChat removes everything stored for the chat
+func deleteChat(tx *sql.Tx, chatId int64) error {
+	for _, table := range chatTables {
+		_, err := tx.Exec(`DELETE FROM `+table+` WHERE chat_id = ?`, chatId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func importChat(tx *sql.Tx, chatId int64, data *api.ChatData) error {
+	err := deleteChat(tx, chatId)
+	if err != nil {
+		return err
+	}
+
+	err = putChatSettings(tx, chatId, data.Settings)
+	if err != nil {
+		return err
+	}
+
+	err = putBalance(tx, chatId, api.TreasuryAccountId, data.Treasury)
+	if err != nil {
+		return err
+	}
+
+	for _, wallet := range data.Wallets {
+		err = putBalance(tx, chatId, wallet.UserId, wallet.Balance)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, character := range data.Characters {
+		err = putCharacter(tx, chatId, character)
+		if err == nil {
+			err = setSequenceAtLeast(tx, charactersSequence, character.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, active := range data.ActiveCharacters {
+		err = putActiveCharacter(tx, chatId, active.UserId, active.CharacterId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, inventory := range data.Inventories {
+		err = putInventory(tx, chatId, inventory.OwnerId, &inventory.Inventory)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range data.ShopItems {
+		err = putShopItem(tx, chatId, item)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, quest := range data.Quests {
+		err = putQuest(tx, chatId, quest)
+		if err == nil {
+			err = setSequenceAtLeast(tx, questsSequence, quest.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, transfer := range data.MoneyTransfers {
+		err = putMoneyTransfer(tx, chatId, transfer)
+		if err == nil {
+			err = setSequenceAtLeast(tx, moneyTransfersSequence, transfer.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, transfer := range data.ItemTransfers {
+		err = putItemTransfer(tx, chatId, transfer)
+		if err == nil {
+			err = setSequenceAtLeast(tx, itemTransfersSequence, transfer.Id)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SqliteStorage) ExportChat(chatId int64) (*api.ChatData, error) {
+	var data *api.ChatData
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		data, err = exportChat(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while ExportChat: %s", err)
+	}
+
+	return data, err
+}
+
+func (s *SqliteStorage) ImportChat(chatId int64, data *api.ChatData) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return importChat(tx, chatId, data)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while ImportChat: %s", err)
+	}
+
+	return err
+}
+
+// ImportUserNames saves the user name mappings in a single transaction
+func (s *SqliteStorage) ImportUserNames(userNames map[int64]string) error {
+	err := s.update(func(tx *sql.Tx) error {
+		for userId, userName := range userNames {
+			err := putUserName(tx, userName, userId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while ImportUserNames: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) ChatIds() ([]int64, error) {
+	chatIds := make([]int64, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		selects := make([]string, 0, len(chatTables))
+		for _, table := range chatTables {
+			selects = append(selects, `SELECT chat_id FROM `+table)
+		}
+
+		rows, err := tx.Query(strings.Join(selects, ` UNION `) + ` ORDER BY chat_id`)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			var chatId int64
+			err = rows.Scan(&chatId)
+			if err != nil {
+				return err
+			}
+
+			chatIds = append(chatIds, chatId)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while ChatIds: %s", err)
+	}
+
+	return chatIds, err
+}
@@ -0,0 +1,284 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"time"
+)
+
+const (
+	itemTransfersSequence = "itemTransfers"
+	itemTransferColumns   = `id, kind, from_id, to_id, actor_id, item, quantity, time`
+)
+
+func getInventory(tx *sql.Tx, chatId int64, ownerId int64) (*api.Inventory, error) {
+	rows, err := tx.Query(
+		`SELECT name, quantity FROM inventory_items WHERE chat_id = ? AND owner_id = ? ORDER BY position`,
+		chatId,
+		ownerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	inventory := api.NewInventory()
+	for rows.Next() {
+		item := new(api.InventoryItem)
+		err = rows.Scan(&item.Name, &item.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		inventory.Items = append(inventory.Items, item)
+	}
+
+	return inventory, rows.Err()
+}
+
+// putInventory replaces the items of the owner keeping the order of the inventory
+func putInventory(tx *sql.Tx, chatId int64, ownerId int64, inventory *api.Inventory) error {
+	_, err := tx.Exec(`DELETE FROM inventory_items WHERE chat_id = ? AND owner_id = ?`, chatId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	for position, item := range inventory.Items {
+		_, err = tx.Exec(
+			`INSERT INTO inventory_items (chat_id, owner_id, position, name, quantity) VALUES (?, ?, ?, ?, ?)`,
+			chatId,
+			ownerId,
+			position,
+			item.Name,
+			item.Quantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkInventoryOwner checks the owner has a wallet in the chat, the party stash always exists
+func checkInventoryOwner(tx *sql.Tx, chatId int64, ownerId int64) error {
+	if ownerId == api.StashOwnerId {
+		return nil
+	}
+
+	ok, err := walletExists(tx, chatId, ownerId)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("inventory owner %d %w", ownerId, api.ErrorNotRegistered)
+	}
+
+	return nil
+}
+
+func putItemTransfer(tx *sql.Tx, chatId int64, transfer *api.ItemTransfer) error {
+	_, err := tx.Exec(
+		`INSERT INTO item_transfers (chat_id, `+itemTransferColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		chatId,
+		transfer.Id,
+		transfer.Kind,
+		transfer.FromId,
+		transfer.ToId,
+		transfer.ActorId,
+		transfer.Item,
+		transfer.Quantity,
+		formatTime(transfer.Time),
+	)
+	return err
+}
+
+func addItemTransfer(tx *sql.Tx, chatId int64, transfer *api.ItemTransfer) error {
+	id, err := nextSequence(tx, itemTransfersSequence)
+	if err != nil {
+		return err
+	}
+
+	transfer.Id = id
+	transfer.Time = time.Now()
+	return putItemTransfer(tx, chatId, transfer)
+}
+
+// queryItemTransfers scans the rows selected with itemTransferColumns
+func queryItemTransfers(tx *sql.Tx, query string, args ...any) ([]*api.ItemTransfer, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	transfers := make([]*api.ItemTransfer, 0)
+	for rows.Next() {
+		transfer := new(api.ItemTransfer)
+		var transferTime string
+		err = rows.Scan(
+			&transfer.Id,
+			&transfer.Kind,
+			&transfer.FromId,
+			&transfer.ToId,
+			&transfer.ActorId,
+			&transfer.Item,
+			&transfer.Quantity,
+			&transferTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		transfer.Time, err = parseTime(transferTime)
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+func moveItem(tx *sql.Tx, chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error {
+	if fromId == toId {
+		return api.ErrorInvalidTransactionParameters
+	}
+
+	for _, ownerId := range []int64{fromId, toId} {
+		err := checkInventoryOwner(tx, chatId, ownerId)
+		if err != nil {
+			return err
+		}
+	}
+
+	from, err := getInventory(tx, chatId, fromId)
+	if err != nil {
+		return err
+	}
+
+	to, err := getInventory(tx, chatId, toId)
+	if err != nil {
+		return err
+	}
+
+	item = from.ItemName(item)
+	err = from.Remove(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	err = to.Add(item, quantity)
+	if err != nil {
+		return err
+	}
+
+	err = putInventory(tx, chatId, fromId, from)
+	if err != nil {
+		return err
+	}
+
+	err = putInventory(tx, chatId, toId, to)
+	if err != nil {
+		return err
+	}
+
+	return addItemTransfer(tx, chatId, &api.ItemTransfer{
+		Kind:     api.ItemTransferKindMove,
+		FromId:   fromId,
+		ToId:     toId,
+		ActorId:  actorId,
+		Item:     item,
+		Quantity: quantity,
+	})
+}
+
+func (s *SqliteStorage) GetInventory(chatId int64, ownerId int64) (*api.Inventory, error) {
+	var inventory *api.Inventory
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		inventory, err = getInventory(tx, chatId, ownerId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetInventory: %s", err)
+	}
+
+	return inventory, err
+}
+
+func (s *SqliteStorage) MoveItem(chatId int64, fromId int64, toId int64, item string, quantity int, actorId int64) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return moveItem(tx, chatId, fromId, toId, item, quantity, actorId)
+	})
+
+	if err != nil {
+		s.logger.Debugf("error while MoveItem: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) SetItemQuantity(chatId int64, ownerId int64, item string, quantity int, actorId int64) error {
+	err := s.update(func(tx *sql.Tx) error {
+		err := checkInventoryOwner(tx, chatId, ownerId)
+		if err != nil {
+			return err
+		}
+
+		inventory, err := getInventory(tx, chatId, ownerId)
+		if err != nil {
+			return err
+		}
+
+		err = inventory.Set(item, quantity)
+		if err != nil {
+			return err
+		}
+
+		err = putInventory(tx, chatId, ownerId, inventory)
+		if err != nil {
+			return err
+		}
+
+		return addItemTransfer(tx, chatId, &api.ItemTransfer{
+			Kind:     api.ItemTransferKindSet,
+			FromId:   ownerId,
+			ToId:     ownerId,
+			ActorId:  actorId,
+			Item:     item,
+			Quantity: quantity,
+		})
+	})
+
+	if err != nil {
+		s.logger.Debugf("error while SetItemQuantity: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) GetItemTransfers(chatId int64, limit int) ([]*api.ItemTransfer, error) {
+	var transfers []*api.ItemTransfer
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		transfers, err = queryItemTransfers(
+			tx,
+			`SELECT `+itemTransferColumns+` FROM item_transfers WHERE chat_id = ? ORDER BY id DESC LIMIT ?`,
+			chatId,
+			limit,
+		)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetItemTransfers: %s", err)
+		return make([]*api.ItemTransfer, 0), err
+	}
+
+	return transfers, nil
+}
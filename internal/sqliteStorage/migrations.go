@@ -0,0 +1,207 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/op/go-logging"
+)
+
+var (
+	// errDryRun rolls back the migration transaction in the dry run mode
+	errDryRun = errors.New("dry run")
+
+	// migrations are applied in order, the schema version stored in user_version is the number of the applied ones.
+	// Never reorder or remove entries, append new ones to the end
+	migrations = []migration{
+		{"create tables", migrateCreateTables},
+	}
+)
+
+type migration struct {
+	description string
+	migrate     func(tx *sql.Tx) error
+}
+
+// SchemaVersion is the schema version the storage works with
+func SchemaVersion() uint64 {
+	return uint64(len(migrations))
+}
+
+func getSchemaVersion(tx *sql.Tx) (uint64, error) {
+	var version uint64
+	err := tx.QueryRow(`PRAGMA user_version`).Scan(&version)
+	return version, err
+}
+
+func putSchemaVersion(tx *sql.Tx, version uint64) error {
+	// pragmas don't take parameters
+	_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version))
+	return err
+}
+
+// migrate applies pending migrations, returns descriptions of the applied ones
+func migrate(tx *sql.Tx, logger *logging.Logger) ([]string, error) {
+	version, err := getSchemaVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > SchemaVersion() {
+		return nil, fmt.Errorf("db schema version %d is newer than supported %d", version, SchemaVersion())
+	}
+
+	applied := make([]string, 0, len(migrations))
+	for i, m := range migrations[version:] {
+		logger.Infof("applying migration %d: %s", version+uint64(i)+1, m.description)
+		err = m.migrate(tx)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q: %w", m.description, err)
+		}
+
+		applied = append(applied, m.description)
+	}
+
+	return applied, putSchemaVersion(tx, SchemaVersion())
+}
+
+// DryRunMigrations applies pending migrations to the db and rolls them back, returns descriptions of the pending ones
+func DryRunMigrations(provider api.LoggerProvider, dbName string) ([]string, error) {
+	logger := provider.MustGetLogger("sqliteStorage")
+	db, err := openDb(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+	var pending []string
+	err = update(db, func(tx *sql.Tx) error {
+		pending, err = migrate(tx, logger)
+		if err != nil {
+			return err
+		}
+
+		return errDryRun
+	})
+
+	if !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+// migrateCreateTables creates the initial schema. Characters, quests, conversations and settings are json documents
+// since they are always read and written whole, the money and the items are plain columns to be queried
+func migrateCreateTables(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE sequences (
+			name TEXT PRIMARY KEY,
+			value INTEGER NOT NULL
+		)`,
+		`CREATE TABLE users (
+			user_id INTEGER PRIMARY KEY,
+			user_name TEXT NOT NULL
+		)`,
+		`CREATE TABLE user_names (
+			user_name TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL
+		)`,
+		`CREATE TABLE wallets (
+			chat_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			balance INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, user_id)
+		)`,
+		`CREATE TABLE conversations (
+			chat_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (chat_id, user_id)
+		)`,
+		`CREATE TABLE chat_settings (
+			chat_id INTEGER PRIMARY KEY,
+			data BLOB NOT NULL
+		)`,
+		`CREATE TABLE characters (
+			chat_id INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			owner_id INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (chat_id, id)
+		)`,
+		`CREATE INDEX characters_owner ON characters (chat_id, owner_id)`,
+		`CREATE TABLE active_characters (
+			chat_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			character_id INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, user_id),
+			FOREIGN KEY (chat_id, character_id) REFERENCES characters (chat_id, id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE inventory_items (
+			chat_id INTEGER NOT NULL,
+			owner_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			quantity INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, owner_id, position)
+		)`,
+		`CREATE TABLE item_transfers (
+			chat_id INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			from_id INTEGER NOT NULL,
+			to_id INTEGER NOT NULL,
+			actor_id INTEGER NOT NULL,
+			item TEXT NOT NULL,
+			quantity INTEGER NOT NULL,
+			time TEXT NOT NULL,
+			PRIMARY KEY (chat_id, id)
+		)`,
+		`CREATE TABLE shop_items (
+			chat_id INTEGER NOT NULL,
+			item_key TEXT NOT NULL,
+			name TEXT NOT NULL,
+			price INTEGER NOT NULL,
+			stock INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, item_key)
+		)`,
+		`CREATE TABLE quests (
+			chat_id INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			state TEXT NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (chat_id, id)
+		)`,
+		`CREATE TABLE money_transfers (
+			chat_id INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			from_id INTEGER NOT NULL,
+			to_id INTEGER NOT NULL,
+			actor_id INTEGER NOT NULL,
+			amount INTEGER NOT NULL,
+			time TEXT NOT NULL,
+			PRIMARY KEY (chat_id, id)
+		)`,
+		`CREATE INDEX money_transfers_from ON money_transfers (chat_id, from_id, id)`,
+		`CREATE INDEX money_transfers_to ON money_transfers (chat_id, to_id, id)`,
+		`CREATE TABLE pending_transfers (
+			chat_id INTEGER NOT NULL,
+			id INTEGER NOT NULL,
+			expires_at TEXT NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (chat_id, id)
+		)`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
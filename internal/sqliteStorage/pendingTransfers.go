@@ -0,0 +1,146 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"time"
+)
+
+const (
+	pendingTransfersSequence = "pendingTransfers"
+)
+
+func getPendingTransfer(tx *sql.Tx, chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	transfer := new(api.PendingTransfer)
+	ok, err := getJson(tx, transfer, `SELECT data FROM pending_transfers WHERE chat_id = ? AND id = ?`, chatId, transferId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("pending transfer %d %w", transferId, api.ErrorNotFound)
+	}
+
+	return transfer, nil
+}
+
+func (s *SqliteStorage) CreatePendingTransfer(chatId int64, transfer *api.PendingTransfer) (int64, error) {
+	err := s.update(func(tx *sql.Tx) error {
+		id, err := nextSequence(tx, pendingTransfersSequence)
+		if err != nil {
+			return err
+		}
+
+		transfer.Id = id
+		transferBytes, err := json.Marshal(transfer)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`INSERT INTO pending_transfers (chat_id, id, expires_at, data) VALUES (?, ?, ?, ?)`,
+			chatId,
+			transfer.Id,
+			formatTime(transfer.ExpiresAt),
+			transferBytes,
+		)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while CreatePendingTransfer: %s", err)
+	}
+
+	return transfer.Id, err
+}
+
+func (s *SqliteStorage) GetPendingTransfer(chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	var transfer *api.PendingTransfer
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		transfer, err = getPendingTransfer(tx, chatId, transferId)
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Errorf("error while GetPendingTransfer: %s", err)
+	}
+
+	return transfer, err
+}
+
+func (s *SqliteStorage) TakePendingTransfer(chatId int64, transferId int64) (*api.PendingTransfer, error) {
+	var transfer *api.PendingTransfer
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		transfer, err = getPendingTransfer(tx, chatId, transferId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM pending_transfers WHERE chat_id = ? AND id = ?`, chatId, transferId)
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Errorf("error while TakePendingTransfer: %s", err)
+	}
+
+	return transfer, err
+}
+
+func (s *SqliteStorage) DeleteExpiredPendingTransfers(chatId int64, now time.Time) error {
+	err := s.update(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id, expires_at FROM pending_transfers WHERE chat_id = ?`, chatId)
+		if err != nil {
+			return err
+		}
+
+		expired := make([]int64, 0)
+		for rows.Next() {
+			var id int64
+			var expiresAtStr string
+			err = rows.Scan(&id, &expiresAtStr)
+			if err != nil {
+				break
+			}
+
+			var expiresAt time.Time
+			expiresAt, err = parseTime(expiresAtStr)
+			if err != nil {
+				break
+			}
+
+			if now.After(expiresAt) {
+				expired = append(expired, id)
+			}
+		}
+
+		_ = rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, id := range expired {
+			_, err = tx.Exec(`DELETE FROM pending_transfers WHERE chat_id = ? AND id = ?`, chatId, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while DeleteExpiredPendingTransfers: %s", err)
+	}
+
+	return err
+}
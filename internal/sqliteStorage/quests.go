@@ -0,0 +1,168 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+const (
+	questsSequence = "quests"
+)
+
+func getQuest(tx *sql.Tx, chatId int64, questId int64) (*api.Quest, error) {
+	quest := new(api.Quest)
+	ok, err := getJson(tx, quest, `SELECT data FROM quests WHERE chat_id = ? AND id = ?`, chatId, questId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("quest %d %w", questId, api.ErrorNotFound)
+	}
+
+	return quest, nil
+}
+
+func putQuest(tx *sql.Tx, chatId int64, quest *api.Quest) error {
+	questBytes, err := json.Marshal(quest)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO quests (chat_id, id, state, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id, id) DO UPDATE SET state = excluded.state, data = excluded.data`,
+		chatId,
+		quest.Id,
+		quest.State,
+		questBytes,
+	)
+	return err
+}
+
+func queryQuests(tx *sql.Tx, chatId int64) ([]*api.Quest, error) {
+	rows, err := tx.Query(`SELECT data FROM quests WHERE chat_id = ? ORDER BY id`, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	quests := make([]*api.Quest, 0)
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+
+		quest := new(api.Quest)
+		err = json.Unmarshal(data, quest)
+		if err != nil {
+			return nil, err
+		}
+
+		quests = append(quests, quest)
+	}
+
+	return quests, rows.Err()
+}
+
+func (s *SqliteStorage) CreateQuest(chatId int64, quest *api.Quest) (int64, error) {
+	err := s.update(func(tx *sql.Tx) error {
+		id, err := nextSequence(tx, questsSequence)
+		if err != nil {
+			return err
+		}
+
+		quest.Id = id
+		return putQuest(tx, chatId, quest)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while CreateQuest: %s", err)
+	}
+
+	return quest.Id, err
+}
+
+func (s *SqliteStorage) GetQuests(chatId int64) ([]*api.Quest, error) {
+	quests := make([]*api.Quest, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		quests, err = queryQuests(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetQuests: %s", err)
+	}
+
+	return quests, err
+}
+
+func (s *SqliteStorage) UpdateQuest(chatId int64, questId int64, update func(quest *api.Quest) error) error {
+	err := s.update(func(tx *sql.Tx) error {
+		quest, err := getQuest(tx, chatId, questId)
+		if err != nil {
+			return err
+		}
+
+		err = update(quest)
+		if err != nil {
+			return err
+		}
+
+		quest.Id = questId
+		return putQuest(tx, chatId, quest)
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Debugf("error while UpdateQuest: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) CompleteQuest(chatId int64, questId int64, complete func(quest *api.Quest) ([]*api.Credit, error)) error {
+	err := s.update(func(tx *sql.Tx) error {
+		quest, err := getQuest(tx, chatId, questId)
+		if err != nil {
+			return err
+		}
+
+		credits, err := complete(quest)
+		if err != nil {
+			return err
+		}
+
+		quest.Id = questId
+		err = putQuest(tx, chatId, quest)
+		if err != nil {
+			return err
+		}
+
+		for _, credit := range credits {
+			err = transferMoney(tx, chatId, &api.MoneyTransfer{
+				Kind:    api.MoneyTransferKindQuest,
+				FromId:  api.TreasuryAccountId,
+				ToId:    credit.UserId,
+				ActorId: quest.CreatedBy,
+				Amount:  credit.Amount,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Debugf("error while CompleteQuest: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,186 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+func getShopItem(tx *sql.Tx, chatId int64, item string) (*api.ShopItem, error) {
+	shopItem := new(api.ShopItem)
+	err := tx.QueryRow(
+		`SELECT name, price, stock FROM shop_items WHERE chat_id = ? AND item_key = ?`,
+		chatId,
+		api.ItemKey(item),
+	).Scan(&shopItem.Name, &shopItem.Price, &shopItem.Stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("shop item %s %w", item, api.ErrorNotFound)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return shopItem, nil
+}
+
+func putShopItem(tx *sql.Tx, chatId int64, item *api.ShopItem) error {
+	_, err := tx.Exec(
+		`INSERT INTO shop_items (chat_id, item_key, name, price, stock) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, item_key) DO UPDATE SET name = excluded.name, price = excluded.price, stock = excluded.stock`,
+		chatId,
+		api.ItemKey(item.Name),
+		item.Name,
+		item.Price,
+		item.Stock,
+	)
+	return err
+}
+
+func queryShopItems(tx *sql.Tx, chatId int64) ([]*api.ShopItem, error) {
+	rows, err := tx.Query(`SELECT name, price, stock FROM shop_items WHERE chat_id = ? ORDER BY item_key`, chatId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	items := make([]*api.ShopItem, 0)
+	for rows.Next() {
+		item := new(api.ShopItem)
+		err = rows.Scan(&item.Name, &item.Price, &item.Stock)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func (s *SqliteStorage) SaveShopItem(chatId int64, item *api.ShopItem) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return putShopItem(tx, chatId, item)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while SaveShopItem: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) DeleteShopItem(chatId int64, item string) error {
+	err := s.update(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM shop_items WHERE chat_id = ? AND item_key = ?`, chatId, api.ItemKey(item))
+		if err != nil {
+			return err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if deleted == 0 {
+			return fmt.Errorf("shop item %s %w", item, api.ErrorNotFound)
+		}
+
+		return nil
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotFound) {
+		s.logger.Errorf("error while DeleteShopItem: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) GetShopItems(chatId int64) ([]*api.ShopItem, error) {
+	items := make([]*api.ShopItem, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		items, err = queryShopItems(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetShopItems: %s", err)
+	}
+
+	return items, err
+}
+
+func (s *SqliteStorage) BuyItem(chatId int64, userId int64, item string, quantity int) (*api.ShopItem, error) {
+	var shopItem *api.ShopItem
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		shopItem, err = getShopItem(tx, chatId, item)
+		if err != nil {
+			return err
+		}
+
+		err = shopItem.TakeFromStock(quantity)
+		if err != nil {
+			return err
+		}
+
+		total, err := shopItem.TotalPrice(quantity)
+		if err != nil {
+			return err
+		}
+
+		err = debitBalance(tx, chatId, userId, total)
+		if err != nil {
+			return err
+		}
+
+		err = addMoneyTransfer(tx, chatId, &api.MoneyTransfer{
+			Kind:    api.MoneyTransferKindBuy,
+			FromId:  userId,
+			ToId:    api.ExternalAccountId,
+			ActorId: userId,
+			Amount:  total,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = putShopItem(tx, chatId, shopItem)
+		if err != nil {
+			return err
+		}
+
+		inventory, err := getInventory(tx, chatId, userId)
+		if err != nil {
+			return err
+		}
+
+		err = inventory.Add(shopItem.Name, quantity)
+		if err != nil {
+			return err
+		}
+
+		err = putInventory(tx, chatId, userId, inventory)
+		if err != nil {
+			return err
+		}
+
+		return addItemTransfer(tx, chatId, &api.ItemTransfer{
+			Kind:     api.ItemTransferKindBuy,
+			FromId:   userId,
+			ToId:     userId,
+			ActorId:  userId,
+			Item:     shopItem.Name,
+			Quantity: quantity,
+		})
+	})
+
+	if err != nil {
+		s.logger.Debugf("error while BuyItem: %s", err)
+		return nil, err
+	}
+
+	return shopItem, nil
+}
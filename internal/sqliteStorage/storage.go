@@ -0,0 +1,458 @@
+package sqliteStorage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/op/go-logging"
+	_ "modernc.org/sqlite"
+	"time"
+)
+
+const (
+	driverName = "sqlite"
+	// busyTimeout is how long a connection waits for the lock held by another process
+	busyTimeout = time.Second
+	// timeLayout keeps the stored times sortable and readable for ad hoc queries
+	timeLayout = time.RFC3339Nano
+)
+
+type SqliteStorage struct {
+	db     *sql.DB
+	logger *logging.Logger
+	// tx is the transaction of WithTx the storage is bound to, nil if every call runs its own transaction
+	tx *sql.Tx
+}
+
+func NewSqliteStorage(provider api.LoggerProvider, dbName string) (storage *SqliteStorage, close func()) {
+	logger := provider.MustGetLogger("sqliteStorage")
+	logger.Debugf("Db path is %s", dbName)
+	db, err := openDb(dbName)
+	if err != nil {
+		logger.Fatalf("error while opening db connection %s", err)
+	}
+
+	Init(db, logger)
+
+	return &SqliteStorage{
+			db:     db,
+			logger: logger,
+		},
+		func() {
+			err := db.Close()
+			if err != nil {
+				logger.Fatalf("error while closing db connection %s", err)
+			}
+		}
+}
+
+// openDb opens the db with the single connection, sqlite has one writer anyway and
+// the single connection serializes the transactions the same way bolt does
+func openDb(dbName string) (*sql.DB, error) {
+	dsn := fmt.Sprintf(
+		"file:%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate",
+		dbName,
+		busyTimeout.Milliseconds(),
+	)
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	err = db.Ping()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Init creates the tables and migrates the db to the current schema version in a single transaction
+func Init(db *sql.DB, logger *logging.Logger) {
+	err := update(db, func(tx *sql.Tx) error {
+		_, err := migrate(tx, logger)
+		return err
+	})
+
+	if err != nil {
+		logger.Fatalf("error during db initialization %s", err)
+	}
+}
+
+// update runs fn in the write transaction, the transaction is rolled back if fn fails
+func update(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// view runs fn in the transaction which is always rolled back
+func view(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+// Ping fails if the db is closed
+func (s *SqliteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// WithTx runs fn in the single write transaction, the driver rolls the transaction back as soon as ctx is canceled
+func (s *SqliteStorage) WithTx(ctx context.Context, fn func(tx api.StorageTx) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(&SqliteStorage{db: s.db, logger: s.logger, tx: tx})
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SqliteStorage) update(fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	return update(s.db, fn)
+}
+
+func (s *SqliteStorage) view(fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	return view(s.db, fn)
+}
+
+// nextSequence works like the bolt bucket sequence, ids are unique across the chats
+func nextSequence(tx *sql.Tx, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(
+		`INSERT INTO sequences (name, value) VALUES (?, 1)
+		ON CONFLICT (name) DO UPDATE SET value = value + 1
+		RETURNING value`,
+		name,
+	).Scan(&id)
+	return id, err
+}
+
+// setSequenceAtLeast keeps nextSequence from returning the imported ids
+func setSequenceAtLeast(tx *sql.Tx, name string, id int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO sequences (name, value) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET value = max(value, excluded.value)`,
+		name,
+		id,
+	)
+	return err
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return t.Local(), nil
+}
+
+func getJson(tx *sql.Tx, value any, query string, args ...any) (bool, error) {
+	var data []byte
+	err := tx.QueryRow(query, args...).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, value)
+}
+
+// creditUsers adds amounts coming from api.ExternalAccountId to the wallets,
+// fails if any of the users is not registered or the wallet overflows
+func creditUsers(tx *sql.Tx, chatId int64, kind string, actorId int64, credits []*api.Credit) error {
+	for _, credit := range credits {
+		balance, err := getBalance(tx, chatId, credit.UserId)
+		if err != nil {
+			return err
+		}
+
+		balance, err = api.CreditBalance(balance, credit.Amount)
+		if err != nil {
+			return err
+		}
+
+		err = putBalance(tx, chatId, credit.UserId, balance)
+		if err != nil {
+			return err
+		}
+
+		err = addMoneyTransfer(tx, chatId, &api.MoneyTransfer{
+			Kind:    kind,
+			FromId:  api.ExternalAccountId,
+			ToId:    credit.UserId,
+			ActorId: actorId,
+			Amount:  credit.Amount,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SqliteStorage) IsRegistered(chatId int64, userId int64) (bool, error) {
+	var ok bool
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		ok, err = walletExists(tx, chatId, userId)
+		return err
+	})
+
+	return ok, err
+}
+
+func (s *SqliteStorage) CreditUsers(chatId int64, kind string, actorId int64, credits []*api.Credit) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return creditUsers(tx, chatId, kind, actorId, credits)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while CreditUsers %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) SetUserBalance(chatId int64, userId int64, amount int64) error {
+	if amount < -api.MaxBalance || amount > api.MaxBalance {
+		return api.ErrorBalanceOverflow
+	}
+
+	return s.update(func(tx *sql.Tx) error {
+		return putBalance(tx, chatId, userId, amount)
+	})
+}
+
+func (s *SqliteStorage) GetUserBalance(chatId int64, userId int64) (int64, error) {
+	var balance int64
+	err := s.view(func(tx *sql.Tx) error {
+		err := tx.QueryRow(`SELECT balance FROM wallets WHERE chat_id = ? AND user_id = ?`, chatId, userId).Scan(&balance)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("error while GetUserBalance %w", api.ErrorNotRegistered)
+		}
+
+		return err
+	})
+
+	if err != nil && !errors.Is(err, api.ErrorNotRegistered) {
+		s.logger.Errorf("error while GetUserBalance: %s", err)
+	}
+
+	return balance, err
+}
+
+func (s *SqliteStorage) GetIdByUserName(userName string) (userId int64, ok bool) {
+	err := s.view(func(tx *sql.Tx) error {
+		return tx.QueryRow(`SELECT user_id FROM user_names WHERE user_name = ?`, userName).Scan(&userId)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false
+	}
+
+	if err != nil {
+		s.logger.Errorf("error while GetIdByUserName: %s", err)
+		return 0, false
+	}
+
+	return userId, true
+}
+
+func (s *SqliteStorage) SaveUserNameToUserIdMapping(userName string, id int64) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return putUserName(tx, userName, id)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while SaveUserNameToUserIdMapping: %s", err)
+	}
+
+	return err
+}
+
+// putUserName keeps both directions of the mapping, the name points to the latest user who had it
+// and the previous name of the renamed user is deleted
+func putUserName(tx *sql.Tx, userName string, id int64) error {
+	_, err := tx.Exec(`DELETE FROM user_names WHERE user_id = ? AND user_name <> ?`, id, userName)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_names (user_name, user_id) VALUES (?, ?)
+		ON CONFLICT (user_name) DO UPDATE SET user_id = excluded.user_id`,
+		userName,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO users (user_id, user_name) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET user_name = excluded.user_name`,
+		id,
+		userName,
+	)
+	return err
+}
+
+func (s *SqliteStorage) GetUserNameById(userId int64) (userName string, ok bool) {
+	err := s.view(func(tx *sql.Tx) error {
+		return tx.QueryRow(`SELECT user_name FROM users WHERE user_id = ?`, userId).Scan(&userName)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false
+	}
+
+	if err != nil {
+		s.logger.Errorf("error while GetUserNameById: %s", err)
+		return "", false
+	}
+
+	return userName, true
+}
+
+func (s *SqliteStorage) GetChatMembers(chatId int64) ([]*api.Member, error) {
+	members := make([]*api.Member, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		rows, err := tx.Query(
+			`SELECT w.user_id, coalesce(u.user_name, '') FROM wallets w
+			LEFT JOIN users u ON u.user_id = w.user_id
+			WHERE w.chat_id = ? AND w.user_id != ?
+			ORDER BY w.user_id`,
+			chatId,
+			api.TreasuryAccountId,
+		)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+		for rows.Next() {
+			member := new(api.Member)
+			err = rows.Scan(&member.UserId, &member.UserName)
+			if err != nil {
+				return err
+			}
+
+			members = append(members, member)
+		}
+
+		return rows.Err()
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetChatMembers: %s", err)
+	}
+
+	return members, err
+}
+
+func (s *SqliteStorage) GetConversation(chatId int64, userId int64) (*api.Conversation, error) {
+	conv := new(api.Conversation)
+	err := s.view(func(tx *sql.Tx) error {
+		ok, err := getJson(tx, conv, `SELECT data FROM conversations WHERE chat_id = ? AND user_id = ?`, chatId, userId)
+		if err == nil && !ok {
+			return fmt.Errorf("error while GetConversation %w", api.ErrorNotFound)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		if !errors.Is(err, api.ErrorNotFound) {
+			s.logger.Errorf("error while GetConversation: %s", err)
+		}
+
+		return nil, err
+	}
+
+	return conv, nil
+}
+
+func (s *SqliteStorage) SaveConversation(chatId int64, userId int64, conv *api.Conversation) error {
+	convBytes, err := json.Marshal(conv)
+	if err != nil {
+		return err
+	}
+
+	err = s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			`INSERT INTO conversations (chat_id, user_id, data) VALUES (?, ?, ?)
+			ON CONFLICT (chat_id, user_id) DO UPDATE SET data = excluded.data`,
+			chatId,
+			userId,
+			convBytes,
+		)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while SaveConversation: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) DeleteConversation(chatId int64, userId int64) error {
+	err := s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM conversations WHERE chat_id = ? AND user_id = ?`, chatId, userId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while DeleteConversation: %s", err)
+	}
+
+	return err
+}
@@ -0,0 +1,23 @@
+package sqliteStorage
+
+import (
+	"github.com/Refreezer/dnd-util-bot/api"
+	"github.com/Refreezer/dnd-util-bot/internal/storagetest"
+	"github.com/op/go-logging"
+	"path/filepath"
+	"testing"
+)
+
+type loggerProvider struct{}
+
+func (lp loggerProvider) MustGetLogger(moduleName string) *logging.Logger {
+	return logging.MustGetLogger(moduleName)
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) api.Storage {
+		storage, closeDb := NewSqliteStorage(loggerProvider{}, filepath.Join(t.TempDir(), "db"))
+		t.Cleanup(closeDb)
+		return storage
+	})
+}
@@ -0,0 +1,247 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"time"
+)
+
+const (
+	moneyTransfersSequence = "moneyTransfers"
+	moneyTransferColumns   = `id, kind, from_id, to_id, actor_id, amount, time`
+)
+
+func walletExists(tx *sql.Tx, chatId int64, accountId int64) (bool, error) {
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM wallets WHERE chat_id = ? AND user_id = ?)`, chatId, accountId).Scan(&exists)
+	return exists, err
+}
+
+// getBalance returns the wallet balance, the treasury wallet is created on the first deposit
+func getBalance(tx *sql.Tx, chatId int64, accountId int64) (int64, error) {
+	var balance int64
+	err := tx.QueryRow(`SELECT balance FROM wallets WHERE chat_id = ? AND user_id = ?`, chatId, accountId).Scan(&balance)
+	if err == nil {
+		return balance, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	if accountId == api.TreasuryAccountId {
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("wallet %d %w", accountId, api.ErrorNotRegistered)
+}
+
+func putBalance(tx *sql.Tx, chatId int64, accountId int64, balance int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO wallets (chat_id, user_id, balance) VALUES (?, ?, ?)
+		ON CONFLICT (chat_id, user_id) DO UPDATE SET balance = excluded.balance`,
+		chatId,
+		accountId,
+		balance,
+	)
+	return err
+}
+
+// debitBalance takes amount from the wallet, players may go in debt up to the credit limit of the chat,
+// the treasury never goes in debt
+func debitBalance(tx *sql.Tx, chatId int64, accountId int64, amount int64) error {
+	balance, err := getBalance(tx, chatId, accountId)
+	if err != nil {
+		return err
+	}
+
+	if accountId == api.TreasuryAccountId {
+		balance, err = api.DebitBalance(balance, amount, 0)
+		if err != nil {
+			return api.ErrorInsufficientTreasury
+		}
+
+		return putBalance(tx, chatId, accountId, balance)
+	}
+
+	settings, err := getChatSettings(tx, chatId)
+	if err != nil {
+		return err
+	}
+
+	balance, err = api.DebitBalance(balance, amount, settings.CreditLimit)
+	if err != nil {
+		return err
+	}
+
+	return putBalance(tx, chatId, accountId, balance)
+}
+
+func creditBalance(tx *sql.Tx, chatId int64, accountId int64, amount int64) error {
+	balance, err := getBalance(tx, chatId, accountId)
+	if err != nil {
+		return err
+	}
+
+	balance, err = api.CreditBalance(balance, amount)
+	if err != nil {
+		return err
+	}
+
+	return putBalance(tx, chatId, accountId, balance)
+}
+
+func putMoneyTransfer(tx *sql.Tx, chatId int64, transfer *api.MoneyTransfer) error {
+	_, err := tx.Exec(
+		`INSERT INTO money_transfers (chat_id, `+moneyTransferColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		chatId,
+		transfer.Id,
+		transfer.Kind,
+		transfer.FromId,
+		transfer.ToId,
+		transfer.ActorId,
+		transfer.Amount,
+		formatTime(transfer.Time),
+	)
+	return err
+}
+
+func addMoneyTransfer(tx *sql.Tx, chatId int64, transfer *api.MoneyTransfer) error {
+	id, err := nextSequence(tx, moneyTransfersSequence)
+	if err != nil {
+		return err
+	}
+
+	transfer.Id = id
+	transfer.Time = time.Now()
+	return putMoneyTransfer(tx, chatId, transfer)
+}
+
+// queryMoneyTransfers scans the rows selected with moneyTransferColumns
+func queryMoneyTransfers(tx *sql.Tx, query string, args ...any) ([]*api.MoneyTransfer, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	transfers := make([]*api.MoneyTransfer, 0)
+	for rows.Next() {
+		transfer := new(api.MoneyTransfer)
+		var transferTime string
+		err = rows.Scan(
+			&transfer.Id,
+			&transfer.Kind,
+			&transfer.FromId,
+			&transfer.ToId,
+			&transfer.ActorId,
+			&transfer.Amount,
+			&transferTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		transfer.Time, err = parseTime(transferTime)
+		if err != nil {
+			return nil, err
+		}
+
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+func transferMoney(tx *sql.Tx, chatId int64, transfer *api.MoneyTransfer) error {
+	if transfer.FromId == transfer.ToId {
+		return api.ErrorInvalidTransactionParameters
+	}
+
+	err := debitBalance(tx, chatId, transfer.FromId, transfer.Amount)
+	if err != nil {
+		return err
+	}
+
+	err = creditBalance(tx, chatId, transfer.ToId, transfer.Amount)
+	if err != nil {
+		return err
+	}
+
+	return addMoneyTransfer(tx, chatId, transfer)
+}
+
+func (s *SqliteStorage) GetTreasuryBalance(chatId int64) (int64, error) {
+	var balance int64
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		balance, err = getBalance(tx, chatId, api.TreasuryAccountId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetTreasuryBalance: %s", err)
+	}
+
+	return balance, err
+}
+
+func (s *SqliteStorage) TransferMoney(chatId int64, transfer *api.MoneyTransfer) error {
+	err := s.update(func(tx *sql.Tx) error {
+		return transferMoney(tx, chatId, transfer)
+	})
+
+	if err != nil {
+		s.logger.Debugf("error while TransferMoney: %s", err)
+	}
+
+	return err
+}
+
+func (s *SqliteStorage) GetMoneyTransfers(chatId int64, accountId int64, limit int) ([]*api.MoneyTransfer, error) {
+	var transfers []*api.MoneyTransfer
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		transfers, err = queryMoneyTransfers(
+			tx,
+			`SELECT `+moneyTransferColumns+` FROM money_transfers
+			WHERE chat_id = ? AND (from_id = ? OR to_id = ?)
+			ORDER BY id DESC LIMIT ?`,
+			chatId,
+			accountId,
+			accountId,
+			limit,
+		)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetMoneyTransfers: %s", err)
+		return make([]*api.MoneyTransfer, 0), err
+	}
+
+	return transfers, nil
+}
+
+func (s *SqliteStorage) GetChatMoneyTransfers(chatId int64, limit int) ([]*api.MoneyTransfer, error) {
+	var transfers []*api.MoneyTransfer
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		transfers, err = queryMoneyTransfers(
+			tx,
+			`SELECT `+moneyTransferColumns+` FROM money_transfers WHERE chat_id = ? ORDER BY id DESC LIMIT ?`,
+			chatId,
+			limit,
+		)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetChatMoneyTransfers: %s", err)
+		return make([]*api.MoneyTransfer, 0), err
+	}
+
+	return transfers, nil
+}
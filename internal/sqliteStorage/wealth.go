@@ -0,0 +1,69 @@
+package sqliteStorage
+
+import (
+	"database/sql"
+	"github.com/Refreezer/dnd-util-bot/api"
+)
+
+func queryWallets(tx *sql.Tx, chatId int64) ([]*api.Wallet, error) {
+	rows, err := tx.Query(
+		`SELECT user_id, balance FROM wallets WHERE chat_id = ? AND user_id != ? ORDER BY user_id`,
+		chatId,
+		api.TreasuryAccountId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	wallets := make([]*api.Wallet, 0)
+	for rows.Next() {
+		wallet := new(api.Wallet)
+		err = rows.Scan(&wallet.UserId, &wallet.Balance)
+		if err != nil {
+			return nil, err
+		}
+
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, rows.Err()
+}
+
+func (s *SqliteStorage) GetChatWallets(chatId int64) ([]*api.Wallet, error) {
+	wallets := make([]*api.Wallet, 0)
+	err := s.view(func(tx *sql.Tx) error {
+		var err error
+		wallets, err = queryWallets(tx, chatId)
+		return err
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetChatWallets: %s", err)
+	}
+
+	return wallets, err
+}
+
+func (s *SqliteStorage) GetAccountStats(chatId int64, accountId int64) (*api.AccountStats, error) {
+	stats := new(api.AccountStats)
+	err := s.view(func(tx *sql.Tx) error {
+		return tx.QueryRow(
+			`SELECT
+				coalesce(sum(CASE WHEN from_id = ?1 THEN amount END), 0),
+				count(CASE WHEN from_id = ?1 THEN 1 END),
+				coalesce(sum(CASE WHEN to_id = ?1 THEN amount END), 0),
+				count(CASE WHEN to_id = ?1 THEN 1 END)
+			FROM money_transfers
+			WHERE chat_id = ?2 AND (from_id = ?1 OR to_id = ?1)`,
+			accountId,
+			chatId,
+		).Scan(&stats.Sent, &stats.SentCount, &stats.Received, &stats.ReceivedCount)
+	})
+
+	if err != nil {
+		s.logger.Errorf("error while GetAccountStats: %s", err)
+	}
+
+	return stats, err
+}
@@ -0,0 +1,155 @@
+package storagetest
+
+import (
+	"errors"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	workers    = 8
+	iterations = 25
+)
+
+// runConcurrently calls fn from the workers and fails on the errors other than the expected ones
+func runConcurrently(t *testing.T, fn func(worker int, iteration int) error, expected ...error) {
+	t.Helper()
+	errs := make(chan error, workers*iterations)
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for iteration := 0; iteration < iterations; iteration++ {
+				errs <- fn(worker, iteration)
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil {
+			continue
+		}
+
+		isExpected := false
+		for _, target := range expected {
+			isExpected = isExpected || errors.Is(err, target)
+		}
+
+		if !isExpected {
+			t.Fatalf("unexpected error %s", err)
+		}
+	}
+}
+
+// testConcurrentTransfers moves the coins back and forth, the total is kept and every successful transfer is recorded
+func testConcurrentTransfers(t *testing.T, storage api.Storage) {
+	users := []int64{alice, bob, carol}
+	register(t, storage, chatId, map[int64]int64{alice: 30, bob: 30, carol: 30})
+	var succeeded atomic.Int64
+	runConcurrently(t, func(worker int, iteration int) error {
+		from := users[(worker+iteration)%len(users)]
+		to := users[(worker+iteration+1)%len(users)]
+		err := storage.TransferMoney(chatId, send(from, to, int64(worker+1)))
+		if err == nil {
+			succeeded.Add(1)
+		}
+
+		return err
+	}, api.ErrorInsufficientMoney)
+
+	var total int64
+	for _, userId := range users {
+		balance, err := storage.GetUserBalance(chatId, userId)
+		mustNotFail(t, err)
+		if balance < 0 {
+			t.Fatalf("the balance of %d went negative %d", userId, balance)
+		}
+
+		total += balance
+	}
+
+	if total != 90 {
+		t.Fatalf("expected 90 coins in total, got %d", total)
+	}
+
+	data, err := storage.ExportChat(chatId)
+	mustNotFail(t, err)
+	if int64(len(data.MoneyTransfers)) != succeeded.Load() {
+		t.Fatalf("expected %d ledger records, got %d", succeeded.Load(), len(data.MoneyTransfers))
+	}
+
+	ids := make(map[int64]bool, len(data.MoneyTransfers))
+	for _, transfer := range data.MoneyTransfers {
+		if ids[transfer.Id] {
+			t.Fatalf("the ledger id %d is duplicated", transfer.Id)
+		}
+
+		ids[transfer.Id] = true
+	}
+}
+
+// testConcurrentCredits credits the wallets from the workers while the treasury pays the quests
+func testConcurrentCredits(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 0, bob: 0})
+	runConcurrently(t, func(worker int, iteration int) error {
+		credits := []*api.Credit{{UserId: alice, Amount: 1}, {UserId: bob, Amount: 2}}
+		return storage.CreditUsers(chatId, api.MoneyTransferKindLoot, admin, credits)
+	})
+
+	expectBalance(t, storage, chatId, alice, workers*iterations)
+	expectBalance(t, storage, chatId, bob, 2*workers*iterations)
+	mustNotFail(t, storage.TransferMoney(chatId, send(bob, api.TreasuryAccountId, workers*iterations)))
+
+	var paid atomic.Int64
+	runConcurrently(t, func(worker int, iteration int) error {
+		questId, err := storage.CreateQuest(chatId, api.NewQuest("Rats", 3, admin))
+		if err != nil {
+			return err
+		}
+
+		err = storage.CompleteQuest(chatId, questId, func(quest *api.Quest) ([]*api.Credit, error) {
+			quest.State = api.QuestStateDone
+			return []*api.Credit{{UserId: alice, Amount: quest.Reward}}, nil
+		})
+		if err == nil {
+			paid.Add(3)
+		}
+
+		return err
+	}, api.ErrorInsufficientTreasury)
+
+	expectTreasury(t, storage, chatId, workers*iterations-paid.Load())
+	expectBalance(t, storage, chatId, alice, workers*iterations+paid.Load())
+}
+
+// testConcurrentItems buys and moves the items from the workers, no item is lost or duplicated
+func testConcurrentItems(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 1000, bob: 1000})
+	stock := workers * iterations / 2
+	mustNotFail(t, storage.SaveShopItem(chatId, &api.ShopItem{Name: "Arrow", Price: 1, Stock: stock}))
+	runConcurrently(t, func(worker int, iteration int) error {
+		buyer := []int64{alice, bob}[worker%2]
+		_, err := storage.BuyItem(chatId, buyer, "arrow", 1)
+		if err != nil {
+			return err
+		}
+
+		return storage.MoveItem(chatId, buyer, api.StashOwnerId, "arrow", 1, buyer)
+	}, api.ErrorOutOfStock)
+
+	expectQuantity(t, storage, chatId, api.StashOwnerId, "arrow", stock)
+	expectQuantity(t, storage, chatId, alice, "arrow", 0)
+	expectQuantity(t, storage, chatId, bob, "arrow", 0)
+	balanceAlice, err := storage.GetUserBalance(chatId, alice)
+	mustNotFail(t, err)
+	balanceBob, err := storage.GetUserBalance(chatId, bob)
+	mustNotFail(t, err)
+	if spent := 2000 - balanceAlice - balanceBob; spent != int64(stock) {
+		t.Fatalf("expected %d coins spent, got %d", stock, spent)
+	}
+}
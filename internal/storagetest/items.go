@@ -0,0 +1,360 @@
+package storagetest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testCharacters(t *testing.T, storage api.Storage) {
+	_, err := storage.GetCharacter(chatId, 1)
+	mustFailWith(t, err, api.ErrorNotFound)
+	_, err = storage.GetActiveCharacter(chatId, alice)
+	mustFailWith(t, err, api.ErrorNotFound)
+
+	first := &api.Character{OwnerId: alice, Name: "Aragorn", Level: 1}
+	firstId, err := storage.CreateCharacter(chatId, first)
+	mustNotFail(t, err)
+	secondId, err := storage.CreateCharacter(chatId, &api.Character{OwnerId: alice, Name: "Legolas"})
+	mustNotFail(t, err)
+	_, err = storage.CreateCharacter(chatId, &api.Character{OwnerId: bob, Name: "Gimli"})
+	mustNotFail(t, err)
+	if firstId == 0 || firstId == secondId || first.Id != firstId {
+		t.Fatalf("unexpected ids %d %d", firstId, secondId)
+	}
+
+	// the created character becomes active
+	active, err := storage.GetActiveCharacter(chatId, alice)
+	mustNotFail(t, err)
+	if active.Id != secondId {
+		t.Fatalf("expected active character %d, got %d", secondId, active.Id)
+	}
+
+	characters, err := storage.GetCharacters(chatId, alice)
+	mustNotFail(t, err)
+	if len(characters) != 2 {
+		t.Fatalf("expected 2 characters of alice, got %d", len(characters))
+	}
+
+	mustFailWith(t, storage.SetActiveCharacter(chatId, bob, firstId), api.ErrorNotCharacterOwner)
+	mustNotFail(t, storage.SetActiveCharacter(chatId, alice, firstId))
+	actives, err := storage.GetActiveCharacters(chatId)
+	mustNotFail(t, err)
+	if len(actives) != 2 {
+		t.Fatalf("expected 2 active characters, got %d", len(actives))
+	}
+
+	// the failed update is not saved
+	failure := errors.New("failure")
+	err = storage.UpdateCharacter(chatId, firstId, func(character *api.Character) error {
+		character.Level = 20
+		return failure
+	})
+	mustFailWith(t, err, failure)
+	mustNotFail(t, storage.UpdateCharacter(chatId, firstId, func(character *api.Character) error {
+		character.Level++
+		character.Id = 0
+		return nil
+	}))
+	character, err := storage.GetCharacter(chatId, firstId)
+	mustNotFail(t, err)
+	if character.Level != 2 || character.Id != firstId || character.Name != "Aragorn" {
+		t.Fatalf("unexpected character %+v", character)
+	}
+
+	err = storage.UpdateChatCharacters(chatId, func(character *api.Character) error {
+		if character.OwnerId == bob {
+			return failure
+		}
+
+		character.Level = 10
+		return nil
+	})
+	mustFailWith(t, err, failure)
+	mustNotFail(t, storage.UpdateChatCharacters(chatId, func(character *api.Character) error {
+		character.MaxHp = 7
+		return nil
+	}))
+	characters, err = storage.GetCharacters(chatId, alice)
+	mustNotFail(t, err)
+	for _, character := range characters {
+		if character.MaxHp != 7 || character.Level == 10 {
+			t.Fatalf("unexpected character after the chat update %+v", character)
+		}
+	}
+
+	// deleting the active character leaves the player without one, deleting another one keeps it
+	mustNotFail(t, storage.DeleteCharacter(chatId, secondId))
+	_, err = storage.GetActiveCharacter(chatId, alice)
+	mustNotFail(t, err)
+	mustNotFail(t, storage.DeleteCharacter(chatId, firstId))
+	_, err = storage.GetActiveCharacter(chatId, alice)
+	mustFailWith(t, err, api.ErrorNotFound)
+	mustFailWith(t, storage.DeleteCharacter(chatId, firstId), api.ErrorNotFound)
+	mustFailWith(t, storage.UpdateCharacter(chatId, firstId, func(*api.Character) error { return nil }), api.ErrorNotFound)
+}
+
+func testInventory(t *testing.T, storage api.Storage) {
+	inventory, err := storage.GetInventory(chatId, alice)
+	mustNotFail(t, err)
+	if len(inventory.Items) != 0 {
+		t.Fatalf("expected empty inventory, got %+v", inventory.Items)
+	}
+
+	mustFailWith(t, storage.SetItemQuantity(chatId, alice, "Rope", 1, admin), api.ErrorNotRegistered)
+	register(t, storage, chatId, map[int64]int64{alice: 0, bob: 0})
+	mustNotFail(t, storage.SetItemQuantity(chatId, alice, "Rope", 3, admin))
+	mustNotFail(t, storage.SetItemQuantity(chatId, alice, "Torch", 1, admin))
+	mustFailWith(t, storage.MoveItem(chatId, alice, alice, "rope", 1, alice), api.ErrorInvalidTransactionParameters)
+	mustFailWith(t, storage.MoveItem(chatId, alice, carol, "rope", 1, alice), api.ErrorNotRegistered)
+	mustFailWith(t, storage.MoveItem(chatId, alice, bob, "rope", 4, alice), api.ErrorNotEnoughItems)
+	mustFailWith(t, storage.MoveItem(chatId, bob, alice, "rope", 1, bob), api.ErrorNotEnoughItems)
+
+	// items are matched by ItemKey and keep the name of the sender
+	mustNotFail(t, storage.MoveItem(chatId, alice, bob, "  ROPE ", 2, alice))
+	mustNotFail(t, storage.MoveItem(chatId, alice, api.StashOwnerId, "torch", 1, alice))
+	expectQuantity(t, storage, chatId, alice, "rope", 1)
+	expectQuantity(t, storage, chatId, bob, "rope", 2)
+	expectQuantity(t, storage, chatId, api.StashOwnerId, "torch", 1)
+	inventory, err = storage.GetInventory(chatId, bob)
+	mustNotFail(t, err)
+	if len(inventory.Items) != 1 || inventory.Items[0].Name != "Rope" {
+		t.Fatalf("unexpected inventory %+v", inventory.Items)
+	}
+
+	inventory, err = storage.GetInventory(chatId, alice)
+	mustNotFail(t, err)
+	if len(inventory.Items) != 1 {
+		t.Fatalf("the items ran out are kept %+v", inventory.Items)
+	}
+
+	mustFailWith(t, storage.SetItemQuantity(chatId, alice, "Rope", api.ItemMaxQuantity+1, admin), api.ErrorItemQuantityOverflow)
+	mustNotFail(t, storage.SetItemQuantity(chatId, alice, "Rope", 0, admin))
+	expectQuantity(t, storage, chatId, alice, "rope", 0)
+
+	transfers, err := storage.GetItemTransfers(chatId, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 5 || transfers[0].Kind != api.ItemTransferKindSet || transfers[0].Quantity != 0 ||
+		transfers[1].Kind != api.ItemTransferKindMove || transfers[1].ToId != api.StashOwnerId {
+		t.Fatalf("unexpected item transfers %+v", transfers)
+	}
+
+	transfers, err = storage.GetItemTransfers(chatId, 1)
+	mustNotFail(t, err)
+	if len(transfers) != 1 {
+		t.Fatalf("the limit is not applied %+v", transfers)
+	}
+}
+
+func testShop(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 10})
+	mustNotFail(t, storage.SaveShopItem(chatId, &api.ShopItem{Name: "Rope", Price: 3, Stock: 2}))
+	mustNotFail(t, storage.SaveShopItem(chatId, &api.ShopItem{Name: "Torch", Price: 1, Stock: api.ShopUnlimitedStock}))
+	mustNotFail(t, storage.SaveShopItem(chatId, &api.ShopItem{Name: "rope", Price: 4, Stock: 2}))
+	items, err := storage.GetShopItems(chatId)
+	mustNotFail(t, err)
+	if len(items) != 2 {
+		t.Fatalf("the item with the same key is not replaced %+v", items)
+	}
+
+	_, err = storage.BuyItem(chatId, alice, "lantern", 1)
+	mustFailWith(t, err, api.ErrorNotFound)
+	_, err = storage.BuyItem(chatId, alice, "rope", 3)
+	mustFailWith(t, err, api.ErrorOutOfStock)
+	_, err = storage.BuyItem(chatId, bob, "rope", 1)
+	mustFailWith(t, err, api.ErrorNotRegistered)
+
+	item, err := storage.BuyItem(chatId, alice, "ROPE", 2)
+	mustNotFail(t, err)
+	if item.Name != "rope" || item.Stock != 0 {
+		t.Fatalf("unexpected bought item %+v", item)
+	}
+
+	expectBalance(t, storage, chatId, alice, 2)
+	expectQuantity(t, storage, chatId, alice, "rope", 2)
+	_, err = storage.BuyItem(chatId, alice, "torch", 3)
+	mustFailWith(t, err, api.ErrorInsufficientMoney)
+	expectBalance(t, storage, chatId, alice, 2)
+	expectQuantity(t, storage, chatId, alice, "torch", 0)
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 1 || transfers[0].Kind != api.MoneyTransferKindBuy || transfers[0].ToId != api.ExternalAccountId || transfers[0].Amount != 8 {
+		t.Fatalf("unexpected ledger %+v", transfers)
+	}
+
+	mustFailWith(t, storage.DeleteShopItem(chatId, "lantern"), api.ErrorNotFound)
+	mustNotFail(t, storage.DeleteShopItem(chatId, "TORCH"))
+	items, err = storage.GetShopItems(chatId)
+	mustNotFail(t, err)
+	if len(items) != 1 || items[0].Name != "rope" {
+		t.Fatalf("unexpected shop items %+v", items)
+	}
+}
+
+func testQuests(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 0, bob: 50})
+	questId, err := storage.CreateQuest(chatId, api.NewQuest("Rats in the cellar", 30, admin))
+	mustNotFail(t, err)
+	mustFailWith(t, storage.UpdateQuest(chatId, questId+1, func(*api.Quest) error { return nil }), api.ErrorNotFound)
+	mustNotFail(t, storage.UpdateQuest(chatId, questId, func(quest *api.Quest) error {
+		quest.State = api.QuestStateTaken
+		quest.TakenBy = append(quest.TakenBy, alice)
+		return nil
+	}))
+
+	complete := func(quest *api.Quest) ([]*api.Credit, error) {
+		quest.State = api.QuestStateDone
+		return []*api.Credit{{UserId: alice, Amount: quest.Reward}}, nil
+	}
+
+	// the treasury can't pay, the quest stays taken
+	mustFailWith(t, storage.CompleteQuest(chatId, questId, complete), api.ErrorInsufficientTreasury)
+	quests, err := storage.GetQuests(chatId)
+	mustNotFail(t, err)
+	if len(quests) != 1 || quests[0].State != api.QuestStateTaken || len(quests[0].TakenBy) != 1 {
+		t.Fatalf("unexpected quests %+v", quests)
+	}
+
+	mustNotFail(t, storage.TransferMoney(chatId, send(bob, api.TreasuryAccountId, 50)))
+	mustNotFail(t, storage.CompleteQuest(chatId, questId, complete))
+	expectBalance(t, storage, chatId, alice, 30)
+	expectTreasury(t, storage, chatId, 20)
+	quests, err = storage.GetQuests(chatId)
+	mustNotFail(t, err)
+	if quests[0].State != api.QuestStateDone {
+		t.Fatalf("the quest is not completed %+v", quests[0])
+	}
+
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 1 || transfers[0].Kind != api.MoneyTransferKindQuest || transfers[0].ActorId != admin {
+		t.Fatalf("unexpected ledger %+v", transfers)
+	}
+}
+
+func testPendingTransfers(t *testing.T, storage api.Storage) {
+	now := time.Now()
+	expiredId, err := storage.CreatePendingTransfer(chatId, &api.PendingTransfer{
+		Kind: api.MoneyTransferKindSend, FromId: alice, ToId: bob, ActorId: alice, Amount: 1, ExpiresAt: now.Add(-time.Minute),
+	})
+	mustNotFail(t, err)
+	activeId, err := storage.CreatePendingTransfer(chatId, &api.PendingTransfer{
+		Kind: api.MoneyTransferKindSend, FromId: alice, ToId: bob, ActorId: alice, Amount: 2, ExpiresAt: now.Add(time.Minute),
+	})
+	mustNotFail(t, err)
+	if expiredId == activeId {
+		t.Fatalf("pending transfers have the same id %d", activeId)
+	}
+
+	transfer, err := storage.GetPendingTransfer(chatId, activeId)
+	mustNotFail(t, err)
+	if transfer.Amount != 2 || transfer.Id != activeId || !transfer.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected pending transfer %+v", transfer)
+	}
+
+	_, err = storage.GetPendingTransfer(otherChatId, activeId)
+	mustFailWith(t, err, api.ErrorNotFound)
+	mustNotFail(t, storage.DeleteExpiredPendingTransfers(chatId, now))
+	_, err = storage.GetPendingTransfer(chatId, expiredId)
+	mustFailWith(t, err, api.ErrorNotFound)
+
+	_, err = storage.TakePendingTransfer(chatId, activeId)
+	mustNotFail(t, err)
+	_, err = storage.TakePendingTransfer(chatId, activeId)
+	mustFailWith(t, err, api.ErrorNotFound)
+}
+
+// fillChat stores a bit of everything in the chat
+func fillChat(t *testing.T, storage api.Storage, chatId int64) {
+	t.Helper()
+	register(t, storage, chatId, map[int64]int64{alice: 100, bob: -5})
+	mustNotFail(t, storage.SaveChatSettings(chatId, &api.ChatSettings{CreditLimit: 10}))
+	mustNotFail(t, storage.TransferMoney(chatId, send(alice, api.TreasuryAccountId, 20)))
+	_, err := storage.CreateCharacter(chatId, &api.Character{OwnerId: alice, Name: "Aragorn", Abilities: map[string]int{"str": 15}})
+	mustNotFail(t, err)
+	mustNotFail(t, storage.SetItemQuantity(chatId, alice, "Rope", 2, admin))
+	mustNotFail(t, storage.MoveItem(chatId, alice, api.StashOwnerId, "rope", 1, alice))
+	mustNotFail(t, storage.SaveShopItem(chatId, &api.ShopItem{Name: "Torch", Price: 1, Stock: 5}))
+	_, err = storage.CreateQuest(chatId, api.NewQuest("Rats", 5, admin))
+	mustNotFail(t, err)
+}
+
+func testExportImport(t *testing.T, storage api.Storage) {
+	fillChat(t, storage, chatId)
+	data, err := storage.ExportChat(chatId)
+	mustNotFail(t, err)
+	if data.Treasury != 20 || len(data.Wallets) != 2 || len(data.Characters) != 1 || len(data.ActiveCharacters) != 1 ||
+		len(data.Inventories) != 2 || len(data.ShopItems) != 1 || len(data.Quests) != 1 ||
+		len(data.MoneyTransfers) != 1 || len(data.ItemTransfers) != 2 || data.Settings.CreditLimit != 10 {
+		t.Fatalf("unexpected export %+v", data)
+	}
+
+	exported, err := json.Marshal(data)
+	mustNotFail(t, err)
+
+	// the import replaces everything stored for the chat
+	register(t, storage, otherChatId, map[int64]int64{carol: 1})
+	mustNotFail(t, storage.ImportChat(otherChatId, data))
+	registered, err := storage.IsRegistered(otherChatId, carol)
+	mustNotFail(t, err)
+	if registered {
+		t.Fatalf("the wallet of the chat is kept after the import")
+	}
+
+	imported, err := storage.ExportChat(otherChatId)
+	mustNotFail(t, err)
+	reexported, err := json.Marshal(imported)
+	mustNotFail(t, err)
+	if string(exported) != string(reexported) {
+		t.Fatalf("the import changed the data\n%s\n%s", exported, reexported)
+	}
+
+	// the new records don't reuse the imported ids
+	characterId, err := storage.CreateCharacter(otherChatId, &api.Character{OwnerId: bob, Name: "Gimli"})
+	mustNotFail(t, err)
+	if characterId <= data.Characters[0].Id {
+		t.Fatalf("the character id %d is reused", characterId)
+	}
+
+	transfer := send(alice, bob, 1)
+	mustNotFail(t, storage.TransferMoney(otherChatId, transfer))
+	if transfer.Id <= data.MoneyTransfers[0].Id {
+		t.Fatalf("the ledger id %d is reused", transfer.Id)
+	}
+}
+
+func testChatIsolation(t *testing.T, storage api.Storage) {
+	fillChat(t, storage, chatId)
+	_, err := storage.GetUserBalance(otherChatId, alice)
+	mustFailWith(t, err, api.ErrorNotRegistered)
+	data, err := storage.ExportChat(otherChatId)
+	mustNotFail(t, err)
+	if data.Treasury != 0 || len(data.Wallets) != 0 || len(data.Characters) != 0 || len(data.Inventories) != 0 ||
+		len(data.ShopItems) != 0 || len(data.Quests) != 0 || len(data.MoneyTransfers) != 0 || len(data.ItemTransfers) != 0 {
+		t.Fatalf("the data leaked to another chat %+v", data)
+	}
+
+	// emptying another chat keeps the chat
+	mustNotFail(t, storage.ImportChat(otherChatId, &api.ChatData{Settings: new(api.ChatSettings)}))
+	expectBalance(t, storage, chatId, alice, 80)
+	expectQuantity(t, storage, chatId, api.StashOwnerId, "rope", 1)
+}
+
+func testChatIds(t *testing.T, storage api.Storage) {
+	chatIds, err := storage.ChatIds()
+	mustNotFail(t, err)
+	if len(chatIds) != 0 {
+		t.Fatalf("unexpected chats %v of the empty storage", chatIds)
+	}
+
+	fillChat(t, storage, chatId)
+	mustNotFail(t, storage.SaveChatSettings(otherChatId, &api.ChatSettings{CreditLimit: 1}))
+	chatIds, err = storage.ChatIds()
+	mustNotFail(t, err)
+	if !slices.Equal(chatIds, []int64{otherChatId, chatId}) {
+		t.Fatalf("unexpected chats %v", chatIds)
+	}
+}
@@ -0,0 +1,303 @@
+package storagetest
+
+import (
+	"github.com/Refreezer/dnd-util-bot/api"
+	"slices"
+	"testing"
+)
+
+func testBalances(t *testing.T, storage api.Storage) {
+	_, err := storage.GetUserBalance(chatId, alice)
+	mustFailWith(t, err, api.ErrorNotRegistered)
+	registered, err := storage.IsRegistered(chatId, alice)
+	mustNotFail(t, err)
+	if registered {
+		t.Fatalf("user without a wallet is registered")
+	}
+
+	register(t, storage, chatId, map[int64]int64{alice: 0})
+	registered, err = storage.IsRegistered(chatId, alice)
+	mustNotFail(t, err)
+	if !registered {
+		t.Fatalf("user with a wallet is not registered")
+	}
+
+	expectBalance(t, storage, chatId, alice, 0)
+	register(t, storage, chatId, map[int64]int64{alice: -api.MaxBalance})
+	expectBalance(t, storage, chatId, alice, -api.MaxBalance)
+	register(t, storage, chatId, map[int64]int64{alice: api.MaxBalance})
+	expectBalance(t, storage, chatId, alice, api.MaxBalance)
+	mustFailWith(t, storage.SetUserBalance(chatId, alice, api.MaxBalance+1), api.ErrorBalanceOverflow)
+	mustFailWith(t, storage.SetUserBalance(chatId, alice, -api.MaxBalance-1), api.ErrorBalanceOverflow)
+	expectBalance(t, storage, chatId, alice, api.MaxBalance)
+}
+
+func testUserNames(t *testing.T, storage api.Storage) {
+	_, ok := storage.GetIdByUserName("alice")
+	if ok {
+		t.Fatalf("unknown user name is found")
+	}
+
+	_, ok = storage.GetUserNameById(alice)
+	if ok {
+		t.Fatalf("unknown user id is found")
+	}
+
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice", alice))
+	userId, ok := storage.GetIdByUserName("alice")
+	if !ok || userId != alice {
+		t.Fatalf("expected id %d of alice, got %d", alice, userId)
+	}
+
+	// the user renamed, the new name points to the user and the old one is forgotten
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice_the_brave", alice))
+	userName, ok := storage.GetUserNameById(alice)
+	if !ok || userName != "alice_the_brave" {
+		t.Fatalf("expected alice_the_brave, got %q", userName)
+	}
+
+	userId, ok = storage.GetIdByUserName("alice_the_brave")
+	if !ok || userId != alice {
+		t.Fatalf("expected id %d of alice_the_brave, got %d", alice, userId)
+	}
+
+	_, ok = storage.GetIdByUserName("alice")
+	if ok {
+		t.Fatalf("the old name of the renamed user is found")
+	}
+
+	// the name went to another user
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice", bob))
+	userId, ok = storage.GetIdByUserName("alice")
+	if !ok || userId != bob {
+		t.Fatalf("expected id %d of alice, got %d", bob, userId)
+	}
+
+	// the old name taken by another user stays with them when the previous owner renames
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice_the_brave", carol))
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice_the_wise", alice))
+	userId, ok = storage.GetIdByUserName("alice_the_brave")
+	if !ok || userId != carol {
+		t.Fatalf("expected id %d of alice_the_brave, got %d", carol, userId)
+	}
+}
+
+func testChatMembers(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 1, bob: 2})
+	register(t, storage, otherChatId, map[int64]int64{carol: 3})
+	mustNotFail(t, storage.SaveUserNameToUserIdMapping("alice", alice))
+	mustNotFail(t, storage.TransferMoney(chatId, &api.MoneyTransfer{
+		Kind:    api.MoneyTransferKindDeposit,
+		FromId:  alice,
+		ToId:    api.TreasuryAccountId,
+		ActorId: alice,
+		Amount:  1,
+	}))
+
+	members, err := storage.GetChatMembers(chatId)
+	mustNotFail(t, err)
+	slices.SortFunc(members, func(a, b *api.Member) int { return int(a.UserId - b.UserId) })
+	if len(members) != 2 || members[0].UserId != alice || members[0].UserName != "alice" || members[1].UserId != bob {
+		t.Fatalf("unexpected members %+v %+v", members[0], members[1:])
+	}
+}
+
+func testConversations(t *testing.T, storage api.Storage) {
+	_, err := storage.GetConversation(chatId, alice)
+	mustFailWith(t, err, api.ErrorNotFound)
+	conv := &api.Conversation{Flow: "flow", Step: "step", Data: map[string]string{"key": "value"}}
+	mustNotFail(t, storage.SaveConversation(chatId, alice, conv))
+	conv.Data["key"] = "changed"
+	saved, err := storage.GetConversation(chatId, alice)
+	mustNotFail(t, err)
+	if saved.Flow != "flow" || saved.Step != "step" || saved.Data["key"] != "value" {
+		t.Fatalf("unexpected conversation %+v", saved)
+	}
+
+	_, err = storage.GetConversation(otherChatId, alice)
+	mustFailWith(t, err, api.ErrorNotFound)
+	mustNotFail(t, storage.DeleteConversation(chatId, alice))
+	_, err = storage.GetConversation(chatId, alice)
+	mustFailWith(t, err, api.ErrorNotFound)
+	mustNotFail(t, storage.DeleteConversation(chatId, alice))
+}
+
+func send(fromId int64, toId int64, amount int64) *api.MoneyTransfer {
+	return &api.MoneyTransfer{
+		Kind:    api.MoneyTransferKindSend,
+		FromId:  fromId,
+		ToId:    toId,
+		ActorId: fromId,
+		Amount:  amount,
+	}
+}
+
+func testTransferMoney(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 100, bob: 0})
+	mustFailWith(t, storage.TransferMoney(chatId, send(alice, alice, 10)), api.ErrorInvalidTransactionParameters)
+	mustFailWith(t, storage.TransferMoney(chatId, send(alice, carol, 10)), api.ErrorNotRegistered)
+	mustFailWith(t, storage.TransferMoney(chatId, send(carol, alice, 10)), api.ErrorNotRegistered)
+	mustFailWith(t, storage.TransferMoney(chatId, send(alice, bob, 101)), api.ErrorInsufficientMoney)
+	expectBalance(t, storage, chatId, alice, 100)
+	expectBalance(t, storage, chatId, bob, 0)
+
+	transfer := send(alice, bob, 100)
+	mustNotFail(t, storage.TransferMoney(chatId, transfer))
+	if transfer.Id == 0 || transfer.Time.IsZero() {
+		t.Fatalf("the transfer is not recorded %+v", transfer)
+	}
+
+	expectBalance(t, storage, chatId, alice, 0)
+	expectBalance(t, storage, chatId, bob, 100)
+
+	// the treasury wallet appears on the first deposit and never goes in debt
+	expectTreasury(t, storage, chatId, 0)
+	mustFailWith(t, storage.TransferMoney(chatId, send(api.TreasuryAccountId, bob, 1)), api.ErrorInsufficientTreasury)
+	mustNotFail(t, storage.TransferMoney(chatId, send(bob, api.TreasuryAccountId, 40)))
+	expectTreasury(t, storage, chatId, 40)
+	mustNotFail(t, storage.TransferMoney(chatId, send(api.TreasuryAccountId, alice, 40)))
+	expectTreasury(t, storage, chatId, 0)
+	expectBalance(t, storage, chatId, alice, 40)
+
+	// the recipient wallet can't overflow, nothing is changed then
+	register(t, storage, chatId, map[int64]int64{carol: api.MaxBalance})
+	mustFailWith(t, storage.TransferMoney(chatId, send(alice, carol, 1)), api.ErrorBalanceOverflow)
+	expectBalance(t, storage, chatId, alice, 40)
+	expectBalance(t, storage, chatId, carol, api.MaxBalance)
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 2 {
+		t.Fatalf("failed transfers are recorded %d", len(transfers))
+	}
+}
+
+func testCreditLimit(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 10, bob: 0})
+	mustNotFail(t, storage.SaveChatSettings(chatId, &api.ChatSettings{CreditLimit: 50}))
+	mustNotFail(t, storage.TransferMoney(chatId, send(alice, bob, 60)))
+	expectBalance(t, storage, chatId, alice, -50)
+	mustFailWith(t, storage.TransferMoney(chatId, send(alice, bob, 1)), api.ErrorInsufficientMoney)
+
+	// the credit limit of the chat doesn't apply to the treasury
+	mustFailWith(t, storage.TransferMoney(chatId, send(api.TreasuryAccountId, bob, 1)), api.ErrorInsufficientTreasury)
+
+	// the credit limit is per chat
+	register(t, storage, otherChatId, map[int64]int64{alice: 0, bob: 0})
+	mustFailWith(t, storage.TransferMoney(otherChatId, send(alice, bob, 1)), api.ErrorInsufficientMoney)
+}
+
+func testCreditUsers(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 0, bob: api.MaxBalance - 5})
+	credits := []*api.Credit{{UserId: alice, Amount: 10}, {UserId: carol, Amount: 10}}
+	mustFailWith(t, storage.CreditUsers(chatId, api.MoneyTransferKindLoot, admin, credits), api.ErrorNotRegistered)
+	expectBalance(t, storage, chatId, alice, 0)
+
+	credits = []*api.Credit{{UserId: alice, Amount: 10}, {UserId: bob, Amount: 10}}
+	mustFailWith(t, storage.CreditUsers(chatId, api.MoneyTransferKindLoot, admin, credits), api.ErrorBalanceOverflow)
+	expectBalance(t, storage, chatId, alice, 0)
+
+	credits = []*api.Credit{{UserId: alice, Amount: 10}, {UserId: bob, Amount: 5}}
+	mustNotFail(t, storage.CreditUsers(chatId, api.MoneyTransferKindLoot, admin, credits))
+	expectBalance(t, storage, chatId, alice, 10)
+	expectBalance(t, storage, chatId, bob, api.MaxBalance)
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 1 || transfers[0].FromId != api.ExternalAccountId || transfers[0].ActorId != admin ||
+		transfers[0].Kind != api.MoneyTransferKindLoot || transfers[0].Amount != 10 {
+		t.Fatalf("unexpected ledger %+v", transfers)
+	}
+}
+
+func testMoneyTransfers(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 100, bob: 100, carol: 100})
+	mustNotFail(t, storage.TransferMoney(chatId, send(alice, bob, 1)))
+	mustNotFail(t, storage.TransferMoney(chatId, send(bob, carol, 2)))
+	mustNotFail(t, storage.TransferMoney(chatId, send(carol, alice, 3)))
+	mustNotFail(t, storage.TransferMoney(chatId, send(alice, carol, 4)))
+
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	mustNotFail(t, err)
+	amounts := make([]int64, 0, len(transfers))
+	for _, transfer := range transfers {
+		amounts = append(amounts, transfer.Amount)
+	}
+
+	if !slices.Equal(amounts, []int64{4, 3, 1}) {
+		t.Fatalf("expected the ledger of alice newest first, got %v", amounts)
+	}
+
+	transfers, err = storage.GetMoneyTransfers(chatId, alice, 2)
+	mustNotFail(t, err)
+	if len(transfers) != 2 || transfers[0].Amount != 4 || transfers[1].Amount != 3 {
+		t.Fatalf("the limit is not applied %+v", transfers)
+	}
+
+	transfers, err = storage.GetMoneyTransfers(chatId, admin, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 0 {
+		t.Fatalf("unexpected ledger of the account without transfers %+v", transfers)
+	}
+
+	register(t, storage, otherChatId, map[int64]int64{alice: 100, bob: 100})
+	mustNotFail(t, storage.TransferMoney(otherChatId, send(alice, bob, 5)))
+	transfers, err = storage.GetChatMoneyTransfers(chatId, 3)
+	mustNotFail(t, err)
+	amounts = amounts[:0]
+	for _, transfer := range transfers {
+		amounts = append(amounts, transfer.Amount)
+	}
+
+	if !slices.Equal(amounts, []int64{4, 3, 2}) {
+		t.Fatalf("expected the ledger of the chat newest first, got %v", amounts)
+	}
+}
+
+func testWealth(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 100, bob: 50})
+	mustNotFail(t, storage.TransferMoney(chatId, send(alice, api.TreasuryAccountId, 30)))
+	mustNotFail(t, storage.TransferMoney(chatId, send(alice, bob, 20)))
+	mustNotFail(t, storage.TransferMoney(chatId, send(bob, alice, 5)))
+
+	wallets, err := storage.GetChatWallets(chatId)
+	mustNotFail(t, err)
+	slices.SortFunc(wallets, func(a, b *api.Wallet) int { return int(a.UserId - b.UserId) })
+	if len(wallets) != 2 || wallets[0].UserId != alice || wallets[0].Balance != 55 || wallets[1].Balance != 65 {
+		t.Fatalf("unexpected wallets %+v", wallets)
+	}
+
+	stats, err := storage.GetAccountStats(chatId, alice)
+	mustNotFail(t, err)
+	expected := api.AccountStats{Sent: 50, SentCount: 2, Received: 5, ReceivedCount: 1}
+	if *stats != expected {
+		t.Fatalf("expected stats %+v, got %+v", expected, *stats)
+	}
+
+	stats, err = storage.GetAccountStats(chatId, api.TreasuryAccountId)
+	mustNotFail(t, err)
+	expected = api.AccountStats{Received: 30, ReceivedCount: 1}
+	if *stats != expected {
+		t.Fatalf("expected treasury stats %+v, got %+v", expected, *stats)
+	}
+}
+
+func testChatSettings(t *testing.T, storage api.Storage) {
+	settings, err := storage.GetChatSettings(chatId)
+	mustNotFail(t, err)
+	if *settings != (api.ChatSettings{}) {
+		t.Fatalf("expected zero settings, got %+v", settings)
+	}
+
+	saved := &api.ChatSettings{SendConfirmThreshold: 1, TransactionConfirmThreshold: 2, CreditLimit: 3}
+	mustNotFail(t, storage.SaveChatSettings(chatId, saved))
+	settings, err = storage.GetChatSettings(chatId)
+	mustNotFail(t, err)
+	if *settings != *saved {
+		t.Fatalf("expected settings %+v, got %+v", saved, settings)
+	}
+
+	settings, err = storage.GetChatSettings(otherChatId)
+	mustNotFail(t, err)
+	if *settings != (api.ChatSettings{}) {
+		t.Fatalf("settings leaked to another chat %+v", settings)
+	}
+}
@@ -0,0 +1,121 @@
+// Package storagetest is the conformance suite every api.Storage implementation has to pass,
+// the backends run it from their tests:
+//
+//	func TestStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) api.Storage {
+//			storage, closeDb := boltStorage.NewBoltStorage(provider, filepath.Join(t.TempDir(), "db"))
+//			t.Cleanup(closeDb)
+//			return storage
+//		})
+//	}
+package storagetest
+
+import (
+	"errors"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"testing"
+)
+
+const (
+	chatId      int64 = -100
+	otherChatId int64 = -200
+	alice       int64 = 10
+	bob         int64 = 11
+	carol       int64 = 12
+	admin       int64 = 13
+)
+
+type (
+	// Factory returns an empty storage, the test registers the cleanup closing it
+	Factory func(t *testing.T) api.Storage
+
+	test struct {
+		name string
+		run  func(t *testing.T, storage api.Storage)
+	}
+)
+
+var (
+	tests = []test{
+		{"Balances", testBalances},
+		{"UserNames", testUserNames},
+		{"ChatMembers", testChatMembers},
+		{"Conversations", testConversations},
+		{"TransferMoney", testTransferMoney},
+		{"CreditLimit", testCreditLimit},
+		{"CreditUsers", testCreditUsers},
+		{"MoneyTransfers", testMoneyTransfers},
+		{"Wealth", testWealth},
+		{"Characters", testCharacters},
+		{"Inventory", testInventory},
+		{"Shop", testShop},
+		{"Quests", testQuests},
+		{"ChatSettings", testChatSettings},
+		{"PendingTransfers", testPendingTransfers},
+		{"ExportImport", testExportImport},
+		{"ChatIsolation", testChatIsolation},
+		{"ChatIds", testChatIds},
+		{"Transactions", testTransactions},
+		{"ConcurrentTransfers", testConcurrentTransfers},
+		{"ConcurrentCredits", testConcurrentCredits},
+		{"ConcurrentItems", testConcurrentItems},
+		{"ConcurrentTransactions", testConcurrentTransactions},
+	}
+)
+
+// Run runs every test of the suite against the new storage made by newStorage
+func Run(t *testing.T, newStorage Factory) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, newStorage(t))
+		})
+	}
+}
+
+func mustNotFail(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+}
+
+func mustFailWith(t *testing.T, err error, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("expected error %q, got %v", target, err)
+	}
+}
+
+func register(t *testing.T, storage api.Storage, chatId int64, balances map[int64]int64) {
+	t.Helper()
+	for userId, balance := range balances {
+		mustNotFail(t, storage.SetUserBalance(chatId, userId, balance))
+	}
+}
+
+func expectBalance(t *testing.T, storage api.Storage, chatId int64, userId int64, expected int64) {
+	t.Helper()
+	balance, err := storage.GetUserBalance(chatId, userId)
+	mustNotFail(t, err)
+	if balance != expected {
+		t.Fatalf("expected balance %d of %d, got %d", expected, userId, balance)
+	}
+}
+
+func expectTreasury(t *testing.T, storage api.Storage, chatId int64, expected int64) {
+	t.Helper()
+	balance, err := storage.GetTreasuryBalance(chatId)
+	mustNotFail(t, err)
+	if balance != expected {
+		t.Fatalf("expected treasury %d, got %d", expected, balance)
+	}
+}
+
+func expectQuantity(t *testing.T, storage api.Storage, chatId int64, ownerId int64, item string, expected int) {
+	t.Helper()
+	inventory, err := storage.GetInventory(chatId, ownerId)
+	mustNotFail(t, err)
+	if quantity := inventory.Quantity(item); quantity != expected {
+		t.Fatalf("expected %d %q of %d, got %d", expected, item, ownerId, quantity)
+	}
+}
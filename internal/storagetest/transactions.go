@@ -0,0 +1,124 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/Refreezer/dnd-util-bot/api"
+	"testing"
+)
+
+var (
+	errAbort = errors.New("abort")
+)
+
+// testTransactions commits the changes of WithTx all at once and rolls them back on the error or the canceled context
+func testTransactions(t *testing.T, storage api.Storage) {
+	register(t, storage, chatId, map[int64]int64{alice: 100, bob: 0})
+	err := storage.WithTx(context.Background(), func(tx api.StorageTx) error {
+		mustNotFail(t, tx.TransferMoney(chatId, send(alice, bob, 30)))
+		// the changes are visible inside the transaction
+		balance, err := tx.GetUserBalance(chatId, bob)
+		mustNotFail(t, err)
+		if balance != 30 {
+			t.Fatalf("expected balance 30 inside the transaction, got %d", balance)
+		}
+
+		_, err = tx.CreateQuest(chatId, api.NewQuest("Rats", 3, admin))
+		return err
+	})
+	mustNotFail(t, err)
+	expectBalance(t, storage, chatId, alice, 70)
+	expectBalance(t, storage, chatId, bob, 30)
+	quests, err := storage.GetQuests(chatId)
+	mustNotFail(t, err)
+	if len(quests) != 1 {
+		t.Fatalf("expected 1 quest, got %d", len(quests))
+	}
+
+	err = storage.WithTx(context.Background(), func(tx api.StorageTx) error {
+		mustNotFail(t, tx.TransferMoney(chatId, send(alice, bob, 30)))
+		mustNotFail(t, tx.SetUserBalance(chatId, carol, 5))
+		// the import deletes everything stored for the chat first
+		data, err := tx.ExportChat(chatId)
+		mustNotFail(t, err)
+		data.Wallets = nil
+		data.Quests = nil
+		mustNotFail(t, tx.ImportChat(chatId, data))
+		return errAbort
+	})
+	mustFailWith(t, err, errAbort)
+	expectBalance(t, storage, chatId, alice, 70)
+	expectBalance(t, storage, chatId, bob, 30)
+	quests, err = storage.GetQuests(chatId)
+	mustNotFail(t, err)
+	if len(quests) != 1 {
+		t.Fatalf("expected 1 quest after the rollback, got %d", len(quests))
+	}
+
+	registered, err := storage.IsRegistered(chatId, carol)
+	mustNotFail(t, err)
+	if registered {
+		t.Fatalf("the wallet of the rolled back transaction is registered")
+	}
+
+	transfers, err := storage.GetMoneyTransfers(chatId, alice, 10)
+	mustNotFail(t, err)
+	if len(transfers) != 1 {
+		t.Fatalf("expected 1 ledger record, got %d", len(transfers))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err = storage.WithTx(ctx, func(tx api.StorageTx) error {
+		called = true
+		return nil
+	})
+	mustFailWith(t, err, context.Canceled)
+	if called {
+		t.Fatalf("the transaction is started with the canceled context")
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = storage.WithTx(ctx, func(tx api.StorageTx) error {
+		mustNotFail(t, tx.TransferMoney(chatId, send(alice, bob, 30)))
+		cancel()
+		return nil
+	})
+	mustFailWith(t, err, context.Canceled)
+	expectBalance(t, storage, chatId, alice, 70)
+	expectBalance(t, storage, chatId, bob, 30)
+}
+
+// testConcurrentTransactions withdraws the coins checking the balance first, the check holds since it's in the transaction
+func testConcurrentTransactions(t *testing.T, storage api.Storage) {
+	stock := int64(workers * iterations / 2)
+	register(t, storage, chatId, map[int64]int64{alice: stock, bob: 0})
+	runConcurrently(t, func(worker int, iteration int) error {
+		return storage.WithTx(context.Background(), func(tx api.StorageTx) error {
+			balance, err := tx.GetUserBalance(chatId, alice)
+			if err != nil {
+				return err
+			}
+
+			if balance == 0 {
+				return api.ErrorInsufficientMoney
+			}
+
+			err = tx.SetUserBalance(chatId, alice, balance-1)
+			if err != nil {
+				return err
+			}
+
+			balance, err = tx.GetUserBalance(chatId, bob)
+			if err != nil {
+				return err
+			}
+
+			return tx.SetUserBalance(chatId, bob, balance+1)
+		})
+	}, api.ErrorInsufficientMoney)
+
+	expectBalance(t, storage, chatId, alice, 0)
+	expectBalance(t, storage, chatId, bob, stock)
+}
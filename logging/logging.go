@@ -1,16 +1,79 @@
 package logging
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/op/go-logging"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	module = "cherry-check"
+	module = "dnd-util-bot"
+
+	// FormatText is the human readable format, the default one
+	FormatText = "text"
+	// FormatJson writes every line as the json object for the log aggregator
+	FormatJson = "json"
+
+	textTimeLayout = "15:04:05.000"
 )
 
-// Logger is the logger instance for the cherry-check module.
-var Logger = logging.MustGetLogger(module)
+type (
+	// Fields are the fields of the update every log line written while handling the update carries
+	Fields struct {
+		UpdateId int    `json:"updateId,omitempty"`
+		ChatId   int64  `json:"chatId,omitempty"`
+		UserId   int64  `json:"userId,omitempty"`
+		Command  string `json:"command,omitempty"`
+		// Start is the time the handling started, the lines carry the duration since then
+		Start time.Time `json:"-"`
+	}
+
+	fieldsKey struct{}
+
+	// backend writes the records to stdout in the selected format with the fields if there are any
+	backend struct {
+		fields *Fields
+	}
+
+	jsonRecord struct {
+		Time    time.Time `json:"time"`
+		Level   string    `json:"level"`
+		Module  string    `json:"module"`
+		Message string    `json:"message"`
+		*Fields
+		DurationMs *float64 `json:"durationMs,omitempty"`
+	}
+)
+
+var (
+	// Logger is the logger instance for the dnd-util-bot module.
+	Logger = logging.MustGetLogger(module)
+
+	// jsonFormat is set by SetFormat, it can be changed while the loggers are used
+	jsonFormat atomic.Bool
+	// level is the level of the last InitLogger, the loggers of FromContext have it
+	level       = logging.INFO
+	output      = io.Writer(os.Stdout)
+	outputMutex sync.Mutex
+)
+
+// SetFormat selects FormatText or FormatJson for every logger
+func SetFormat(f string) error {
+	switch f {
+	case FormatText, FormatJson:
+		jsonFormat.Store(f == FormatJson)
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %s, use %s or %s", f, FormatText, FormatJson)
+	}
+}
 
 // InitGlobalLogger initializes the logger with the specified log level.
 // If debug is true, the log level is set to DEBUG; otherwise, it is set to INFO.
@@ -19,19 +82,106 @@ func InitGlobalLogger(debug bool) {
 }
 
 func InitLogger(debug bool, logger *logging.Logger) {
-	var logLevel logging.Level
+	level = logging.INFO
 	if debug {
-		logLevel = logging.DEBUG
+		level = logging.DEBUG
+	}
+
+	logger.SetBackend(newLeveledBackend(level, nil))
+}
+
+// WithFields returns the context the loggers of FromContext take the fields from
+func WithFields(ctx context.Context, fields *Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// FieldsFromContext returns the fields of WithFields, they can be changed while handling the update, e.g. the command
+func FieldsFromContext(ctx context.Context) (*Fields, bool) {
+	fields, ok := ctx.Value(fieldsKey{}).(*Fields)
+	return fields, ok
+}
+
+// FromContext returns the logger of the same module writing the fields of ctx, it's the logger if there are none
+func FromContext(ctx context.Context, logger *logging.Logger) *logging.Logger {
+	fields, ok := FieldsFromContext(ctx)
+	if !ok {
+		return logger
+	}
+
+	contextLogger := logging.MustGetLogger(logger.Module)
+	contextLogger.SetBackend(newLeveledBackend(level, fields))
+	return contextLogger
+}
+
+func newLeveledBackend(logLevel logging.Level, fields *Fields) logging.LeveledBackend {
+	leveled := logging.AddModuleLevel(&backend{fields: fields})
+	// the empty module is the level of every module
+	leveled.SetLevel(logLevel, "")
+	return leveled
+}
+
+func (b *backend) Log(level logging.Level, _ int, record *logging.Record) error {
+	var line []byte
+	if jsonFormat.Load() {
+		var err error
+		line, err = b.json(level, record)
+		if err != nil {
+			return err
+		}
 	} else {
-		logLevel = logging.INFO
+		line = []byte(b.text(level, record))
+	}
+
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	_, err := output.Write(append(line, '\n'))
+	return err
+}
+
+func (b *backend) json(level logging.Level, record *logging.Record) ([]byte, error) {
+	r := &jsonRecord{
+		Time:    record.Time,
+		Level:   level.String(),
+		Module:  record.Module,
+		Message: record.Message(),
+		Fields:  b.fields,
+	}
+
+	if b.fields != nil && !b.fields.Start.IsZero() {
+		durationMs := float64(record.Time.Sub(b.fields.Start).Microseconds()) / 1000
+		r.DurationMs = &durationMs
+	}
+
+	return json.Marshal(r)
+}
+
+func (b *backend) text(level logging.Level, record *logging.Record) string {
+	line := fmt.Sprintf("%s ▶ %s %s", record.Time.Format(textTimeLayout), level, record.Message())
+	if b.fields == nil {
+		return line
+	}
+
+	var sb strings.Builder
+	sb.WriteString(line)
+	if b.fields.UpdateId != 0 {
+		fmt.Fprintf(&sb, " update=%d", b.fields.UpdateId)
+	}
+
+	if b.fields.ChatId != 0 {
+		fmt.Fprintf(&sb, " chat=%d", b.fields.ChatId)
+	}
+
+	if b.fields.UserId != 0 {
+		fmt.Fprintf(&sb, " user=%d", b.fields.UserId)
+	}
+
+	if b.fields.Command != "" {
+		fmt.Fprintf(&sb, " command=%s", b.fields.Command)
+	}
+
+	if !b.fields.Start.IsZero() {
+		fmt.Fprintf(&sb, " duration=%s", record.Time.Sub(b.fields.Start))
 	}
 
-	backend := logging.NewLogBackend(os.Stdout, "", 0)
-	var format = logging.MustStringFormatter(
-		`%{time:15:04:05.000} ▶ %{level} %{message}`,
-	)
-	formatter := logging.NewBackendFormatter(backend, format)
-	leveled := logging.AddModuleLevel(formatter)
-	leveled.SetLevel(logLevel, module)
-	logger.SetBackend(leveled)
+	return sb.String()
 }
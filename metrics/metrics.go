@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	namespace = "dnd_util"
+
+	// OutcomeOk is the outcome of the command which didn't fail
+	OutcomeOk = "ok"
+	// OutcomeError is the outcome of the command which failed with an unexpected error
+	OutcomeError = "error"
+)
+
+var (
+	// UpdatesReceived counts the updates read from the long poll by the type
+	UpdatesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "updates_received_total",
+		Help:      "Telegram updates received by type.",
+	}, []string{"type"})
+
+	// CommandsExecuted counts the commands by the command key and the outcome, ok or the api error name
+	CommandsExecuted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_executed_total",
+		Help:      "Commands executed by command key and outcome.",
+	}, []string{"command", "outcome"})
+
+	// TelegramRequestDuration is the latency of the Telegram bot api calls including the long poll
+	TelegramRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Telegram bot API call latency by method.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method"})
+
+	// TelegramRequestErrors counts the failed calls, the transport errors and the non 2xx responses
+	TelegramRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_request_errors_total",
+		Help:      "Failed Telegram bot API calls by method and status code, 0 is the transport error.",
+	}, []string{"method", "code"})
+
+	// WorkerQueueDepth is the number of the updates waiting for the free worker
+	WorkerQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_queue_depth",
+		Help:      "Updates queued for the workers.",
+	})
+
+	// RateLimiterWaitDuration is the time the worker waits for the rate limiter token
+	RateLimiterWaitDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limiter_wait_seconds",
+		Help:      "Time the workers wait for the rate limiter.",
+		Buckets:   []float64{.0001, .001, .01, .05, .1, .5, 1, 5},
+	})
+
+	// StorageOperationDuration is the latency of the storage operations by the name of the operation
+	StorageOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storage_operation_duration_seconds",
+		Help:      "Storage operation latency by operation.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"operation"})
+)
+
+// Handler serves the metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveStorageOperation is deferred by the storage operation: defer metrics.ObserveStorageOperation("op", time.Now())
+func ObserveStorageOperation(operation string, start time.Time) {
+	StorageOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// NewTelegramClient returns the http client recording the latency and the errors of the bot api calls
+func NewTelegramClient() *http.Client {
+	return &http.Client{Transport: &telegramTransport{next: http.DefaultTransport}}
+}
+
+type telegramTransport struct {
+	next http.RoundTripper
+}
+
+func (t *telegramTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method := telegramMethod(req)
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	TelegramRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		TelegramRequestErrors.WithLabelValues(method, "0").Inc()
+	} else if resp.StatusCode >= http.StatusMultipleChoices {
+		TelegramRequestErrors.WithLabelValues(method, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+
+	return resp, err
+}
+
+// telegramMethod is the last element of /bot<token>/<method>, the token and the file paths never become the labels
+func telegramMethod(req *http.Request) string {
+	if !strings.HasPrefix(req.URL.Path, "/bot") {
+		return "file"
+	}
+
+	return path.Base(req.URL.Path)
+}